@@ -1,15 +1,27 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/cam-boltnote/go-ignite/internal/config"
 	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/migrations"
 	"github.com/cam-boltnote/go-ignite/internal/routes"
+	"github.com/cam-boltnote/go-ignite/internal/services"
+	"github.com/cam-boltnote/go-ignite/internal/utils"
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"gorm.io/gorm"
@@ -37,7 +49,8 @@ import (
 
 // Add EmailSender to the application context
 type AppContext struct {
-	DB          *gorm.DB
+	Config      *config.Store
+	Database    *connectors.Database
 	EmailSender *connectors.EmailSender
 }
 
@@ -46,17 +59,15 @@ func setupRouter(ctx *AppContext) *gin.Engine {
 	router := gin.Default()
 
 	// Configure trusted proxies
-	trustedProxies := os.Getenv("TRUSTED_PROXIES")
-	if trustedProxies != "" {
-		proxies := strings.Split(trustedProxies, ",")
+	if proxies := ctx.Config.Current().Server.TrustedProxies; len(proxies) > 0 {
 		router.SetTrustedProxies(proxies)
 		log.Printf("Configured trusted proxies: %v", proxies)
 	} else {
-		log.Println("Warning: No trusted proxies configured. Set TRUSTED_PROXIES in .env file for production use.")
+		log.Println("Warning: No trusted proxies configured. Set server.trusted_proxies (TRUSTED_PROXIES) for production use.")
 	}
 
-	// Update to pass both DB and EmailSender
-	appRoutes := routes.NewRoutes(ctx.DB, ctx.EmailSender)
+	// Update to pass both the database and EmailSender
+	appRoutes := routes.NewRoutes(ctx.Database, ctx.EmailSender, ctx.Config)
 	appRoutes.RegisterRoutes(router)
 
 	// Swagger documentation endpoint
@@ -65,44 +76,271 @@ func setupRouter(ctx *AppContext) *gin.Engine {
 	return router
 }
 
+// runKeygen implements the keygen command, which writes a new JWT signing key
+// and its public key to disk:
+//
+//	go run cmd/main.go keygen -alg EdDSA -out keys/jwt-signing.pem
+func runKeygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	alg := fs.String("alg", middleware.AlgEdDSA, "signing algorithm (EdDSA or RS256)")
+	out := fs.String("out", "keys/jwt-signing.pem", "path of the private key file; the public key is written next to it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	privatePEM, publicPEM, kid, err := middleware.GenerateSigningKey(*alg)
+	if err != nil {
+		return err
+	}
+
+	publicPath := strings.TrimSuffix(*out, filepath.Ext(*out)) + ".pub.pem"
+	if err := os.MkdirAll(filepath.Dir(*out), 0o700); err != nil {
+		return err
+	}
+	// Never overwrite an existing key; it may still be in use
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(privatePEM); err != nil {
+		return err
+	}
+	if err := os.WriteFile(publicPath, publicPEM, 0o644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Generated %s signing key\n  kid:         %s\n  private key: %s\n  public key:  %s\n", *alg, kid, *out, publicPath)
+	return nil
+}
+
+// runConfig implements the config command, which prints the effective
+// configuration with secrets masked. It accepts the same flags as the server:
+//
+//	go run cmd/main.go config -config config.yaml
+func runConfig(args []string) error {
+	cfg, err := config.Load(args)
+	if err != nil {
+		return err
+	}
+
+	dump, err := cfg.Dump()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(dump)
+	return err
+}
+
+// migrateUsage describes the migrate command
+const migrateUsage = `usage: go run cmd/main.go migrate [flags] <command>
+
+Commands:
+  up              apply every pending migration
+  down [steps]    roll back the last steps migrations (default 1)
+  status          list migrations and whether they are applied
+  new [-go] name  create an empty SQL migration, or a Go one with -go
+
+The flags are the server's, e.g. -config config.yaml`
+
+// runMigrate implements the migrate command, which manages the database
+// schema. It accepts the same flags as the server before the subcommand:
+//
+//	go run cmd/main.go migrate -config config.yaml status
+func runMigrate(args []string) error {
+	// Creating a migration needs neither configuration nor a database
+	if len(args) > 0 && args[0] == "new" {
+		fs := flag.NewFlagSet("migrate new", flag.ExitOnError)
+		goMigration := fs.Bool("go", false, "create a Go migration instead of SQL files")
+		dir := fs.String("dir", "internal/migrations", "directory of the migrations package")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return errors.New(migrateUsage)
+		}
+		paths, err := migrations.Create(*dir, fs.Arg(0), *goMigration)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			fmt.Println("Created", path)
+		}
+		return nil
+	}
+
+	cfg, rest, err := config.LoadCommand(args)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return errors.New(migrateUsage)
+	}
+	command, steps := rest[0], 1
+	switch {
+	case (command == "up" || command == "status" || command == "down") && len(rest) == 1:
+	case command == "down" && len(rest) == 2:
+		if steps, err = strconv.Atoi(rest[1]); err != nil || steps < 1 {
+			return fmt.Errorf("invalid number of steps: %s", rest[1])
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	database, err := connectors.NewDatabase(cfg.Database)
+	if err != nil {
+		return err
+	}
+	db := database.Primary()
+	if db == nil {
+		return errors.New("no database connection; check the database settings")
+	}
+	defer database.Close()
+
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		fmt.Printf("Applied %d migration(s)\n", applied)
+		return err
+	case "down":
+		rolledBack, err := migrator.Down(ctx, steps)
+		fmt.Printf("Rolled back %d migration(s)\n", rolledBack)
+		return err
+	default:
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "-"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, status.Name, status.Status, appliedAt)
+		}
+		return w.Flush()
+	}
+}
+
+// migrateDatabase brings the schema up to date at startup. With
+// database.auto_migrate off it only checks that the schema is up to date.
+func migrateDatabase(db *gorm.DB, autoMigrate bool) error {
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	if !autoMigrate {
+		if err := migrator.Check(ctx); err != nil {
+			return fmt.Errorf("%w; run \"go run cmd/main.go migrate up\" or set database.auto_migrate (AUTO_MIGRATE)", err)
+		}
+		return nil
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		return err
+	}
+	if applied > 0 {
+		log.Printf("Applied %d migration(s)", applied)
+	}
+	return nil
+}
+
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Printf("Warning: .env file not found")
+	if len(os.Args) > 1 && os.Args[1] == "keygen" {
+		if err := runKeygen(os.Args[2:]); err != nil {
+			log.Fatal("Failed to generate key: ", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := runConfig(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	// Initialize database connection based on INIT_DB environment variable
-	var db *gorm.DB
-	var err error
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	initDB, err := strconv.ParseBool(os.Getenv("INIT_DB"))
+	// Load configuration from defaults, the config file, the environment and flags
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		initDB = false // Default to false if not set or invalid
+		log.Fatal(err)
+	}
+
+	if err := utils.InitLogger(cfg); err != nil {
+		log.Fatal("Failed to initialize logger: ", err)
+	}
+	gin.SetMode(cfg.Server.Mode)
+	if cfg.Server.Mode == gin.DebugMode {
+		log.Printf("Effective configuration:\n%s", cfg)
+	}
+
+	if cfg.Security.CursorKey == "" {
+		log.Println("Warning: No cursor key configured. Pagination cursors won't survive restarts or work across instances; set security.cursor_key (CURSOR_KEY).")
+	}
+
+	// Load JWT signing keys and the RBAC policy; tokens can't be issued or verified without them
+	if err := middleware.Configure(cfg); err != nil {
+		log.Fatal("Failed to configure authentication: ", err)
+	}
+
+	// Apply changes to the reloadable settings when the config file changes or on SIGHUP
+	store := config.NewStore(cfg, os.Args[1:], utils.GetLogger().WithService("config"))
+	store.Subscribe(utils.ApplyLogConfig)
+	store.Subscribe(middleware.ApplyConfig)
+	if err := store.Watch(context.Background()); err != nil {
+		log.Printf("Warning: config file changes won't be picked up: %v", err)
 	}
 
-	if initDB {
-		database, err := connectors.NewDatabase()
+	// Initialize database connection if enabled
+	var database *connectors.Database
+
+	if cfg.Database.Enabled {
+		database, err = connectors.NewDatabase(cfg.Database)
 		if err != nil {
 			log.Printf("Warning: Failed to connect to database: %v", err)
-			db = nil
-		} else {
-			db = database.GetDB()
+			database = nil
+		} else if db := database.Primary(); db != nil {
 			log.Println("Database initialized successfully")
+			// Refuse to serve from a schema the code doesn't match
+			if err := migrateDatabase(db, cfg.Database.AutoMigrate); err != nil {
+				log.Fatal("Database schema isn't up to date: ", err)
+			}
+			// Export the connection pool statistics on /metrics
+			if cfg.Metrics.Enabled {
+				if err := database.RegisterMetrics(prometheus.DefaultRegisterer); err != nil {
+					log.Printf("Warning: Failed to register database metrics: %v", err)
+				}
+			}
 		}
 	} else {
-		log.Println("Database initialization skipped (INIT_DB=false)")
+		log.Println("Database initialization skipped (database.enabled=false)")
 	}
 
-	// Initialize email sender based on INIT_SMTP environment variable
+	// Initialize email sender if enabled
 	var emailSender *connectors.EmailSender
 
-	initSMTP, err := strconv.ParseBool(os.Getenv("INIT_SMTP"))
-	if err != nil {
-		initSMTP = false // Default to false if not set or invalid
-	}
-
-	if initSMTP {
-		emailSender, err = connectors.NewEmailSender()
+	if cfg.Email.Enabled {
+		emailSender, err = connectors.NewEmailSender(cfg.Email)
 		if err != nil {
 			log.Printf("Warning: Failed to initialize email sender: %v", err)
 			emailSender = nil
@@ -110,27 +348,29 @@ func main() {
 			log.Println("Email sender initialized successfully")
 		}
 	} else {
-		log.Println("Email sender initialization skipped (INIT_SMTP=false)")
+		log.Println("Email sender initialization skipped (email.enabled=false)")
 		emailSender = nil
 	}
 
+	// Deliver side effects queued in the outbox, such as signup emails
+	if database != nil {
+		if db := database.GetDB(); db != nil {
+			go services.NewOutboxService(db, emailSender).Run(context.Background())
+		}
+	}
+
 	// Create application context
 	appCtx := &AppContext{
-		DB:          db,
+		Config:      store,
+		Database:    database,
 		EmailSender: emailSender,
 	}
 
 	// Setup router with context
 	router := setupRouter(appCtx)
 
-	// Get port from environment variable or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
 	// Start server
-	if err := router.Run(":" + port); err != nil {
+	if err := router.Run(cfg.Server.Addr()); err != nil {
 		log.Fatal("Failed to start server:", err)
 	}
 }
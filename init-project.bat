@@ -22,6 +22,7 @@ xcopy /E /I /Y "%CURRENT_DIR%\internal" "%NEW_PROJECT_DIR%\internal"
 xcopy /E /I /Y "%CURRENT_DIR%\docs" "%NEW_PROJECT_DIR%\docs"
 xcopy /E /I /Y "%CURRENT_DIR%\tools" "%NEW_PROJECT_DIR%\tools"
 copy /Y "%CURRENT_DIR%\.env.example" "%NEW_PROJECT_DIR%\.env.example"
+copy /Y "%CURRENT_DIR%\config.example.yaml" "%NEW_PROJECT_DIR%\config.example.yaml"
 copy /Y "%CURRENT_DIR%\.air.toml" "%NEW_PROJECT_DIR%\.air.toml"
 copy /Y "%CURRENT_DIR%\.gitignore" "%NEW_PROJECT_DIR%\.gitignore"
 copy /Y "%CURRENT_DIR%\README.md" "%NEW_PROJECT_DIR%\README.md"
@@ -47,7 +48,7 @@ echo DB_PORT=3306
 echo DB_NAME=%PROJECT_NAME%
 echo.
 echo # Encryption Configuration
-echo ENCRYPTION_KEY=your_32_byte_encryption_key_here
+echo ENCRYPTION_KEY=
 echo.
 echo # Email Configuration
 echo INIT_SMTP=false
@@ -20,6 +20,7 @@ cp -r "$CURRENT_DIR/internal" "$NEW_PROJECT_DIR/"
 cp -r "$CURRENT_DIR/docs" "$NEW_PROJECT_DIR/"
 cp -r "$CURRENT_DIR/tools" "$NEW_PROJECT_DIR/"
 cp "$CURRENT_DIR/.env.example" "$NEW_PROJECT_DIR/.env.example"
+cp "$CURRENT_DIR/config.example.yaml" "$NEW_PROJECT_DIR/config.example.yaml"
 cp "$CURRENT_DIR/.air.toml" "$NEW_PROJECT_DIR/.air.toml"
 cp "$CURRENT_DIR/.gitignore" "$NEW_PROJECT_DIR/.gitignore"
 cp "$CURRENT_DIR/README.md" "$NEW_PROJECT_DIR/README.md"
@@ -45,7 +46,7 @@ DB_PORT=3306
 DB_NAME=$PROJECT_NAME
 
 # Encryption Configuration
-ENCRYPTION_KEY=your_32_byte_encryption_key_here
+ENCRYPTION_KEY=
 
 # Email Configuration
 INIT_SMTP=false
@@ -2,110 +2,356 @@ package config
 
 import (
 	"fmt"
-	"os"
-
-	"github.com/joho/godotenv"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// Config holds all configuration for the application
+// Config holds all configuration for the application. Each field can be set in
+// the config file (by its yaml key), by the environment variable in its env tag
+// (later names are deprecated aliases) or by a command line flag named after its
+// dotted path, e.g. -server.port. See Load for the precedence. Fields tagged
+// secret:"true" are masked by Redacted, Dump and String, and fields tagged
+// reload:"true" take effect without a restart (see Store).
 type Config struct {
-	// Server configuration
-	ServerPort string
-	ServerHost string
-	ServerMode string
-
-	// Database configuration
-	DBHost     string
-	DBPort     string
-	DBUser     string
-	DBPassword string
-	DBName     string
-
-	// JWT configuration
-	JWTSecret     string
-	JWTExpiration string
-
-	// Logging configuration
-	LogLevel string
-	LogFile  string
-
-	// API configuration
-	APIVersion string
-	APIPrefix  string
-}
-
-// LoadConfig loads configuration from environment variables
-func LoadConfig() (*Config, error) {
-	// Load .env file if it exists
-	_ = godotenv.Load()
-
-	config := &Config{
-		// Server configuration
-		ServerPort: getEnvOrDefault("SERVER_PORT", "8080"),
-		ServerHost: getEnvOrDefault("SERVER_HOST", "localhost"),
-		ServerMode: getEnvOrDefault("SERVER_MODE", "debug"),
-
-		// Database configuration
-		DBHost:     getEnvOrDefault("DB_HOST", "localhost"),
-		DBPort:     getEnvOrDefault("DB_PORT", "3306"),
-		DBUser:     getEnvOrDefault("DB_USER", "root"),
-		DBPassword: getEnvOrDefault("DB_PASSWORD", ""),
-		DBName:     getEnvOrDefault("DB_NAME", "app_db"),
-
-		// JWT configuration
-		JWTSecret:     getEnvOrDefault("JWT_SECRET", "your-secret-key"),
-		JWTExpiration: getEnvOrDefault("JWT_EXPIRATION", "24h"),
-
-		// Logging configuration
-		LogLevel: getEnvOrDefault("LOG_LEVEL", "info"),
-		LogFile:  getEnvOrDefault("LOG_FILE", "app.log"),
-
-		// API configuration
-		APIVersion: getEnvOrDefault("API_VERSION", "v1"),
-		APIPrefix:  getEnvOrDefault("API_PREFIX", "/api"),
-	}
+	Server            ServerConfig            `yaml:"server"`
+	Log               LogConfig               `yaml:"log"`
+	Database          DatabaseConfig          `yaml:"database"`
+	Email             EmailConfig             `yaml:"email"`
+	JWT               JWTConfig               `yaml:"jwt"`
+	Security          SecurityConfig          `yaml:"security"`
+	Password          PasswordConfig          `yaml:"password"`
+	EmailVerification EmailVerificationConfig `yaml:"email_verification"`
+	PasswordReset     PasswordResetConfig     `yaml:"password_reset"`
+	LoginThrottle     LoginThrottleConfig     `yaml:"login_throttle"`
+	Impersonation     ImpersonationConfig     `yaml:"impersonation"`
+	Organizations     OrganizationsConfig     `yaml:"organizations"`
+	MagicLink         MagicLinkConfig         `yaml:"magic_link"`
+	Audit             AuditConfig             `yaml:"audit"`
+	Metrics           MetricsConfig           `yaml:"metrics"`
+	OIDC              OIDCConfig              `yaml:"oidc"`
+	OpenAI            OpenAIConfig            `yaml:"openai"`
+	Gemini            GeminiConfig            `yaml:"gemini"`
+	GoogleCalendar    GoogleCalendarConfig    `yaml:"google_calendar"`
 
-	// Validate required configuration
-	if err := config.validate(); err != nil {
-		return nil, err
-	}
+	file string // Config file the configuration was loaded from, if any
+}
 
-	return config, nil
+// File returns the path of the config file the configuration was loaded
+// from, or "" if there was none
+func (c *Config) File() string {
+	return c.file
 }
 
-// validate checks if all required configuration is present
-func (c *Config) validate() error {
-	if c.DBPassword == "" {
-		return fmt.Errorf("DB_PASSWORD is required")
-	}
-	return nil
+// ServerConfig configures the HTTP server
+type ServerConfig struct {
+	Host           string   `yaml:"host" env:"SERVER_HOST"` // Empty listens on all interfaces
+	Port           int      `yaml:"port" env:"PORT,SERVER_PORT" validate:"min=1,max=65535"`
+	Mode           string   `yaml:"mode" env:"GIN_MODE,SERVER_MODE" validate:"oneof=debug release test"`
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	CORSOrigins    []string `yaml:"cors_origins" env:"CORS_ALLOWED_ORIGINS" reload:"true"` // Empty allows every origin
+}
+
+// Addr returns the address the server listens on
+func (c ServerConfig) Addr() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+// LogConfig configures application logging
+type LogConfig struct {
+	Level string `yaml:"level" env:"LOG_LEVEL" reload:"true" validate:"oneof=debug info warn error fatal"`
+	Dir   string `yaml:"dir" env:"LOG_DIR" validate:"required"` // Directory for the per-level log files
+}
+
+// Database drivers
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// DatabaseConfig configures the database connection. SQLite only needs Name,
+// the path of the database file or ":memory:".
+type DatabaseConfig struct {
+	Enabled  bool   `yaml:"enabled" env:"INIT_DB"`
+	Driver   string `yaml:"driver" env:"DB_DRIVER" validate:"oneof=mysql postgres sqlite"`
+	Host     string `yaml:"host" env:"DB_HOST" validate:"required_if=Enabled true Driver mysql,required_if=Enabled true Driver postgres"`
+	Port     int    `yaml:"port" env:"DB_PORT" validate:"min=0,max=65535"` // 0 uses the driver's default port
+	User     string `yaml:"user" env:"DB_USER" validate:"required_if=Enabled true Driver mysql,required_if=Enabled true Driver postgres"`
+	Password string `yaml:"password" env:"DB_PASSWORD" secret:"true" validate:"required_if=Enabled true Driver mysql,required_if=Enabled true Driver postgres"`
+	Name     string `yaml:"name" env:"DB_NAME" validate:"required_if=Enabled true"`
+	SSLMode  string `yaml:"ssl_mode" env:"DB_SSL_MODE" validate:"omitempty,oneof=disable allow prefer require verify-ca verify-full"` // PostgreSQL only
+	// Replicas are read-only copies of the database, as "host" or "host:port",
+	// sharing its user, password and name. Reads outside transactions go to a
+	// random replica.
+	Replicas []string `yaml:"replicas" env:"DB_REPLICAS" validate:"excluded_if=Driver sqlite"`
+
+	// Connection pool of the primary and of each replica
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" validate:"min=0"` // 0 is unlimited
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" validate:"min=0"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" validate:"gte=0"`   // 0 keeps connections open indefinitely
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME" validate:"gte=0"` // 0 keeps idle connections open indefinitely
+
+	// AutoMigrate applies pending migrations at startup; otherwise startup
+	// fails while any are pending
+	AutoMigrate bool `yaml:"auto_migrate" env:"AUTO_MIGRATE"`
 }
 
-// getEnvOrDefault returns the value of an environment variable or a default value
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// DSN returns the data source name in the driver's format
+func (c DatabaseConfig) DSN() string {
+	switch c.Driver {
+	case DriverPostgres:
+		port := c.Port
+		if port == 0 {
+			port = 5432
+		}
+		dsn := url.URL{
+			Scheme: "postgres",
+			User:   url.UserPassword(c.User, c.Password),
+			Host:   net.JoinHostPort(c.Host, strconv.Itoa(port)),
+			Path:   "/" + c.Name,
+		}
+		if c.SSLMode != "" {
+			dsn.RawQuery = url.Values{"sslmode": {c.SSLMode}}.Encode()
+		}
+		return dsn.String()
+	case DriverSQLite:
+		name := c.Name
+		if name == ":memory:" {
+			// Connections share one in-memory database only with a shared cache
+			name = "file::memory:?cache=shared"
+		}
+		separator := "?"
+		if strings.Contains(name, "?") {
+			separator = "&"
+		}
+		// Enforce foreign keys like the other databases do, and wait for a
+		// locked database instead of failing
+		return name + separator + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	default:
+		port := c.Port
+		if port == 0 {
+			port = 3306
+		}
+		return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+			c.User,
+			c.Password,
+			c.Host,
+			port,
+			c.Name,
+		)
 	}
-	return defaultValue
 }
 
-// GetDSN returns the database connection string
-func (c *Config) GetDSN() string {
-	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		c.DBUser,
-		c.DBPassword,
-		c.DBHost,
-		c.DBPort,
-		c.DBName,
-	)
+// EmailConfig configures outgoing email over SMTP
+type EmailConfig struct {
+	Enabled                bool   `yaml:"enabled" env:"INIT_SMTP"`
+	Host                   string `yaml:"host" env:"SMTP_HOST" validate:"required_if=Enabled true"`
+	Port                   int    `yaml:"port" env:"SMTP_PORT" validate:"min=1,max=65535"`
+	Username               string `yaml:"username" env:"SMTP_USERNAME" validate:"required_if=Enabled true"`
+	Password               string `yaml:"password" env:"SMTP_PASSWORD" secret:"true" validate:"required_if=Enabled true"`
+	FromEmail              string `yaml:"from_email" env:"SMTP_FROM_EMAIL" validate:"required_if=Enabled true,omitempty,email"`
+	AdminNotificationEmail string `yaml:"admin_notification_email" env:"ADMIN_NOTIFICATION_EMAIL" validate:"required,email"`
+}
+
+// JWTConfig configures access and refresh tokens
+type JWTConfig struct {
+	SigningKeyFile       string        `yaml:"signing_key_file" env:"JWT_SIGNING_KEY_FILE" validate:"required"`
+	VerificationKeyFiles []string      `yaml:"verification_key_files" env:"JWT_VERIFICATION_KEY_FILES"` // Extra public keys still accepted
+	AccessTokenTTL       time.Duration `yaml:"access_token_ttl" env:"JWT_ACCESS_TOKEN_TTL" validate:"gt=0"`
+	RefreshTokenTTL      time.Duration `yaml:"refresh_token_ttl" env:"JWT_REFRESH_TOKEN_TTL" validate:"gt=0"`
+}
+
+// SecurityConfig holds settings shared by the authentication middleware and services
+type SecurityConfig struct {
+	EncryptionKey  string `yaml:"encryption_key" env:"ENCRYPTION_KEY" secret:"true" validate:"omitempty,base64"`
+	RBACPolicyFile string `yaml:"rbac_policy_file" env:"RBAC_POLICY_FILE" validate:"omitempty,file"`
+	MFAIssuer      string `yaml:"mfa_issuer" env:"MFA_ISSUER" validate:"required"`
+	// CursorKey signs pagination cursors; it is required in release mode.
+	// Without it a random key is used, so cursors stop working on restart and
+	// aren't accepted by other instances.
+	CursorKey string `yaml:"cursor_key" env:"CURSOR_KEY" secret:"true" validate:"omitempty,base64"`
+}
+
+// MinCursorKeyLength is the length in bytes of the shortest cursor key accepted
+const MinCursorKeyLength = 32
+
+// PasswordConfig configures password rules and hashing
+type PasswordConfig struct {
+	MinLength         int    `yaml:"min_length" env:"PASSWORD_MIN_LENGTH" reload:"true" validate:"min=1"`
+	MaxLength         int    `yaml:"max_length" env:"PASSWORD_MAX_LENGTH" reload:"true" validate:"gtefield=MinLength,max=72"`
+	HashAlgorithm     string `yaml:"hash_algorithm" env:"PASSWORD_HASH_ALGORITHM" validate:"oneof=argon2id bcrypt"`
+	Argon2Memory      uint32 `yaml:"argon2_memory" env:"ARGON2_MEMORY" validate:"min=1024,max=1048576"` // KiB
+	Argon2Iterations  uint32 `yaml:"argon2_iterations" env:"ARGON2_ITERATIONS" validate:"min=1,max=64"`
+	Argon2Parallelism uint8  `yaml:"argon2_parallelism" env:"ARGON2_PARALLELISM" validate:"min=1,max=64"`
+	BcryptCost        int    `yaml:"bcrypt_cost" env:"BCRYPT_COST" validate:"min=4,max=31"`
+}
+
+// EmailVerificationConfig configures email address verification
+type EmailVerificationConfig struct {
+	Required bool          `yaml:"required" env:"REQUIRE_EMAIL_VERIFICATION"` // Block login until the address is verified
+	URL      string        `yaml:"url" env:"EMAIL_VERIFICATION_URL" validate:"url"`
+	TTL      time.Duration `yaml:"ttl" env:"EMAIL_VERIFICATION_TTL" validate:"gt=0"`
+	// Minimum time between verification emails a user can ask to be re-sent
+	ResendInterval time.Duration `yaml:"resend_interval" env:"EMAIL_VERIFICATION_RESEND_INTERVAL" validate:"gte=0"`
 }
 
-// GetServerAddr returns the server address
-func (c *Config) GetServerAddr() string {
-	return fmt.Sprintf("%s:%s", c.ServerHost, c.ServerPort)
+// PasswordResetConfig configures password reset emails
+type PasswordResetConfig struct {
+	URL string `yaml:"url" env:"PASSWORD_RESET_URL" validate:"url"`
 }
 
-// GetAPIPath returns the full API path
-func (c *Config) GetAPIPath() string {
-	return fmt.Sprintf("%s/%s", c.APIPrefix, c.APIVersion)
+// LoginThrottleConfig configures brute-force protection for logins
+type LoginThrottleConfig struct {
+	MaxAttempts     int           `yaml:"max_attempts" env:"LOGIN_MAX_ATTEMPTS" validate:"min=1"`       // Failures before an account is locked
+	IPMaxAttempts   int           `yaml:"ip_max_attempts" env:"LOGIN_IP_MAX_ATTEMPTS" validate:"min=1"` // Failures before a client IP is locked
+	LockoutDuration time.Duration `yaml:"lockout_duration" env:"LOGIN_LOCKOUT_DURATION" validate:"gt=0"`
+	BackoffBase     time.Duration `yaml:"backoff_base" env:"LOGIN_BACKOFF_BASE" validate:"gte=0"` // Delay after the first failure past the free attempts
+	BackoffMax      time.Duration `yaml:"backoff_max" env:"LOGIN_BACKOFF_MAX" validate:"gte=0"`
+}
+
+// ImpersonationConfig configures admin impersonation
+type ImpersonationConfig struct {
+	TTL time.Duration `yaml:"ttl" env:"IMPERSONATION_TTL" validate:"gt=0"`
+}
+
+// OrganizationsConfig configures organization invitations
+type OrganizationsConfig struct {
+	InvitationURL string        `yaml:"invitation_url" env:"ORG_INVITATION_URL" validate:"url"`
+	InvitationTTL time.Duration `yaml:"invitation_ttl" env:"ORG_INVITATION_TTL" validate:"gt=0"`
+}
+
+// MagicLinkConfig configures passwordless sign-in links
+type MagicLinkConfig struct {
+	URL         string        `yaml:"url" env:"MAGIC_LINK_URL" validate:"url"`
+	TTL         time.Duration `yaml:"ttl" env:"MAGIC_LINK_TTL" validate:"gt=0"`
+	MaxRequests int           `yaml:"max_requests" env:"MAGIC_LINK_MAX_REQUESTS" validate:"min=1"` // Links an address may request per window
+	Window      time.Duration `yaml:"window" env:"MAGIC_LINK_WINDOW" validate:"gt=0"`
+}
+
+// AuditConfig configures the audit log
+type AuditConfig struct {
+	HashChain bool `yaml:"hash_chain" env:"AUDIT_HASH_CHAIN"` // Link each event to the previous one by hash
+}
+
+// MetricsConfig configures the Prometheus /metrics endpoint. It is off by
+// default; when on, scrapers must send the token as a Bearer token.
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled" env:"METRICS_ENABLED"`
+	Token   string `yaml:"token" env:"METRICS_TOKEN" secret:"true" validate:"required_if=Enabled true"`
+}
+
+// OIDCConfig configures sign-in with OpenID Connect identity providers. In the
+// environment, OIDC_PROVIDERS lists provider names and each provider is
+// configured with OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET, _REDIRECT_URL
+// and optionally _SCOPES (space-separated).
+type OIDCConfig struct {
+	Providers []OIDCProviderConfig `yaml:"providers" validate:"dive"`
+}
+
+// OIDCProviderConfig configures a single OpenID Connect identity provider
+type OIDCProviderConfig struct {
+	Name         string   `yaml:"name" validate:"required"`
+	IssuerURL    string   `yaml:"issuer" validate:"required,url"`
+	ClientID     string   `yaml:"client_id" validate:"required"`
+	ClientSecret string   `yaml:"client_secret" secret:"true"`
+	RedirectURL  string   `yaml:"redirect_url" validate:"required,url"`
+	Scopes       []string `yaml:"scopes"` // "openid email profile" when empty
+}
+
+// OpenAIConfig configures the OpenAI connector
+type OpenAIConfig struct {
+	APIKey             string  `yaml:"api_key" env:"OPENAI_API_KEY" secret:"true"`
+	DefaultModel       string  `yaml:"default_model" env:"OPENAI_DEFAULT_MODEL" reload:"true" validate:"required"`
+	DefaultTemperature float32 `yaml:"default_temperature" env:"OPENAI_DEFAULT_TEMPERATURE" reload:"true" validate:"gte=0,lte=2"`
+}
+
+// GeminiConfig configures the Gemini connector
+type GeminiConfig struct {
+	APIKey             string  `yaml:"api_key" env:"GEMINI_API_KEY" secret:"true"`
+	DefaultModel       string  `yaml:"default_model" env:"GEMINI_DEFAULT_MODEL" reload:"true" validate:"required"`
+	DefaultTemperature float32 `yaml:"default_temperature" env:"GEMINI_DEFAULT_TEMPERATURE" reload:"true" validate:"gte=0,lte=2"`
+}
+
+// GoogleCalendarConfig configures the Google Calendar connector
+type GoogleCalendarConfig struct {
+	Credentials string `yaml:"credentials" env:"GOOGLE_CALENDAR_CREDENTIALS" secret:"true"` // OAuth client credentials JSON
+}
+
+// Default returns the configuration used for anything that isn't set elsewhere
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port: 8080,
+			Mode: "debug",
+		},
+		Log: LogConfig{
+			Level: "info",
+			Dir:   "logs",
+		},
+		Database: DatabaseConfig{
+			Driver:          DriverMySQL,
+			MaxOpenConns:    100,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: time.Hour,
+		},
+		Email: EmailConfig{
+			Port:                   587,
+			AdminNotificationEmail: "cam@boltnote.ai",
+		},
+		JWT: JWTConfig{
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		Security: SecurityConfig{
+			MFAIssuer: "boltnote.ai",
+		},
+		Password: PasswordConfig{
+			MinLength:         8,
+			MaxLength:         72,
+			HashAlgorithm:     "argon2id",
+			Argon2Memory:      64 * 1024,
+			Argon2Iterations:  3,
+			Argon2Parallelism: 2,
+			BcryptCost:        10,
+		},
+		EmailVerification: EmailVerificationConfig{
+			URL:            "https://app.boltnote.ai/verify-email",
+			TTL:            24 * time.Hour,
+			ResendInterval: time.Minute,
+		},
+		PasswordReset: PasswordResetConfig{
+			URL: "https://app.boltnote.ai/reset-password",
+		},
+		LoginThrottle: LoginThrottleConfig{
+			MaxAttempts:     5,
+			IPMaxAttempts:   20,
+			LockoutDuration: 15 * time.Minute,
+			BackoffBase:     time.Second,
+			BackoffMax:      30 * time.Second,
+		},
+		Impersonation: ImpersonationConfig{
+			TTL: 15 * time.Minute,
+		},
+		Organizations: OrganizationsConfig{
+			InvitationURL: "https://app.boltnote.ai/accept-invitation",
+			InvitationTTL: 7 * 24 * time.Hour,
+		},
+		MagicLink: MagicLinkConfig{
+			URL:         "https://app.boltnote.ai/magic-login",
+			TTL:         15 * time.Minute,
+			MaxRequests: 3,
+			Window:      15 * time.Minute,
+		},
+		OpenAI: OpenAIConfig{
+			DefaultModel:       "gpt-3.5-turbo",
+			DefaultTemperature: 0.7,
+		},
+		Gemini: GeminiConfig{
+			DefaultModel:       "gemini-1.5-flash",
+			DefaultTemperature: 0.7,
+		},
+	}
 }
@@ -0,0 +1,358 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the environment variable holding the config file path when
+// the -config flag isn't given
+const FileEnv = "CONFIG_FILE"
+
+// Load builds the configuration from, in increasing order of precedence:
+//
+//  1. the defaults from Default
+//  2. the config file named by -config or CONFIG_FILE, YAML or TOML by extension
+//  3. environment variables, including those from a .env file; any variable
+//     can instead be read from the file named by the same name plus _FILE
+//  4. command line flags, e.g. -server.port=9090 or -database.enabled
+//
+// String settings from any source may be a reference, file:///path or
+// env:NAME, to a value kept elsewhere. The result is validated and every
+// invalid value is reported in a single *ValidationError rather than
+// stopping at the first.
+func Load(args []string) (*Config, error) {
+	cfg, rest, err := LoadCommand(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(rest, " "))
+	}
+	return cfg, nil
+}
+
+// LoadCommand is Load for commands that take arguments of their own after the
+// flags. It returns the arguments following the flags.
+func LoadCommand(args []string) (*Config, []string, error) {
+	// Load .env file if it exists; real environment variables win
+	_ = godotenv.Load()
+
+	cfg := Default()
+	settings := fields(cfg)
+
+	flags, configFile, rest, err := parseFlags(settings, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if configFile == "" {
+		configFile = os.Getenv(FileEnv)
+	}
+	if configFile != "" {
+		if err := loadFile(cfg, configFile); err != nil {
+			return nil, nil, err
+		}
+		cfg.file = configFile
+	}
+
+	problems := loadEnv(cfg, settings, os.LookupEnv)
+
+	for _, setting := range settings {
+		if value, ok := flags[setting.path]; ok {
+			if err := setting.set(value); err != nil {
+				return nil, nil, fmt.Errorf("flag -%s: %v", setting.path, err)
+			}
+		}
+	}
+
+	problems = append(problems, resolveReferences(cfg, os.LookupEnv)...)
+
+	if err := cfg.Validate(); err != nil {
+		var invalid *ValidationError
+		if !errors.As(err, &invalid) {
+			return nil, nil, err
+		}
+		problems = append(problems, invalid.Problems...)
+	}
+	if len(problems) > 0 {
+		return nil, nil, &ValidationError{Problems: problems}
+	}
+	return cfg, rest, nil
+}
+
+// setting is a single configurable value of the config tree
+type setting struct {
+	path       string   // Dotted yaml path; also the flag name
+	env        []string // Environment variable followed by its deprecated aliases
+	reloadable bool     // Takes effect without a restart
+	value      reflect.Value
+}
+
+// fields lists every setting of cfg that has a single value. Lists of
+// sections, such as the OIDC providers, are only set from the file or by
+// their own environment variables.
+func fields(cfg *Config) []setting {
+	var settings []setting
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			path := prefix + yamlName(field)
+			value := v.Field(i)
+
+			switch {
+			case field.Type.Kind() == reflect.Struct:
+				walk(value, path+".")
+			case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct:
+				continue
+			default:
+				var env []string
+				if tag := field.Tag.Get("env"); tag != "" {
+					env = strings.Split(tag, ",")
+				}
+				reloadable, _ := strconv.ParseBool(field.Tag.Get("reload"))
+				settings = append(settings, setting{path: path, env: env, reloadable: reloadable, value: value})
+			}
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "")
+	return settings
+}
+
+// yamlName returns the key of a field in the config file
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// set parses a string into the setting. Lists are comma-separated.
+func (s setting) set(raw string) error {
+	raw = strings.TrimSpace(raw)
+	v := s.value
+
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", raw)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// String formats the setting's current value the way set parses it
+func (s setting) String() string {
+	if s.value.Type() == reflect.TypeOf(time.Duration(0)) {
+		return time.Duration(s.value.Int()).String()
+	}
+	if s.value.Kind() == reflect.Slice {
+		return strings.Join(s.value.Interface().([]string), ",")
+	}
+	return fmt.Sprint(s.value.Interface())
+}
+
+// recordedFlag collects a flag's value so flags can be applied after the file
+// and the environment, whatever order they were parsed in
+type recordedFlag struct {
+	setting setting
+	isBool  bool
+	values  map[string]string
+}
+
+func (f *recordedFlag) String() string {
+	if f == nil || !f.setting.value.IsValid() {
+		return ""
+	}
+	return f.setting.String()
+}
+
+func (f *recordedFlag) Set(value string) error {
+	// Check the value now so a typo is reported against the flag
+	probe := setting{value: reflect.New(f.setting.value.Type()).Elem()}
+	if err := probe.set(value); err != nil {
+		return err
+	}
+	f.values[f.setting.path] = value
+	return nil
+}
+
+func (f *recordedFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// parseFlags parses the command line into raw values keyed by setting path,
+// plus the -config file path and the arguments following the flags
+func parseFlags(settings []setting, args []string) (map[string]string, string, []string, error) {
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	configFile := fs.String("config", "", "path of a YAML or TOML config file (or set "+FileEnv+")")
+
+	values := make(map[string]string)
+	for _, s := range settings {
+		usage := "see the config file key " + s.path
+		if len(s.env) > 0 {
+			usage = "overrides " + s.env[0]
+		}
+		fs.Var(&recordedFlag{setting: s, isBool: s.value.Kind() == reflect.Bool, values: values}, s.path, usage)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, "", nil, err
+	}
+	return values, *configFile, fs.Args(), nil
+}
+
+// loadFile applies a YAML or TOML config file. Unknown keys are rejected so a
+// misspelt setting isn't silently ignored.
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	case ".toml":
+		// Decode TOML through YAML so both formats share one set of keys and
+		// durations are written the same way ("15m")
+		var tree map[string]interface{}
+		if err := toml.Unmarshal(data, &tree); err != nil {
+			return fmt.Errorf("failed to parse config file %s: %v", path, err)
+		}
+		if data, err = yaml.Marshal(tree); err != nil {
+			return fmt.Errorf("failed to parse config file %s: %v", path, err)
+		}
+	default:
+		return fmt.Errorf("config file %s must be .yaml, .yml or .toml", path)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// loadEnv applies environment variables and returns those that couldn't be
+// parsed or read. Empty variables count as unset.
+func loadEnv(cfg *Config, settings []setting, lookup func(string) (string, bool)) []string {
+	var problems []string
+	lookup = withFileVariables(lookup, &problems)
+	for _, s := range settings {
+		for i, name := range s.env {
+			value, ok := lookup(name)
+			if !ok || value == "" {
+				continue
+			}
+			if i > 0 {
+				log.Printf("Warning: %s is deprecated, use %s instead", name, s.env[0])
+			}
+			if err := s.set(value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			}
+			break
+		}
+	}
+
+	loadOIDCEnv(&cfg.OIDC, lookup)
+	return problems
+}
+
+// loadOIDCEnv replaces the configured OIDC providers with those listed in
+// OIDC_PROVIDERS, if set
+func loadOIDCEnv(cfg *OIDCConfig, lookup func(string) (string, bool)) {
+	names, _ := lookup("OIDC_PROVIDERS")
+	if strings.TrimSpace(names) == "" {
+		return
+	}
+
+	get := func(name string) string {
+		value, _ := lookup(name)
+		return value
+	}
+
+	cfg.Providers = nil
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := OIDCEnvPrefix(name)
+		cfg.Providers = append(cfg.Providers, OIDCProviderConfig{
+			Name:         name,
+			IssuerURL:    get(prefix + "ISSUER"),
+			ClientID:     get(prefix + "CLIENT_ID"),
+			ClientSecret: get(prefix + "CLIENT_SECRET"),
+			RedirectURL:  get(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(get(prefix + "SCOPES")),
+		})
+	}
+}
+
+// OIDCEnvPrefix returns the prefix of the environment variables configuring the provider
+func OIDCEnvPrefix(name string) string {
+	return "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+}
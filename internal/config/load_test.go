@@ -0,0 +1,215 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	const file = `
+server:
+  port: 8001
+  mode: test
+jwt:
+  signing_key_file: keys/jwt-signing.pem
+  access_token_ttl: 10m
+`
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		args     []string
+		wantPort int
+		wantMode string
+		wantTTL  time.Duration
+	}{
+		{
+			name:     "file over defaults",
+			wantPort: 8001,
+			wantMode: "test",
+			wantTTL:  10 * time.Minute,
+		},
+		{
+			name:     "env over file",
+			env:      map[string]string{"PORT": "8002", "JWT_ACCESS_TOKEN_TTL": "5m"},
+			wantPort: 8002,
+			wantMode: "test",
+			wantTTL:  5 * time.Minute,
+		},
+		{
+			name:     "flags over env",
+			env:      map[string]string{"PORT": "8002", "GIN_MODE": "debug"},
+			args:     []string{"-server.port=8003", "-jwt.access_token_ttl", "1m"},
+			wantPort: 8003,
+			wantMode: "debug",
+			wantTTL:  time.Minute,
+		},
+		{
+			name:     "env name over deprecated alias",
+			env:      map[string]string{"PORT": "8002", "SERVER_PORT": "8004"},
+			wantPort: 8002,
+			wantMode: "test",
+			wantTTL:  10 * time.Minute,
+		},
+		{
+			name:     "deprecated alias alone",
+			env:      map[string]string{"SERVER_PORT": "8004"},
+			wantPort: 8004,
+			wantMode: "test",
+			wantTTL:  10 * time.Minute,
+		},
+		{
+			name:     "empty env counts as unset",
+			env:      map[string]string{"PORT": ""},
+			wantPort: 8001,
+			wantMode: "test",
+			wantTTL:  10 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			path := writeConfigFile(t, "config.yaml", file)
+			t.Setenv(FileEnv, path)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := Load(tt.args)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Server.Port != tt.wantPort {
+				t.Errorf("server.port = %d, want %d", cfg.Server.Port, tt.wantPort)
+			}
+			if cfg.Server.Mode != tt.wantMode {
+				t.Errorf("server.mode = %q, want %q", cfg.Server.Mode, tt.wantMode)
+			}
+			if cfg.JWT.AccessTokenTTL != tt.wantTTL {
+				t.Errorf("jwt.access_token_ttl = %s, want %s", cfg.JWT.AccessTokenTTL, tt.wantTTL)
+			}
+			if cfg.File() != path {
+				t.Errorf("File() = %q, want %q", cfg.File(), path)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFlagOverridesEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv(FileEnv, writeConfigFile(t, "env.yaml", "server:\n  port: 8001\njwt:\n  signing_key_file: a.pem\n"))
+	flagFile := writeConfigFile(t, "flag.toml", "[server]\nport = 8002\n[jwt]\nsigning_key_file = \"b.pem\"\n")
+
+	cfg, err := Load([]string{"-config", flagFile})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Server.Port != 8002 || cfg.File() != flagFile {
+		t.Errorf("loaded port %d from %q, want 8002 from %q", cfg.Server.Port, cfg.File(), flagFile)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		env      map[string]string
+		args     []string
+		wantErrs []string
+	}{
+		{
+			name:     "unknown file key",
+			file:     "server:\n  prot: 8001\n",
+			wantErrs: []string{"field prot not found"},
+		},
+		{
+			name:     "problems from every source reported together",
+			file:     "jwt:\n  signing_key_file: a.pem\n",
+			env:      map[string]string{"PORT": "not a number", "GIN_MODE": "production"},
+			wantErrs: []string{`PORT: invalid integer "not a number"`, "server.mode (GIN_MODE) must be one of: debug, release, test"},
+		},
+		{
+			name:     "invalid flag value",
+			file:     "jwt:\n  signing_key_file: a.pem\n",
+			args:     []string{"-server.port=eighty"},
+			wantErrs: []string{`invalid integer "eighty"`},
+		},
+		{
+			name:     "unexpected arguments",
+			file:     "jwt:\n  signing_key_file: a.pem\n",
+			args:     []string{"serve"},
+			wantErrs: []string{"unexpected arguments: serve"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			t.Setenv(FileEnv, writeConfigFile(t, "config.yaml", tt.file))
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			_, err := Load(tt.args)
+			if err == nil {
+				t.Fatal("Load succeeded, want an error")
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("err = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadAggregatesValidationErrors(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("PORT", "70000")
+	t.Setenv("GIN_MODE", "production")
+
+	_, err := Load(nil)
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("err = %v, want a *ValidationError", err)
+	}
+	// The port, the mode and the missing signing key
+	if len(invalid.Problems) != 3 {
+		t.Errorf("problems = %q, want 3", invalid.Problems)
+	}
+}
+
+// clearEnv unsets, for the duration of the test, every variable the
+// configuration reads so the environment running the tests can't leak in
+func clearEnv(t *testing.T) {
+	t.Helper()
+
+	names := []string{FileEnv, "OIDC_PROVIDERS"}
+	for _, s := range fields(Default()) {
+		names = append(names, s.env...)
+	}
+	for _, name := range names {
+		for _, variable := range []string{name, name + "_FILE"} {
+			if value, ok := os.LookupEnv(variable); ok {
+				t.Setenv(variable, value)
+				os.Unsetenv(variable)
+			}
+		}
+	}
+}
+
+// writeConfigFile writes a config file to a temporary directory and returns its path
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write the config file: %v", err)
+	}
+	return path
+}
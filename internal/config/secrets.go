@@ -0,0 +1,205 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Prefixes of values that refer to where the real value is kept
+const (
+	fileReferencePrefix = "file://" // file:///run/secrets/db_password
+	envReferencePrefix  = "env:"    // env:OTHER_VAR
+)
+
+// redactedValue replaces secrets in redacted configurations
+const redactedValue = "********"
+
+// Redacted returns a deep copy of the configuration with every field tagged
+// secret:"true" masked, for logging and dumping
+func (c *Config) Redacted() *Config {
+	return redact(reflect.ValueOf(c), false).Interface().(*Config)
+}
+
+// redact returns a deep copy of v with its secrets masked: the strings of
+// fields tagged secret:"true", including those inside such a field's maps,
+// lists and pointers. Structs are copied whole, unexported fields included.
+func redact(v reflect.Value, secret bool) reflect.Value {
+	switch v.Kind() {
+	case reflect.String:
+		if !secret || v.String() == "" {
+			return v
+		}
+		masked := reflect.New(v.Type()).Elem()
+		masked.SetString(redactedValue)
+		return masked
+	case reflect.Struct:
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			fieldSecret, _ := strconv.ParseBool(field.Tag.Get("secret"))
+			copied.Field(i).Set(redact(v.Field(i), secret || fieldSecret))
+		}
+		return copied
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type().Elem())
+		copied.Elem().Set(redact(v.Elem(), secret))
+		return copied
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(redact(v.Elem(), secret))
+		return copied
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(redact(v.Index(i), secret))
+		}
+		return copied
+	case reflect.Array:
+		copied := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(redact(v.Index(i), secret))
+		}
+		return copied
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			copied.SetMapIndex(iter.Key(), redact(iter.Value(), secret))
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
+// Dump formats the configuration as YAML with secrets masked. The output can
+// be used as a config file once the secrets are filled back in.
+func (c *Config) Dump() ([]byte, error) {
+	return yaml.Marshal(c.Redacted())
+}
+
+// String formats the configuration like Dump so printing it never leaks secrets
+func (c *Config) String() string {
+	dump, err := c.Dump()
+	if err != nil {
+		return fmt.Sprintf("<invalid configuration: %v>", err)
+	}
+	return string(dump)
+}
+
+// walkStrings calls fn with the dotted path of every string field in cfg,
+// including those of list items, and whether it is tagged secret:"true"
+func walkStrings(cfg *Config, fn func(path string, secret bool, value reflect.Value)) {
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			path := prefix + yamlName(field)
+			value := v.Field(i)
+
+			switch {
+			case field.Type.Kind() == reflect.String:
+				secret, _ := strconv.ParseBool(field.Tag.Get("secret"))
+				fn(path, secret, value)
+			case field.Type.Kind() == reflect.Struct:
+				walk(value, path+".")
+			case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct:
+				for j := 0; j < value.Len(); j++ {
+					walk(value.Index(j), fmt.Sprintf("%s[%d].", path, j))
+				}
+			}
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "")
+}
+
+// resolveReferences replaces file:// and env: references in string settings
+// with the values they point to, and returns those that couldn't be resolved
+func resolveReferences(cfg *Config, lookup func(string) (string, bool)) []string {
+	var problems []string
+	walkStrings(cfg, func(path string, _ bool, value reflect.Value) {
+		resolved, err := resolveReference(value.String(), lookup)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", path, err))
+			return
+		}
+		value.SetString(resolved)
+	})
+	return problems
+}
+
+// resolveReference returns the value a reference points to, or raw itself if
+// it isn't a reference
+func resolveReference(raw string, lookup func(string) (string, bool)) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, fileReferencePrefix):
+		return readSecretFile(strings.TrimPrefix(raw, fileReferencePrefix))
+	case strings.HasPrefix(raw, envReferencePrefix):
+		name := strings.TrimPrefix(raw, envReferencePrefix)
+		value, ok := lookup(name)
+		if !ok || value == "" {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	default:
+		return raw, nil
+	}
+}
+
+// withFileVariables extends lookup with the Docker and Kubernetes secrets
+// convention: when NAME isn't set, NAME_FILE names a file holding its value.
+// Files that can't be read, and names set both ways, are added to problems.
+func withFileVariables(lookup func(string) (string, bool), problems *[]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := lookup(name)
+		path, _ := lookup(name + "_FILE")
+		if path == "" {
+			return value, ok
+		}
+		if value != "" {
+			*problems = append(*problems, fmt.Sprintf("%s: set either %s or %s_FILE, not both", name, name, name))
+			return value, ok
+		}
+
+		value, err := readSecretFile(path)
+		if err != nil {
+			*problems = append(*problems, fmt.Sprintf("%s_FILE: %v", name, err))
+			return "", false
+		}
+		return value, true
+	}
+}
+
+// readSecretFile reads a value from a file, ignoring the trailing newline
+// most editors and secret managers add
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %v", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
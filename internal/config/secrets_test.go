@@ -0,0 +1,178 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadSecrets(t *testing.T) {
+	const file = "jwt:\n  signing_key_file: a.pem\ndatabase:\n  password: file://%s\n"
+
+	tests := []struct {
+		name         string
+		file         bool // Set database.password to a file:// reference in the config file
+		env          map[string]string
+		wantPassword string
+		wantErr      string
+	}{
+		{
+			name:         "file reference",
+			file:         true,
+			wantPassword: "from-file",
+		},
+		{
+			name:         "env reference",
+			env:          map[string]string{"DB_PASSWORD": "env:VAULT_DB_PASSWORD", "VAULT_DB_PASSWORD": "from-env"},
+			wantPassword: "from-env",
+		},
+		{
+			name:         "_FILE variable",
+			env:          map[string]string{"DB_PASSWORD_FILE": "%s"},
+			wantPassword: "from-file",
+		},
+		{
+			name:    "missing env reference",
+			env:     map[string]string{"DB_PASSWORD": "env:VAULT_DB_PASSWORD"},
+			wantErr: "database.password: environment variable VAULT_DB_PASSWORD is not set",
+		},
+		{
+			name:    "missing secret file",
+			env:     map[string]string{"DB_PASSWORD": "file:///nonexistent/db_password"},
+			wantErr: "database.password: failed to read secret file",
+		},
+		{
+			name:    "missing _FILE variable file",
+			env:     map[string]string{"DB_PASSWORD_FILE": "/nonexistent/db_password"},
+			wantErr: "DB_PASSWORD_FILE: failed to read secret file",
+		},
+		{
+			name:    "variable set both ways",
+			env:     map[string]string{"DB_PASSWORD": "plain", "DB_PASSWORD_FILE": "%s"},
+			wantErr: "DB_PASSWORD: set either DB_PASSWORD or DB_PASSWORD_FILE, not both",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			// Editors and secret managers usually end the file with a newline
+			secretFile := writeConfigFile(t, "db_password", "from-file\n")
+			content := "jwt:\n  signing_key_file: a.pem\n"
+			if tt.file {
+				content = strings.Replace(file, "%s", secretFile, 1)
+			}
+			t.Setenv(FileEnv, writeConfigFile(t, "config.yaml", content))
+			for name, value := range tt.env {
+				t.Setenv(name, strings.Replace(value, "%s", secretFile, 1))
+			}
+
+			cfg, err := Load(nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Database.Password != tt.wantPassword {
+				t.Errorf("database.password = %q, want %q", cfg.Database.Password, tt.wantPassword)
+			}
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.OIDC.Providers = []OIDCProviderConfig{{Name: "google"}, {Name: "github"}}
+	// Give every string setting a distinct value
+	walkStrings(cfg, func(path string, _ bool, value reflect.Value) {
+		value.SetString("value of " + path)
+	})
+
+	redacted := cfg.Redacted()
+
+	var secrets int
+	walkStrings(redacted, func(path string, secret bool, value reflect.Value) {
+		want := "value of " + path
+		if secret {
+			secrets++
+			want = redactedValue
+		}
+		if value.String() != want {
+			t.Errorf("%s = %q, want %q", path, value.String(), want)
+		}
+	})
+	// The eight top-level secrets and both providers' client secrets
+	if secrets != 10 {
+		t.Errorf("%d secrets masked, want 10", secrets)
+	}
+
+	walkStrings(cfg, func(path string, _ bool, value reflect.Value) {
+		if value.String() != "value of "+path {
+			t.Errorf("original %s = %q, want it left unmasked", path, value.String())
+		}
+	})
+
+	dump, err := cfg.Dump()
+	if err != nil {
+		t.Fatalf("Dump: %v", err)
+	}
+	walkStrings(cfg, func(path string, secret bool, value reflect.Value) {
+		if secret && strings.Contains(string(dump), value.String()) {
+			t.Errorf("the dump contains %s", path)
+		}
+	})
+}
+
+func TestRedactNested(t *testing.T) {
+	type credentials struct {
+		User     string
+		Password string `secret:"true"`
+	}
+	type settings struct {
+		Name        string
+		Tokens      map[string]string        `secret:"true"`
+		ByTenant    map[string]credentials   // Secrets within the values
+		Primary     *credentials             // Secrets behind a pointer
+		Fallbacks   []*credentials           // Secrets behind pointers in a list
+		Extra       interface{}              // Secrets in a value of any type
+		Keys        [2]string                `secret:"true"`
+		PerProvider map[string][]credentials // Secrets in lists within a map
+	}
+
+	original := settings{
+		Name:        "app",
+		Tokens:      map[string]string{"ci": "ci-token"},
+		ByTenant:    map[string]credentials{"acme": {User: "acme", Password: "acme-password"}},
+		Primary:     &credentials{User: "root", Password: "root-password"},
+		Fallbacks:   []*credentials{{User: "backup", Password: "backup-password"}},
+		Extra:       credentials{User: "extra", Password: "extra-password"},
+		Keys:        [2]string{"key-1", ""},
+		PerProvider: map[string][]credentials{"google": {{User: "g", Password: "google-password"}}},
+	}
+
+	redacted := redact(reflect.ValueOf(&original), false).Interface().(*settings)
+
+	want := settings{
+		Name:        "app",
+		Tokens:      map[string]string{"ci": redactedValue},
+		ByTenant:    map[string]credentials{"acme": {User: "acme", Password: redactedValue}},
+		Primary:     &credentials{User: "root", Password: redactedValue},
+		Fallbacks:   []*credentials{{User: "backup", Password: redactedValue}},
+		Extra:       credentials{User: "extra", Password: redactedValue},
+		Keys:        [2]string{redactedValue, ""},
+		PerProvider: map[string][]credentials{"google": {{User: "g", Password: redactedValue}}},
+	}
+	if !reflect.DeepEqual(*redacted, want) {
+		t.Errorf("redacted = %+v, want %+v", *redacted, want)
+	}
+
+	if original.Tokens["ci"] != "ci-token" || original.ByTenant["acme"].Password != "acme-password" ||
+		original.Primary.Password != "root-password" || original.Fallbacks[0].Password != "backup-password" ||
+		original.PerProvider["google"][0].Password != "google-password" {
+		t.Errorf("the original was masked: %+v", original)
+	}
+}
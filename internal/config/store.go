@@ -0,0 +1,192 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce groups the burst of events an editor or a Kubernetes
+// ConfigMap update produces into a single reload
+const reloadDebounce = 200 * time.Millisecond
+
+// Logger is the logging a Store does. *utils.Logger implements it; this
+// package can't import utils, which depends on it.
+type Logger interface {
+	Info(msg string, fields map[string]interface{})
+	Warn(msg string, fields map[string]interface{})
+	Error(msg string, err error, fields map[string]interface{})
+}
+
+// Store holds the current configuration and replaces it when the config file
+// changes or the process receives SIGHUP. Only settings tagged reload:"true"
+// change on a reload; the rest keep their startup values until a restart.
+type Store struct {
+	args        []string
+	current     atomic.Pointer[Config]
+	mu          sync.Mutex // Serializes reloads and guards subscribers
+	subscribers []func(cfg *Config)
+	logger      Logger
+	// notifyHangup relays SIGHUP to c until stop is called; tests replace it
+	notifyHangup func(c chan<- os.Signal) (stop func())
+}
+
+// NewStore creates a store holding cfg, which was loaded by Load(args).
+// Reloads load the configuration again with the same arguments.
+func NewStore(cfg *Config, args []string, logger Logger) *Store {
+	s := &Store{args: args, logger: logger, notifyHangup: notifyHangup}
+	s.current.Store(cfg)
+	return s
+}
+
+// notifyHangup relays the process's SIGHUP signals to c
+func notifyHangup(c chan<- os.Signal) func() {
+	signal.Notify(c, syscall.SIGHUP)
+	return func() { signal.Stop(c) }
+}
+
+// Current returns the configuration in effect. It must not be modified.
+func (s *Store) Current() *Config {
+	return s.current.Load()
+}
+
+// Subscribe registers fn to be called with every configuration accepted by a
+// reload. Subscribers are called one at a time and should return quickly.
+func (s *Store) Subscribe(fn func(cfg *Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers = append(s.subscribers, fn)
+}
+
+// Reload loads the configuration again and, if it is valid, swaps in its
+// reloadable settings and notifies subscribers. An invalid configuration is
+// rejected and the current one stays in effect.
+func (s *Store) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loaded, err := Load(s.args)
+	if err != nil {
+		return err
+	}
+
+	current := s.Current()
+	next := *current
+	loadedSettings := fields(loaded)
+	var restart []string
+	for i, setting := range fields(&next) {
+		value := loadedSettings[i].value
+		if reflect.DeepEqual(setting.value.Interface(), value.Interface()) {
+			continue
+		}
+		if setting.reloadable {
+			setting.value.Set(value)
+		} else {
+			restart = append(restart, setting.path)
+		}
+	}
+	if !reflect.DeepEqual(current.OIDC, loaded.OIDC) {
+		restart = append(restart, "oidc.providers")
+	}
+
+	if err := next.Validate(); err != nil {
+		return err
+	}
+	if len(restart) > 0 {
+		s.logger.Warn("Some configuration changes take effect after a restart", map[string]interface{}{
+			"settings": strings.Join(restart, ", "),
+		})
+	}
+
+	s.current.Store(&next)
+	for _, fn := range s.subscribers {
+		fn(&next)
+	}
+	return nil
+}
+
+// Watch reloads the configuration whenever the config file changes or the
+// process receives SIGHUP, until ctx is done. Failed reloads are logged.
+func (s *Store) Watch(ctx context.Context) error {
+	var fileEvents <-chan fsnotify.Event
+	var fileErrors <-chan error
+
+	file := s.Current().File()
+	if file != "" {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return err
+		}
+		// Watch the directory rather than the file, which editors and
+		// Kubernetes replace instead of writing to
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			watcher.Close()
+			return err
+		}
+		fileEvents, fileErrors = watcher.Events, watcher.Errors
+		go func() {
+			<-ctx.Done()
+			watcher.Close()
+		}()
+	}
+
+	hangup := make(chan os.Signal, 1)
+	stop := s.notifyHangup(hangup)
+
+	go func() {
+		defer stop()
+
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				s.reloadAndLog("SIGHUP")
+			case event, ok := <-fileEvents:
+				if !ok {
+					fileEvents = nil
+					continue
+				}
+				// Kubernetes swaps the ..data symlink when a mounted ConfigMap changes
+				if filepath.Clean(event.Name) == filepath.Clean(file) || filepath.Base(event.Name) == "..data" {
+					debounce = time.After(reloadDebounce)
+				}
+			case <-debounce:
+				debounce = nil
+				s.reloadAndLog("config file change")
+			case err, ok := <-fileErrors:
+				if !ok {
+					fileErrors = nil
+					continue
+				}
+				s.logger.Error("Watching the config file failed", err, map[string]interface{}{
+					"file": file,
+				})
+			}
+		}
+	}()
+	return nil
+}
+
+// reloadAndLog reloads the configuration and logs the outcome
+func (s *Store) reloadAndLog(trigger string) {
+	if err := s.Reload(); err != nil {
+		s.logger.Error("Rejected configuration reload, keeping the current configuration", err, map[string]interface{}{
+			"trigger": trigger,
+		})
+		return
+	}
+	s.logger.Info("Configuration reloaded", map[string]interface{}{
+		"trigger": trigger,
+	})
+}
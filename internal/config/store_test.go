@@ -0,0 +1,211 @@
+package config
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// storeWait bounds how long a test waits for a reload triggered in the background
+const storeWait = 5 * time.Second
+
+// fakeLogger records the messages logged to it
+type fakeLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *fakeLogger) Info(msg string, fields map[string]interface{}) {
+	l.record("INFO", msg, fields)
+}
+
+func (l *fakeLogger) Warn(msg string, fields map[string]interface{}) {
+	l.record("WARN", msg, fields)
+}
+
+func (l *fakeLogger) Error(msg string, err error, fields map[string]interface{}) {
+	l.record("ERROR", msg+": "+err.Error(), fields)
+}
+
+func (l *fakeLogger) record(level, msg string, fields map[string]interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, value := range fields {
+		msg += " " + key + "=" + value.(string)
+	}
+	l.messages = append(l.messages, level+" "+msg)
+}
+
+// logged reports whether a message containing text was logged
+func (l *fakeLogger) logged(text string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, msg := range l.messages {
+		if strings.Contains(msg, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// newTestStore loads the configuration from a config file holding content and
+// returns a store for it, the file's path and a channel of reloaded configurations
+func newTestStore(t *testing.T, content string) (*Store, string, <-chan *Config, *fakeLogger) {
+	t.Helper()
+
+	clearEnv(t)
+	path := writeConfigFile(t, "config.yaml", content)
+	t.Setenv(FileEnv, path)
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	logger := &fakeLogger{}
+	store := NewStore(cfg, nil, logger)
+	reloaded := make(chan *Config, 10)
+	store.Subscribe(func(cfg *Config) { reloaded <- cfg })
+	return store, path, reloaded, logger
+}
+
+// rewriteConfigFile replaces the content of the config file at path
+func rewriteConfigFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write the config file: %v", err)
+	}
+}
+
+// waitForReload returns the next configuration a store's subscriber receives
+func waitForReload(t *testing.T, reloaded <-chan *Config) *Config {
+	t.Helper()
+	select {
+	case cfg := <-reloaded:
+		return cfg
+	case <-time.After(storeWait):
+		t.Fatal("the configuration wasn't reloaded")
+		return nil
+	}
+}
+
+const storeTestFile = `
+server:
+  port: 8001
+log:
+  level: info
+jwt:
+  signing_key_file: a.pem
+`
+
+func TestStoreReload(t *testing.T) {
+	store, path, reloaded, logger := newTestStore(t, storeTestFile)
+	original := store.Current()
+
+	rewriteConfigFile(t, path, strings.NewReplacer("8001", "8002", "info", "debug").Replace(storeTestFile))
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	current := store.Current()
+	if current.Log.Level != "debug" {
+		t.Errorf("log.level = %q, want the reloaded debug", current.Log.Level)
+	}
+	if current.Server.Port != 8001 {
+		t.Errorf("server.port = %d, want 8001 until a restart", current.Server.Port)
+	}
+	if original.Log.Level != "info" {
+		t.Errorf("the previous configuration was modified: log.level = %q", original.Log.Level)
+	}
+	if !logger.logged("settings=server.port") {
+		t.Errorf("no restart warning for server.port in %q", logger.messages)
+	}
+
+	select {
+	case cfg := <-reloaded:
+		if cfg != current {
+			t.Error("the subscriber got a configuration other than the current one")
+		}
+	default:
+		t.Error("the subscriber wasn't notified")
+	}
+}
+
+func TestStoreReloadInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"invalid reloadable setting", strings.Replace(storeTestFile, "info", "verbose", 1)},
+		{"unparsable file", storeTestFile + "log: [\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, path, reloaded, _ := newTestStore(t, storeTestFile)
+			original := store.Current()
+
+			rewriteConfigFile(t, path, tt.content)
+			if err := store.Reload(); err == nil {
+				t.Fatal("Reload succeeded, want an error")
+			}
+			if store.Current() != original || original.Log.Level != "info" {
+				t.Error("the rejected configuration replaced the current one")
+			}
+			if len(reloaded) != 0 {
+				t.Error("subscribers were notified of a rejected configuration")
+			}
+		})
+	}
+}
+
+func TestStoreWatch(t *testing.T) {
+	store, path, reloaded, logger := newTestStore(t, storeTestFile)
+	hangup := make(chan chan<- os.Signal, 1)
+	store.notifyHangup = func(c chan<- os.Signal) func() {
+		hangup <- c
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := store.Watch(ctx); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	signals := <-hangup
+
+	t.Run("SIGHUP", func(t *testing.T) {
+		// Only the environment changes, so the file watcher stays quiet
+		t.Setenv("LOG_LEVEL", "warn")
+		signals <- syscall.SIGHUP
+		if cfg := waitForReload(t, reloaded); cfg.Log.Level != "warn" {
+			t.Errorf("log.level = %q, want warn", cfg.Log.Level)
+		}
+		if !logger.logged("Configuration reloaded trigger=SIGHUP") {
+			t.Errorf("the reload wasn't logged: %q", logger.messages)
+		}
+	})
+
+	t.Run("config file change", func(t *testing.T) {
+		rewriteConfigFile(t, path, strings.Replace(storeTestFile, "info", "error", 1))
+		if cfg := waitForReload(t, reloaded); cfg.Log.Level != "error" {
+			t.Errorf("log.level = %q, want error", cfg.Log.Level)
+		}
+	})
+
+	t.Run("rejected config file change", func(t *testing.T) {
+		rewriteConfigFile(t, path, strings.Replace(storeTestFile, "info", "verbose", 1))
+		deadline := time.Now().Add(storeWait)
+		for !logger.logged("Rejected configuration reload") {
+			if time.Now().After(deadline) {
+				t.Fatalf("the rejected reload wasn't logged: %q", logger.messages)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if level := store.Current().Log.Level; level != "error" {
+			t.Errorf("log.level = %q, want the previous error", level)
+		}
+	})
+}
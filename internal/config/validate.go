@@ -0,0 +1,138 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ValidationError lists every problem found in the configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the configuration against the validate tags of its fields
+// and the rules that span several fields
+func (c *Config) Validate() error {
+	problems, err := c.fieldProblems()
+	if err != nil {
+		return err
+	}
+	problems = append(problems, c.crossFieldProblems()...)
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: problems}
+}
+
+// fieldProblems checks the validate tags of every field
+func (c *Config) fieldProblems() ([]string, error) {
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	validate.RegisterTagNameFunc(yamlName)
+
+	err := validate.Struct(c)
+	if err == nil {
+		return nil, nil
+	}
+
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		return nil, err
+	}
+
+	envNames := c.envNames()
+	problems := make([]string, 0, len(fieldErrors))
+	for _, fe := range fieldErrors {
+		path := strings.TrimPrefix(fe.Namespace(), "Config.")
+		if env, ok := envNames[path]; ok {
+			path += " (" + env + ")"
+		}
+		problems = append(problems, path+" "+describe(fe))
+	}
+	return problems, nil
+}
+
+// crossFieldProblems checks the rules validate tags can't express
+func (c *Config) crossFieldProblems() []string {
+	var problems []string
+	if c.Security.CursorKey != "" {
+		if key, err := base64.StdEncoding.DecodeString(c.Security.CursorKey); err == nil && len(key) < MinCursorKeyLength {
+			problems = append(problems, fmt.Sprintf("security.cursor_key (CURSOR_KEY) must be at least %d bytes", MinCursorKeyLength))
+		}
+	} else if c.Server.Mode == "release" {
+		// Every instance must sign cursors with the same key, and keep it across restarts
+		problems = append(problems, "security.cursor_key (CURSOR_KEY) is required when server.mode is release")
+	}
+	return problems
+}
+
+// envNames maps the dotted path of every setting to its environment variable
+func (c *Config) envNames() map[string]string {
+	envNames := make(map[string]string)
+	for _, s := range fields(c) {
+		if len(s.env) > 0 {
+			envNames[s.path] = s.env[0]
+		}
+	}
+	return envNames
+}
+
+// describe turns a failed validation into a readable requirement
+func describe(fe validator.FieldError) string {
+	param := fe.Param()
+	if fe.Kind() == reflect.Int64 && fe.Type().String() == "time.Duration" && param == "0" {
+		param = "0s"
+	}
+
+	switch fe.Tag() {
+	case "required", "required_if":
+		return "is required"
+	case "excluded_if":
+		condition := strings.Fields(param)
+		return "must be empty when " + snakeCase(condition[0]) + " is " + condition[1]
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(param, " ", ", ")
+	case "min", "gte":
+		return "must be at least " + param
+	case "max", "lte":
+		return "must be at most " + param
+	case "gt":
+		return "must be greater than " + param
+	case "gtefield":
+		return "must be at least " + snakeCase(param)
+	case "email":
+		return "must be an email address"
+	case "url":
+		return "must be a URL"
+	case "file":
+		return "must be an existing file"
+	case "base64":
+		return "must be base64 encoded"
+	default:
+		return fmt.Sprintf("failed the %q check", fe.Tag())
+	}
+}
+
+// snakeCase converts a Go field name to its config file key
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateCursorKey(t *testing.T) {
+	key := func(n int) string {
+		return base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", n)))
+	}
+
+	tests := []struct {
+		name    string
+		mode    string
+		key     string
+		wantErr string
+	}{
+		{"debug without key", "debug", "", ""},
+		{"release without key", "release", "", "security.cursor_key (CURSOR_KEY) is required"},
+		{"release with key", "release", key(MinCursorKeyLength), ""},
+		{"short key", "debug", key(MinCursorKeyLength - 1), "must be at least 32 bytes"},
+		{"not base64", "debug", "not base64!", "must be base64 encoded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validTestConfig()
+			cfg.Server.Mode = tt.mode
+			cfg.Security.CursorKey = tt.key
+
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want a problem containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		metrics MetricsConfig
+		wantErr string
+	}{
+		{"disabled", MetricsConfig{}, ""},
+		{"enabled with token", MetricsConfig{Enabled: true, Token: "s3cret"}, ""},
+		{"enabled without token", MetricsConfig{Enabled: true}, "metrics.token (METRICS_TOKEN) is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validTestConfig()
+			cfg.Metrics = tt.metrics
+
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want a problem containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// validTestConfig returns the default configuration with the settings that
+// have no default filled in
+func validTestConfig() *Config {
+	cfg := Default()
+	cfg.JWT.SigningKeyFile = "keys/jwt-signing.pem"
+	return cfg
+}
@@ -0,0 +1,391 @@
+package connectors
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+)
+
+type Database struct {
+	db      *gorm.DB
+	enabled bool
+	// primary bypasses the replicas; nil without them, when db does
+	primary *gorm.DB
+	// pools are the connection pools of the primary and then of each replica
+	pools []*sql.DB
+}
+
+// PoolStats describes one connection pool, as reported by Health
+type PoolStats struct {
+	Name              string        `json:"name"` // "primary" or "replica-N"
+	Healthy           bool          `json:"healthy"`
+	MaxOpen           int           `json:"max_open"`
+	Open              int           `json:"open"`
+	InUse             int           `json:"in_use"`
+	Idle              int           `json:"idle"`
+	WaitCount         int64         `json:"wait_count"`
+	WaitDuration      time.Duration `json:"wait_duration_ns"`
+	MaxIdleClosed     int64         `json:"max_idle_closed"`
+	MaxIdleTimeClosed int64         `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64         `json:"max_lifetime_closed"`
+}
+
+// NewDatabase creates a new database connection to MySQL, PostgreSQL or SQLite,
+// as cfg.Driver says. The schema is managed by the migrations package. When
+// cfg.Replicas are set, reads outside transactions go to a random replica and
+// everything else to the primary; see ReadFromPrimary.
+func NewDatabase(cfg config.DatabaseConfig) (*Database, error) {
+	embedded := cfg.Driver == config.DriverSQLite
+	if embedded && len(cfg.Replicas) > 0 {
+		return nil, errors.New("read replicas aren't supported with the sqlite driver; unset database.replicas (DB_REPLICAS)")
+	}
+	if cfg.Name == "" || (!embedded && (cfg.Host == "" || cfg.User == "" || cfg.Password == "")) {
+		log.Println("Database configuration incomplete. Database functionality will be disabled.")
+		return &Database{enabled: false}, nil
+	}
+
+	// Configure GORM logger
+	gormLogger := logger.New(
+		log.New(os.Stdout, "\r\n", log.LstdFlags),
+		logger.Config{
+			SlowThreshold:             time.Second,
+			LogLevel:                  logger.Info,
+			IgnoreRecordNotFoundError: true,
+			Colorful:                  true,
+		},
+	)
+
+	// Open connection to database
+	db, err := gorm.Open(dialector(cfg), &gorm.Config{
+		Logger: gormLogger,
+	})
+	if err != nil {
+		log.Printf("Failed to connect to database: %v. Database functionality will be disabled.", err)
+		return &Database{enabled: false}, nil
+	}
+
+	// Keep queries on organization-owned tables within the request's organization
+	if err := models.RegisterTenantScope(db); err != nil {
+		log.Printf("Failed to register tenant scope: %v. Database functionality will be disabled.", err)
+		return &Database{enabled: false}, nil
+	}
+
+	// Get underlying SQL DB to configure connection pool
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Printf("Failed to get underlying SQL DB: %v. Database functionality will be disabled.", err)
+		return &Database{enabled: false}, nil
+	}
+
+	// Create database wrapper
+	database := &Database{
+		db:      db,
+		enabled: true,
+		pools:   []*sql.DB{sqlDB},
+	}
+
+	// Route reads to the replicas; without them everything uses the primary
+	if len(cfg.Replicas) > 0 {
+		if err := database.useReplicas(cfg); err != nil {
+			log.Printf("Failed to connect to read replicas: %v. Reads will use the primary.", err)
+		} else {
+			log.Printf("Routing reads to %d replica(s)", len(cfg.Replicas))
+		}
+	}
+
+	// Configure connection pools
+	for _, pool := range database.pools {
+		configurePool(pool, cfg)
+	}
+
+	return database, nil
+}
+
+// useReplicas registers the replicas with GORM's resolver. Reads are sent to a
+// random replica unless they run in a transaction, lock rows or their context
+// asks for the primary.
+func (db *Database) useReplicas(cfg config.DatabaseConfig) error {
+	replicas := make([]gorm.Dialector, 0, len(cfg.Replicas))
+	for _, address := range cfg.Replicas {
+		replicaCfg := cfg
+		replicaCfg.Host, replicaCfg.Port = splitHostPort(address, cfg.Port)
+		replicas = append(replicas, dialector(replicaCfg))
+	}
+
+	// Keep a handle on the primary that the resolver doesn't route
+	primary, err := gorm.Open(connDialector(cfg.Driver, db.pools[0]), &gorm.Config{Logger: db.db.Logger})
+	if err != nil {
+		return err
+	}
+	if err := models.RegisterTenantScope(primary); err != nil {
+		return err
+	}
+
+	resolver := dbresolver.Register(dbresolver.Config{
+		Replicas: replicas,
+		Policy:   dbresolver.RandomPolicy{},
+	})
+	if err := db.db.Use(resolver); err != nil {
+		return err
+	}
+
+	// The resolver's pools are the primary's followed by the replicas'
+	var pools []*sql.DB
+	resolver.Call(func(pool gorm.ConnPool) error {
+		if sqlDB, ok := pool.(*sql.DB); ok {
+			pools = append(pools, sqlDB)
+		}
+		return nil
+	})
+	db.pools = pools
+	db.primary = primary
+
+	// Override the resolver's choice for contexts from ReadFromPrimary
+	callbacks := db.db.Callback()
+	if err := callbacks.Query().After("gorm:db_resolver").Before("gorm:query").Register("resolver:read_primary", readPrimary); err != nil {
+		return err
+	}
+	if err := callbacks.Row().After("gorm:db_resolver").Before("gorm:row").Register("resolver:read_primary", readPrimary); err != nil {
+		return err
+	}
+	return callbacks.Raw().After("gorm:db_resolver").Before("gorm:raw").Register("resolver:read_primary", readPrimary)
+}
+
+// splitHostPort splits a replica address into its host and port, using
+// defaultPort when it has none
+func splitHostPort(address string, defaultPort int) (string, int) {
+	host, rawPort, err := net.SplitHostPort(address)
+	if err != nil {
+		return address, defaultPort
+	}
+	port, err := strconv.Atoi(rawPort)
+	if err != nil {
+		return address, defaultPort
+	}
+	return host, port
+}
+
+// configurePool applies the configured limits to a connection pool
+func configurePool(pool *sql.DB, cfg config.DatabaseConfig) {
+	maxIdle, lifetime, idleTime := cfg.MaxIdleConns, cfg.ConnMaxLifetime, cfg.ConnMaxIdleTime
+	if cfg.Driver == config.DriverSQLite {
+		// An in-memory database is dropped when its last connection closes
+		maxIdle, lifetime, idleTime = max(maxIdle, 1), 0, 0
+	}
+	pool.SetMaxOpenConns(cfg.MaxOpenConns)
+	pool.SetMaxIdleConns(maxIdle)
+	pool.SetConnMaxLifetime(lifetime)
+	pool.SetConnMaxIdleTime(idleTime)
+}
+
+type readPrimaryKey struct{}
+
+// ReadFromPrimary returns a context whose reads go to the primary instead of a
+// replica, so they see writes the replicas may not have received yet
+func ReadFromPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readPrimaryKey{}, true)
+}
+
+// readsFromPrimary reports whether the context was returned by ReadFromPrimary
+func readsFromPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(readPrimaryKey{}).(bool)
+	return primary
+}
+
+// readPrimary sends the reads of contexts from ReadFromPrimary to the primary
+func readPrimary(db *gorm.DB) {
+	if db.Statement.Context != nil && readsFromPrimary(db.Statement.Context) {
+		dbresolver.Write.ModifyStatement(db.Statement)
+	}
+}
+
+type transactionKey struct{}
+
+// WithTransaction runs fn as a unit of work: in a transaction carried by the
+// context fn receives, which commits when fn returns nil and rolls back when
+// it returns an error or panics. Services given that context run their
+// statements in the transaction (see Conn), so fn can combine several of them
+// atomically. When ctx already carries a transaction, fn runs in a savepoint
+// of it instead, and only the savepoint's work is rolled back on error.
+func WithTransaction(ctx context.Context, db *gorm.DB, fn func(ctx context.Context) error) error {
+	return Conn(ctx, db).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, transactionKey{}, tx))
+	})
+}
+
+// Conn returns the handle statements made for ctx should use: the transaction
+// ctx carries from WithTransaction, or db outside of one
+func Conn(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(transactionKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
+
+// InTransaction reports whether ctx carries a transaction from WithTransaction
+func InTransaction(ctx context.Context) bool {
+	_, ok := ctx.Value(transactionKey{}).(*gorm.DB)
+	return ok
+}
+
+// dialector returns the GORM dialector of the configured driver
+func dialector(cfg config.DatabaseConfig) gorm.Dialector {
+	switch cfg.Driver {
+	case config.DriverPostgres:
+		return postgres.Open(cfg.DSN())
+	case config.DriverSQLite:
+		return sqlite.Open(cfg.DSN())
+	default:
+		return mysql.Open(cfg.DSN())
+	}
+}
+
+// connDialector returns the GORM dialector of the configured driver on an open
+// connection pool
+func connDialector(driver string, pool *sql.DB) gorm.Dialector {
+	switch driver {
+	case config.DriverPostgres:
+		return postgres.New(postgres.Config{Conn: pool})
+	case config.DriverSQLite:
+		return &sqlite.Dialector{Conn: pool}
+	default:
+		return mysql.New(mysql.Config{Conn: pool})
+	}
+}
+
+// AutoMigrate performs database migrations for arbitrary models. The
+// application's own tables are managed by the migrations package instead.
+func (db *Database) AutoMigrate(models ...interface{}) error {
+	if !db.enabled {
+		log.Println("Database functionality is disabled. Skipping migrations.")
+		return nil
+	}
+	for _, model := range models {
+		if err := db.db.AutoMigrate(model); err != nil {
+			return fmt.Errorf("failed to migrate model %T: %v", model, err)
+		}
+		log.Printf("Successfully migrated model %T", model)
+	}
+	return nil
+}
+
+// Transaction runs fn as a unit of work on the database; see WithTransaction
+func (db *Database) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !db.enabled {
+		log.Println("Database functionality is disabled. Skipping transaction.")
+		return nil
+	}
+	return WithTransaction(ctx, db.db, fn)
+}
+
+// GetDB returns the underlying GORM DB instance
+func (db *Database) GetDB() *gorm.DB {
+	if !db.enabled {
+		log.Println("Database functionality is disabled. Returning nil DB.")
+		return nil
+	}
+	return db.db
+}
+
+// Primary returns the GORM DB instance of the primary without routing reads
+// to the replicas, for work that must stay on one connection, such as
+// migrations holding a lock
+func (db *Database) Primary() *gorm.DB {
+	if !db.enabled {
+		log.Println("Database functionality is disabled. Returning nil DB.")
+		return nil
+	}
+	if db.primary != nil {
+		return db.primary
+	}
+	return db.db
+}
+
+// Close closes the connections to the primary and the replicas
+func (db *Database) Close() error {
+	if !db.enabled {
+		log.Println("Database functionality is disabled. No connection to close.")
+		return nil
+	}
+	var errs []error
+	for _, pool := range db.pools {
+		if err := pool.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Health pings the primary and every replica and returns the statistics of
+// their connection pools. The error joins the failed pings.
+func (db *Database) Health() ([]PoolStats, error) {
+	if !db.enabled {
+		log.Println("Database functionality is disabled. Health check skipped.")
+		return nil, nil
+	}
+
+	stats := make([]PoolStats, 0, len(db.pools))
+	var errs []error
+	for i, pool := range db.pools {
+		name := poolName(i)
+		err := pool.Ping()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		s := pool.Stats()
+		stats = append(stats, PoolStats{
+			Name:              name,
+			Healthy:           err == nil,
+			MaxOpen:           s.MaxOpenConnections,
+			Open:              s.OpenConnections,
+			InUse:             s.InUse,
+			Idle:              s.Idle,
+			WaitCount:         s.WaitCount,
+			WaitDuration:      s.WaitDuration,
+			MaxIdleClosed:     s.MaxIdleClosed,
+			MaxIdleTimeClosed: s.MaxIdleTimeClosed,
+			MaxLifetimeClosed: s.MaxLifetimeClosed,
+		})
+	}
+	return stats, errors.Join(errs...)
+}
+
+// RegisterMetrics exports the statistics of every connection pool to
+// Prometheus, labelled db_name="primary" or "replica-N"
+func (db *Database) RegisterMetrics(registerer prometheus.Registerer) error {
+	if !db.enabled {
+		return nil
+	}
+	for i, pool := range db.pools {
+		if err := registerer.Register(collectors.NewDBStatsCollector(pool, poolName(i))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// poolName names the i-th pool in Database.pools
+func poolName(i int) string {
+	if i == 0 {
+		return "primary"
+	}
+	return fmt.Sprintf("replica-%d", i)
+}
@@ -0,0 +1,20 @@
+package connectors_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+)
+
+func TestNewDatabaseRejectsSQLiteReplicas(t *testing.T) {
+	_, err := connectors.NewDatabase(config.DatabaseConfig{
+		Driver:   config.DriverSQLite,
+		Name:     ":memory:",
+		Replicas: []string{"replica-1"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "sqlite") {
+		t.Errorf("err = %v, want one rejecting replicas for sqlite", err)
+	}
+}
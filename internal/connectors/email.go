@@ -3,11 +3,12 @@ package connectors
 import (
 	"crypto/tls"
 	"fmt"
+	"html"
 	"log"
-	"os"
-	"strconv"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
 
-	"github.com/joho/godotenv"
 	"gopkg.in/mail.v2"
 )
 
@@ -24,50 +25,20 @@ func (e *EmailSender) IsEnabled() bool {
 }
 
 // NewEmailSender creates a new instance of EmailSender
-func NewEmailSender() (*EmailSender, error) {
+func NewEmailSender(cfg config.EmailConfig) (*EmailSender, error) {
 	log.Println("Initializing EmailSender...")
 
-	// Load .env file if it exists
-	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
-		log.Printf("Error loading .env file: %v", err)
-		return nil, fmt.Errorf("error loading .env file: %v", err)
-	}
-
-	// Get required environment variables
-	requiredVars := []string{"SMTP_HOST", "SMTP_PORT", "SMTP_USERNAME", "SMTP_PASSWORD", "SMTP_FROM_EMAIL"}
-	config := make(map[string]string)
-
-	for _, v := range requiredVars {
-		if value := os.Getenv(v); value != "" {
-			config[v] = value
-			// Log the first few characters of sensitive info
-			if v == "SMTP_PASSWORD" {
-				log.Printf("%s: %s...", v, value[:min(len(value), 3)])
-			} else {
-				log.Printf("%s: %s", v, value)
-			}
-		} else {
-			log.Printf("SMTP configuration missing: %s. Email functionality will be disabled.", v)
-			return &EmailSender{Enabled: false}, nil
-		}
-	}
-
-	port, err := strconv.Atoi(config["SMTP_PORT"])
-	if err != nil {
-		log.Printf("Invalid SMTP port: %v. Email functionality will be disabled.", err)
+	if cfg.Host == "" || cfg.Username == "" || cfg.Password == "" || cfg.FromEmail == "" {
+		log.Println("SMTP configuration incomplete. Email functionality will be disabled.")
 		return &EmailSender{Enabled: false}, nil
 	}
+	log.Printf("SMTP server: %s:%d, username: %s, from: %s", cfg.Host, cfg.Port, cfg.Username, cfg.FromEmail)
 
-	dialer := mail.NewDialer(
-		config["SMTP_HOST"],
-		port,
-		config["SMTP_USERNAME"],
-		config["SMTP_PASSWORD"],
-	)
+	dialer := mail.NewDialer(cfg.Host, cfg.Port, cfg.Username, cfg.Password)
 
 	// For Gmail SMTP relay, use TLS instead of SSL
 	dialer.SSL = false
-	dialer.TLSConfig = &tls.Config{ServerName: config["SMTP_HOST"]}
+	dialer.TLSConfig = &tls.Config{ServerName: cfg.Host}
 
 	// Test the connection
 	s, err := dialer.Dial()
@@ -80,18 +51,11 @@ func NewEmailSender() (*EmailSender, error) {
 	log.Println("EmailSender initialized successfully - SMTP connection test passed")
 	return &EmailSender{
 		dialer:  dialer,
-		from:    config["SMTP_FROM_EMAIL"],
+		from:    cfg.FromEmail,
 		Enabled: true,
 	}, nil
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
 // SendEmail sends an email with the given parameters
 func (e *EmailSender) SendEmail(to string, subject string, body string) error {
 	if !e.Enabled {
@@ -160,6 +124,91 @@ func (e *EmailSender) SendPasswordReset(to string, resetToken string, resetURL s
 	return e.SendEmail(to, subject, body)
 }
 
+// SendEmailVerification sends an email address verification link
+func (e *EmailSender) SendEmailVerification(to string, verifyURL string) error {
+	subject := "Verify Your Email Address"
+	body := fmt.Sprintf(`
+		<html>
+		<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+			<div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+				<h2 style="color: #2c3e50;">Verify Your Email Address</h2>
+				<p>Please confirm that this is your email address by clicking the link below:</p>
+				<p style="margin: 25px 0;">
+					<a href="%s" style="background-color: #3498db; color: white; padding: 12px 25px; text-decoration: none; border-radius: 4px;">Verify Email</a>
+				</p>
+				<p style="color: #7f8c8d; font-size: 0.9em;">If you didn't create an account or request this change, please ignore this email.</p>
+			</div>
+		</body>
+		</html>
+	`, verifyURL)
+
+	return e.SendEmail(to, subject, body)
+}
+
+// SendMagicLink sends a single-use passwordless sign-in link
+func (e *EmailSender) SendMagicLink(to string, loginURL string, ttl time.Duration) error {
+	subject := "Your Sign-In Link"
+	body := fmt.Sprintf(`
+		<html>
+		<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+			<div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+				<h2 style="color: #2c3e50;">Sign In</h2>
+				<p>Click the link below to sign in. No password is needed.</p>
+				<p style="margin: 25px 0;">
+					<a href="%s" style="background-color: #3498db; color: white; padding: 12px 25px; text-decoration: none; border-radius: 4px;">Sign In</a>
+				</p>
+				<p style="color: #7f8c8d; font-size: 0.9em;">This link can be used once and will expire in %d minutes.</p>
+				<p style="color: #7f8c8d; font-size: 0.9em;">If you didn't request this, please ignore this email.</p>
+			</div>
+		</body>
+		</html>
+	`, loginURL, int(ttl.Minutes()))
+
+	return e.SendEmail(to, subject, body)
+}
+
+// SendAccountLocked notifies a user that their account was temporarily locked
+// after repeated failed sign-in attempts
+func (e *EmailSender) SendAccountLocked(to string, lockedUntil time.Time) error {
+	subject := "Your Account Has Been Temporarily Locked"
+	body := fmt.Sprintf(`
+		<html>
+		<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+			<div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+				<h2 style="color: #2c3e50;">Account Temporarily Locked</h2>
+				<p>We noticed several failed attempts to sign in to your account, so we have locked it until %s.</p>
+				<p>If this was you, you can try again after that time or reset your password.</p>
+				<p style="color: #7f8c8d; font-size: 0.9em;">If this wasn't you, someone may be trying to guess your password. We recommend choosing a strong, unique password and enabling multi-factor authentication.</p>
+			</div>
+		</body>
+		</html>
+	`, lockedUntil.UTC().Format("January 2, 2006 15:04 MST"))
+
+	return e.SendEmail(to, subject, body)
+}
+
+// SendOrganizationInvitation sends an invitation to join an organization
+func (e *EmailSender) SendOrganizationInvitation(to string, organizationName string, acceptURL string) error {
+	subject := fmt.Sprintf("You're Invited to Join %s", organizationName)
+	body := fmt.Sprintf(`
+		<html>
+		<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+			<div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+				<h2 style="color: #2c3e50;">Join %s</h2>
+				<p>You have been invited to join the %s workspace. Click the link below to accept:</p>
+				<p style="margin: 25px 0;">
+					<a href="%s" style="background-color: #3498db; color: white; padding: 12px 25px; text-decoration: none; border-radius: 4px;">Accept Invitation</a>
+				</p>
+				<p style="color: #7f8c8d; font-size: 0.9em;">You will need to sign in, or create an account, with this email address.</p>
+				<p style="color: #7f8c8d; font-size: 0.9em;">If you weren't expecting this invitation, you can ignore this email.</p>
+			</div>
+		</body>
+		</html>
+	`, html.EscapeString(organizationName), html.EscapeString(organizationName), acceptURL)
+
+	return e.SendEmail(to, subject, body)
+}
+
 // SendFollowUpReminder sends a reminder email for follow-up items
 func (e *EmailSender) SendFollowUpReminder(to string, entryTitle string, dueDate string) error {
 	subject := "Follow-up Reminder"
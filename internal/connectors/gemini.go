@@ -6,23 +6,20 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"os"
-	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
 
 	"github.com/google/generative-ai-go/genai"
 	"google.golang.org/api/option"
 )
 
-const (
-	defaultGeminiModel       = "gemini-1.5-flash"
-	defaultGeminiTemperature = 0.7
-)
-
 // GeminiClient handles communication with the Google Gemini API
 type GeminiClient struct {
 	apiKey             string
 	client             *genai.Client
+	mu                 sync.RWMutex // Guards the defaults, which change on config reload
 	defaultModel       string
 	defaultTemperature float32
 	ctx                context.Context
@@ -41,65 +38,57 @@ type GeminiResponse struct {
 }
 
 // NewGeminiClient creates a new Gemini client instance
-func NewGeminiClient() (*GeminiClient, error) {
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
-		return nil, errors.New("GEMINI_API_KEY environment variable is not set")
+func NewGeminiClient(cfg config.GeminiConfig) (*GeminiClient, error) {
+	if cfg.APIKey == "" {
+		return nil, errors.New("GEMINI_API_KEY is not set")
 	}
 
 	// Validate API key format (basic check)
-	if len(apiKey) < 20 {
+	if len(cfg.APIKey) < 20 {
 		return nil, errors.New("GEMINI_API_KEY appears to be invalid (too short)")
 	}
 
-	// Read default model from env or use constant
-	model := os.Getenv("GEMINI_DEFAULT_MODEL")
-	if model == "" {
-		model = defaultGeminiModel
-		log.Printf("Using default Gemini model: %s", model)
-	} else {
-		log.Printf("Using configured Gemini model: %s", model)
-	}
-
-	// Read default temperature from env or use constant
-	var temperature float32 = defaultGeminiTemperature
-	if tempStr := os.Getenv("GEMINI_DEFAULT_TEMPERATURE"); tempStr != "" {
-		if temp, err := strconv.ParseFloat(tempStr, 32); err == nil {
-			temperature = float32(temp)
-			log.Printf("Using configured Gemini temperature: %f", temperature)
-		} else {
-			log.Printf("Error parsing GEMINI_DEFAULT_TEMPERATURE, using default: %f", defaultGeminiTemperature)
-		}
-	} else {
-		log.Printf("Using default Gemini temperature: %f", temperature)
-	}
-
 	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	client, err := genai.NewClient(ctx, option.WithAPIKey(cfg.APIKey))
 	if err != nil {
 		return nil, fmt.Errorf("error creating Gemini client: %w", err)
 	}
 
-	log.Printf("Gemini client initialized successfully")
+	log.Printf("Gemini client initialized successfully (model: %s, temperature: %f)", cfg.DefaultModel, cfg.DefaultTemperature)
 
 	return &GeminiClient{
-		apiKey:             apiKey,
+		apiKey:             cfg.APIKey,
 		client:             client,
-		defaultModel:       model,
-		defaultTemperature: temperature,
+		defaultModel:       cfg.DefaultModel,
+		defaultTemperature: cfg.DefaultTemperature,
 		ctx:                ctx,
 	}, nil
 }
 
+// ApplyConfig applies a reloaded configuration's default model and temperature
+func (c *GeminiClient) ApplyConfig(cfg *config.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.defaultModel = cfg.Gemini.DefaultModel
+	c.defaultTemperature = cfg.Gemini.DefaultTemperature
+}
+
+// defaults returns the model and temperature used when a request doesn't set them
+func (c *GeminiClient) defaults() (string, float32) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.defaultModel, c.defaultTemperature
+}
+
 // CreateUnstructuredChatCompletion sends a chat completion request to the Gemini API
 func (c *GeminiClient) CreateUnstructuredChatCompletion(messages []GeminiMessage, model string, temperature *float32) (*GeminiResponse, error) {
 	// Use default model if not provided
 	if model == "" {
-		model = c.defaultModel
+		model, _ = c.defaults()
 	}
 
 	// Use default temperature if not provided
-	temp := c.defaultTemperature
+	_, temp := c.defaults()
 	if temperature != nil {
 		temp = *temperature
 	}
@@ -208,14 +197,14 @@ func (c *GeminiClient) CreateStructuredChatCompletion(messages []GeminiMessage,
 
 	// Use default model if not provided
 	if model == "" {
-		model = c.defaultModel
+		model, _ = c.defaults()
 		log.Printf("Using default model for Gemini structured completion: %s", model)
 	} else {
 		log.Printf("Using provided model for Gemini structured completion: %s", model)
 	}
 
 	// Use default temperature if not provided
-	temp := c.defaultTemperature
+	_, temp := c.defaults()
 	if temperature != nil {
 		temp = *temperature
 		log.Printf("Using provided temperature for Gemini structured completion: %f", temp)
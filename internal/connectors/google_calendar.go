@@ -9,7 +9,8 @@ import (
 	"os"
 	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/cam-boltnote/go-ignite/internal/config"
+
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/calendar/v3"
@@ -22,17 +23,10 @@ type CalendarConnector struct {
 }
 
 // NewCalendarConnector creates and initializes a new CalendarConnector
-func NewCalendarConnector() (*CalendarConnector, error) {
-	// Load .env file
-	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
-		log.Printf("Error loading .env file: %v", err)
-		return nil, fmt.Errorf("error loading .env file: %v", err)
-	}
-
-	// Read credentials from environment variable
-	credentials := os.Getenv("GOOGLE_CALENDAR_CREDENTIALS")
+func NewCalendarConnector(cfg config.GoogleCalendarConfig) (*CalendarConnector, error) {
+	credentials := cfg.Credentials
 	if credentials == "" {
-		return nil, fmt.Errorf("GOOGLE_CALENDAR_CREDENTIALS environment variable not set")
+		return nil, fmt.Errorf("GOOGLE_CALENDAR_CREDENTIALS is not set")
 	}
 
 	// Log the configured redirect URIs
@@ -47,7 +41,7 @@ func NewCalendarConnector() (*CalendarConnector, error) {
 	}
 
 	// Parse credentials
-	config, err := google.ConfigFromJSON([]byte(credentials),
+	oauthConfig, err := google.ConfigFromJSON([]byte(credentials),
 		calendar.CalendarEventsScope,
 		calendar.CalendarReadonlyScope,
 	)
@@ -56,12 +50,12 @@ func NewCalendarConnector() (*CalendarConnector, error) {
 	}
 
 	// Set the token endpoint URL
-	config.Endpoint = google.Endpoint
+	oauthConfig.Endpoint = google.Endpoint
 
-	log.Printf("OAuth config initialized with redirect URIs: %v", config.RedirectURL)
+	log.Printf("OAuth config initialized with redirect URIs: %v", oauthConfig.RedirectURL)
 
 	return &CalendarConnector{
-		config: config,
+		config: oauthConfig,
 	}, nil
 }
 
@@ -0,0 +1,191 @@
+package connectors_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/testutil"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+func TestNewOIDCProviderDiscovery(t *testing.T) {
+	fake := testutil.NewOIDCProvider(t)
+	ctx := context.Background()
+
+	provider, err := connectors.NewOIDCProvider(ctx, fake.ProviderConfig("fake"))
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	authURL, err := url.Parse(provider.AuthCodeURL("state", "nonce", oauth2.GenerateVerifier()))
+	if err != nil {
+		t.Fatalf("invalid authorization URL: %v", err)
+	}
+	if got := authURL.Scheme + "://" + authURL.Host + authURL.Path; got != fake.Issuer()+"/authorize" {
+		t.Errorf("authorization endpoint = %s, want the discovered one", got)
+	}
+	if scope := authURL.Query().Get("scope"); scope != "openid email profile" {
+		t.Errorf("scope = %q, want the default scopes", scope)
+	}
+
+	fake.DiscoveryIssuer = "https://evil.example.com"
+	if _, err := connectors.NewOIDCProvider(ctx, fake.ProviderConfig("fake")); err == nil {
+		t.Error("a discovery document for another issuer was accepted")
+	}
+
+	cfg := fake.ProviderConfig("fake")
+	cfg.IssuerURL = fake.Issuer() + "/missing"
+	if _, err := connectors.NewOIDCProvider(ctx, cfg); err == nil {
+		t.Error("an issuer without a discovery document was accepted")
+	}
+}
+
+func TestOIDCProviderPKCE(t *testing.T) {
+	fake := testutil.NewOIDCProvider(t)
+	ctx := context.Background()
+	provider, err := connectors.NewOIDCProvider(ctx, fake.ProviderConfig("fake"))
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	user := testutil.OIDCUser{Subject: "sub-1", Email: "Ada@Example.com", EmailVerified: true}
+
+	tests := []struct {
+		name     string
+		verifier func(verifier string) string
+		wantErr  bool
+	}{
+		{"matching verifier", func(v string) string { return v }, false},
+		{"other verifier", func(string) string { return oauth2.GenerateVerifier() }, true},
+		{"no verifier", func(string) string { return "" }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := oauth2.GenerateVerifier()
+			code, _ := fake.Authorize(t, provider.AuthCodeURL("state", "nonce", verifier), user, nil)
+
+			identity, err := provider.Exchange(ctx, code, tt.verifier(verifier), "nonce")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("exchange succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			if identity.Subject != "sub-1" || identity.Email != "ada@example.com" || !identity.EmailVerified {
+				t.Errorf("identity = %+v", identity)
+			}
+		})
+	}
+}
+
+func TestOIDCProviderExchangeRejectsReusedCode(t *testing.T) {
+	fake := testutil.NewOIDCProvider(t)
+	ctx := context.Background()
+	provider, err := connectors.NewOIDCProvider(ctx, fake.ProviderConfig("fake"))
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+
+	verifier := oauth2.GenerateVerifier()
+	code, _ := fake.Authorize(t, provider.AuthCodeURL("state", "nonce", verifier), testutil.OIDCUser{Subject: "sub-1"}, nil)
+	if _, err := provider.Exchange(ctx, code, verifier, "nonce"); err != nil {
+		t.Fatalf("first exchange: %v", err)
+	}
+	if _, err := provider.Exchange(ctx, code, verifier, "nonce"); err == nil {
+		t.Error("a code was redeemed twice")
+	}
+}
+
+func TestOIDCProviderVerifyIDToken(t *testing.T) {
+	fake := testutil.NewOIDCProvider(t)
+	ctx := context.Background()
+	provider, err := connectors.NewOIDCProvider(ctx, fake.ProviderConfig("fake"))
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	foreignKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	user := testutil.OIDCUser{Subject: "sub-1", Email: "ada@example.com", EmailVerified: true}
+
+	tests := []struct {
+		name      string
+		modify    func(jwt.MapClaims)
+		sign      func(jwt.MapClaims) string
+		nonce     string
+		wantErr   string
+		wantEmail bool
+	}{
+		{name: "valid", nonce: "nonce", wantEmail: true},
+		{name: "email_verified as a string", nonce: "nonce", wantEmail: true,
+			modify: func(c jwt.MapClaims) { c["email_verified"] = "true" }},
+		{name: "unverified email", nonce: "nonce",
+			modify: func(c jwt.MapClaims) { c["email_verified"] = false }},
+		{name: "nonce mismatch", nonce: "other", wantErr: "nonce"},
+		{name: "no nonce expected", nonce: "", wantErr: "nonce"},
+		{name: "other audience", nonce: "nonce", wantErr: "aud",
+			modify: func(c jwt.MapClaims) { c["aud"] = "other-client" }},
+		{name: "several audiences without azp", nonce: "nonce", wantErr: "authorized party",
+			modify: func(c jwt.MapClaims) { c["aud"] = []string{fake.ClientID, "other-client"} }},
+		{name: "several audiences with azp", nonce: "nonce", wantEmail: true,
+			modify: func(c jwt.MapClaims) {
+				c["aud"] = []string{fake.ClientID, "other-client"}
+				c["azp"] = fake.ClientID
+			}},
+		{name: "other issuer", nonce: "nonce", wantErr: "iss",
+			modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "expired", nonce: "nonce", wantErr: "expired",
+			modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "no expiry", nonce: "nonce", wantErr: "exp",
+			modify: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "no subject", nonce: "nonce", wantErr: "subject",
+			modify: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{name: "signed with another key", nonce: "nonce", wantErr: "signature",
+			sign: func(c jwt.MapClaims) string { return testutil.SignIDToken(t, foreignKey, c) }},
+		{name: "unsigned", nonce: "nonce", wantErr: "signing method",
+			sign: func(c jwt.MapClaims) string {
+				token, _ := jwt.NewWithClaims(jwt.SigningMethodNone, c).SignedString(jwt.UnsafeAllowNoneSignatureType)
+				return token
+			}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := fake.Claims(user, "nonce")
+			if tt.modify != nil {
+				tt.modify(claims)
+			}
+			var token string
+			if tt.sign != nil {
+				token = tt.sign(claims)
+			} else {
+				token = fake.SignIDToken(t, claims)
+			}
+
+			identity, err := provider.VerifyIDToken(ctx, token, tt.nonce)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyIDToken: %v", err)
+			}
+			if identity.EmailVerified != tt.wantEmail {
+				t.Errorf("email verified = %v, want %v", identity.EmailVerified, tt.wantEmail)
+			}
+		})
+	}
+}
@@ -8,13 +8,9 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"os"
-	"strconv"
-)
+	"sync"
 
-const (
-	defaultModel       = "gpt-3.5-turbo"
-	defaultTemperature = 0.7
+	"github.com/cam-boltnote/go-ignite/internal/config"
 )
 
 // OpenAIClient handles communication with the OpenAI API
@@ -22,6 +18,7 @@ type OpenAIClient struct {
 	apiKey             string
 	httpClient         *http.Client
 	baseURL            string
+	mu                 sync.RWMutex // Guards the defaults, which change on config reload
 	defaultModel       string
 	defaultTemperature float32
 }
@@ -63,50 +60,42 @@ type ResponseFormat struct {
 }
 
 // NewOpenAIClient creates a new OpenAI client instance
-func NewOpenAIClient() (*OpenAIClient, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return nil, errors.New("OPENAI_API_KEY environment variable is not set")
+func NewOpenAIClient(cfg config.OpenAIConfig) (*OpenAIClient, error) {
+	if cfg.APIKey == "" {
+		return nil, errors.New("OPENAI_API_KEY is not set")
 	}
 
 	// Validate API key format (basic check)
-	if len(apiKey) < 20 {
+	if len(cfg.APIKey) < 20 {
 		return nil, errors.New("OPENAI_API_KEY appears to be invalid (too short)")
 	}
 
-	// Read default model from env or use constant
-	model := os.Getenv("OPENAI_DEFAULT_MODEL")
-	if model == "" {
-		model = defaultModel
-		log.Printf("Using default OpenAI model: %s", model)
-	} else {
-		log.Printf("Using configured OpenAI model: %s", model)
-	}
-
-	// Read default temperature from env or use constant
-	var temperature float32 = defaultTemperature
-	if tempStr := os.Getenv("OPENAI_DEFAULT_TEMPERATURE"); tempStr != "" {
-		if temp, err := strconv.ParseFloat(tempStr, 32); err == nil {
-			temperature = float32(temp)
-			log.Printf("Using configured OpenAI temperature: %f", temperature)
-		} else {
-			log.Printf("Error parsing OPENAI_DEFAULT_TEMPERATURE, using default: %f", defaultTemperature)
-		}
-	} else {
-		log.Printf("Using default OpenAI temperature: %f", temperature)
-	}
-
-	log.Printf("OpenAI client initialized successfully")
+	log.Printf("OpenAI client initialized successfully (model: %s, temperature: %f)", cfg.DefaultModel, cfg.DefaultTemperature)
 
 	return &OpenAIClient{
-		apiKey:             apiKey,
+		apiKey:             cfg.APIKey,
 		httpClient:         &http.Client{},
 		baseURL:            "https://api.openai.com/v1",
-		defaultModel:       model,
-		defaultTemperature: temperature,
+		defaultModel:       cfg.DefaultModel,
+		defaultTemperature: cfg.DefaultTemperature,
 	}, nil
 }
 
+// ApplyConfig applies a reloaded configuration's default model and temperature
+func (c *OpenAIClient) ApplyConfig(cfg *config.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.defaultModel = cfg.OpenAI.DefaultModel
+	c.defaultTemperature = cfg.OpenAI.DefaultTemperature
+}
+
+// defaults returns the model and temperature used when a request doesn't set them
+func (c *OpenAIClient) defaults() (string, float32) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.defaultModel, c.defaultTemperature
+}
+
 // CreateChatCompletion sends a chat completion request to the OpenAI API
 func (c *OpenAIClient) CreateChatCompletion(messages []ChatMessage, model string, temperature float32) (*ChatCompletionResponse, error) {
 	if model == "" {
@@ -159,11 +148,11 @@ func (c *OpenAIClient) CreateChatCompletion(messages []ChatMessage, model string
 func (c *OpenAIClient) CreateUnstructuredChatCompletion(messages []ChatMessage, model string, temperature *float32) (*ChatCompletionResponse, error) {
 	// Use default model if not provided
 	if model == "" {
-		model = c.defaultModel
+		model, _ = c.defaults()
 	}
 
 	// Use default temperature if not provided
-	temp := c.defaultTemperature
+	_, temp := c.defaults()
 	if temperature != nil {
 		temp = *temperature
 	}
@@ -229,12 +218,12 @@ func (c *OpenAIClient) CreateStructuredChatCompletion(messages []ChatMessage, mo
 
 	// Use default model if not provided
 	if model == "" {
-		model = c.defaultModel
+		model, _ = c.defaults()
 		log.Printf("Using default model for structured completion: %s", model)
 	}
 
 	// Use default temperature if not provided
-	temp := c.defaultTemperature
+	_, temp := c.defaults()
 	if temperature != nil {
 		temp = *temperature
 		log.Printf("Using provided temperature for structured completion: %f", temp)
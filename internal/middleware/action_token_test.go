@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/models"
+)
+
+func TestValidateActionToken(t *testing.T) {
+	setTestKeyManager(t)
+
+	magicLink, err := GenerateActionTokenWithData(PurposeMagicLink, 7, "ada@example.com", map[string]string{"link_id": "abc"}, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateActionTokenWithData: %v", err)
+	}
+	expired, _ := GenerateActionToken(PurposeMagicLink, 7, "ada@example.com", -time.Minute)
+	access, err := GenerateToken(&models.User{BaseModel: models.BaseModel{ID: 7}, Email: "ada@example.com", Role: RoleUser}, 1)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		purpose string
+		token   string
+		wantErr bool
+	}{
+		{"matching purpose", PurposeMagicLink, magicLink, false},
+		{"other purpose", PurposeEmailVerification, magicLink, true},
+		{"expired", PurposeMagicLink, expired, true},
+		{"access token", PurposeMagicLink, access, true},
+		{"garbage", PurposeMagicLink, "not-a-token", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ValidateActionToken(tt.purpose, tt.token)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("ValidateActionToken accepted the token")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateActionToken: %v", err)
+			}
+			if claims.UserID != 7 || claims.Email != "ada@example.com" || claims.Data["link_id"] != "abc" {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestActionTokenIsNotAnAccessToken(t *testing.T) {
+	setTestKeyManager(t)
+
+	for _, purpose := range []string{PurposeEmailVerification, PurposeMFALogin, PurposeOIDCState, PurposeOrgInvitation, PurposeMagicLink} {
+		token, err := GenerateActionToken(purpose, 7, "ada@example.com", time.Minute)
+		if err != nil {
+			t.Fatalf("GenerateActionToken: %v", err)
+		}
+		if _, err := validateToken(token); err == nil {
+			t.Errorf("a %s token was accepted as an access token", purpose)
+		}
+	}
+}
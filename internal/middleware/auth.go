@@ -1,58 +1,157 @@
 package middleware
 
 import (
-	"github.com/cam-boltnote/go-ignite/internal/models"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
+	"github.com/cam-boltnote/go-ignite/internal/config"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey = []byte(os.Getenv("JWT_SECRET_KEY"))
+// defaultAccessTokenTTL is used until Configure is called
+const defaultAccessTokenTTL = 15 * time.Minute
+
+var (
+	accessTokenTTL = defaultAccessTokenTTL
+	encryptionKey  string // Base64 AES-256 key for EncryptPassword and DecryptPassword
+)
+
+// Configure applies the token and encryption settings and loads the JWT keys
+// and RBAC policy. The server must not start if this fails.
+func Configure(cfg *config.Config) error {
+	if err := InitKeys(cfg.JWT); err != nil {
+		return err
+	}
+	if cfg.Security.RBACPolicyFile != "" {
+		policy, err := LoadRolePermissions(cfg.Security.RBACPolicyFile)
+		if err != nil {
+			return err
+		}
+		SetRolePermissions(policy)
+	}
+
+	accessTokenTTL = cfg.JWT.AccessTokenTTL
+	encryptionKey = cfg.Security.EncryptionKey
+	ApplyConfig(cfg)
+	return nil
+}
+
+// ApplyConfig applies the settings the middleware can change without a
+// restart; subscribe it to the config store
+func ApplyConfig(cfg *config.Config) {
+	SetCORSOrigins(cfg.Server.CORSOrigins)
+}
 
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
+	UserID    uint   `json:"user_id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	SessionID uint   `json:"sid,omitempty"`      // Session the token was issued for
+	ActorID   uint   `json:"actor_id,omitempty"` // Admin impersonating the user, if any
+	// IssuedAtMs is the issue time in Unix milliseconds; iat only has whole
+	// seconds, too coarse to tell a token issued right after a revocation from
+	// one issued before it
+	IssuedAtMs int64 `json:"iat_ms,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(user *models.User) (string, error) {
+// TokenRevocationChecker reports whether an otherwise valid access token has been revoked
+type TokenRevocationChecker interface {
+	IsTokenRevoked(ctx context.Context, claims *Claims) (bool, error)
+}
+
+// APIKeyHeader is the request header carrying a personal API key
+const APIKeyHeader = "X-API-Key"
+
+// ErrInvalidAPIKey is returned by an APIKeyAuthenticator for unknown, expired or revoked keys
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// APIKeyPrincipal is the user an API key acts as, limited to the key's scopes
+type APIKeyPrincipal struct {
+	KeyID  uint
+	UserID uint
+	Email  string
+	Role   string
+	Scopes []string
+}
+
+// APIKeyAuthenticator resolves the user behind an API key
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (*APIKeyPrincipal, error)
+}
+
+// AuthOptions configures AuthMiddleware. Both checks are optional so the API can
+// run without a database; API keys are rejected when APIKeys is nil.
+type AuthOptions struct {
+	Revocations TokenRevocationChecker
+	APIKeys     APIKeyAuthenticator
+}
+
+// AccessTokenTTL returns the lifetime of access tokens
+func AccessTokenTTL() time.Duration {
+	return accessTokenTTL
+}
+
+// GenerateToken signs an access token for the user within the given session
+func GenerateToken(user *models.User, sessionID uint) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
 	// Create claims with user data and expiration time
+	now := time.Now()
 	claims := &Claims{
-		UserID: user.ID,
-		Email:  user.Email,
+		UserID:     user.ID,
+		Email:      user.Email,
+		Role:       user.Role,
+		SessionID:  sessionID,
+		IssuedAtMs: now.UnixMilli(),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL())),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	// Generate token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	// Sign token with the active signing key
+	km, err := getKeyManager()
 	if err != nil {
 		return "", err
 	}
 
-	return tokenString, nil
+	return km.Sign(claims)
 }
 
-func validateToken(tokenString string) (*Claims, error) {
-	claims := &Claims{}
+// newTokenID returns a random identifier for the jti claim
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token ID: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
+func validateToken(tokenString string) (*Claims, error) {
+	km, err := getKeyManager()
+	if err != nil {
+		return nil, err
+	}
 
+	claims := &Claims{}
+	token, err := km.Parse(tokenString, claims)
 	if err != nil {
 		return nil, err
 	}
@@ -61,11 +160,24 @@ func validateToken(tokenString string) (*Claims, error) {
 		return nil, errors.New("invalid token")
 	}
 
+	// Action tokens carry an audience; they must never grant API access
+	if len(claims.Audience) > 0 {
+		return nil, errors.New("token is not an access token")
+	}
+
 	return claims, nil
 }
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware authenticates the request with either a Bearer access token or
+// an API key in the X-API-Key header. Both set the same context values (user_id,
+// email and role) so handlers don't need to know which was used.
+func AuthMiddleware(opts AuthOptions) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if apiKey := c.GetHeader(APIKeyHeader); apiKey != "" {
+			authenticateAPIKey(c, opts.APIKeys, apiKey)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
@@ -88,18 +200,79 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if opts.Revocations != nil {
+			revoked, err := opts.Revocations.IsTokenRevoked(c.Request.Context(), claims)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error validating token"})
+				c.Abort()
+				return
+			}
+			if revoked {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+				c.Abort()
+				return
+			}
+		}
+
 		// Set user claims in context
 		c.Set("user_id", claims.UserID)
 		c.Set("email", claims.Email)
+		c.Set("role", claims.Role)
+		c.Set("claims", claims)
+		if claims.ActorID != 0 {
+			setImpersonationContext(c, claims)
+		}
+		setAuditActor(c)
+		c.Next()
+	}
+}
+
+// authenticateAPIKey resolves an API key and sets the same context values as a
+// Bearer token, plus the key's ID and scopes
+func authenticateAPIKey(c *gin.Context, apiKeys APIKeyAuthenticator, key string) {
+	if apiKeys == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API keys are not available"})
+		c.Abort()
+		return
+	}
+
+	principal, err := apiKeys.AuthenticateAPIKey(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, ErrInvalidAPIKey) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error validating API key"})
+		}
+		c.Abort()
+		return
+	}
+
+	c.Set("user_id", principal.UserID)
+	c.Set("email", principal.Email)
+	c.Set("role", principal.Role)
+	c.Set("api_key_id", principal.KeyID)
+	c.Set("scopes", principal.Scopes)
+	setAuditActor(c)
+	c.Next()
+}
+
+// RequireTokenAuth aborts with 403 when the request was authenticated with an
+// API key. Use it for operations that manage credentials or the session.
+func RequireTokenAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("api_key_id"); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This operation requires signing in; API keys are not accepted"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
 
 // DecryptPassword decrypts an encrypted password using AES-256 encryption
 func DecryptPassword(encryptedPassword string) (string, error) {
-	// Get encryption key from environment and decode from base64
-	encodedKey := os.Getenv("ENCRYPTION_KEY")
-	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	// Decode the configured encryption key from base64
+	key, err := base64.StdEncoding.DecodeString(encryptionKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to decode base64 key: %v", err)
 	}
@@ -139,14 +312,12 @@ func DecryptPassword(encryptedPassword string) (string, error) {
 
 // EncryptPassword encrypts a password using AES-256 encryption
 func EncryptPassword(password string) (string, error) {
-	// Get encryption key from environment and decode from base64
-	encodedKey := os.Getenv("ENCRYPTION_KEY")
-	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	// Decode the configured encryption key from base64
+	key, err := base64.StdEncoding.DecodeString(encryptionKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to decode base64 key: %v", err)
 	}
 
-	fmt.Printf("Key length: %d bytes\n", len(key)) // Debug line
 	if len(key) != 32 {
 		return "", fmt.Errorf("encryption key must be 32 bytes for AES-256 (got %d bytes)", len(key))
 	}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeAPIKeys authenticates a single key
+type fakeAPIKeys struct {
+	key       string
+	principal APIKeyPrincipal
+}
+
+func (f fakeAPIKeys) AuthenticateAPIKey(_ context.Context, key string) (*APIKeyPrincipal, error) {
+	switch key {
+	case f.key:
+		return &f.principal, nil
+	case "broken":
+		return nil, errors.New("database is down")
+	}
+	return nil, ErrInvalidAPIKey
+}
+
+func TestAuthMiddlewareAPIKeyScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	apiKeys := fakeAPIKeys{
+		key:       "ign_abc.secret",
+		principal: APIKeyPrincipal{KeyID: 3, UserID: 7, Role: RoleModerator, Scopes: []string{PermUsersRead}},
+	}
+	router := gin.New()
+	api := router.Group("", AuthMiddleware(AuthOptions{APIKeys: apiKeys}))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	api.GET("/me", RequirePermission(PermUsersRead), ok)
+	api.GET("/users", RequirePermission(PermUsersReadAny), ok)
+	api.POST("/logout", RequireTokenAuth(), ok)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		key    string
+		want   int
+	}{
+		{"permission in scope", http.MethodGet, "/me", apiKeys.key, http.StatusOK},
+		{"role grants it but the key doesn't", http.MethodGet, "/users", apiKeys.key, http.StatusForbidden},
+		{"signed-in only route", http.MethodPost, "/logout", apiKeys.key, http.StatusForbidden},
+		{"invalid key", http.MethodGet, "/me", "ign_abc.wrong", http.StatusUnauthorized},
+		{"authenticator failure", http.MethodGet, "/me", "broken", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set(APIKeyHeader, tt.key)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareWithoutAPIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/me", AuthMiddleware(AuthOptions{}), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set(APIKeyHeader, "ign_abc.secret")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
@@ -2,22 +2,55 @@ package middleware
 
 import (
 	"net/http"
+	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 )
 
-// CORSMiddleware adds headers to allow all origins for CORS
+var (
+	corsOrigins   []string
+	corsOriginsMu sync.RWMutex
+)
+
+// SetCORSOrigins limits cross-origin requests to the given origins. An empty
+// list allows every origin.
+func SetCORSOrigins(origins []string) {
+	corsOriginsMu.Lock()
+	defer corsOriginsMu.Unlock()
+	corsOrigins = origins
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for a request
+// from origin, or "" if the origin isn't allowed
+func allowedOrigin(origin string) string {
+	if origin == "" {
+		return "*"
+	}
+
+	corsOriginsMu.RLock()
+	defer corsOriginsMu.RUnlock()
+	if len(corsOrigins) == 0 {
+		return origin
+	}
+	for _, allowed := range corsOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// CORSMiddleware adds headers to allow the configured origins (all by default) for CORS
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		origin := c.GetHeader("Origin")
-		if origin == "" {
-			origin = "*"
+		if origin := allowedOrigin(c.GetHeader("Origin")); origin != "" {
+			c.Header("Access-Control-Allow-Origin", origin)
 		}
-
-		c.Header("Access-Control-Allow-Origin", origin)
 		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, Access-Control-Allow-Methods, Access-Control-Allow-Headers, Access-Control-Allow-Origin")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, X-Organization-ID, X-Request-ID, X-Read-Your-Writes, accept, origin, Cache-Control, X-Requested-With, Access-Control-Allow-Methods, Access-Control-Allow-Headers, Access-Control-Allow-Origin")
 		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Header("Access-Control-Expose-Headers", ImpersonationHeader+", "+RequestIDHeader)
 		c.Header("Access-Control-Max-Age", "86400") // 24 hours
 
 		if c.Request.Method == "OPTIONS" {
@@ -31,14 +64,11 @@ func CORSMiddleware() gin.HandlerFunc {
 }
 
 func CorsOptionsHandler(c *gin.Context) {
-	origin := c.GetHeader("Origin")
-	if origin == "" {
-		origin = "*"
+	if origin := allowedOrigin(c.GetHeader("Origin")); origin != "" {
+		c.Header("Access-Control-Allow-Origin", origin)
 	}
-
-	c.Header("Access-Control-Allow-Origin", origin)
 	c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, Access-Control-Allow-Methods, Access-Control-Allow-Headers, Access-Control-Allow-Origin")
+	c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, X-Organization-ID, X-Request-ID, X-Read-Your-Writes, accept, origin, Cache-Control, X-Requested-With, Access-Control-Allow-Methods, Access-Control-Allow-Headers, Access-Control-Allow-Origin")
 	c.Header("Access-Control-Allow-Credentials", "true")
 	c.Header("Access-Control-Max-Age", "86400")
 
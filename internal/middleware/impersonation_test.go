@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeAuditor records the requests it is given
+type fakeAuditor struct {
+	requests []string
+	actorIDs []uint
+}
+
+func (f *fakeAuditor) RecordImpersonatedRequest(_ context.Context, claims *Claims, method, path string, status int) {
+	f.requests = append(f.requests, method+" "+path)
+	f.actorIDs = append(f.actorIDs, claims.ActorID)
+}
+
+func TestGenerateImpersonationToken(t *testing.T) {
+	setTestKeyManager(t)
+
+	target := &models.User{BaseModel: models.BaseModel{ID: 7}, Email: "ada@example.com", Role: RoleUser}
+	token, claims, err := GenerateImpersonationToken(target, 3, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateImpersonationToken: %v", err)
+	}
+
+	parsed, err := validateToken(token)
+	if err != nil {
+		t.Fatalf("validateToken: %v", err)
+	}
+	if parsed.UserID != 7 || parsed.ActorID != 3 || parsed.Role != RoleUser {
+		t.Errorf("user %d, actor %d, role %q, want 7, 3 and user", parsed.UserID, parsed.ActorID, parsed.Role)
+	}
+	if parsed.SessionID != 0 {
+		t.Errorf("session = %d, want none so the token can't be refreshed", parsed.SessionID)
+	}
+	if parsed.ID == "" || parsed.ID != claims.ID {
+		t.Errorf("jti = %q, want %q", parsed.ID, claims.ID)
+	}
+	if ttl := time.Until(parsed.ExpiresAt.Time); ttl > time.Minute || ttl < 58*time.Second {
+		t.Errorf("expires in %v, want a minute", ttl)
+	}
+}
+
+func TestImpersonationMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setTestKeyManager(t)
+
+	target := &models.User{BaseModel: models.BaseModel{ID: 7}, Email: "ada@example.com", Role: RoleUser}
+	impersonation, _, err := GenerateImpersonationToken(target, 3, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateImpersonationToken: %v", err)
+	}
+	regular, err := GenerateToken(target, 1)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	auditor := &fakeAuditor{}
+	router := gin.New()
+	api := router.Group("", AuthMiddleware(AuthOptions{}), AuditImpersonation(auditor))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	api.GET("/me", ok)
+	api.PUT("/me", ok)
+	api.PUT("/me/password", BlockImpersonation(), ok)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		token       string
+		want        int
+		wantHeader  string
+		wantAudited bool
+	}{
+		{"read while impersonating", http.MethodGet, "/me", impersonation, http.StatusOK, "3", false},
+		{"update while impersonating", http.MethodPut, "/me", impersonation, http.StatusOK, "3", true},
+		{"sensitive route while impersonating", http.MethodPut, "/me/password", impersonation, http.StatusForbidden, "3", true},
+		{"update as the user", http.MethodPut, "/me", regular, http.StatusOK, "", false},
+		{"sensitive route as the user", http.MethodPut, "/me/password", regular, http.StatusOK, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditor.requests, auditor.actorIDs = nil, nil
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if header := rec.Header().Get(ImpersonationHeader); header != tt.wantHeader {
+				t.Errorf("%s = %q, want %q", ImpersonationHeader, header, tt.wantHeader)
+			}
+			if audited := len(auditor.requests) > 0; audited != tt.wantAudited {
+				t.Fatalf("audited %v, want %v", auditor.requests, tt.wantAudited)
+			}
+			if tt.wantAudited && (auditor.requests[0] != tt.method+" "+tt.path || auditor.actorIDs[0] != 3) {
+				t.Errorf("audited %v by %v, want %s %s by 3", auditor.requests, auditor.actorIDs, tt.method, tt.path)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms supported by the key manager
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// minRSAKeyBits is the smallest RSA key accepted for signing or verification
+const minRSAKeyBits = 2048
+
+// ErrKeysNotLoaded is returned when tokens are signed or verified before InitKeys
+var ErrKeysNotLoaded = errors.New("JWT signing keys have not been loaded")
+
+// verificationKey is a public key that tokens may be verified against
+type verificationKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	publicKey crypto.PublicKey
+}
+
+// KeyManager signs tokens with a single active private key and verifies them
+// against every configured public key, selected by the kid header. Keeping the
+// previous key in the verification set allows signing keys to be rotated
+// without invalidating tokens that are still in flight.
+type KeyManager struct {
+	signingKID    string
+	signingMethod jwt.SigningMethod
+	signingKey    crypto.Signer
+	keys          map[string]*verificationKey
+	order         []string // kids in load order, so the JWKS output is stable
+}
+
+// NewKeyManager creates a key manager from a PEM-encoded private signing key and
+// any number of PEM-encoded verification keys (public or private)
+func NewKeyManager(signingKeyPEM []byte, verificationKeyPEMs ...[]byte) (*KeyManager, error) {
+	signer, err := parsePrivateKey(signingKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: %v", err)
+	}
+
+	km := &KeyManager{
+		signingKey: signer,
+		keys:       make(map[string]*verificationKey),
+	}
+
+	signing, err := km.addVerificationKey(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: %v", err)
+	}
+	km.signingKID = signing.kid
+	km.signingMethod = signing.method
+
+	for i, keyPEM := range verificationKeyPEMs {
+		publicKey, err := parsePublicKey(keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("invalid verification key %d: %v", i+1, err)
+		}
+		if _, err := km.addVerificationKey(publicKey); err != nil {
+			return nil, fmt.Errorf("invalid verification key %d: %v", i+1, err)
+		}
+	}
+
+	return km, nil
+}
+
+// LoadKeyManager reads the signing key and verification keys from PEM files
+func LoadKeyManager(signingKeyFile string, verificationKeyFiles []string) (*KeyManager, error) {
+	if signingKeyFile == "" {
+		return nil, errors.New("no JWT signing key configured; set JWT_SIGNING_KEY_FILE (generate one with `go run cmd/main.go keygen`)")
+	}
+
+	signingKeyPEM, err := os.ReadFile(signingKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT signing key: %v", err)
+	}
+
+	var verificationKeyPEMs [][]byte
+	for _, path := range verificationKeyFiles {
+		keyPEM, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT verification key %s: %v", path, err)
+		}
+		verificationKeyPEMs = append(verificationKeyPEMs, keyPEM)
+	}
+
+	return NewKeyManager(signingKeyPEM, verificationKeyPEMs...)
+}
+
+// SigningKID returns the kid of the active signing key
+func (km *KeyManager) SigningKID() string {
+	return km.signingKID
+}
+
+// Sign signs the claims with the active signing key and sets the kid header
+func (km *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(km.signingMethod, claims)
+	token.Header["kid"] = km.signingKID
+	return token.SignedString(km.signingKey)
+}
+
+// Parse verifies a token against the key named by its kid header
+func (km *KeyManager) Parse(tokenString string, claims jwt.Claims, options ...jwt.ParserOption) (*jwt.Token, error) {
+	options = append(options, jwt.WithValidMethods([]string{AlgRS256, AlgEdDSA}))
+	return jwt.ParseWithClaims(tokenString, claims, km.keyFunc, options...)
+}
+
+// keyFunc resolves the verification key for a token and checks that the token's
+// algorithm is the one the key was issued for
+func (km *KeyManager) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+
+	key, ok := km.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+	}
+	return key.publicKey, nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served from /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns every verification key as a JWK set
+func (km *KeyManager) JWKS() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(km.order))}
+	for _, kid := range km.order {
+		key := km.keys[kid]
+		jwk := publicJWK(key.publicKey)
+		jwk.Use = "sig"
+		jwk.Alg = key.method.Alg()
+		jwk.Kid = kid
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// addVerificationKey registers a public key under its RFC 7638 thumbprint
+func (km *KeyManager) addVerificationKey(publicKey crypto.PublicKey) (*verificationKey, error) {
+	var method jwt.SigningMethod
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA keys must be at least %d bits", minRSAKeyBits)
+		}
+		method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T; use RSA or Ed25519", publicKey)
+	}
+
+	kid, err := keyThumbprint(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing, ok := km.keys[kid]; ok {
+		return existing, nil
+	}
+
+	key := &verificationKey{kid: kid, method: method, publicKey: publicKey}
+	km.keys[kid] = key
+	km.order = append(km.order, kid)
+	return key, nil
+}
+
+// publicJWK returns the key-type specific JWK members of a public key
+func publicJWK(publicKey crypto.PublicKey) JWK {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}
+	}
+	return JWK{}
+}
+
+// keyThumbprint computes the RFC 7638 JWK thumbprint used as the key's kid
+func keyThumbprint(publicKey crypto.PublicKey) (string, error) {
+	jwk := publicJWK(publicKey)
+
+	// The required members in lexicographic order, with no whitespace
+	var members string
+	switch jwk.Kty {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	case "OKP":
+		members = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, jwk.Crv, jwk.X)
+	default:
+		return "", fmt.Errorf("unsupported key type %T", publicKey)
+	}
+
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// parsePrivateKey decodes a PEM-encoded PKCS#8 or PKCS#1 private key
+func parsePrivateKey(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// parsePublicKey decodes a PEM-encoded public key. A private key is also accepted,
+// in which case only its public half is used.
+func parsePublicKey(keyPEM []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		signer, err := parsePrivateKey(keyPEM)
+		if err != nil {
+			return nil, err
+		}
+		return signer.Public(), nil
+	}
+}
+
+// GenerateSigningKey creates a new private key for the algorithm and returns it
+// PEM-encoded together with its public key and kid
+func GenerateSigningKey(alg string) (privatePEM, publicPEM []byte, kid string, err error) {
+	var signer crypto.Signer
+	switch alg {
+	case AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	case AlgRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 3072)
+	default:
+		return nil, nil, "", fmt.Errorf("unsupported algorithm %q; use %s or %s", alg, AlgEdDSA, AlgRS256)
+	}
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to generate key: %v", err)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, nil, "", err
+	}
+	kid, err = keyThumbprint(signer.Public())
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	privatePEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})
+	publicPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	return privatePEM, publicPEM, kid, nil
+}
+
+var (
+	keyManager   *KeyManager
+	keyManagerMu sync.RWMutex
+)
+
+// InitKeys loads the key manager from the configured signing and verification
+// key files. The server must not start if this fails.
+func InitKeys(cfg config.JWTConfig) error {
+	km, err := LoadKeyManager(cfg.SigningKeyFile, cfg.VerificationKeyFiles)
+	if err != nil {
+		return err
+	}
+
+	SetKeyManager(km)
+	return nil
+}
+
+// SetKeyManager replaces the key manager used to sign and verify tokens
+func SetKeyManager(km *KeyManager) {
+	keyManagerMu.Lock()
+	defer keyManagerMu.Unlock()
+	keyManager = km
+}
+
+// getKeyManager returns the active key manager or ErrKeysNotLoaded
+func getKeyManager() (*KeyManager, error) {
+	keyManagerMu.RLock()
+	defer keyManagerMu.RUnlock()
+	if keyManager == nil {
+		return nil, ErrKeysNotLoaded
+	}
+	return keyManager, nil
+}
+
+// JWKSHandler serves the public verification keys so other services can verify tokens
+func JWKSHandler(c *gin.Context) {
+	km, err := getKeyManager()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	body, err := json.Marshal(km.JWKS())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Data(http.StatusOK, "application/jwk-set+json", body)
+}
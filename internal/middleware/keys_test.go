@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// generateTestKey returns a new PEM-encoded private key, its public key and kid
+func generateTestKey(t *testing.T, alg string) (privatePEM, publicPEM []byte, kid string) {
+	t.Helper()
+
+	privatePEM, publicPEM, kid, err := GenerateSigningKey(alg)
+	if err != nil {
+		t.Fatalf("GenerateSigningKey(%s): %v", alg, err)
+	}
+	return privatePEM, publicPEM, kid
+}
+
+// setTestKeyManager installs a key manager with a new EdDSA key for the test
+func setTestKeyManager(t *testing.T) *KeyManager {
+	t.Helper()
+
+	privatePEM, _, _ := generateTestKey(t, AlgEdDSA)
+	km, err := NewKeyManager(privatePEM)
+	if err != nil {
+		t.Fatalf("NewKeyManager: %v", err)
+	}
+	previous, _ := getKeyManager()
+	SetKeyManager(km)
+	t.Cleanup(func() { SetKeyManager(previous) })
+	return km
+}
+
+func testClaims() *Claims {
+	return &Claims{
+		UserID: 7,
+		Role:   RoleUser,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+}
+
+func TestKeyManagerSignAndParse(t *testing.T) {
+	for _, alg := range []string{AlgEdDSA, AlgRS256} {
+		t.Run(alg, func(t *testing.T) {
+			privatePEM, _, kid := generateTestKey(t, alg)
+			km, err := NewKeyManager(privatePEM)
+			if err != nil {
+				t.Fatalf("NewKeyManager: %v", err)
+			}
+			if km.SigningKID() != kid {
+				t.Errorf("SigningKID = %s, want %s", km.SigningKID(), kid)
+			}
+
+			signed, err := km.Sign(testClaims())
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			claims := &Claims{}
+			token, err := km.Parse(signed, claims)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if token.Header["kid"] != kid || token.Method.Alg() != alg || claims.UserID != 7 {
+				t.Errorf("parsed kid %v, alg %s, user %d", token.Header["kid"], token.Method.Alg(), claims.UserID)
+			}
+
+			jwks := km.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != kid || jwks.Keys[0].Alg != alg || jwks.Keys[0].Use != "sig" {
+				t.Errorf("JWKS = %+v, want the signing key", jwks)
+			}
+		})
+	}
+}
+
+func TestKeyManagerRotation(t *testing.T) {
+	oldPrivate, oldPublic, oldKID := generateTestKey(t, AlgEdDSA)
+	newPrivate, _, newKID := generateTestKey(t, AlgEdDSA)
+
+	before, err := NewKeyManager(oldPrivate)
+	if err != nil {
+		t.Fatalf("NewKeyManager: %v", err)
+	}
+	inFlight, err := before.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	// The new key signs; the old one is kept for verification only
+	rotated, err := NewKeyManager(newPrivate, oldPublic)
+	if err != nil {
+		t.Fatalf("NewKeyManager: %v", err)
+	}
+	if _, err := rotated.Parse(inFlight, &Claims{}); err != nil {
+		t.Errorf("token from the previous key: %v", err)
+	}
+	signed, _ := rotated.Sign(testClaims())
+	if token, _ := rotated.Parse(signed, &Claims{}); token == nil || token.Header["kid"] != newKID {
+		t.Error("new tokens aren't signed with the new key")
+	}
+	jwks := rotated.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != newKID || jwks.Keys[1].Kid != oldKID {
+		t.Errorf("JWKS kids = %+v, want %s then %s", jwks.Keys, newKID, oldKID)
+	}
+
+	// Once the old key is retired its tokens are rejected
+	retired, err := NewKeyManager(newPrivate)
+	if err != nil {
+		t.Fatalf("NewKeyManager: %v", err)
+	}
+	if _, err := retired.Parse(inFlight, &Claims{}); err == nil {
+		t.Error("a token from a retired key was accepted")
+	}
+}
+
+func TestKeyManagerRejectsForgedTokens(t *testing.T) {
+	rsaPrivate, rsaPublic, rsaKID := generateTestKey(t, AlgRS256)
+	km, err := NewKeyManager(rsaPrivate)
+	if err != nil {
+		t.Fatalf("NewKeyManager: %v", err)
+	}
+	otherPrivate, _, _ := generateTestKey(t, AlgRS256)
+	other, _ := NewKeyManager(otherPrivate)
+
+	sign := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, testClaims())
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return signed
+	}
+	valid, _ := km.Sign(testClaims())
+	parts := strings.Split(valid, ".")
+	tamperedClaims, _ := json.Marshal(map[string]interface{}{"user_id": 1, "role": RoleAdmin, "exp": time.Now().Add(time.Hour).Unix()})
+	otherSigned, _ := other.Sign(testClaims())
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"no kid", sign(jwt.SigningMethodHS256, "", []byte("secret"))},
+		{"unknown kid", otherSigned},
+		{"HMAC with the public key as secret", sign(jwt.SigningMethodHS256, rsaKID, rsaPublic)},
+		{"alg none", sign(jwt.SigningMethodNone, rsaKID, jwt.UnsafeAllowNoneSignatureType)},
+		{"tampered claims", parts[0] + "." + base64.RawURLEncoding.EncodeToString(tamperedClaims) + "." + parts[2]},
+		{"other key under our kid", strings.Join(append(strings.Split(otherSigned, ".")[:2], parts[2]), ".")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := km.Parse(tt.token, &Claims{}); err == nil {
+				t.Error("Parse accepted the token")
+			}
+		})
+	}
+}
+
+func TestNewKeyManagerRejectsKeys(t *testing.T) {
+	weakRSA, _ := rsa.GenerateKey(rand.Reader, 1024)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encode := func(key interface{}) []byte {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatalf("marshal key: %v", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+	validPrivate, _, _ := generateTestKey(t, AlgEdDSA)
+
+	tests := []struct {
+		name         string
+		signing      []byte
+		verification []byte
+		wantErr      string
+	}{
+		{"not PEM", []byte("not a key"), nil, "no PEM data"},
+		{"short RSA key", encode(weakRSA), nil, "at least 2048 bits"},
+		{"ECDSA key", encode(ecKey), nil, "unsupported key type"},
+		{"short RSA verification key", validPrivate, encode(weakRSA), "verification key 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var verification [][]byte
+			if tt.verification != nil {
+				verification = append(verification, tt.verification)
+			}
+			_, err := NewKeyManager(tt.signing, verification...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWKSHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	km := setTestKeyManager(t)
+
+	router := gin.New()
+	router.GET("/.well-known/jwks.json", JWKSHandler)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/jwk-set+json" {
+		t.Fatalf("status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var jwks JWKSet
+	if err := json.Unmarshal(rec.Body.Bytes(), &jwks); err != nil {
+		t.Fatalf("decode JWKS: %v", err)
+	}
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != km.SigningKID() || jwks.Keys[0].Kty != "OKP" || jwks.Keys[0].X == "" {
+		t.Errorf("JWKS = %+v", jwks)
+	}
+}
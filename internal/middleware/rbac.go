@@ -0,0 +1,252 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Built-in roles
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// ErrUserNotFound is returned by a RoleResolver when the user doesn't exist
+var ErrUserNotFound = errors.New("user not found")
+
+// RoleResolver looks up a user's role
+type RoleResolver interface {
+	UserRole(ctx context.Context, userID uint) (string, error)
+}
+
+// Permissions checked by RequirePermission. A role may also be granted "*" for
+// every permission or "<resource>:*" for every permission on a resource.
+// The "_any" permissions extend a permission from the user's own resources to everyone's.
+const (
+	PermUsersRead         = "users:read"
+	PermUsersReadAny      = "users:read_any"
+	PermUsersUpdate       = "users:update"
+	PermUsersUpdateAny    = "users:update_any"
+	PermUsersDelete       = "users:delete"
+	PermUsersActivate     = "users:activate"
+	PermUsersManageRoles  = "users:manage_roles"
+	PermUsersImpersonate  = "users:impersonate"
+	PermSettingsRead      = "settings:read"
+	PermSettingsReadAny   = "settings:read_any"
+	PermSettingsUpdate    = "settings:update"
+	PermSettingsUpdateAny = "settings:update_any"
+	PermAPIKeysManage     = "api_keys:manage"
+	PermOrgsManage        = "orgs:manage"
+	PermAuditRead         = "audit:read"
+	PermConfigRead        = "config:read"
+)
+
+// defaultRolePermissions is used unless the security.rbac_policy_file setting points to a policy
+var defaultRolePermissions = map[string][]string{
+	RoleUser: {
+		PermUsersRead,
+		PermUsersUpdate,
+		PermSettingsRead,
+		PermSettingsUpdate,
+		PermAPIKeysManage,
+		PermOrgsManage,
+	},
+	RoleModerator: {
+		PermUsersRead,
+		PermUsersReadAny,
+		PermUsersUpdate,
+		PermUsersActivate,
+		PermSettingsRead,
+		PermSettingsUpdate,
+		PermAPIKeysManage,
+		PermOrgsManage,
+	},
+	RoleAdmin: {"*"},
+}
+
+var (
+	rolePermissions   = defaultRolePermissions
+	rolePermissionsMu sync.RWMutex
+)
+
+// LoadRolePermissions reads a role policy from a JSON file mapping each role to
+// its permissions, e.g. {"user": ["users:read"], "admin": ["*"]}
+func LoadRolePermissions(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RBAC policy file: %v", err)
+	}
+
+	var policy map[string][]string
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse RBAC policy file: %v", err)
+	}
+	if len(policy) == 0 {
+		return nil, fmt.Errorf("RBAC policy file %s defines no roles", path)
+	}
+	return policy, nil
+}
+
+// SetRolePermissions replaces the active role policy
+func SetRolePermissions(policy map[string][]string) {
+	rolePermissionsMu.Lock()
+	defer rolePermissionsMu.Unlock()
+	rolePermissions = policy
+}
+
+// getRolePermissions returns the active role policy
+func getRolePermissions() map[string][]string {
+	rolePermissionsMu.RLock()
+	defer rolePermissionsMu.RUnlock()
+	return rolePermissions
+}
+
+// RoleRank orders the built-in roles so they can be compared; other roles rank lowest
+func RoleRank(role string) int {
+	switch role {
+	case RoleAdmin:
+		return 3
+	case RoleModerator:
+		return 2
+	case RoleUser:
+		return 1
+	}
+	return 0
+}
+
+// IsKnownRole reports whether the role is defined in the active policy
+func IsKnownRole(role string) bool {
+	_, ok := getRolePermissions()[role]
+	return ok
+}
+
+// HasPermission reports whether the role is granted the permission
+func HasPermission(role, permission string) bool {
+	return grants(getRolePermissions()[role], permission)
+}
+
+// grants reports whether the permission is in the list, directly or through a wildcard
+func grants(granted []string, permission string) bool {
+	resource, _, _ := strings.Cut(permission, ":")
+	for _, g := range granted {
+		if g == "*" || g == permission || g == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// contextHasPermission reports whether the authenticated request may use the
+// permission. Requests made with an API key are limited to the intersection of
+// the user's role and the key's scopes.
+func contextHasPermission(c *gin.Context, permission string) bool {
+	if !HasPermission(c.GetString("role"), permission) {
+		return false
+	}
+	if scopes, ok := c.Get("scopes"); ok {
+		return grants(scopes.([]string), permission)
+	}
+	return true
+}
+
+// RequireRole aborts with 403 unless the authenticated user has one of the roles
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient role"})
+		c.Abort()
+	}
+}
+
+// RequirePermission aborts with 403 unless the authenticated user's role grants every permission
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, permission := range permissions {
+			if !contextHasPermission(c, permission) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// RequireSelfOrPermission aborts with 403 unless the user ID in the path parameter
+// is the authenticated user's, or the user's role grants the permission
+func RequireSelfOrPermission(param, permission string) gin.HandlerFunc {
+	return requireSelfOr(func(c *gin.Context) bool {
+		id, err := strconv.ParseUint(c.Param(param), 10, 32)
+		return err == nil && uint(id) == c.GetUint("user_id")
+	}, permission)
+}
+
+// RequireSelfEmailOrPermission aborts with 403 unless the email in the path parameter
+// is the authenticated user's, or the user's role grants the permission
+func RequireSelfEmailOrPermission(param, permission string) gin.HandlerFunc {
+	return requireSelfOr(func(c *gin.Context) bool {
+		return strings.EqualFold(c.Param(param), c.GetString("email"))
+	}, permission)
+}
+
+func requireSelfOr(isSelf func(c *gin.Context) bool, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isSelf(c) || contextHasPermission(c, permission) {
+			c.Next()
+			return
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only access your own resources"})
+		c.Abort()
+	}
+}
+
+// RequireLowerRole aborts with 403 unless the user whose ID is in the path
+// parameter has a role ranking strictly below the authenticated user's, so a
+// permission to manage users can't be used on peers or superiors
+func RequireLowerRole(resolver RoleResolver, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param(param), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			c.Abort()
+			return
+		}
+
+		role, err := resolver.UserRole(c.Request.Context(), uint(id))
+		if err != nil {
+			if errors.Is(err, ErrUserNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error resolving user role"})
+			}
+			c.Abort()
+			return
+		}
+
+		if RoleRank(role) >= RoleRank(c.GetString("role")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only manage users with a lower role"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeRoleResolver resolves roles from a map of user ID to role
+type fakeRoleResolver map[uint]string
+
+func (f fakeRoleResolver) UserRole(_ context.Context, userID uint) (string, error) {
+	if userID == 99 {
+		return "", errors.New("database is down")
+	}
+	role, ok := f[userID]
+	if !ok {
+		return "", ErrUserNotFound
+	}
+	return role, nil
+}
+
+func TestRequireLowerRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	users := fakeRoleResolver{1: RoleUser, 2: RoleModerator, 3: RoleAdmin, 4: "support"}
+
+	tests := []struct {
+		name   string
+		role   string
+		target string
+		want   int
+	}{
+		{"moderator on user", RoleModerator, "1", http.StatusOK},
+		{"moderator on moderator", RoleModerator, "2", http.StatusForbidden},
+		{"moderator on admin", RoleModerator, "3", http.StatusForbidden},
+		{"moderator on custom role", RoleModerator, "4", http.StatusOK},
+		{"admin on moderator", RoleAdmin, "2", http.StatusOK},
+		{"admin on admin", RoleAdmin, "3", http.StatusForbidden},
+		{"user on user", RoleUser, "1", http.StatusForbidden},
+		{"custom role on user", "support", "1", http.StatusForbidden},
+		{"custom role on custom role", "support", "4", http.StatusForbidden},
+		{"unknown user", RoleAdmin, "42", http.StatusNotFound},
+		{"invalid ID", RoleAdmin, "abc", http.StatusBadRequest},
+		{"resolver failure", RoleAdmin, "99", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.PUT("/user/:id/deactivate", func(c *gin.Context) {
+				c.Set("role", tt.role)
+			}, RequireLowerRole(users, "id"), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/user/"+tt.target+"/deactivate", nil))
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		role       string
+		scopes     []string
+		permission string
+		want       int
+	}{
+		{"user reads own", RoleUser, nil, PermUsersRead, http.StatusOK},
+		{"user reads any", RoleUser, nil, PermUsersReadAny, http.StatusForbidden},
+		{"moderator activates", RoleModerator, nil, PermUsersActivate, http.StatusOK},
+		{"moderator manages roles", RoleModerator, nil, PermUsersManageRoles, http.StatusForbidden},
+		{"admin wildcard", RoleAdmin, nil, PermUsersManageRoles, http.StatusOK},
+		{"unknown role", "ghost", nil, PermUsersRead, http.StatusForbidden},
+		{"no role", "", nil, PermUsersRead, http.StatusForbidden},
+		{"key scope grants", RoleAdmin, []string{PermUsersRead}, PermUsersRead, http.StatusOK},
+		{"key scope limits admin", RoleAdmin, []string{PermUsersRead}, PermUsersDelete, http.StatusForbidden},
+		{"key resource wildcard", RoleAdmin, []string{"users:*"}, PermUsersDelete, http.StatusOK},
+		{"key can't exceed role", RoleUser, []string{"*"}, PermUsersDelete, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", func(c *gin.Context) {
+				c.Set("role", tt.role)
+				if tt.scopes != nil {
+					c.Set("scopes", tt.scopes)
+				}
+			}, RequirePermission(tt.permission), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireSelfOrPermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		role   string
+		scopes []string
+		target string
+		want   int
+	}{
+		{"self", RoleUser, nil, "7", http.StatusOK},
+		{"someone else", RoleUser, nil, "8", http.StatusForbidden},
+		{"someone else with read_any", RoleModerator, nil, "8", http.StatusOK},
+		{"someone else with a key lacking read_any", RoleModerator, []string{PermUsersRead}, "8", http.StatusForbidden},
+		{"self with a narrow key", RoleUser, []string{PermSettingsRead}, "7", http.StatusOK},
+		{"invalid ID", RoleUser, nil, "7abc", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/user/:id", func(c *gin.Context) {
+				c.Set("role", tt.role)
+				c.Set("user_id", uint(7))
+				if tt.scopes != nil {
+					c.Set("scopes", tt.scopes)
+				}
+			}, RequireSelfOrPermission("id", PermUsersReadAny), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/user/"+tt.target, nil))
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireSelfEmailOrPermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		role   string
+		target string
+		want   int
+	}{
+		{"own email", RoleUser, "ada@example.com", http.StatusOK},
+		{"own email in another case", RoleUser, "Ada@Example.com", http.StatusOK},
+		{"someone else's email", RoleUser, "bob@example.com", http.StatusForbidden},
+		{"someone else's email with read_any", RoleModerator, "bob@example.com", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/user/email/:email", func(c *gin.Context) {
+				c.Set("role", tt.role)
+				c.Set("email", "ada@example.com")
+			}, RequireSelfEmailOrPermission("email", PermUsersReadAny), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/user/email/"+tt.target, nil))
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReadYourWritesHeader lets a client send a read to the primary database, e.g.
+// right after a write whose result it needs to see
+const ReadYourWritesHeader = "X-Read-Your-Writes"
+
+// ReadYourWrites sends the reads of a request to the primary instead of a read
+// replica when the request changes data, so it reads back its own writes, or
+// when the client sets X-Read-Your-Writes to true. Only queries made with the
+// request's context are affected.
+func ReadYourWrites() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		primary, _ := strconv.ParseBool(c.GetHeader(ReadYourWritesHeader))
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			primary = true
+		}
+
+		if primary {
+			c.Request = c.Request.WithContext(connectors.ReadFromPrimary(c.Request.Context()))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/cam-boltnote/go-ignite/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the ID that ties a request to its log lines and audit events
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits the request IDs accepted from clients or proxies
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID assigns every request an ID, reusing a well-formed X-Request-ID from
+// the client or a proxy, and echoes it in the response. It also starts the audit
+// actor of the request, which AuthMiddleware completes once the caller is known.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			var err error
+			if requestID, err = newTokenID(); err != nil {
+				requestID = ""
+			}
+		}
+
+		c.Set("request_id", requestID)
+		c.Header(RequestIDHeader, requestID)
+		setAuditActor(c)
+		c.Next()
+	}
+}
+
+// setAuditActor attributes changes made while handling the request to the
+// caller, as far as it is known at this point
+func setAuditActor(c *gin.Context) {
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+
+	c.Request = c.Request.WithContext(models.WithAuditActor(c.Request.Context(), models.AuditActor{
+		UserID:         c.GetUint("user_id"),
+		ImpersonatorID: c.GetUint("actor_id"),
+		APIKeyID:       c.GetUint("api_key_id"),
+		IP:             c.ClientIP(),
+		UserAgent:      userAgent,
+		RequestID:      c.GetString("request_id"),
+	}))
+}
@@ -0,0 +1,222 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// The baseline creates the schema the application had before versioned
+// migrations. It uses copies of the models as they were then, so later changes
+// to the models don't change what it creates. Databases already created by
+// AutoMigrate are left as they are.
+func init() {
+	Register(Migration{
+		Version: 20261016000001,
+		Name:    "baseline",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(baselineModels()...)
+		},
+		Down: func(tx *gorm.DB) error {
+			models := baselineModels()
+			for i := len(models) - 1; i >= 0; i-- {
+				if err := tx.Migrator().DropTable(models[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// baselineModels returns the baseline tables in dependency order. The types
+// keep the names of the models they copy because GORM derives table, index
+// and constraint names from them.
+func baselineModels() []interface{} {
+	type BaseModel struct {
+		ID        uint `gorm:"primarykey"`
+		CreatedAt time.Time
+		UpdatedAt time.Time
+		DeletedAt gorm.DeletedAt `gorm:"index"`
+	}
+	type User struct {
+		BaseModel
+		Email           string `gorm:"unique;not null"`
+		FirstName       string
+		LastName        string
+		Password        string `gorm:"not null"`
+		IsActive        bool   `gorm:"default:true"`
+		Role            string `gorm:"default:'user'"`
+		EmailVerifiedAt *time.Time
+		PendingEmail    *string `gorm:"size:255"`
+		MFAEnabled      bool    `gorm:"default:false"`
+		MFASecret       string
+		MFALastUsedStep int64
+		TokensRevokedAt *time.Time
+	}
+	type Settings struct {
+		BaseModel
+		UserID                    uint   `gorm:"uniqueIndex;not null"`
+		User                      User   `gorm:"constraint:OnDelete:CASCADE;"`
+		Timezone                  string `gorm:"default:'UTC'"`
+		Language                  string `gorm:"default:'en'"`
+		Theme                     string `gorm:"default:'light'"`
+		EmailNotificationsEnabled bool   `gorm:"default:true"`
+		PushNotificationsEnabled  bool   `gorm:"default:true"`
+		NotificationFrequency     string `gorm:"default:'daily'"`
+		ProfileVisibility         string `gorm:"default:'private'"`
+		DataSharing               bool   `gorm:"default:false"`
+		PasswordlessOnly          bool   `gorm:"default:false"`
+		CustomSettings            baselineJSON
+	}
+	type RefreshToken struct {
+		BaseModel
+		UserID       uint      `gorm:"index;not null"`
+		User         User      `gorm:"constraint:OnDelete:CASCADE;"`
+		TokenHash    string    `gorm:"size:64;uniqueIndex;not null"`
+		FamilyID     string    `gorm:"size:64;index;not null"`
+		ExpiresAt    time.Time `gorm:"not null"`
+		RevokedAt    *time.Time
+		ReplacedByID *uint
+	}
+	type RevokedToken struct {
+		BaseModel
+		JTI       string    `gorm:"size:64;uniqueIndex;not null"`
+		UserID    uint      `gorm:"index;not null"`
+		ExpiresAt time.Time `gorm:"index;not null"`
+	}
+	type PasswordResetToken struct {
+		BaseModel
+		UserID    uint      `gorm:"index;not null"`
+		User      User      `gorm:"constraint:OnDelete:CASCADE;"`
+		TokenHash string    `gorm:"size:64;uniqueIndex;not null"`
+		ExpiresAt time.Time `gorm:"not null"`
+		UsedAt    *time.Time
+	}
+	type MFARecoveryCode struct {
+		BaseModel
+		UserID   uint   `gorm:"index;not null"`
+		User     User   `gorm:"constraint:OnDelete:CASCADE;"`
+		CodeHash string `gorm:"size:64;not null"`
+		UsedAt   *time.Time
+	}
+	type APIKey struct {
+		BaseModel
+		UserID     uint     `gorm:"index;not null"`
+		User       User     `gorm:"constraint:OnDelete:CASCADE;"`
+		Name       string   `gorm:"size:100;not null"`
+		Prefix     string   `gorm:"size:32;uniqueIndex;not null"`
+		SecretHash string   `gorm:"size:64;not null"`
+		Scopes     []string `gorm:"serializer:json"`
+		ExpiresAt  *time.Time
+		LastUsedAt *time.Time
+		RevokedAt  *time.Time
+	}
+	type UserIdentity struct {
+		BaseModel
+		UserID   uint   `gorm:"index;not null"`
+		User     User   `gorm:"constraint:OnDelete:CASCADE;"`
+		Provider string `gorm:"size:64;not null;uniqueIndex:idx_identity_provider_subject"`
+		Subject  string `gorm:"size:255;not null;uniqueIndex:idx_identity_provider_subject"`
+		Email    string `gorm:"size:255"`
+	}
+	type LoginThrottle struct {
+		BaseModel
+		Key           string    `gorm:"column:throttle_key;size:320;uniqueIndex;not null"`
+		Failures      int       `gorm:"not null;default:0"`
+		LastFailureAt time.Time `gorm:"index"`
+		LockedUntil   *time.Time
+	}
+	type Session struct {
+		BaseModel
+		UserID     uint   `gorm:"index;not null"`
+		User       User   `gorm:"constraint:OnDelete:CASCADE;"`
+		FamilyID   string `gorm:"size:64;uniqueIndex;not null"`
+		Method     string `gorm:"size:64"`
+		UserAgent  string `gorm:"size:512"`
+		IP         string `gorm:"size:45"`
+		LastSeenAt time.Time
+		RevokedAt  *time.Time
+	}
+	type AuditEvent struct {
+		ID             uint      `gorm:"primarykey"`
+		CreatedAt      time.Time `gorm:"index"`
+		ActorID        *uint     `gorm:"index"`
+		ImpersonatorID *uint
+		APIKeyID       *uint
+		Action         string                 `gorm:"size:64;index;not null"`
+		TargetType     string                 `gorm:"size:64;index:idx_audit_target"`
+		TargetID       string                 `gorm:"size:64;index:idx_audit_target"`
+		Changes        map[string]interface{} `gorm:"serializer:json"`
+		Metadata       map[string]interface{} `gorm:"serializer:json"`
+		IP             string                 `gorm:"size:45"`
+		UserAgent      string                 `gorm:"size:512"`
+		RequestID      string                 `gorm:"size:64;index"`
+		PrevHash       string                 `gorm:"size:64"`
+		Hash           string                 `gorm:"size:64"`
+	}
+	type Organization struct {
+		BaseModel
+		Name string `gorm:"size:100;not null"`
+		Slug string `gorm:"size:100;uniqueIndex;not null"`
+	}
+	type Membership struct {
+		BaseModel
+		OrganizationID uint         `gorm:"uniqueIndex:idx_membership_org_user;not null"`
+		Organization   Organization `gorm:"constraint:OnDelete:CASCADE;"`
+		UserID         uint         `gorm:"uniqueIndex:idx_membership_org_user;index;not null"`
+		User           User         `gorm:"constraint:OnDelete:CASCADE;"`
+		Role           string       `gorm:"size:16;not null"`
+	}
+	type Invitation struct {
+		BaseModel
+		OrganizationID uint         `gorm:"index;not null"`
+		Organization   Organization `gorm:"constraint:OnDelete:CASCADE;"`
+		Email          string       `gorm:"size:255;index;not null"`
+		Role           string       `gorm:"size:16;not null"`
+		InvitedByID    uint         `gorm:"not null"`
+		ExpiresAt      time.Time    `gorm:"not null"`
+		AcceptedAt     *time.Time
+	}
+	type MagicLink struct {
+		BaseModel
+		Email     string    `gorm:"size:255;index;not null"`
+		UserID    *uint     `gorm:"index"`
+		LinkID    string    `gorm:"size:64;index"`
+		ExpiresAt time.Time `gorm:"not null"`
+		UsedAt    *time.Time
+	}
+
+	return []interface{}{
+		&User{},
+		&Settings{},
+		&RefreshToken{},
+		&RevokedToken{},
+		&PasswordResetToken{},
+		&MFARecoveryCode{},
+		&APIKey{},
+		&UserIdentity{},
+		&LoginThrottle{},
+		&Session{},
+		&AuditEvent{},
+		&Organization{},
+		&Membership{},
+		&Invitation{},
+		&MagicLink{},
+	}
+}
+
+// baselineJSON gives JSON columns the type models.JSONMap had at the time
+type baselineJSON map[string]interface{}
+
+func (baselineJSON) GormDataType() string {
+	return "json"
+}
+
+func (baselineJSON) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	if db.Dialector.Name() == "postgres" {
+		return "JSONB"
+	}
+	return "JSON"
+}
@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// outbox_messages holds side effects, such as signup emails, queued in the
+// transaction of the change that causes them
+func init() {
+	Register(Migration{
+		Version: 20261016000003,
+		Name:    "outbox_messages",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(outboxMessageModel())
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(outboxMessageModel())
+		},
+	})
+}
+
+// outboxMessageModel returns a copy of models.OutboxMessage as this migration
+// creates it
+func outboxMessageModel() interface{} {
+	type OutboxMessage struct {
+		ID          uint `gorm:"primarykey"`
+		CreatedAt   time.Time
+		UpdatedAt   time.Time
+		DeletedAt   gorm.DeletedAt `gorm:"index"`
+		Topic       string         `gorm:"size:64;not null"`
+		Payload     baselineJSON
+		Attempts    int        `gorm:"not null;default:0"`
+		AvailableAt time.Time  `gorm:"index;not null"`
+		SentAt      *time.Time `gorm:"index"`
+		LastError   string     `gorm:"size:1024"`
+	}
+	return &OutboxMessage{}
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// users.verification_sent_at throttles how often a user can have their
+// verification link re-sent
+func init() {
+	Register(Migration{
+		Version: 20261016000004,
+		Name:    "users_verification_sent_at",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(verificationSentAtModel(), "VerificationSentAt")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(verificationSentAtModel(), "VerificationSentAt")
+		},
+	})
+}
+
+// verificationSentAtModel returns the column this migration adds to users
+func verificationSentAtModel() interface{} {
+	type User struct {
+		VerificationSentAt *time.Time
+	}
+	return &User{}
+}
@@ -0,0 +1,226 @@
+// Package migrations holds the versioned database schema changes and applies
+// them in order. Migrations are either Go functions registered from this
+// package, which can check tx.Dialector.Name() where databases differ, or
+// pairs of SQL files embedded from the sql directory; both are
+// identified by a version, which by convention is the UTC time they were
+// created at (YYYYMMDDHHMMSS), so migrations written on different branches
+// don't collide.
+package migrations
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Migration is one versioned change to the database schema
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       func(tx *gorm.DB) error
+	Down     func(tx *gorm.DB) error // Nil when the migration can't be rolled back
+	Checksum string                  // SHA-256 of the up SQL run on this dialect; empty for Go migrations, which aren't verified
+}
+
+//go:embed sql/*.sql
+var sqlFiles embed.FS
+
+// sqlFileName matches "<version>_<name>[.<dialect>].<up|down>.sql"
+var sqlFileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+?)(?:\.(mysql|postgres|sqlite))?\.(up|down)\.sql$`)
+
+// registered holds the Go migrations added by Register
+var registered []Migration
+
+// Register adds a Go migration. Call it from an init function in this package.
+func Register(m Migration) {
+	registered = append(registered, m)
+}
+
+// All returns every migration, Go and SQL, ordered by version. SQL files
+// written for a specific dialect replace the generic file of the same
+// migration on that dialect, e.g. 0002_x.mysql.down.sql over 0002_x.down.sql
+// on MySQL.
+func All(dialect string) ([]Migration, error) {
+	sqlMigrations, err := loadSQL(sqlFiles, "sql", dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	all := append(append([]Migration(nil), registered...), sqlMigrations...)
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+
+	for i, m := range all {
+		if m.Version <= 0 || m.Name == "" || m.Up == nil {
+			return nil, fmt.Errorf("migration %d_%s needs a positive version, a name and an Up function", m.Version, m.Name)
+		}
+		if i > 0 && all[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", all[i-1].Name, m.Name, m.Version)
+		}
+	}
+	return all, nil
+}
+
+// sqlSource collects the files of one SQL migration
+type sqlSource struct {
+	name     string
+	up, down []byte
+	// Whether up and down were written for the dialect rather than generic
+	upDialect, downDialect bool
+}
+
+// loadSQL reads the SQL migrations in dir for dialect. Each needs an up file;
+// the down file is optional.
+func loadSQL(files fs.FS, dir, dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(map[int64]*sqlSource)
+	var versions []int64
+	for _, entry := range entries {
+		match := sqlFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file %s isn't named <version>_<name>[.<dialect>].<up|down>.sql", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration file %s: invalid version: %v", entry.Name(), err)
+		}
+
+		source, ok := sources[version]
+		if !ok {
+			source = &sqlSource{name: match[2]}
+			sources[version] = source
+			versions = append(versions, version)
+		} else if source.name != match[2] {
+			return nil, fmt.Errorf("migration files %d_%s and %s share a version", version, source.name, entry.Name())
+		}
+
+		fileDialect, direction := match[3], match[4]
+		if fileDialect != "" && fileDialect != dialect {
+			continue
+		}
+		data, err := fs.ReadFile(files, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case direction == "up" && (fileDialect != "" || !source.upDialect):
+			source.up, source.upDialect = data, fileDialect != ""
+		case direction == "down" && (fileDialect != "" || !source.downDialect):
+			source.down, source.downDialect = data, fileDialect != ""
+		}
+	}
+
+	migrations := make([]Migration, 0, len(versions))
+	for _, version := range versions {
+		source := sources[version]
+		if source.up == nil {
+			return nil, fmt.Errorf("migration %d_%s has no up file for %s", version, source.name, dialect)
+		}
+
+		m := Migration{Version: version, Name: source.name}
+		statements, err := splitStatements(string(source.up))
+		if err != nil {
+			return nil, fmt.Errorf("migration %d_%s: %v", version, source.name, err)
+		}
+		m.Up = execStatements(statements)
+		sum := sha256.Sum256(source.up)
+		m.Checksum = hex.EncodeToString(sum[:])
+
+		if source.down != nil {
+			statements, err := splitStatements(string(source.down))
+			if err != nil {
+				return nil, fmt.Errorf("migration %d_%s: %v", version, source.name, err)
+			}
+			m.Down = execStatements(statements)
+		}
+		migrations = append(migrations, m)
+	}
+	return migrations, nil
+}
+
+// execStatements returns a migration function running statements in order
+func execStatements(statements []string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// splitStatements splits a SQL script on the semicolons ending its statements.
+// Semicolons inside quotes, backticks and comments don't end a statement, and
+// comments are dropped. Drivers run one statement per call, so the script
+// can't be sent as it is.
+func splitStatements(script string) ([]string, error) {
+	var statements []string
+	var current strings.Builder
+	flush := func() {
+		if statement := strings.TrimSpace(current.String()); statement != "" {
+			statements = append(statements, statement)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := i + 1
+			for ; end < len(script); end++ {
+				if script[end] == '\\' && c != '`' {
+					end++
+					continue
+				}
+				if script[end] == c {
+					// A doubled quote is an escaped quote
+					if end+1 < len(script) && script[end+1] == c {
+						end++
+						continue
+					}
+					break
+				}
+			}
+			if end >= len(script) {
+				return nil, fmt.Errorf("unterminated %c quote", c)
+			}
+			current.WriteString(script[i : end+1])
+			i = end
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end
+				current.WriteByte('\n')
+			}
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated /* comment")
+			}
+			i += end + 3
+			current.WriteByte(' ')
+		case c == ';':
+			flush()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	flush()
+	return statements, nil
+}
@@ -0,0 +1,140 @@
+package migrations
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gorm.io/gorm"
+)
+
+func TestLoadSQL(t *testing.T) {
+	// Each down file creates a table named after itself, showing which one ran
+	files := fstest.MapFS{
+		"sql/0002_index.up.sql":         {Data: []byte("CREATE TABLE up_ran (id INTEGER);")},
+		"sql/0002_index.down.sql":       {Data: []byte("CREATE TABLE generic_down (id INTEGER);")},
+		"sql/0002_index.mysql.down.sql": {Data: []byte("CREATE TABLE mysql_down (id INTEGER);")},
+		"sql/0003_seed.up.sql":          {Data: []byte("SELECT 1;")},
+	}
+
+	tests := []struct {
+		name     string
+		dialect  string
+		wantDown string
+	}{
+		{"generic files", "sqlite", "generic_down"},
+		{"dialect file replaces the generic one", "mysql", "mysql_down"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := loadSQL(files, "sql", tt.dialect)
+			if err != nil {
+				t.Fatalf("loadSQL: %v", err)
+			}
+			if len(migrations) != 2 || migrations[0].Version != 2 || migrations[0].Name != "index" || migrations[1].Version != 3 {
+				t.Fatalf("migrations = %+v, want 0002_index and 0003_seed", migrations)
+			}
+			if migrations[0].Checksum == "" || migrations[0].Checksum == migrations[1].Checksum {
+				t.Errorf("checksums %q and %q", migrations[0].Checksum, migrations[1].Checksum)
+			}
+			if migrations[1].Down != nil {
+				t.Error("0003_seed has no down file but can be rolled back")
+			}
+
+			db := openTestDB(t)
+			if err := migrations[0].Down(db); err != nil {
+				t.Fatalf("Down: %v", err)
+			}
+			if !db.Migrator().HasTable(tt.wantDown) {
+				t.Errorf("%s didn't run", tt.wantDown)
+			}
+		})
+	}
+}
+
+func TestLoadSQLErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		wantErr string
+	}{
+		{
+			name:    "badly named file",
+			files:   fstest.MapFS{"sql/0001_Create Users.up.sql": {Data: []byte("SELECT 1;")}},
+			wantErr: "isn't named",
+		},
+		{
+			name: "two names for one version",
+			files: fstest.MapFS{
+				"sql/0001_users.up.sql":  {Data: []byte("SELECT 1;")},
+				"sql/0001_orders.up.sql": {Data: []byte("SELECT 1;")},
+			},
+			wantErr: "share a version",
+		},
+		{
+			name:    "no up file",
+			files:   fstest.MapFS{"sql/0001_users.down.sql": {Data: []byte("SELECT 1;")}},
+			wantErr: "has no up file",
+		},
+		{
+			name:    "up file only for another dialect",
+			files:   fstest.MapFS{"sql/0001_users.mysql.up.sql": {Data: []byte("SELECT 1;")}},
+			wantErr: "has no up file for sqlite",
+		},
+		{
+			name:    "unterminated quote",
+			files:   fstest.MapFS{"sql/0001_users.up.sql": {Data: []byte("INSERT INTO t VALUES ('a);")}},
+			wantErr: "unterminated",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadSQL(tt.files, "sql", "sqlite")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"one statement", "SELECT 1;", []string{"SELECT 1"}},
+		{"no final semicolon", "SELECT 1; SELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"semicolon in quotes", "INSERT INTO t VALUES ('a;b', \"c;d\", `e;f`);", []string{"INSERT INTO t VALUES ('a;b', \"c;d\", `e;f`)"}},
+		{"escaped quotes", `INSERT INTO t VALUES ('it''s;', 'a\';b');`, []string{`INSERT INTO t VALUES ('it''s;', 'a\';b')`}},
+		{"line comment", "-- drop; this\nSELECT 1;", []string{"SELECT 1"}},
+		{"block comment", "SELECT /* a; b */ 1;", []string{"SELECT   1"}},
+		{"only comments", "-- nothing here;\n/* or here; */", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitStatements(tt.script)
+			if err != nil {
+				t.Fatalf("splitStatements: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("statements = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllSharedVersion(t *testing.T) {
+	saved := registered
+	t.Cleanup(func() { registered = saved })
+
+	noop := func(*gorm.DB) error { return nil }
+	Register(Migration{Version: registered[0].Version, Name: "duplicate", Up: noop})
+	if _, err := All("sqlite"); err == nil || !strings.Contains(err.Error(), "share version") {
+		t.Errorf("err = %v, want migrations sharing a version rejected", err)
+	}
+}
@@ -0,0 +1,300 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// lockName identifies the advisory lock held while migrating
+const lockName = "go_ignite_schema_migrations"
+
+// lockTimeout is how long a replica waits for another one to finish migrating
+const lockTimeout = 5 * time.Minute
+
+var (
+	// ErrSchemaBehind is returned by Check when migrations are pending
+	ErrSchemaBehind = errors.New("database schema is behind")
+	// ErrChecksumMismatch is returned when an applied SQL migration was edited afterwards
+	ErrChecksumMismatch = errors.New("applied migration was modified")
+	// ErrIrreversible is returned when rolling back a migration without a Down step
+	ErrIrreversible = errors.New("migration can't be rolled back")
+	// ErrLocked is returned when another process holds the migration lock for too long
+	ErrLocked = errors.New("timed out waiting for the migration lock")
+)
+
+// Migration states reported by Status
+const (
+	StatusApplied  = "applied"
+	StatusPending  = "pending"
+	StatusModified = "modified" // Applied, but the SQL has changed since
+	StatusUnknown  = "unknown"  // Applied, but not part of this build
+)
+
+// SchemaMigration records an applied migration
+type SchemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"size:255;not null"`
+	Checksum  string    `gorm:"size:64"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// MigrationStatus describes one migration and whether it has been applied
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Status    string
+	AppliedAt *time.Time
+}
+
+// Migrator applies and rolls back migrations
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// NewMigrator creates a migrator for every migration in this package
+func NewMigrator(db *gorm.DB) (*Migrator, error) {
+	migrations, err := All(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Up applies every pending migration in version order and returns how many
+// were applied. Each migration runs in its own transaction with the record of
+// it being applied, though MySQL commits schema changes immediately. Nothing
+// is applied while an applied migration has been modified.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	count := 0
+	err := m.withLock(ctx, func(db *gorm.DB) error {
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			log.Printf("Applying migration %d_%s", migration.Version, migration.Name)
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := migration.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&SchemaMigration{
+					Version:   migration.Version,
+					Name:      migration.Name,
+					Checksum:  migration.Checksum,
+					AppliedAt: time.Now().UTC(),
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down rolls back the last steps applied migrations, newest first, and
+// returns how many were rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	count := 0
+	err := m.withLock(ctx, func(db *gorm.DB) error {
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == nil {
+				return fmt.Errorf("%w: %d_%s", ErrIrreversible, migration.Version, migration.Name)
+			}
+			log.Printf("Rolling back migration %d_%s", migration.Version, migration.Name)
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := migration.Down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&SchemaMigration{}, migration.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("rolling back migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Status lists every known migration, and every applied one this build
+// doesn't know, ordered by version
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(m.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	known := make(map[int64]bool, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = true
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name, Status: StatusPending}
+		if record, ok := applied[migration.Version]; ok {
+			status.Status = StatusApplied
+			status.AppliedAt = &record.AppliedAt
+			if migration.Checksum != "" && record.Checksum != migration.Checksum {
+				status.Status = StatusModified
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	for version, record := range applied {
+		if !known[version] {
+			appliedAt := record.AppliedAt
+			statuses = append(statuses, MigrationStatus{Version: version, Name: record.Name, Status: StatusUnknown, AppliedAt: &appliedAt})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Check returns ErrSchemaBehind if any migration is pending and
+// ErrChecksumMismatch if an applied one was modified. Migrations applied by a
+// newer build are allowed, so older replicas keep running during a rollout.
+func (m *Migrator) Check(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, status := range statuses {
+		switch status.Status {
+		case StatusPending:
+			pending = append(pending, fmt.Sprintf("%d_%s", status.Version, status.Name))
+		case StatusModified:
+			return fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, status.Version, status.Name)
+		case StatusUnknown:
+			log.Printf("Warning: migration %d_%s is applied but unknown to this build", status.Version, status.Name)
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d pending migration(s), first %s", ErrSchemaBehind, len(pending), pending[0])
+	}
+	return nil
+}
+
+// applied returns the applied migrations by version. A database without the
+// schema_migrations table has none.
+func (m *Migrator) applied(db *gorm.DB) (map[int64]SchemaMigration, error) {
+	applied := make(map[int64]SchemaMigration)
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return applied, nil
+	}
+
+	var records []SchemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// verify returns ErrChecksumMismatch if an applied SQL migration was modified
+func (m *Migrator) verify(applied map[int64]SchemaMigration) error {
+	for _, migration := range m.migrations {
+		record, ok := applied[migration.Version]
+		if ok && migration.Checksum != "" && record.Checksum != migration.Checksum {
+			return fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, migration.Version, migration.Name)
+		}
+	}
+	return nil
+}
+
+// withLock runs fn on a single connection holding the migration lock, after
+// creating the schema_migrations table if needed. Other replicas wait for the
+// lock instead of applying the same migrations concurrently.
+func (m *Migrator) withLock(ctx context.Context, fn func(db *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		// Start every statement afresh; the connection's own instance would
+		// carry one statement's table into the next
+		conn = conn.Session(&gorm.Session{})
+
+		unlock, err := lock(conn)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		if err := conn.AutoMigrate(&SchemaMigration{}); err != nil {
+			return fmt.Errorf("failed to create the schema_migrations table: %w", err)
+		}
+		return fn(conn)
+	})
+}
+
+// lock takes the advisory lock on conn and returns the function releasing it
+func lock(conn *gorm.DB) (func(), error) {
+	switch dialect := conn.Dialector.Name(); dialect {
+	case "mysql":
+		var acquired *int
+		if err := conn.Raw("SELECT GET_LOCK(?, ?)", lockName, int(lockTimeout.Seconds())).Scan(&acquired).Error; err != nil {
+			return nil, fmt.Errorf("failed to take the migration lock: %w", err)
+		}
+		if acquired == nil || *acquired != 1 {
+			return nil, ErrLocked
+		}
+		return func() {
+			var released *int
+			if err := conn.Raw("SELECT RELEASE_LOCK(?)", lockName).Scan(&released).Error; err != nil {
+				log.Printf("Warning: failed to release the migration lock: %v", err)
+			}
+		}, nil
+	case "postgres":
+		// pg_advisory_lock waits without a timeout, so poll instead
+		deadline := time.Now().Add(lockTimeout)
+		for {
+			var acquired bool
+			if err := conn.Raw("SELECT pg_try_advisory_lock(hashtext(?))", lockName).Scan(&acquired).Error; err != nil {
+				return nil, fmt.Errorf("failed to take the migration lock: %w", err)
+			}
+			if acquired {
+				break
+			}
+			if time.Now().After(deadline) {
+				return nil, ErrLocked
+			}
+			time.Sleep(time.Second)
+		}
+		return func() {
+			var released bool
+			if err := conn.Raw("SELECT pg_advisory_unlock(hashtext(?))", lockName).Scan(&released).Error; err != nil {
+				log.Printf("Warning: failed to release the migration lock: %v", err)
+			}
+		}, nil
+	case "sqlite":
+		// A SQLite database belongs to one process, and SQLite serializes writes itself
+		return func() {}, nil
+	default:
+		return nil, fmt.Errorf("migrations don't support the %s database", dialect)
+	}
+}
@@ -0,0 +1,192 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// databases numbers the in-memory databases so each test gets its own
+var databases atomic.Int64
+
+// openTestDB returns a new, empty in-memory SQLite database. testutil.NewDB
+// can't be used here: it imports this package and migrates the database.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	database, err := connectors.NewDatabase(config.DatabaseConfig{
+		Driver: config.DriverSQLite,
+		Name:   fmt.Sprintf("file:migrations%d?mode=memory&cache=shared", databases.Add(1)),
+	})
+	if err != nil {
+		t.Fatalf("failed to open the test database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	db := database.GetDB()
+	return db.Session(&gorm.Session{Logger: db.Logger.LogMode(logger.Silent)})
+}
+
+// countStatuses counts the migrations in each state
+func countStatuses(t *testing.T, migrator *Migrator) map[string]int {
+	t.Helper()
+
+	statuses, err := migrator.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, status := range statuses {
+		counts[status.Status]++
+	}
+	return counts
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	db := openTestDB(t)
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	ctx := context.Background()
+	total := len(migrator.migrations)
+
+	if err := migrator.Check(ctx); !errors.Is(err, ErrSchemaBehind) {
+		t.Errorf("Check on an empty database: err = %v, want ErrSchemaBehind", err)
+	}
+
+	steps := []struct {
+		name        string
+		run         func() (int, error)
+		wantCount   int
+		wantApplied int
+		wantTables  bool
+	}{
+		{"up from empty", func() (int, error) { return migrator.Up(ctx) }, total, total, true},
+		{"up again", func() (int, error) { return migrator.Up(ctx) }, 0, total, true},
+		{"down one", func() (int, error) { return migrator.Down(ctx, 1) }, 1, total - 1, true},
+		{"down the rest", func() (int, error) { return migrator.Down(ctx, total) }, total - 1, 0, false},
+		{"down on an empty database", func() (int, error) { return migrator.Down(ctx, 1) }, 0, 0, false},
+		{"up after rolling back", func() (int, error) { return migrator.Up(ctx) }, total, total, true},
+	}
+
+	for _, step := range steps {
+		count, err := step.run()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if count != step.wantCount {
+			t.Errorf("%s: %d migrations run, want %d", step.name, count, step.wantCount)
+		}
+		counts := countStatuses(t, migrator)
+		if counts[StatusApplied] != step.wantApplied || counts[StatusPending] != total-step.wantApplied {
+			t.Errorf("%s: statuses %v, want %d applied", step.name, counts, step.wantApplied)
+		}
+		if hasUsers := db.Migrator().HasTable("users"); hasUsers != step.wantTables {
+			t.Errorf("%s: users table exists = %v, want %v", step.name, hasUsers, step.wantTables)
+		}
+	}
+
+	if err := migrator.Check(ctx); err != nil {
+		t.Errorf("Check after migrating: %v", err)
+	}
+}
+
+func TestMigratorChecks(t *testing.T) {
+	ctx := context.Background()
+	noop := func(*gorm.DB) error { return nil }
+
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T, db *gorm.DB, migrator *Migrator)
+		run        func(migrator *Migrator) error
+		wantErr    error
+		wantStatus string
+	}{
+		{
+			name: "modified migration",
+			setup: func(t *testing.T, db *gorm.DB, migrator *Migrator) {
+				db.Model(&SchemaMigration{}).Where("checksum <> ''").Update("checksum", "edited")
+			},
+			run:        func(m *Migrator) error { _, err := m.Up(ctx); return err },
+			wantErr:    ErrChecksumMismatch,
+			wantStatus: StatusModified,
+		},
+		{
+			name: "modified migration fails the check",
+			setup: func(t *testing.T, db *gorm.DB, migrator *Migrator) {
+				db.Model(&SchemaMigration{}).Where("checksum <> ''").Update("checksum", "edited")
+			},
+			run:        func(m *Migrator) error { return m.Check(ctx) },
+			wantErr:    ErrChecksumMismatch,
+			wantStatus: StatusModified,
+		},
+		{
+			name: "migration applied by a newer build",
+			setup: func(t *testing.T, db *gorm.DB, migrator *Migrator) {
+				db.Create(&SchemaMigration{Version: 99991231000000, Name: "from_the_future"})
+			},
+			run:        func(m *Migrator) error { return m.Check(ctx) },
+			wantStatus: StatusUnknown,
+		},
+		{
+			name: "irreversible migration",
+			setup: func(t *testing.T, db *gorm.DB, migrator *Migrator) {
+				migrator.migrations = append(migrator.migrations, Migration{Version: 99991231000000, Name: "one_way", Up: noop})
+				if _, err := migrator.Up(ctx); err != nil {
+					t.Fatalf("Up: %v", err)
+				}
+			},
+			run:        func(m *Migrator) error { _, err := m.Down(ctx, 1); return err },
+			wantErr:    ErrIrreversible,
+			wantStatus: StatusApplied,
+		},
+		{
+			name: "failed migration isn't recorded",
+			setup: func(t *testing.T, db *gorm.DB, migrator *Migrator) {
+				migrator.migrations = append(migrator.migrations, Migration{
+					Version: 99991231000000,
+					Name:    "broken",
+					Up:      func(tx *gorm.DB) error { return tx.Exec("CREATE TABLE users (id INTEGER)").Error },
+				})
+			},
+			run:        func(m *Migrator) error { _, err := m.Up(ctx); return err },
+			wantErr:    errors.New("migration 99991231000000_broken failed"),
+			wantStatus: StatusPending,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			migrator, err := NewMigrator(db)
+			if err != nil {
+				t.Fatalf("NewMigrator: %v", err)
+			}
+			if _, err := migrator.Up(ctx); err != nil {
+				t.Fatalf("Up: %v", err)
+			}
+			tt.setup(t, db, migrator)
+
+			err = tt.run(migrator)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Errorf("err = %v, want none", err)
+			case tt.wantErr != nil && err == nil:
+				t.Errorf("err = nil, want %v", tt.wantErr)
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr) && !strings.HasPrefix(err.Error(), tt.wantErr.Error()):
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if counts := countStatuses(t, migrator); counts[tt.wantStatus] == 0 {
+				t.Errorf("statuses %v, want one %s", counts, tt.wantStatus)
+			}
+		})
+	}
+}
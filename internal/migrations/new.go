@@ -0,0 +1,69 @@
+package migrations
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// migrationName matches the names migrations can be given
+var migrationName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+const goTemplate = `package migrations
+
+import "gorm.io/gorm"
+
+func init() {
+	Register(Migration{
+		Version: %s,
+		Name:    %q,
+		Up: func(tx *gorm.DB) error {
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return nil
+		},
+	})
+}
+`
+
+// Create writes the files of a new, empty migration to dir, the directory of
+// this package, and returns their paths. The migration is versioned with the
+// current UTC time. SQL migrations get an up and a down file in dir/sql; Go
+// migrations get a single file registering the migration.
+func Create(dir, name string, goMigration bool) ([]string, error) {
+	name = strings.ToLower(strings.NewReplacer(" ", "_", "-", "_").Replace(strings.TrimSpace(name)))
+	if !migrationName.MatchString(name) {
+		return nil, fmt.Errorf("migration name %q may only contain letters, digits and underscores", name)
+	}
+	version := time.Now().UTC().Format("20060102150405")
+
+	var paths, contents []string
+	if goMigration {
+		paths = []string{filepath.Join(dir, version+"_"+name+".go")}
+		contents = []string{fmt.Sprintf(goTemplate, version, name)}
+	} else {
+		base := filepath.Join(dir, "sql", version+"_"+name)
+		paths = []string{base + ".up.sql", base + ".down.sql"}
+		contents = []string{"-- " + name + "\n", "-- Undo " + name + "\n"}
+	}
+
+	for i, path := range paths {
+		// Never overwrite an existing migration
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		_, err = f.WriteString(contents[i])
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
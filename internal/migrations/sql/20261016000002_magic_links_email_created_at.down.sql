@@ -0,0 +1 @@
+DROP INDEX idx_magic_links_email_created_at;
@@ -0,0 +1,2 @@
+-- Serves the magic link rate limit, which counts an address's recent requests
+CREATE INDEX idx_magic_links_email_created_at ON magic_links (email, created_at);
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// APIKey is a long-lived credential that lets machine clients act as a user.
+// The key is shown once on creation as "<prefix>.<secret>"; only the prefix,
+// used for lookup, and a hash of the secret are stored.
+type APIKey struct {
+	BaseModel
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	User       User       `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Prefix     string     `gorm:"size:32;uniqueIndex;not null" json:"prefix"`
+	SecretHash string     `gorm:"size:64;not null" json:"-"`     // SHA-256 of the secret part
+	Scopes     []string   `gorm:"serializer:json" json:"scopes"` // Permissions the key is limited to
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`          // Never expires when nil
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Audit actions
+const (
+	AuditUserUpdate           = "user.update"
+	AuditUserDelete           = "user.delete"
+	AuditUserPasswordChange   = "user.password_change"
+	AuditUserRoleChange       = "user.role_change"
+	AuditUserActivate         = "user.activate"
+	AuditUserDeactivate       = "user.deactivate"
+	AuditSettingsUpdate       = "settings.update"
+	AuditImpersonationStart   = "impersonation.start"
+	AuditImpersonationEnd     = "impersonation.end"
+	AuditImpersonationRequest = "impersonation.request"
+)
+
+// ErrAuditEventImmutable is returned when updating or deleting an audit event
+var ErrAuditEventImmutable = errors.New("audit events can't be changed or deleted")
+
+// AuditEvent records a change: who made it, what it touched and how the record
+// differed before and after. Events are append-only; with hash chaining enabled
+// each event also carries the hash of the one before it, so editing or removing
+// an event is detectable.
+type AuditEvent struct {
+	ID             uint                   `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time              `gorm:"index" json:"created_at"`
+	ActorID        *uint                  `gorm:"index" json:"actor_id,omitempty"`      // User who made the change; nil for anonymous or system changes
+	ImpersonatorID *uint                  `json:"impersonator_id,omitempty"`            // Admin acting as the actor, if any
+	APIKeyID       *uint                  `json:"api_key_id,omitempty"`                 // API key the change was made with, if any
+	Action         string                 `gorm:"size:64;index;not null" json:"action"` // e.g. "user.update"
+	TargetType     string                 `gorm:"size:64;index:idx_audit_target" json:"target_type"`
+	TargetID       string                 `gorm:"size:64;index:idx_audit_target" json:"target_id"`
+	Changes        map[string]AuditChange `gorm:"serializer:json" json:"changes,omitempty"`
+	Metadata       map[string]interface{} `gorm:"serializer:json" json:"metadata,omitempty"`
+	IP             string                 `gorm:"size:45" json:"ip"`
+	UserAgent      string                 `gorm:"size:512" json:"user_agent"`
+	RequestID      string                 `gorm:"size:64;index" json:"request_id"`
+	PrevHash       string                 `gorm:"size:64" json:"prev_hash,omitempty"`
+	Hash           string                 `gorm:"size:64" json:"hash,omitempty"`
+}
+
+// AuditChange is the value of one field before and after a change
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// BeforeUpdate keeps audit events append-only
+func (AuditEvent) BeforeUpdate(*gorm.DB) error {
+	return ErrAuditEventImmutable
+}
+
+// BeforeDelete keeps audit events append-only
+func (AuditEvent) BeforeDelete(*gorm.DB) error {
+	return ErrAuditEventImmutable
+}
+
+// AuditActor describes who is making a request and from where
+type AuditActor struct {
+	UserID         uint
+	ImpersonatorID uint
+	APIKeyID       uint
+	IP             string
+	UserAgent      string
+	RequestID      string
+}
+
+type auditActorKey struct{}
+
+// WithAuditActor returns a context whose audited changes are attributed to the actor
+func WithAuditActor(ctx context.Context, actor AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// AuditActorFromContext returns the actor set with WithAuditActor
+func AuditActorFromContext(ctx context.Context) (AuditActor, bool) {
+	actor, ok := ctx.Value(auditActorKey{}).(AuditActor)
+	return actor, ok
+}
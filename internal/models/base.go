@@ -22,13 +22,16 @@ type PaginationParams struct {
 	Order    string `json:"order" query:"order"`
 }
 
-// PaginatedResponse provides a standard structure for paginated responses
+// PaginatedResponse provides a standard structure for paginated responses.
+// Lists paged by cursor have page 0 and next and previous cursors instead.
 type PaginatedResponse struct {
 	Data       interface{} `json:"data"`
 	Total      int64       `json:"total"`
 	Page       int         `json:"page"`
 	PageSize   int         `json:"page_size"`
 	TotalPages int         `json:"total_pages"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	PrevCursor string      `json:"prev_cursor,omitempty"`
 }
 
 // ErrorResponse provides a standard structure for error responses
@@ -0,0 +1,11 @@
+package models
+
+// UserIdentity links a user to an account at an external OpenID Connect provider
+type UserIdentity struct {
+	BaseModel
+	UserID   uint   `gorm:"index;not null" json:"user_id"`
+	User     User   `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	Provider string `gorm:"size:64;not null;uniqueIndex:idx_identity_provider_subject" json:"provider"`
+	Subject  string `gorm:"size:255;not null;uniqueIndex:idx_identity_provider_subject" json:"-"` // The provider's stable user ID (sub claim)
+	Email    string `gorm:"size:255" json:"email"`                                                // Email reported by the provider at last login
+}
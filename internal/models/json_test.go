@@ -0,0 +1,81 @@
+package models_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/testutil"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestJSONMapRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value models.JSONMap
+	}{
+		{"nil", nil},
+		{"empty", models.JSONMap{}},
+		{"nested", models.JSONMap{
+			"theme":  "dark",
+			"count":  float64(3),
+			"nested": map[string]interface{}{"enabled": true},
+			"list":   []interface{}{"a", "b"},
+		}},
+	}
+
+	db := testutil.NewDB(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &models.User{Email: tt.name + "@example.com", Password: "x"}
+			if err := db.Create(user).Error; err != nil {
+				t.Fatalf("create user: %v", err)
+			}
+			settings := &models.Settings{UserID: user.ID, CustomSettings: tt.value}
+			if err := db.Create(settings).Error; err != nil {
+				t.Fatalf("create settings: %v", err)
+			}
+
+			var loaded models.Settings
+			if err := db.First(&loaded, settings.ID).Error; err != nil {
+				t.Fatalf("load settings: %v", err)
+			}
+			if !reflect.DeepEqual(loaded.CustomSettings, tt.value) {
+				t.Errorf("custom settings = %#v, want %#v", loaded.CustomSettings, tt.value)
+			}
+		})
+	}
+}
+
+func TestJSONMapScanRejectsOtherTypes(t *testing.T) {
+	var m models.JSONMap
+	if err := m.Scan(42); err == nil {
+		t.Error("scanning an int succeeded")
+	}
+	if err := m.Scan("[1, 2]"); err == nil {
+		t.Error("scanning a JSON array succeeded")
+	}
+}
+
+func TestJSONMapColumnType(t *testing.T) {
+	tests := []struct {
+		dialector gorm.Dialector
+		want      string
+	}{
+		{postgres.New(postgres.Config{}), "JSONB"},
+		{mysql.New(mysql.Config{}), "JSON"},
+		{testutil.NewDB(t).Dialector, "JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialector.Name(), func(t *testing.T) {
+			db := &gorm.DB{Config: &gorm.Config{Dialector: tt.dialector}}
+			if got := (models.JSONMap{}).GormDBDataType(db, nil); got != tt.want {
+				t.Errorf("column type = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
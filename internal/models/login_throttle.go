@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// LoginThrottle tracks consecutive failed logins for one account or one client
+// IP so that password guessing can be slowed down and locked out. It also
+// counts the codes tried with one MFA login token.
+type LoginThrottle struct {
+	BaseModel
+	Key           string     `gorm:"column:throttle_key;size:320;uniqueIndex;not null" json:"key"` // "account:<email>", "ip:<address>" or "mfa_token:<jti>"
+	Failures      int        `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time  `gorm:"index" json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// MagicLink records a request for a passwordless sign-in link. Requests for
+// addresses without an account are recorded too, so rate limiting behaves the
+// same whether or not the address is registered.
+type MagicLink struct {
+	BaseModel
+	Email     string     `gorm:"size:255;index;not null" json:"email"`
+	UserID    *uint      `gorm:"index" json:"user_id,omitempty"`
+	LinkID    string     `gorm:"size:64;index" json:"-"` // Carried in the signed link; empty when no link was sent
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
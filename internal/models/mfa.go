@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// MFARecoveryCode represents a single-use recovery code for a user with MFA enabled
+type MFARecoveryCode struct {
+	BaseModel
+	UserID   uint       `gorm:"index;not null" json:"user_id"`
+	User     User       `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	CodeHash string     `gorm:"size:64;not null" json:"-"` // SHA-256 of the normalized code
+	UsedAt   *time.Time `json:"used_at,omitempty"`
+}
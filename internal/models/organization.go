@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// Organization roles, from most to least privileged
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// Organization is a workspace shared by its members
+type Organization struct {
+	BaseModel
+	Name string `gorm:"size:100;not null" json:"name"`
+	Slug string `gorm:"size:100;uniqueIndex;not null" json:"slug"`
+}
+
+// Membership gives a user a role in an organization
+type Membership struct {
+	BaseModel
+	OrganizationID uint         `gorm:"uniqueIndex:idx_membership_org_user;not null" json:"organization_id"`
+	Organization   Organization `gorm:"constraint:OnDelete:CASCADE;" json:"organization,omitempty"`
+	UserID         uint         `gorm:"uniqueIndex:idx_membership_org_user;index;not null" json:"user_id"`
+	User           User         `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	Role           string       `gorm:"size:16;not null" json:"role"`
+}
+
+// Invitation asks the owner of an email address to join an organization. It is
+// redeemed with a signed link sent to that address.
+type Invitation struct {
+	TenantModel
+	Email       string     `gorm:"size:255;index;not null" json:"email"`
+	Role        string     `gorm:"size:16;not null" json:"role"`
+	InvitedByID uint       `gorm:"not null" json:"invited_by_id"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	AcceptedAt  *time.Time `json:"accepted_at,omitempty"`
+}
+
+// OrgRoleRank orders organization roles so they can be compared; unknown roles rank lowest
+func OrgRoleRank(role string) int {
+	switch role {
+	case OrgRoleOwner:
+		return 3
+	case OrgRoleAdmin:
+		return 2
+	case OrgRoleMember:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// OutboxMessage is a side effect, such as an email, recorded in the same
+// transaction as the change that causes it and delivered after the commit. A
+// rolled back change leaves no message behind, and a committed one is
+// delivered even if the process stops before sending it.
+type OutboxMessage struct {
+	BaseModel
+	Topic       string     `gorm:"size:64;not null" json:"topic"` // Selects the handler that delivers the message
+	Payload     JSONMap    `json:"payload"`
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	AvailableAt time.Time  `gorm:"index;not null" json:"available_at"` // Not delivered before; pushed back while claimed and after failures
+	SentAt      *time.Time `gorm:"index" json:"sent_at,omitempty"`
+	LastError   string     `gorm:"size:1024" json:"last_error,omitempty"`
+}
@@ -0,0 +1,17 @@
+package models
+
+// QueryFields declares the fields of a model that list queries may filter,
+// sort and search by, named by their columns. Other fields can't be used, so
+// clients can't probe secrets such as password hashes or sort by columns
+// without an index.
+type QueryFields struct {
+	Filter []string
+	Sort   []string
+	Search []string // Matched against the q parameter
+}
+
+// Queryable is implemented by models that can be listed with filters, sorting
+// and search
+type Queryable interface {
+	QueryFields() QueryFields
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Session is a signed-in device. It is created at login, shares its lifetime
+// with one refresh token family and is referenced by the sid claim of every
+// access token issued for it.
+type Session struct {
+	BaseModel
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	User       User       `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	FamilyID   string     `gorm:"size:64;uniqueIndex;not null" json:"-"` // Refresh token family of this session
+	Method     string     `gorm:"size:64" json:"method"`                 // How the user signed in, e.g. "password" or "oidc:google"
+	UserAgent  string     `gorm:"size:512" json:"user_agent"`
+	IP         string     `gorm:"size:45" json:"ip"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
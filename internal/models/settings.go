@@ -26,8 +26,11 @@ type Settings struct {
 	ProfileVisibility string `gorm:"default:'private'" json:"profile_visibility"` // private, public, friends
 	DataSharing       bool   `gorm:"default:false" json:"data_sharing"`           // Whether to share usage data
 
+	// Security Settings
+	PasswordlessOnly bool `gorm:"default:false" json:"passwordless_only"` // Sign in only with emailed magic links, never a password
+
 	// Custom Settings (JSON field for application-specific settings)
-	CustomSettings map[string]interface{} `gorm:"type:json" json:"custom_settings"`
+	CustomSettings JSONMap `json:"custom_settings"`
 }
 
 // SettingsService handles settings-related database operations
@@ -92,7 +95,7 @@ func (s *SettingsService) Delete(id uint) error {
 func (s *SettingsService) UpdateCustomSettings(userID uint, customSettings map[string]interface{}) error {
 	return s.db.Model(&Settings{}).
 		Where("user_id = ?", userID).
-		Update("custom_settings", customSettings).Error
+		Update("custom_settings", JSONMap(customSettings)).Error
 }
 
 // GetCustomSetting retrieves a specific custom setting
@@ -0,0 +1,176 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// tenantField is the field holding the organization of a tenant-owned model
+const tenantField = "OrganizationID"
+
+var (
+	// ErrTenantRequired is returned when a tenant-owned table is used without an
+	// organization in the statement's context
+	ErrTenantRequired = errors.New("organization context required for tenant-owned data")
+	// ErrTenantMismatch is returned when creating a record for another organization
+	// than the one in the statement's context
+	ErrTenantMismatch = errors.New("record belongs to a different organization")
+	// ErrTenantUpsert is returned when creating a tenant-owned record with an ON
+	// CONFLICT clause, which would update rows of any organization
+	ErrTenantUpsert = errors.New("tenant-owned records can't be upserted")
+)
+
+// TenantModel provides common fields for models owned by an organization.
+// Queries on these models are filtered to the organization in the context; see
+// RegisterTenantScope.
+type TenantModel struct {
+	BaseModel
+	OrganizationID uint         `gorm:"index;not null" json:"organization_id"`
+	Organization   Organization `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// tenantOwned is implemented by models that embed TenantModel
+type tenantOwned interface {
+	tenantOwned()
+}
+
+func (TenantModel) tenantOwned() {}
+
+// IsTenantOwned reports whether model, a model or a pointer to one, embeds TenantModel
+func IsTenantOwned(model interface{}) bool {
+	_, owned := model.(tenantOwned)
+	return owned
+}
+
+type tenantContextKey struct{}
+
+type tenantScopeDisabledKey struct{}
+
+// WithTenant returns a context whose database statements are limited to the organization
+func WithTenant(ctx context.Context, organizationID uint) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, organizationID)
+}
+
+// TenantFromContext returns the organization set with WithTenant
+func TenantFromContext(ctx context.Context) (uint, bool) {
+	id, ok := ctx.Value(tenantContextKey{}).(uint)
+	return id, ok && id != 0
+}
+
+// WithoutTenantScope returns a context whose database statements may touch every
+// organization's data. Use it only for work that is deliberately cross-tenant,
+// such as redeeming an invitation before the user is a member.
+func WithoutTenantScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tenantScopeDisabledKey{}, true)
+}
+
+// TenantScope limits a query to one organization. RegisterTenantScope applies it
+// automatically; use it directly for queries that don't go through a model.
+func TenantScope(organizationID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("organization_id = ?", organizationID)
+	}
+}
+
+// RegisterTenantScope installs callbacks that filter every query, update and
+// delete on a tenant-owned model to the organization in the statement's context,
+// and stamp that organization on created records. Upserts of tenant-owned
+// records fail with ErrTenantUpsert, since the conflicting row may belong to
+// another organization; this also stops Save from inserting over another
+// organization's record when its filtered update matches nothing. Statements on tenant-owned
+// models fail with ErrTenantRequired when the context carries no organization,
+// so forgetting the context can't leak data across organizations.
+func RegisterTenantScope(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Query().Before("gorm:query").Register("tenant:query", filterTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("tenant:row", filterTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("tenant:update", filterTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("tenant:delete", filterTenant); err != nil {
+		return err
+	}
+	return callbacks.Create().Before("gorm:create").Register("tenant:create", assignTenant)
+}
+
+// tenantOf returns the tenant field of the statement's model and the organization
+// to scope it to. ok is false when the statement needs no scoping.
+func tenantOf(db *gorm.DB) (field *schema.Field, organizationID uint, ok bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil, 0, false
+	}
+	if _, owned := reflect.New(db.Statement.Schema.ModelType).Interface().(tenantOwned); !owned {
+		return nil, 0, false
+	}
+	field = db.Statement.Schema.LookUpField(tenantField)
+	if field == nil {
+		return nil, 0, false
+	}
+
+	ctx := db.Statement.Context
+	if disabled, _ := ctx.Value(tenantScopeDisabledKey{}).(bool); disabled {
+		return nil, 0, false
+	}
+	organizationID, found := TenantFromContext(ctx)
+	if !found {
+		db.AddError(ErrTenantRequired)
+		return nil, 0, false
+	}
+	return field, organizationID, true
+}
+
+// filterTenant adds the organization condition to queries, updates and deletes
+func filterTenant(db *gorm.DB) {
+	field, organizationID, ok := tenantOf(db)
+	if !ok {
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: db.Statement.Table, Name: field.DBName}, Value: organizationID},
+	}})
+}
+
+// assignTenant sets the organization on created records, refusing records that
+// already name another organization and upserts
+func assignTenant(db *gorm.DB) {
+	field, organizationID, ok := tenantOf(db)
+	if !ok {
+		return
+	}
+	if _, upsert := db.Statement.Clauses[clause.OnConflict{}.Name()]; upsert {
+		db.AddError(ErrTenantUpsert)
+		return
+	}
+
+	ctx := db.Statement.Context
+	assign := func(rv reflect.Value) {
+		value, zero := field.ValueOf(ctx, rv)
+		if zero {
+			if err := field.Set(ctx, rv, organizationID); err != nil {
+				db.AddError(err)
+			}
+			return
+		}
+		if id, _ := value.(uint); id != organizationID {
+			db.AddError(ErrTenantMismatch)
+		}
+	}
+
+	switch rv := db.Statement.ReflectValue; rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			assign(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		assign(rv)
+	}
+}
@@ -0,0 +1,172 @@
+package models_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/testutil"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// createOrganizations stores an organization per slug
+func createOrganizations(t *testing.T, db *gorm.DB, slugs ...string) []models.Organization {
+	t.Helper()
+	orgs := make([]models.Organization, len(slugs))
+	for i, slug := range slugs {
+		orgs[i] = models.Organization{Name: slug, Slug: slug}
+		if err := db.Create(&orgs[i]).Error; err != nil {
+			t.Fatalf("create organization %s: %v", slug, err)
+		}
+	}
+	return orgs
+}
+
+func newInvitation(email string) *models.Invitation {
+	return &models.Invitation{
+		Email:       email,
+		Role:        models.OrgRoleMember,
+		InvitedByID: 1,
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+}
+
+func TestTenantScope(t *testing.T) {
+	db := testutil.NewDB(t)
+	orgs := createOrganizations(t, db, "a", "b")
+	ctxA := models.WithTenant(context.Background(), orgs[0].ID)
+	ctxB := models.WithTenant(context.Background(), orgs[1].ID)
+
+	invitationA := newInvitation("a@example.com")
+	if err := db.WithContext(ctxA).Create(invitationA).Error; err != nil {
+		t.Fatalf("create in a: %v", err)
+	}
+	if invitationA.OrganizationID != orgs[0].ID {
+		t.Errorf("organization = %d, want %d", invitationA.OrganizationID, orgs[0].ID)
+	}
+	invitationB := newInvitation("b@example.com")
+	if err := db.WithContext(ctxB).Create(invitationB).Error; err != nil {
+		t.Fatalf("create in b: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		run     func() *gorm.DB
+		wantErr error
+		wantN   int64
+	}{
+		{
+			name: "query sees own organization only",
+			run: func() *gorm.DB {
+				var found []models.Invitation
+				return db.WithContext(ctxA).Find(&found)
+			},
+			wantN: 1,
+		},
+		{
+			name: "query of another organization's record finds nothing",
+			run: func() *gorm.DB {
+				var found models.Invitation
+				return db.WithContext(ctxA).Find(&found, invitationB.ID)
+			},
+			wantN: 0,
+		},
+		{
+			name: "update of another organization's record changes nothing",
+			run: func() *gorm.DB {
+				return db.WithContext(ctxA).Model(&models.Invitation{}).Where("id = ?", invitationB.ID).Update("role", models.OrgRoleOwner)
+			},
+			wantN: 0,
+		},
+		{
+			name: "delete of another organization's record deletes nothing",
+			run: func() *gorm.DB {
+				return db.WithContext(ctxA).Delete(&models.Invitation{}, invitationB.ID)
+			},
+			wantN: 0,
+		},
+		{
+			name: "query without organization fails",
+			run: func() *gorm.DB {
+				var found []models.Invitation
+				return db.WithContext(context.Background()).Find(&found)
+			},
+			wantErr: models.ErrTenantRequired,
+		},
+		{
+			name: "create for another organization fails",
+			run: func() *gorm.DB {
+				invitation := newInvitation("c@example.com")
+				invitation.OrganizationID = orgs[1].ID
+				return db.WithContext(ctxA).Create(invitation)
+			},
+			wantErr: models.ErrTenantMismatch,
+		},
+		{
+			name: "upsert fails",
+			run: func() *gorm.DB {
+				invitation := newInvitation("d@example.com")
+				invitation.ID = invitationB.ID
+				return db.WithContext(ctxA).Clauses(clause.OnConflict{UpdateAll: true}).Create(invitation)
+			},
+			wantErr: models.ErrTenantUpsert,
+		},
+		{
+			name: "save of another organization's record fails",
+			run: func() *gorm.DB {
+				invitation := newInvitation("attacker@example.com")
+				invitation.ID = invitationB.ID
+				invitation.Role = models.OrgRoleOwner
+				return db.WithContext(ctxA).Save(invitation)
+			},
+			wantErr: models.ErrTenantUpsert,
+		},
+		{
+			name: "unscoped query sees every organization",
+			run: func() *gorm.DB {
+				var found []models.Invitation
+				return db.WithContext(models.WithoutTenantScope(context.Background())).Find(&found)
+			},
+			wantN: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.run()
+			if tt.wantErr != nil {
+				if !errors.Is(result.Error, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", result.Error, tt.wantErr)
+				}
+				return
+			}
+			if result.Error != nil {
+				t.Fatalf("err = %v", result.Error)
+			}
+			if result.RowsAffected != tt.wantN {
+				t.Errorf("rows = %d, want %d", result.RowsAffected, tt.wantN)
+			}
+		})
+	}
+
+	var stored models.Invitation
+	if err := db.WithContext(ctxB).First(&stored, invitationB.ID).Error; err != nil {
+		t.Fatalf("load b's invitation: %v", err)
+	}
+	if stored.Email != "b@example.com" || stored.Role != models.OrgRoleMember || stored.OrganizationID != orgs[1].ID {
+		t.Errorf("b's invitation was changed: %+v", stored)
+	}
+}
+
+func TestIsTenantOwned(t *testing.T) {
+	if !models.IsTenantOwned(&models.Invitation{}) {
+		t.Error("Invitation is not tenant-owned")
+	}
+	if models.IsTenantOwned(&models.Membership{}) {
+		t.Error("Membership is tenant-owned")
+	}
+}
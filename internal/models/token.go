@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// RefreshToken represents a rotating refresh token. Every refresh token issued
+// from the same login shares a FamilyID so that reuse of an already-rotated
+// token can revoke the whole chain.
+type RefreshToken struct {
+	BaseModel
+	UserID       uint       `gorm:"index;not null" json:"user_id"`
+	User         User       `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	TokenHash    string     `gorm:"size:64;uniqueIndex;not null" json:"-"` // SHA-256 of the opaque token
+	FamilyID     string     `gorm:"size:64;index;not null" json:"family_id"`
+	ExpiresAt    time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`     // Set when rotated, logged out or revoked
+	ReplacedByID *uint      `json:"replaced_by_id,omitempty"` // Token issued when this one was rotated
+}
+
+// RevokedToken records an access token revoked before its natural expiry
+type RevokedToken struct {
+	BaseModel
+	JTI       string    `gorm:"size:64;uniqueIndex;not null" json:"jti"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	ExpiresAt time.Time `gorm:"index;not null" json:"expires_at"` // Row can be purged after this time
+}
+
+// PasswordResetToken represents a single-use password reset token
+type PasswordResetToken struct {
+	BaseModel
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	User      User       `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	TokenHash string     `gorm:"size:64;uniqueIndex;not null" json:"-"` // SHA-256 of the token sent by email
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"errors"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -15,6 +16,28 @@ type User struct {
 	Password  string `gorm:"not null" json:"-"`
 	IsActive  bool   `gorm:"default:true" json:"is_active"`
 	Role      string `gorm:"default:'user'" json:"role"` // Common roles: 'user', 'admin', 'moderator'
+
+	// Email verification
+	EmailVerifiedAt    *time.Time `json:"email_verified_at"`
+	PendingEmail       *string    `gorm:"size:255" json:"pending_email,omitempty"` // New address awaiting confirmation
+	VerificationSentAt *time.Time `json:"-"`                                       // When a verification link was last sent; throttles resends
+
+	// Multi-factor authentication
+	MFAEnabled      bool   `gorm:"default:false" json:"mfa_enabled"`
+	MFASecret       string `json:"-"` // Base32 TOTP secret; set during enrollment, active once MFAEnabled
+	MFALastUsedStep int64  `json:"-"` // Last accepted TOTP time step, prevents code replay
+
+	// TokensRevokedAt invalidates every access token issued before it
+	TokensRevokedAt *time.Time `json:"-"`
+}
+
+// QueryFields lists the fields users can be filtered, sorted and searched by
+func (User) QueryFields() QueryFields {
+	return QueryFields{
+		Filter: []string{"id", "email", "first_name", "last_name", "role", "is_active", "mfa_enabled", "email_verified_at", "created_at", "updated_at"},
+		Sort:   []string{"id", "email", "first_name", "last_name", "role", "created_at", "updated_at"},
+		Search: []string{"email", "first_name", "last_name"},
+	}
 }
 
 // UserService handles user-related database operations
@@ -87,11 +110,6 @@ func (s *UserService) List(page, pageSize int) ([]User, int64, error) {
 	return users, total, nil
 }
 
-// UpdatePassword updates a user's password
-func (s *UserService) UpdatePassword(id uint, hashedPassword string) error {
-	return s.db.Model(&User{}).Where("id = ?", id).Update("password", hashedPassword).Error
-}
-
 // Deactivate deactivates a user account
 func (s *UserService) Deactivate(id uint) error {
 	return s.db.Model(&User{}).Where("id = ?", id).Update("is_active", false).Error
@@ -0,0 +1,150 @@
+package routes
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAuditPageSize caps how many audit events are returned per page
+const maxAuditPageSize = 100
+
+// AdminRoutes handles administrative operations on other users' accounts, the
+// audit log and the running configuration
+type AdminRoutes struct {
+	impersonationService *services.ImpersonationService
+	auditService         *services.AuditService
+	configStore          *config.Store
+}
+
+// NewAdminRoutes creates a new admin routes instance
+func NewAdminRoutes(impersonationService *services.ImpersonationService, auditService *services.AuditService, configStore *config.Store) *AdminRoutes {
+	return &AdminRoutes{
+		impersonationService: impersonationService,
+		auditService:         auditService,
+		configStore:          configStore,
+	}
+}
+
+// RegisterRoutes registers protected admin routes
+func (r *AdminRoutes) RegisterRoutes(rg *gin.RouterGroup) {
+	admin := rg.Group("/admin")
+	{
+		// Impersonation can only be started from an admin's own signed-in session
+		admin.OPTIONS("/users/:id/impersonate", middleware.CorsOptionsHandler)
+		admin.POST("/users/:id/impersonate",
+			middleware.RequireTokenAuth(),
+			middleware.BlockImpersonation(),
+			middleware.RequirePermission(middleware.PermUsersImpersonate),
+			r.StartImpersonation)
+
+		admin.OPTIONS("/impersonation/end", middleware.CorsOptionsHandler)
+		admin.POST("/impersonation/end", middleware.RequireTokenAuth(), r.EndImpersonation)
+
+		admin.OPTIONS("/audit-events", middleware.CorsOptionsHandler)
+		admin.GET("/audit-events", middleware.RequirePermission(middleware.PermAuditRead), r.ListAuditEvents)
+
+		admin.OPTIONS("/audit-events/verify", middleware.CorsOptionsHandler)
+		admin.GET("/audit-events/verify", middleware.RequirePermission(middleware.PermAuditRead), r.VerifyAuditChain)
+
+		admin.OPTIONS("/config", middleware.CorsOptionsHandler)
+		admin.GET("/config", middleware.RequirePermission(middleware.PermConfigRead), r.GetConfig)
+	}
+}
+
+// StartImpersonation issues a short-lived token acting as the user on behalf of the admin
+func (r *AdminRoutes) StartImpersonation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	token, err := r.impersonationService.Start(c.Request.Context(), c.GetUint("user_id"), uint(id))
+	if err != nil {
+		if errors.Is(err, services.ErrCannotImpersonate) {
+			c.JSON(403, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, token)
+}
+
+// EndImpersonation revokes the impersonation token used for the request
+func (r *AdminRoutes) EndImpersonation(c *gin.Context) {
+	claims, ok := c.MustGet("claims").(*middleware.Claims)
+	if !ok {
+		c.JSON(401, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	if err := r.impersonationService.End(c.Request.Context(), claims); err != nil {
+		if errors.Is(err, services.ErrNotImpersonating) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Impersonation ended"})
+}
+
+// ListAuditEvents lists audit events matching the query filters, newest first
+func (r *AdminRoutes) ListAuditEvents(c *gin.Context) {
+	var filter services.AuditFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(400, gin.H{"error": "Invalid page"})
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize < 1 || pageSize > maxAuditPageSize {
+		c.JSON(400, gin.H{"error": "Invalid page size"})
+		return
+	}
+
+	events, total, err := r.auditService.List(c.Request.Context(), filter, page, pageSize)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, models.PaginatedResponse{
+		Data:       events,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: int((total + int64(pageSize) - 1) / int64(pageSize)),
+	})
+}
+
+// VerifyAuditChain checks that no hash-chained audit event has been altered or removed
+func (r *AdminRoutes) VerifyAuditChain(c *gin.Context) {
+	result, err := r.auditService.VerifyChain(c.Request.Context())
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, result)
+}
+
+// GetConfig returns the effective configuration as YAML with secrets masked
+func (r *AdminRoutes) GetConfig(c *gin.Context) {
+	c.YAML(200, r.configStore.Current().Redacted())
+}
@@ -0,0 +1,97 @@
+package routes
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyRoutes handles management of the current user's API keys
+type APIKeyRoutes struct {
+	apiKeyService *services.APIKeyService
+}
+
+// NewAPIKeyRoutes creates a new API key routes instance
+func NewAPIKeyRoutes(apiKeyService *services.APIKeyService) *APIKeyRoutes {
+	return &APIKeyRoutes{
+		apiKeyService: apiKeyService,
+	}
+}
+
+// RegisterRoutes registers protected API key routes. Keys can only be managed
+// from a signed-in session, never with another API key or while impersonating.
+func (r *APIKeyRoutes) RegisterRoutes(rg *gin.RouterGroup) {
+	keys := rg.Group("/user/api-keys")
+	keys.Use(middleware.RequireTokenAuth(), middleware.BlockImpersonation(), middleware.RequirePermission(middleware.PermAPIKeysManage))
+	{
+		keys.OPTIONS("", middleware.CorsOptionsHandler)
+		keys.GET("", r.ListAPIKeys)
+		keys.POST("", r.CreateAPIKey)
+
+		keys.OPTIONS("/:keyId", middleware.CorsOptionsHandler)
+		keys.DELETE("/:keyId", r.RevokeAPIKey)
+	}
+}
+
+// CreateAPIKey issues a new API key. The key is only returned in this response.
+func (r *APIKeyRoutes) CreateAPIKey(c *gin.Context) {
+	var input services.CreateAPIKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, plaintext, err := r.apiKeyService.Create(c.Request.Context(), c.GetUint("user_id"), input)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidAPIKeyScope):
+			c.JSON(400, gin.H{"error": "Scopes must be permissions your role grants"})
+		case errors.Is(err, services.ErrTooManyAPIKeys):
+			c.JSON(409, gin.H{"error": err.Error()})
+		default:
+			c.JSON(400, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(201, gin.H{
+		"api_key": key,
+		"key":     plaintext,
+		"message": "Store this key now; it will not be shown again",
+	})
+}
+
+// ListAPIKeys lists the current user's active API keys
+func (r *APIKeyRoutes) ListAPIKeys(c *gin.Context) {
+	keys, err := r.apiKeyService.List(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, keys)
+}
+
+// RevokeAPIKey revokes one of the current user's API keys
+func (r *APIKeyRoutes) RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("keyId"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	if err := r.apiKeyService.Revoke(c.Request.Context(), c.GetUint("user_id"), uint(id)); err != nil {
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "API key revoked"})
+}
@@ -0,0 +1,207 @@
+package routes
+
+import (
+	"errors"
+
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MFARoutes handles multi-factor enrollment and the second step of login
+type MFARoutes struct {
+	mfaService    *services.MFAService
+	userService   *services.UserService
+	tokenService  *services.TokenService
+	loginThrottle *services.LoginThrottleService
+}
+
+// NewMFARoutes creates a new MFA routes instance
+func NewMFARoutes(mfaService *services.MFAService, userService *services.UserService, tokenService *services.TokenService, loginThrottle *services.LoginThrottleService) *MFARoutes {
+	return &MFARoutes{
+		mfaService:    mfaService,
+		userService:   userService,
+		tokenService:  tokenService,
+		loginThrottle: loginThrottle,
+	}
+}
+
+// RegisterPublicRoutes registers public MFA routes
+func (r *MFARoutes) RegisterPublicRoutes(rg *gin.RouterGroup) {
+	rg.OPTIONS("/user/login/mfa", middleware.CorsOptionsHandler)
+	rg.POST("/user/login/mfa", r.LoginMFA)
+}
+
+// RegisterRoutes registers protected MFA routes for the current user
+func (r *MFARoutes) RegisterRoutes(rg *gin.RouterGroup) {
+	mfa := rg.Group("/user/mfa")
+	mfa.Use(middleware.RequireTokenAuth(), middleware.BlockImpersonation())
+	{
+		mfa.OPTIONS("/enroll", middleware.CorsOptionsHandler)
+		mfa.POST("/enroll", r.BeginEnrollment)
+
+		mfa.OPTIONS("/confirm", middleware.CorsOptionsHandler)
+		mfa.POST("/confirm", r.ConfirmEnrollment)
+
+		mfa.OPTIONS("/disable", middleware.CorsOptionsHandler)
+		mfa.POST("/disable", r.Disable)
+
+		mfa.OPTIONS("/recovery-codes", middleware.CorsOptionsHandler)
+		mfa.POST("/recovery-codes", r.RegenerateRecoveryCodes)
+	}
+}
+
+// mfaCodeInput is the request body for endpoints that require a current MFA code
+type mfaCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// LoginMFA completes a login by exchanging the MFA pending token and a code for
+// tokens. Wrong codes count as failed logins of the account and the client IP,
+// and each MFA token allows a few codes and a single login.
+func (r *MFARoutes) LoginMFA(c *gin.Context) {
+	var input struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := middleware.ValidateActionToken(middleware.PurposeMFALogin, input.MFAToken)
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if !checkLoginThrottle(c, r.loginThrottle, claims.Email) {
+		return
+	}
+	if err := r.loginThrottle.UseMFAToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		if errors.Is(err, services.ErrMFATokenUsed) {
+			c.JSON(401, gin.H{"error": "Invalid or expired MFA token"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Error checking login attempts"})
+		return
+	}
+
+	if err := r.mfaService.Verify(ctx, claims.UserID, input.Code); err != nil {
+		if errors.Is(err, services.ErrInvalidMFACode) {
+			r.loginThrottle.RecordFailure(ctx, claims.Email, c.ClientIP())
+		}
+		c.JSON(401, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	user, err := r.userService.GetByID(ctx, claims.UserID)
+	if err != nil || !user.IsActive {
+		c.JSON(401, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	if err := r.loginThrottle.SpendMFAToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		c.JSON(500, gin.H{"error": "Error generating token"})
+		return
+	}
+	r.loginThrottle.RecordSuccess(ctx, claims.Email)
+
+	method := claims.Data["method"]
+	if method == "" {
+		method = "password"
+	}
+
+	tokens, err := r.tokenService.IssueTokens(ctx, user, sessionInfo(c, method+"+mfa"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error generating token"})
+		return
+	}
+
+	c.JSON(200, loginResponse(tokens, user))
+}
+
+// BeginEnrollment generates a TOTP secret and otpauth:// URI for the current user
+func (r *MFARoutes) BeginEnrollment(c *gin.Context) {
+	enrollment, err := r.mfaService.BeginEnrollment(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		if errors.Is(err, services.ErrMFAAlreadyEnabled) {
+			c.JSON(409, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, enrollment)
+}
+
+// ConfirmEnrollment enables MFA and returns the recovery codes
+func (r *MFARoutes) ConfirmEnrollment(c *gin.Context) {
+	var input mfaCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := r.mfaService.ConfirmEnrollment(c.Request.Context(), c.GetUint("user_id"), input.Code)
+	if err != nil {
+		r.handleError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message":        "Multi-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// Disable turns off MFA for the current user
+func (r *MFARoutes) Disable(c *gin.Context) {
+	var input mfaCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.mfaService.Disable(c.Request.Context(), c.GetUint("user_id"), input.Code); err != nil {
+		r.handleError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Multi-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes
+func (r *MFARoutes) RegenerateRecoveryCodes(c *gin.Context) {
+	var input mfaCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := r.mfaService.RegenerateRecoveryCodes(c.Request.Context(), c.GetUint("user_id"), input.Code)
+	if err != nil {
+		r.handleError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"recovery_codes": codes})
+}
+
+// handleError maps MFA service errors to HTTP responses
+func (r *MFARoutes) handleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidMFACode):
+		c.JSON(401, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrMFAAlreadyEnabled):
+		c.JSON(409, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrMFANotEnabled), errors.Is(err, services.ErrMFAEnrollmentNotStarted):
+		c.JSON(400, gin.H{"error": err.Error()})
+	default:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
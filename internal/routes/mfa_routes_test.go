@@ -0,0 +1,188 @@
+package routes
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/services"
+	"github.com/cam-boltnote/go-ignite/internal/testutil"
+	"github.com/cam-boltnote/go-ignite/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// testPassword satisfies the default password rules
+const testPassword = "Correct-Horse-9"
+
+// mfaLoginEnv is a router serving the login routes for a user with MFA enabled
+type mfaLoginEnv struct {
+	db     *gorm.DB
+	router *gin.Engine
+	user   *models.User
+	secret string
+}
+
+// newMFALoginEnv creates ada@example.com with password testPassword and MFA
+// enabled. Accounts lock after maxAttempts failures, with no backoff before.
+func newMFALoginEnv(t *testing.T, maxAttempts int) *mfaLoginEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, cfg := testutil.NewDB(t), testutil.Config(t)
+	cfg.LoginThrottle.MaxAttempts = maxAttempts
+	cfg.LoginThrottle.BackoffBase = time.Nanosecond
+	cfg.LoginThrottle.BackoffMax = time.Nanosecond
+
+	tokenService := services.NewTokenService(db, cfg)
+	userService := services.NewUserService(db, nil, services.NewSettingsService(db, cfg), tokenService, services.NewAuditService(db, cfg), cfg)
+	loginThrottle := services.NewLoginThrottleService(db, userService, cfg)
+	userRoutes := NewUserRoutes(userService, tokenService, services.NewPasswordResetService(db, userService, cfg),
+		loginThrottle, services.NewMagicLinkService(db, userService, cfg))
+	mfaRoutes := NewMFARoutes(services.NewMFAService(db, cfg), userService, tokenService, loginThrottle)
+
+	router := gin.New()
+	api := router.Group("/api/v1")
+	userRoutes.RegisterPublicRoutes(api)
+	mfaRoutes.RegisterPublicRoutes(api)
+
+	user, err := userService.CreateUser(context.Background(), services.CreateUserInput{
+		Email: "ada@example.com", Password: testPassword, FirstName: "Ada", LastName: "Lovelace",
+	})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	if err := db.Model(user).Updates(map[string]interface{}{"mfa_enabled": true, "mfa_secret": secret}).Error; err != nil {
+		t.Fatalf("enable MFA: %v", err)
+	}
+	return &mfaLoginEnv{db: db, router: router, user: user, secret: secret}
+}
+
+// post sends a JSON body and returns the status and decoded response
+func (e *mfaLoginEnv) post(t *testing.T, path string, body gin.H) (int, map[string]interface{}) {
+	t.Helper()
+
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	e.router.ServeHTTP(rec, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	return rec.Code, response
+}
+
+// mfaToken passes the password step and returns the MFA login token
+func (e *mfaLoginEnv) mfaToken(t *testing.T) string {
+	t.Helper()
+
+	status, response := e.post(t, "/api/v1/user/login", gin.H{"email": e.user.Email, "password": testPassword})
+	token, _ := response["mfa_token"].(string)
+	if status != http.StatusOK || token == "" {
+		t.Fatalf("password step: status %d, response %v", status, response)
+	}
+	return token
+}
+
+// code returns the current TOTP code
+func (e *mfaLoginEnv) code(t *testing.T) string {
+	t.Helper()
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(e.secret)
+	if err != nil {
+		t.Fatalf("decode TOTP secret: %v", err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(time.Now().Unix()/utils.TOTPPeriod))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+// wrongCode returns a code that isn't the current one
+func (e *mfaLoginEnv) wrongCode(t *testing.T) string {
+	if e.code(t) == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
+
+// accountFailures returns the failed logins counted against the account
+func (e *mfaLoginEnv) accountFailures(t *testing.T) int {
+	var throttle models.LoginThrottle
+	if err := e.db.Where("throttle_key = ?", "account:"+e.user.Email).First(&throttle).Error; err != nil {
+		return 0
+	}
+	return throttle.Failures
+}
+
+func TestLoginMFATokenAttempts(t *testing.T) {
+	env := newMFALoginEnv(t, 100)
+
+	token := env.mfaToken(t)
+	for i := 0; i < 5; i++ {
+		if status, _ := env.post(t, "/api/v1/user/login/mfa", gin.H{"mfa_token": token, "code": env.wrongCode(t)}); status != http.StatusUnauthorized {
+			t.Fatalf("wrong code %d: status = %d, want %d", i+1, status, http.StatusUnauthorized)
+		}
+	}
+	status, response := env.post(t, "/api/v1/user/login/mfa", gin.H{"mfa_token": token, "code": env.code(t)})
+	if status != http.StatusUnauthorized || response["error"] != "Invalid or expired MFA token" {
+		t.Errorf("right code after the token's attempts: status %d, response %v", status, response)
+	}
+
+	token = env.mfaToken(t)
+	if status, response := env.post(t, "/api/v1/user/login/mfa", gin.H{"mfa_token": token, "code": env.code(t)}); status != http.StatusOK {
+		t.Fatalf("right code with a fresh token: status %d, response %v", status, response)
+	}
+	if failures := env.accountFailures(t); failures != 0 {
+		t.Errorf("%d failures left after completing the login, want 0", failures)
+	}
+	status, response = env.post(t, "/api/v1/user/login/mfa", gin.H{"mfa_token": token, "code": env.code(t)})
+	if status != http.StatusUnauthorized || response["error"] != "Invalid or expired MFA token" {
+		t.Errorf("token that completed a login: status %d, response %v", status, response)
+	}
+}
+
+func TestLoginMFALocksAccount(t *testing.T) {
+	env := newMFALoginEnv(t, 3)
+
+	// A fresh token for every guess doesn't help: the password step no longer
+	// clears the account's failures while MFA is outstanding
+	for i := 0; i < 3; i++ {
+		token := env.mfaToken(t)
+		if status, _ := env.post(t, "/api/v1/user/login/mfa", gin.H{"mfa_token": token, "code": env.wrongCode(t)}); status != http.StatusUnauthorized {
+			t.Fatalf("wrong code %d: status = %d, want %d", i+1, status, http.StatusUnauthorized)
+		}
+		if failures := env.accountFailures(t); failures != i+1 {
+			t.Fatalf("%d failures after wrong code %d, want %d", failures, i+1, i+1)
+		}
+	}
+
+	token, err := middleware.GenerateActionTokenWithData(middleware.PurposeMFALogin, env.user.ID, env.user.Email,
+		map[string]string{"method": "password"}, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateActionTokenWithData: %v", err)
+	}
+	if status, response := env.post(t, "/api/v1/user/login/mfa", gin.H{"mfa_token": token, "code": env.code(t)}); status != http.StatusTooManyRequests {
+		t.Errorf("right code on a locked account: status %d, response %v", status, response)
+	}
+}
@@ -0,0 +1,103 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// oidcStateCookie holds the signed state of a login in progress
+	oidcStateCookie = "oidc_state"
+	// oidcCookiePath limits the state cookie to the OIDC endpoints
+	oidcCookiePath = "/api/v1/user/oidc"
+)
+
+// OIDCRoutes handles sign-in through external OpenID Connect providers
+type OIDCRoutes struct {
+	oidcService  *services.OIDCService
+	tokenService *services.TokenService
+}
+
+// NewOIDCRoutes creates a new OIDC routes instance
+func NewOIDCRoutes(oidcService *services.OIDCService, tokenService *services.TokenService) *OIDCRoutes {
+	return &OIDCRoutes{
+		oidcService:  oidcService,
+		tokenService: tokenService,
+	}
+}
+
+// RegisterPublicRoutes registers public OIDC routes
+func (r *OIDCRoutes) RegisterPublicRoutes(rg *gin.RouterGroup) {
+	oidc := rg.Group("/user/oidc")
+	{
+		oidc.OPTIONS("/providers", middleware.CorsOptionsHandler)
+		oidc.GET("/providers", r.ListProviders)
+
+		oidc.GET("/:provider/login", r.Login)
+		oidc.GET("/:provider/callback", r.Callback)
+	}
+}
+
+// ListProviders lists the identity providers users can sign in with
+func (r *OIDCRoutes) ListProviders(c *gin.Context) {
+	c.JSON(200, gin.H{"providers": r.oidcService.Providers()})
+}
+
+// Login redirects the user to the identity provider
+func (r *OIDCRoutes) Login(c *gin.Context) {
+	authURL, stateToken, err := r.oidcService.BeginLogin(c.Param("provider"))
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownOIDCProvider) {
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Error starting login"})
+		return
+	}
+
+	setOIDCStateCookie(c, stateToken, int(services.OIDCStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback completes the login when the identity provider redirects back
+func (r *OIDCRoutes) Callback(c *gin.Context) {
+	stateToken, _ := c.Cookie(oidcStateCookie)
+	setOIDCStateCookie(c, "", -1) // The state is single-use
+
+	if errorCode := c.Query("error"); errorCode != "" {
+		c.JSON(401, gin.H{"error": "Sign-in was not completed", "provider_error": errorCode})
+		return
+	}
+
+	user, err := r.oidcService.CompleteLogin(c.Request.Context(), c.Param("provider"), c.Query("code"), c.Query("state"), stateToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnknownOIDCProvider):
+			c.JSON(404, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrInvalidOIDCState):
+			c.JSON(400, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrAccountInactive):
+			c.JSON(403, gin.H{"error": "Account is deactivated"})
+		case errors.Is(err, services.ErrOIDCEmailNotVerified):
+			c.JSON(403, gin.H{"error": err.Error()})
+		default:
+			c.JSON(401, gin.H{"error": "Sign-in failed"})
+		}
+		return
+	}
+
+	respondWithLogin(c, r.tokenService, user, "oidc:"+c.Param("provider"))
+}
+
+// setOIDCStateCookie sets or, with a negative maxAge, clears the state cookie
+func setOIDCStateCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	// Lax so the cookie survives the top-level redirect back from the provider
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, value, maxAge, oidcCookiePath, "", secure, true)
+}
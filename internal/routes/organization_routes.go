@@ -0,0 +1,291 @@
+package routes
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OrganizationRoutes handles organizations, their members and invitations
+type OrganizationRoutes struct {
+	organizationService *services.OrganizationService
+}
+
+// NewOrganizationRoutes creates a new organization routes instance
+func NewOrganizationRoutes(organizationService *services.OrganizationService) *OrganizationRoutes {
+	return &OrganizationRoutes{
+		organizationService: organizationService,
+	}
+}
+
+// RegisterRoutes registers protected organization routes. Routes under
+// /orgs/:orgId require membership and run with the request context scoped to
+// that organization.
+func (r *OrganizationRoutes) RegisterRoutes(rg *gin.RouterGroup) {
+	orgs := rg.Group("/orgs")
+	orgs.Use(middleware.RequirePermission(middleware.PermOrgsManage))
+	{
+		orgs.OPTIONS("", middleware.CorsOptionsHandler)
+		orgs.GET("", r.ListOrganizations)
+		orgs.POST("", r.CreateOrganization)
+
+		orgs.OPTIONS("/invitations/accept", middleware.CorsOptionsHandler)
+		orgs.POST("/invitations/accept", r.AcceptInvitation)
+	}
+
+	org := orgs.Group("/:orgId")
+	org.Use(middleware.RequireOrganization(r.organizationService, "orgId"))
+	{
+		org.OPTIONS("", middleware.CorsOptionsHandler)
+		org.GET("", r.GetOrganization)
+		org.PUT("", middleware.RequireOrgRole(models.OrgRoleAdmin), r.UpdateOrganization)
+		org.DELETE("", middleware.RequireOrgRole(models.OrgRoleOwner), r.DeleteOrganization)
+
+		org.OPTIONS("/members", middleware.CorsOptionsHandler)
+		org.GET("/members", r.ListMembers)
+
+		org.OPTIONS("/members/:userId", middleware.CorsOptionsHandler)
+		org.PUT("/members/:userId", middleware.RequireOrgRole(models.OrgRoleAdmin), r.UpdateMemberRole)
+		org.DELETE("/members/:userId", r.RemoveMember)
+
+		org.OPTIONS("/invitations", middleware.CorsOptionsHandler)
+		org.GET("/invitations", middleware.RequireOrgRole(models.OrgRoleAdmin), r.ListInvitations)
+		org.POST("/invitations", middleware.RequireOrgRole(models.OrgRoleAdmin), r.InviteMember)
+
+		org.OPTIONS("/invitations/:invitationId", middleware.CorsOptionsHandler)
+		org.DELETE("/invitations/:invitationId", middleware.RequireOrgRole(models.OrgRoleAdmin), r.RevokeInvitation)
+	}
+}
+
+// CreateOrganization creates an organization owned by the current user
+func (r *OrganizationRoutes) CreateOrganization(c *gin.Context) {
+	var input services.CreateOrganizationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	org, err := r.organizationService.Create(c.Request.Context(), c.GetUint("user_id"), input)
+	if err != nil {
+		if errors.Is(err, services.ErrSlugTaken) {
+			c.JSON(409, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(201, org)
+}
+
+// ListOrganizations lists the organizations the current user belongs to, with their role in each
+func (r *OrganizationRoutes) ListOrganizations(c *gin.Context) {
+	memberships, err := r.organizationService.ListForUser(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, memberships)
+}
+
+// GetOrganization retrieves the organization
+func (r *OrganizationRoutes) GetOrganization(c *gin.Context) {
+	org, err := r.organizationService.Get(c.Request.Context(), c.GetUint("org_id"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"organization": org,
+		"role":         c.GetString("org_role"),
+	})
+}
+
+// UpdateOrganization renames the organization
+func (r *OrganizationRoutes) UpdateOrganization(c *gin.Context) {
+	var input services.UpdateOrganizationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	org, err := r.organizationService.Update(c.Request.Context(), c.GetUint("org_id"), input)
+	if err != nil {
+		if errors.Is(err, services.ErrOrganizationNotFound) {
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, org)
+}
+
+// DeleteOrganization deletes the organization
+func (r *OrganizationRoutes) DeleteOrganization(c *gin.Context) {
+	if err := r.organizationService.Delete(c.Request.Context(), c.GetUint("org_id")); err != nil {
+		if errors.Is(err, services.ErrOrganizationNotFound) {
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Organization deleted successfully"})
+}
+
+// ListMembers lists the organization's members
+func (r *OrganizationRoutes) ListMembers(c *gin.Context) {
+	members, err := r.organizationService.ListMembers(c.Request.Context(), c.GetUint("org_id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, members)
+}
+
+// UpdateMemberRole changes a member's role
+func (r *OrganizationRoutes) UpdateMemberRole(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = r.organizationService.UpdateMemberRole(c.Request.Context(), c.GetUint("org_id"), c.GetString("org_role"), uint(userID), input.Role)
+	if err != nil {
+		respondWithMembershipError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Member role updated successfully"})
+}
+
+// RemoveMember removes a member from the organization, or lets the current user leave it
+func (r *OrganizationRoutes) RemoveMember(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	err = r.organizationService.RemoveMember(c.Request.Context(), c.GetUint("org_id"), c.GetUint("user_id"), c.GetString("org_role"), uint(userID))
+	if err != nil {
+		respondWithMembershipError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Member removed successfully"})
+}
+
+// InviteMember emails an invitation to join the organization
+func (r *OrganizationRoutes) InviteMember(c *gin.Context) {
+	var input services.InviteMemberInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	invitation, err := r.organizationService.Invite(c.Request.Context(), c.GetUint("org_id"), c.GetUint("user_id"), c.GetString("org_role"), input)
+	if err != nil {
+		if errors.Is(err, services.ErrAlreadyMember) {
+			c.JSON(409, gin.H{"error": err.Error()})
+			return
+		}
+		respondWithMembershipError(c, err)
+		return
+	}
+
+	c.JSON(201, invitation)
+}
+
+// ListInvitations lists the organization's pending invitations
+func (r *OrganizationRoutes) ListInvitations(c *gin.Context) {
+	invitations, err := r.organizationService.ListInvitations(c.Request.Context(), c.GetUint("org_id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, invitations)
+}
+
+// RevokeInvitation revokes a pending invitation
+func (r *OrganizationRoutes) RevokeInvitation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("invitationId"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	if err := r.organizationService.RevokeInvitation(c.Request.Context(), c.GetUint("org_id"), uint(id)); err != nil {
+		if errors.Is(err, services.ErrInvitationNotFound) {
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Invitation revoked"})
+}
+
+// AcceptInvitation adds the current user to the organization they were invited to
+func (r *OrganizationRoutes) AcceptInvitation(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	membership, err := r.organizationService.AcceptInvitation(c.Request.Context(), c.GetUint("user_id"), c.GetString("email"), input.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidInvitation):
+			c.JSON(400, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrInvitationEmailMismatch):
+			c.JSON(403, gin.H{"error": err.Error()})
+		default:
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(200, membership)
+}
+
+// respondWithMembershipError maps organization membership errors to responses
+func respondWithMembershipError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidOrgRole):
+		c.JSON(400, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrOrgRoleNotAllowed):
+		c.JSON(403, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrMemberNotFound), errors.Is(err, services.ErrOrganizationNotFound):
+		c.JSON(404, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrLastOwner):
+		c.JSON(409, gin.H{"error": err.Error()})
+	default:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,136 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/services"
+	"github.com/cam-boltnote/go-ignite/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestOwnershipChecks checks every route taking a user ID or email refuses a
+// plain user acting on someone else's account before reaching its handler
+func TestOwnershipChecks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	api := router.Group("/api/v1", func(c *gin.Context) {
+		c.Set("user_id", uint(7))
+		c.Set("email", "ada@example.com")
+		c.Set("role", middleware.RoleUser)
+	})
+	(&UserRoutes{}).RegisterRoutes(api)
+	(&SettingsRoutes{}).RegisterRoutes(api)
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/api/v1/user/8"},
+		{http.MethodPut, "/api/v1/user/8"},
+		{http.MethodPut, "/api/v1/user/8/password"},
+		{http.MethodGet, "/api/v1/user/email/bob@example.com"},
+		{http.MethodDelete, "/api/v1/user/8"},
+		{http.MethodPut, "/api/v1/user/8/role"},
+		{http.MethodPut, "/api/v1/user/8/activate"},
+		{http.MethodPut, "/api/v1/user/8/deactivate"},
+		{http.MethodPut, "/api/v1/user/8/unlock"},
+		{http.MethodGet, "/api/v1/settings/8"},
+		{http.MethodPut, "/api/v1/settings/8"},
+		{http.MethodPut, "/api/v1/settings/8/notifications"},
+		{http.MethodPut, "/api/v1/settings/8/privacy"},
+		{http.MethodPut, "/api/v1/settings/8/general"},
+		{http.MethodPut, "/api/v1/settings/8/security"},
+		{http.MethodPut, "/api/v1/settings/8/custom"},
+		{http.MethodGet, "/api/v1/settings/8/custom/theme"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+strings.TrimPrefix(tt.path, "/api/v1"), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader("{}")))
+
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+			}
+		})
+	}
+}
+
+// TestManageUsersByRank checks admins can only delete, or change the role of,
+// users ranked below them, and only grant roles ranked below their own
+func TestManageUsersByRank(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, cfg := testutil.NewDB(t), testutil.Config(t)
+	userService := services.NewUserService(db, nil, services.NewSettingsService(db, cfg), services.NewTokenService(db, cfg), services.NewAuditService(db, cfg), cfg)
+	ids := make(map[string]uint)
+	for _, role := range []string{"admin", "other-admin", middleware.RoleModerator, middleware.RoleUser} {
+		user, err := userService.CreateUser(context.Background(), services.CreateUserInput{
+			Email: role + "@example.com", Password: testPassword, FirstName: "Test", LastName: "User",
+		})
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		dbRole := strings.TrimPrefix(role, "other-")
+		if err := db.Model(user).Update("role", dbRole).Error; err != nil {
+			t.Fatalf("set role: %v", err)
+		}
+		ids[role] = user.ID
+	}
+
+	router := gin.New()
+	api := router.Group("/api/v1", func(c *gin.Context) {
+		c.Set("user_id", ids["admin"])
+		c.Set("email", "admin@example.com")
+		c.Set("role", middleware.RoleAdmin)
+	})
+	(&UserRoutes{userService: userService}).RegisterRoutes(api)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"promote user to moderator", http.MethodPut, middleware.RoleUser, `{"role":"moderator"}`, http.StatusOK},
+		{"promote moderator to admin", http.MethodPut, middleware.RoleModerator, `{"role":"admin"}`, http.StatusForbidden},
+		{"demote another admin", http.MethodPut, "other-admin", `{"role":"user"}`, http.StatusForbidden},
+		{"demote self", http.MethodPut, "admin", `{"role":"user"}`, http.StatusForbidden},
+		{"delete another admin", http.MethodDelete, "other-admin", "", http.StatusForbidden},
+		{"delete moderator", http.MethodDelete, middleware.RoleModerator, "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := fmt.Sprintf("/api/v1/user/%d", ids[tt.target])
+			if tt.method == http.MethodPut {
+				path += "/role"
+			}
+			req := httptest.NewRequest(tt.method, path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	role, err := userService.UserRole(context.Background(), ids[middleware.RoleUser])
+	if err != nil {
+		t.Fatalf("UserRole: %v", err)
+	}
+	if role != middleware.RoleModerator {
+		t.Errorf("role = %q, want %q", role, middleware.RoleModerator)
+	}
+}
@@ -1,38 +1,81 @@
 package routes
 
 import (
+	"github.com/cam-boltnote/go-ignite/internal/config"
 	"github.com/cam-boltnote/go-ignite/internal/connectors"
 	"github.com/cam-boltnote/go-ignite/internal/middleware"
 	"github.com/cam-boltnote/go-ignite/internal/services"
 
+	"context"
 	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"gorm.io/gorm"
 )
 
 type Routes struct {
 	db             *gorm.DB
+	database       *connectors.Database
 	emailSender    *connectors.EmailSender
+	tokenService   *services.TokenService
+	apiKeyService  *services.APIKeyService
 	userRoutes     *UserRoutes
+	mfaRoutes      *MFARoutes
+	oidcRoutes     *OIDCRoutes
+	apiKeyRoutes   *APIKeyRoutes
+	adminRoutes    *AdminRoutes
+	orgRoutes      *OrganizationRoutes
 	settingsRoutes *SettingsRoutes
 	testRoutes     *TestRoutes
+	metrics        config.MetricsConfig
+
+	impersonationService *services.ImpersonationService
 }
 
-func NewRoutes(db *gorm.DB, emailSender *connectors.EmailSender) *Routes {
+func NewRoutes(database *connectors.Database, emailSender *connectors.EmailSender, store *config.Store) *Routes {
+	cfg := store.Current()
+
+	var db *gorm.DB
+	if database != nil {
+		db = database.GetDB()
+	}
+
 	// Initialize test service and routes (always available)
 	testService := services.NewTestService()
 	testRoutes := NewTestRoutes(testService)
 
 	// Initialize other services and routes only if dependencies are available
+	var tokenService *services.TokenService
+	var apiKeyService *services.APIKeyService
 	var userRoutes *UserRoutes
+	var mfaRoutes *MFARoutes
+	var oidcRoutes *OIDCRoutes
+	var apiKeyRoutes *APIKeyRoutes
+	var adminRoutes *AdminRoutes
+	var orgRoutes *OrganizationRoutes
 	var settingsRoutes *SettingsRoutes
+	var impersonationService *services.ImpersonationService
 
 	if db != nil {
-		userService := services.NewUserService(db)
-		settingsService := services.NewSettingsService(db)
-		userRoutes = NewUserRoutes(userService)
+		settingsService := services.NewSettingsService(db, cfg)
+		tokenService = services.NewTokenService(db, cfg)
+		auditService := services.NewAuditService(db, cfg)
+		userService := services.NewUserService(db, emailSender, settingsService, tokenService, auditService, cfg)
+		store.Subscribe(userService.ApplyConfig)
+		passwordResetService := services.NewPasswordResetService(db, userService, cfg)
+		loginThrottle := services.NewLoginThrottleService(db, userService, cfg)
+		magicLinkService := services.NewMagicLinkService(db, userService, cfg)
+		userRoutes = NewUserRoutes(userService, tokenService, passwordResetService, loginThrottle, magicLinkService)
+		mfaRoutes = NewMFARoutes(services.NewMFAService(db, cfg), userService, tokenService, loginThrottle)
+		oidcService := services.NewOIDCService(db, userService, connectors.NewOIDCProviders(context.Background(), cfg.OIDC)...)
+		oidcRoutes = NewOIDCRoutes(oidcService, tokenService)
+		apiKeyService = services.NewAPIKeyService(db)
+		apiKeyRoutes = NewAPIKeyRoutes(apiKeyService)
+		impersonationService = services.NewImpersonationService(db, tokenService, cfg)
+		adminRoutes = NewAdminRoutes(impersonationService, auditService, store)
+		orgRoutes = NewOrganizationRoutes(services.NewOrganizationService(db, userService, cfg))
 		settingsRoutes = NewSettingsRoutes(settingsService)
 	} else {
 		log.Println("Database functionality is disabled. User and settings routes will not be available.")
@@ -40,10 +83,21 @@ func NewRoutes(db *gorm.DB, emailSender *connectors.EmailSender) *Routes {
 
 	return &Routes{
 		db:             db,
+		database:       database,
 		emailSender:    emailSender,
+		tokenService:   tokenService,
+		apiKeyService:  apiKeyService,
 		userRoutes:     userRoutes,
+		mfaRoutes:      mfaRoutes,
+		oidcRoutes:     oidcRoutes,
+		apiKeyRoutes:   apiKeyRoutes,
+		adminRoutes:    adminRoutes,
+		orgRoutes:      orgRoutes,
 		settingsRoutes: settingsRoutes,
 		testRoutes:     testRoutes,
+		metrics:        cfg.Metrics,
+
+		impersonationService: impersonationService,
 	}
 }
 
@@ -52,13 +106,28 @@ func (r *Routes) RegisterRoutes(router *gin.Engine) {
 	// Add CORS middleware
 	router.Use(middleware.CORSMiddleware())
 
+	// Tag every request with an ID for its logs and audit events
+	router.Use(middleware.RequestID())
+
+	// Read back this request's writes from the primary rather than a replica
+	router.Use(middleware.ReadYourWrites())
+
+	// Public keys for verifying our tokens
+	router.GET("/.well-known/jwks.json", middleware.JWKSHandler)
+
+	// Prometheus metrics, including the database connection pools, for scrapers holding the token
+	if r.metrics.Enabled {
+		router.GET("/metrics", middleware.RequireBearerToken(r.metrics.Token), gin.WrapH(promhttp.Handler()))
+	}
+
 	// API versioning group
 	v1 := router.Group("/api/v1")
 
 	// Public routes (no auth required)
 	if r.userRoutes != nil {
 		r.userRoutes.RegisterPublicRoutes(v1)
-		r.userRoutes.RegisterRoutes(v1)
+		r.mfaRoutes.RegisterPublicRoutes(v1)
+		r.oidcRoutes.RegisterPublicRoutes(v1)
 	} else {
 		// Register a placeholder route that returns a service unavailable message
 		v1.GET("/user", func(c *gin.Context) {
@@ -69,12 +138,30 @@ func (r *Routes) RegisterRoutes(router *gin.Engine) {
 	}
 
 	// Protected routes (auth required)
+	// Tokens can only be checked against the revocation list, and API keys can
+	// only be used, when the database is available
+	var authOptions middleware.AuthOptions
+	if r.tokenService != nil {
+		authOptions.Revocations = r.tokenService
+	}
+	if r.apiKeyService != nil {
+		authOptions.APIKeys = r.apiKeyService
+	}
+
 	protected := v1.Group("")
-	protected.Use(middleware.AuthMiddleware())
+	protected.Use(middleware.AuthMiddleware(authOptions))
+	if r.impersonationService != nil {
+		// Record every change made while an admin is acting as a user
+		protected.Use(middleware.AuditImpersonation(r.impersonationService))
+	}
 	{
 		// Protected user routes
 		if r.userRoutes != nil {
 			r.userRoutes.RegisterRoutes(protected)
+			r.mfaRoutes.RegisterRoutes(protected)
+			r.apiKeyRoutes.RegisterRoutes(protected)
+			r.adminRoutes.RegisterRoutes(protected)
+			r.orgRoutes.RegisterRoutes(protected)
 		}
 
 		// Settings routes
@@ -98,6 +185,14 @@ func (r *Routes) RegisterRoutes(router *gin.Engine) {
 					"email":    r.emailSender != nil && r.emailSender.IsEnabled(),
 				},
 			}
+			if r.db != nil {
+				pools, err := r.database.Health()
+				if err != nil {
+					log.Printf("Database health check failed: %v", err)
+					status["status"] = "degraded"
+				}
+				status["database_pools"] = pools
+			}
 			c.JSON(http.StatusOK, status)
 		})
 	}
@@ -0,0 +1,45 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMetricsRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name          string
+		metrics       config.MetricsConfig
+		authorization string
+		want          int
+	}{
+		{"off by default", config.MetricsConfig{}, "", http.StatusNotFound},
+		{"enabled without token", config.MetricsConfig{Enabled: true, Token: "s3cret"}, "", http.StatusUnauthorized},
+		{"enabled with wrong token", config.MetricsConfig{Enabled: true, Token: "s3cret"}, "Bearer guess", http.StatusUnauthorized},
+		{"enabled with token", config.MetricsConfig{Enabled: true, Token: "s3cret"}, "Bearer s3cret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			(&Routes{metrics: tt.metrics}).RegisterRoutes(router)
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
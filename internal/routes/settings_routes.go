@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"errors"
 	"strconv"
 
 	"github.com/cam-boltnote/go-ignite/internal/middleware"
@@ -26,22 +27,40 @@ func NewSettingsRoutes(settingsService *services.SettingsService) *SettingsRoute
 func (r *SettingsRoutes) RegisterRoutes(rg *gin.RouterGroup) {
 	settings := rg.Group("/settings")
 	{
+		settings.OPTIONS("/me", middleware.CorsOptionsHandler)
+		settings.GET("/me", middleware.RequirePermission(middleware.PermSettingsRead), r.GetCurrentSettings)
+
+		// Every :userId route is limited to the user's own settings unless the role grants the _any permission
+		read := []gin.HandlerFunc{
+			middleware.RequirePermission(middleware.PermSettingsRead),
+			middleware.RequireSelfOrPermission("userId", middleware.PermSettingsReadAny),
+		}
+		update := []gin.HandlerFunc{
+			middleware.RequirePermission(middleware.PermSettingsUpdate),
+			middleware.RequireSelfOrPermission("userId", middleware.PermSettingsUpdateAny),
+		}
+
 		settings.OPTIONS("/:userId", middleware.CorsOptionsHandler)
-		settings.GET("/:userId", r.GetSettings)
-		settings.PUT("/:userId", r.UpdateSettings)
+		settings.GET("/:userId", append(read, r.GetSettings)...)
+		settings.PUT("/:userId", append(update, r.UpdateSettings)...)
 
 		settings.OPTIONS("/:userId/notifications", middleware.CorsOptionsHandler)
-		settings.PUT("/:userId/notifications", r.UpdateNotificationSettings)
+		settings.PUT("/:userId/notifications", append(update, r.UpdateNotificationSettings)...)
 
 		settings.OPTIONS("/:userId/privacy", middleware.CorsOptionsHandler)
-		settings.PUT("/:userId/privacy", r.UpdatePrivacySettings)
+		settings.PUT("/:userId/privacy", append(update, r.UpdatePrivacySettings)...)
 
 		settings.OPTIONS("/:userId/general", middleware.CorsOptionsHandler)
-		settings.PUT("/:userId/general", r.UpdateGeneralSettings)
+		settings.PUT("/:userId/general", append(update, r.UpdateGeneralSettings)...)
+
+		// Changing how the account signs in needs a signed-in session, not an API key or impersonation
+		security := append([]gin.HandlerFunc{middleware.RequireTokenAuth(), middleware.BlockImpersonation()}, update...)
+		settings.OPTIONS("/:userId/security", middleware.CorsOptionsHandler)
+		settings.PUT("/:userId/security", append(security, r.UpdateSecuritySettings)...)
 
 		settings.OPTIONS("/:userId/custom", middleware.CorsOptionsHandler)
-		settings.PUT("/:userId/custom", r.UpdateCustomSettings)
-		settings.GET("/:userId/custom/:key", r.GetCustomSetting)
+		settings.PUT("/:userId/custom", append(update, r.UpdateCustomSettings)...)
+		settings.GET("/:userId/custom/:key", append(read, r.GetCustomSetting)...)
 	}
 }
 
@@ -53,7 +72,18 @@ func (r *SettingsRoutes) GetSettings(c *gin.Context) {
 		return
 	}
 
-	settings, err := r.settingsService.GetByUserID(uint(userID))
+	settings, err := r.settingsService.GetByUserID(c.Request.Context(), uint(userID))
+	if err != nil {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, settings)
+}
+
+// GetCurrentSettings retrieves the authenticated user's settings
+func (r *SettingsRoutes) GetCurrentSettings(c *gin.Context) {
+	settings, err := r.settingsService.GetByUserID(c.Request.Context(), c.GetUint("user_id"))
 	if err != nil {
 		c.JSON(404, gin.H{"error": err.Error()})
 		return
@@ -77,7 +107,7 @@ func (r *SettingsRoutes) UpdateSettings(c *gin.Context) {
 	}
 
 	settings.UserID = uint(userID)
-	if err := r.settingsService.Update(&settings); err != nil {
+	if err := r.settingsService.Update(c.Request.Context(), &settings); err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
@@ -105,6 +135,7 @@ func (r *SettingsRoutes) UpdateNotificationSettings(c *gin.Context) {
 	}
 
 	if err := r.settingsService.UpdateNotificationSettings(
+		c.Request.Context(),
 		uint(userID),
 		input.EmailEnabled,
 		input.PushEnabled,
@@ -136,6 +167,7 @@ func (r *SettingsRoutes) UpdatePrivacySettings(c *gin.Context) {
 	}
 
 	if err := r.settingsService.UpdatePrivacySettings(
+		c.Request.Context(),
 		uint(userID),
 		input.Visibility,
 		input.DataSharing,
@@ -147,6 +179,35 @@ func (r *SettingsRoutes) UpdatePrivacySettings(c *gin.Context) {
 	c.JSON(200, gin.H{"message": "Privacy settings updated successfully"})
 }
 
+// UpdateSecuritySettings updates sign-in preferences
+func (r *SettingsRoutes) UpdateSecuritySettings(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input struct {
+		PasswordlessOnly *bool `json:"passwordless_only" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.settingsService.UpdateSecuritySettings(c.Request.Context(), uint(userID), *input.PasswordlessOnly); err != nil {
+		if errors.Is(err, services.ErrEmailNotVerified) {
+			c.JSON(400, gin.H{"error": "Verify your email address before turning on passwordless sign-in"})
+			return
+		}
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Security settings updated successfully"})
+}
+
 // UpdateGeneralSettings updates general preferences
 func (r *SettingsRoutes) UpdateGeneralSettings(c *gin.Context) {
 	userID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
@@ -167,6 +228,7 @@ func (r *SettingsRoutes) UpdateGeneralSettings(c *gin.Context) {
 	}
 
 	if err := r.settingsService.UpdateGeneralSettings(
+		c.Request.Context(),
 		uint(userID),
 		input.Timezone,
 		input.Language,
@@ -193,7 +255,7 @@ func (r *SettingsRoutes) UpdateCustomSettings(c *gin.Context) {
 		return
 	}
 
-	if err := r.settingsService.UpdateCustomSettings(uint(userID), customSettings); err != nil {
+	if err := r.settingsService.UpdateCustomSettings(c.Request.Context(), uint(userID), customSettings); err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
@@ -210,7 +272,7 @@ func (r *SettingsRoutes) GetCustomSetting(c *gin.Context) {
 	}
 
 	key := c.Param("key")
-	value, err := r.settingsService.GetCustomSetting(uint(userID), key)
+	value, err := r.settingsService.GetCustomSetting(c.Request.Context(), uint(userID), key)
 	if err != nil {
 		c.JSON(404, gin.H{"error": err.Error()})
 		return
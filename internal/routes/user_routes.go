@@ -1,7 +1,10 @@
 package routes
 
 import (
+	"errors"
+	"math"
 	"strconv"
+	"time"
 
 	"github.com/cam-boltnote/go-ignite/internal/middleware"
 	"github.com/cam-boltnote/go-ignite/internal/models"
@@ -10,15 +13,26 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// mfaLoginTokenTTL bounds the time between the password step and the MFA step of a login
+const mfaLoginTokenTTL = 5 * time.Minute
+
 // UserRoutes handles all user-related routes
 type UserRoutes struct {
-	userService *services.UserService
+	userService          *services.UserService
+	tokenService         *services.TokenService
+	passwordResetService *services.PasswordResetService
+	loginThrottle        *services.LoginThrottleService
+	magicLinkService     *services.MagicLinkService
 }
 
 // NewUserRoutes creates a new user routes instance
-func NewUserRoutes(userService *services.UserService) *UserRoutes {
+func NewUserRoutes(userService *services.UserService, tokenService *services.TokenService, passwordResetService *services.PasswordResetService, loginThrottle *services.LoginThrottleService, magicLinkService *services.MagicLinkService) *UserRoutes {
 	return &UserRoutes{
-		userService: userService,
+		userService:          userService,
+		tokenService:         tokenService,
+		passwordResetService: passwordResetService,
+		loginThrottle:        loginThrottle,
+		magicLinkService:     magicLinkService,
 	}
 }
 
@@ -30,28 +44,103 @@ func (r *UserRoutes) RegisterPublicRoutes(rg *gin.RouterGroup) {
 
 	rg.OPTIONS("/user/login", middleware.CorsOptionsHandler)
 	rg.POST("/user/login", r.Login)
+
+	rg.OPTIONS("/user/login/magic", middleware.CorsOptionsHandler)
+	rg.POST("/user/login/magic", r.RequestMagicLink)
+
+	rg.OPTIONS("/user/login/magic/verify", middleware.CorsOptionsHandler)
+	rg.POST("/user/login/magic/verify", r.RedeemMagicLink)
+
+	rg.OPTIONS("/user/refresh", middleware.CorsOptionsHandler)
+	rg.POST("/user/refresh", r.Refresh)
+
+	rg.OPTIONS("/user/password/forgot", middleware.CorsOptionsHandler)
+	rg.POST("/user/password/forgot", r.ForgotPassword)
+
+	rg.OPTIONS("/user/password/reset", middleware.CorsOptionsHandler)
+	rg.POST("/user/password/reset", r.ResetPassword)
+
+	rg.OPTIONS("/user/email/verify", middleware.CorsOptionsHandler)
+	rg.POST("/user/email/verify", r.VerifyEmail)
 }
 
 // RegisterRoutes registers protected user-related routes
 func (r *UserRoutes) RegisterRoutes(rg *gin.RouterGroup) {
 	users := rg.Group("/user")
 	{
+		// OPTIONS is registered with the public POST /user
+		users.GET("", middleware.RequirePermission(middleware.PermUsersReadAny), r.ListUsers)
+
+		users.OPTIONS("/logout", middleware.CorsOptionsHandler)
+		users.POST("/logout", middleware.RequireTokenAuth(), r.Logout)
+
+		users.OPTIONS("/me", middleware.CorsOptionsHandler)
+		users.GET("/me", middleware.RequirePermission(middleware.PermUsersRead), r.GetCurrentUser)
+
+		// Sessions belong to signed-in devices, so API keys can't manage them
+		users.OPTIONS("/me/sessions", middleware.CorsOptionsHandler)
+		users.GET("/me/sessions", middleware.RequireTokenAuth(), r.ListSessions)
+		users.DELETE("/me/sessions", middleware.RequireTokenAuth(), middleware.BlockImpersonation(), r.RevokeOtherSessions)
+
+		users.OPTIONS("/me/sessions/:sessionId", middleware.CorsOptionsHandler)
+		users.DELETE("/me/sessions/:sessionId", middleware.RequireTokenAuth(), middleware.BlockImpersonation(), r.RevokeSession)
+
 		users.OPTIONS("/:id", middleware.CorsOptionsHandler)
-		users.GET("/:id", r.GetUser)
-		users.PUT("/:id", r.UpdateUser)
-		users.DELETE("/:id", r.DeleteUser)
+		users.GET("/:id",
+			middleware.RequirePermission(middleware.PermUsersRead),
+			middleware.RequireSelfOrPermission("id", middleware.PermUsersReadAny),
+			r.GetUser)
+		users.PUT("/:id",
+			middleware.RequirePermission(middleware.PermUsersUpdate),
+			middleware.RequireSelfOrPermission("id", middleware.PermUsersUpdateAny),
+			r.UpdateUser)
+		users.DELETE("/:id",
+			middleware.BlockImpersonation(),
+			middleware.RequirePermission(middleware.PermUsersDelete),
+			middleware.RequireLowerRole(r.userService, "id"),
+			r.DeleteUser)
+
+		users.OPTIONS("/email/verify/resend", middleware.CorsOptionsHandler)
+		users.POST("/email/verify/resend", r.ResendEmailVerification)
 
 		users.OPTIONS("/email/:email", middleware.CorsOptionsHandler)
-		users.GET("/email/:email", r.GetUserByEmail)
+		users.GET("/email/:email",
+			middleware.RequirePermission(middleware.PermUsersRead),
+			middleware.RequireSelfEmailOrPermission("email", middleware.PermUsersReadAny),
+			r.GetUserByEmail)
 
 		users.OPTIONS("/:id/password", middleware.CorsOptionsHandler)
-		users.PUT("/:id/password", r.UpdatePassword)
+		users.PUT("/:id/password",
+			middleware.RequireTokenAuth(),
+			middleware.BlockImpersonation(),
+			middleware.RequirePermission(middleware.PermUsersUpdate),
+			middleware.RequireSelfOrPermission("id", middleware.PermUsersUpdateAny),
+			r.UpdatePassword)
+
+		users.OPTIONS("/:id/role", middleware.CorsOptionsHandler)
+		users.PUT("/:id/role",
+			middleware.BlockImpersonation(),
+			middleware.RequirePermission(middleware.PermUsersManageRoles),
+			middleware.RequireLowerRole(r.userService, "id"),
+			r.UpdateRole)
 
 		users.OPTIONS("/:id/activate", middleware.CorsOptionsHandler)
-		users.PUT("/:id/activate", r.ActivateUser)
+		users.PUT("/:id/activate",
+			middleware.RequirePermission(middleware.PermUsersActivate),
+			middleware.RequireLowerRole(r.userService, "id"),
+			r.ActivateUser)
 
 		users.OPTIONS("/:id/deactivate", middleware.CorsOptionsHandler)
-		users.PUT("/:id/deactivate", r.DeactivateUser)
+		users.PUT("/:id/deactivate",
+			middleware.RequirePermission(middleware.PermUsersActivate),
+			middleware.RequireLowerRole(r.userService, "id"),
+			r.DeactivateUser)
+
+		users.OPTIONS("/:id/unlock", middleware.CorsOptionsHandler)
+		users.PUT("/:id/unlock",
+			middleware.RequirePermission(middleware.PermUsersActivate),
+			middleware.RequireLowerRole(r.userService, "id"),
+			r.UnlockUser)
 	}
 }
 
@@ -64,7 +153,7 @@ func (r *UserRoutes) CreateUser(c *gin.Context) {
 		return
 	}
 
-	user, err := r.userService.CreateUser(input)
+	user, err := r.userService.CreateUser(c.Request.Context(), input)
 	if err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
@@ -85,25 +174,391 @@ func (r *UserRoutes) Login(c *gin.Context) {
 		return
 	}
 
-	user, err := r.userService.ValidateCredentials(loginInput.Email, loginInput.Password)
+	// Slow down and lock out password guessing per account and per client IP
+	if !checkLoginThrottle(c, r.loginThrottle, loginInput.Email) {
+		return
+	}
+
+	user, err := r.userService.ValidateCredentials(c.Request.Context(), loginInput.Email, loginInput.Password)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			r.loginThrottle.RecordFailure(c.Request.Context(), loginInput.Email, c.ClientIP())
+		}
+		if errors.Is(err, services.ErrAccountInactive) {
+			c.JSON(403, gin.H{"error": "Account is deactivated"})
+			return
+		}
+		if errors.Is(err, services.ErrEmailNotVerified) {
+			c.JSON(403, gin.H{"error": "Email address has not been verified"})
+			return
+		}
+		if errors.Is(err, services.ErrPasswordlessOnly) {
+			c.JSON(403, gin.H{"error": "This account signs in with email links only"})
+			return
+		}
 		c.JSON(401, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	// Generate JWT token
-	token, err := middleware.GenerateToken(user)
+	// With MFA the failures are only cleared once the second step passes, or
+	// knowing the password would allow guessing codes without limit
+	if !user.MFAEnabled {
+		r.loginThrottle.RecordSuccess(c.Request.Context(), loginInput.Email)
+	}
+	respondWithLogin(c, r.tokenService, user, "password")
+}
+
+// checkLoginThrottle responds with 429 and returns false while the account or
+// the client IP must wait before another login attempt
+func checkLoginThrottle(c *gin.Context, loginThrottle *services.LoginThrottleService, email string) bool {
+	wait, err := loginThrottle.Check(c.Request.Context(), email, c.ClientIP())
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, services.ErrLoginThrottled) {
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(429, gin.H{"error": "Too many failed login attempts. Try again later.", "retry_after": retryAfter})
+		return false
+	}
+	c.JSON(500, gin.H{"error": "Error checking login attempts"})
+	return false
+}
+
+// RequestMagicLink emails a single-use sign-in link
+func (r *UserRoutes) RequestMagicLink(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	wait, err := r.magicLinkService.RequestLink(c.Request.Context(), input.Email)
+	if err != nil {
+		if errors.Is(err, services.ErrMagicLinkRateLimited) {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(429, gin.H{"error": "Too many sign-in links requested. Try again later.", "retry_after": retryAfter})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Error processing sign-in link request"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "If an account exists for this email, a sign-in link has been sent"})
+}
+
+// RedeemMagicLink exchanges a sign-in link for the same response as Login
+func (r *UserRoutes) RedeemMagicLink(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := r.magicLinkService.Redeem(c.Request.Context(), input.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidMagicLink):
+			c.JSON(401, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrAccountInactive):
+			c.JSON(403, gin.H{"error": "Account is deactivated"})
+		default:
+			c.JSON(500, gin.H{"error": "Error signing in"})
+		}
+		return
+	}
+
+	if !user.MFAEnabled {
+		r.loginThrottle.RecordSuccess(c.Request.Context(), user.Email)
+	}
+	respondWithLogin(c, r.tokenService, user, "magic_link")
+}
+
+// respondWithLogin finishes a successful first authentication step. With MFA
+// enabled it only returns a short-lived token for the second step; otherwise
+// it starts a session and issues access and refresh tokens.
+func respondWithLogin(c *gin.Context, tokenService *services.TokenService, user *models.User, method string) {
+	if user.MFAEnabled {
+		mfaToken, err := middleware.GenerateActionTokenWithData(middleware.PurposeMFALogin, user.ID, user.Email,
+			map[string]string{"method": method}, mfaLoginTokenTTL)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Error generating token"})
+			return
+		}
+		c.JSON(200, gin.H{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+			"expires_in":   int64(mfaLoginTokenTTL.Seconds()),
+		})
+		return
+	}
+
+	// Generate access and refresh tokens
+	tokens, err := tokenService.IssueTokens(c.Request.Context(), user, sessionInfo(c, method))
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Error generating token"})
 		return
 	}
 
+	c.JSON(200, loginResponse(tokens, user))
+}
+
+// sessionInfo describes the requesting device for a new or refreshed session
+func sessionInfo(c *gin.Context, method string) services.SessionInfo {
+	return services.SessionInfo{
+		Method:    method,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token pair
+func (r *UserRoutes) Refresh(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, user, err := r.tokenService.Refresh(c.Request.Context(), input.RefreshToken, sessionInfo(c, ""))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+			c.JSON(401, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Error refreshing token"})
+		return
+	}
+
+	c.JSON(200, loginResponse(tokens, user))
+}
+
+// Logout revokes the current access token and the given refresh token
+func (r *UserRoutes) Logout(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	// The body is optional; without a refresh token only the access token is revoked
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	claims, ok := c.MustGet("claims").(*middleware.Claims)
+	if !ok {
+		c.JSON(401, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	if err := r.tokenService.Logout(c.Request.Context(), claims, input.RefreshToken); err != nil {
+		c.JSON(500, gin.H{"error": "Error logging out"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Logged out successfully"})
+}
+
+// ListSessions lists the devices the current user is signed in on
+func (r *UserRoutes) ListSessions(c *gin.Context) {
+	sessions, err := r.tokenService.ListSessions(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"sessions":           sessions,
+		"current_session_id": currentSessionID(c),
+	})
+}
+
+// RevokeSession signs the current user out of one session
+func (r *UserRoutes) RevokeSession(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("sessionId"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	if err := r.tokenService.RevokeSession(c.Request.Context(), c.GetUint("user_id"), uint(id)); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Session signed out"})
+}
+
+// RevokeOtherSessions signs the current user out everywhere except this session
+func (r *UserRoutes) RevokeOtherSessions(c *gin.Context) {
+	count, err := r.tokenService.RevokeOtherSessions(c.Request.Context(), c.GetUint("user_id"), currentSessionID(c))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Signed out of all other sessions", "revoked": count})
+}
+
+// currentSessionID returns the session of the request's access token, or 0
+func currentSessionID(c *gin.Context) uint {
+	if claims, ok := c.MustGet("claims").(*middleware.Claims); ok {
+		return claims.SessionID
+	}
+	return 0
+}
+
+// ForgotPassword sends a password reset link. The response is the same whether
+// or not the email belongs to an account.
+func (r *UserRoutes) ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.passwordResetService.RequestReset(c.Request.Context(), input.Email); err != nil {
+		c.JSON(500, gin.H{"error": "Error processing password reset request"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "If an account exists for this email, a password reset link has been sent"})
+}
+
+// ResetPassword sets a new password using a reset token
+func (r *UserRoutes) ResetPassword(c *gin.Context) {
+	var input struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.passwordResetService.ResetPassword(c.Request.Context(), input.Token, input.NewPassword); err != nil {
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			c.JSON(400, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Password has been reset successfully"})
+}
+
+// VerifyEmail redeems an email verification link
+func (r *UserRoutes) VerifyEmail(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := r.userService.VerifyEmail(c.Request.Context(), input.Token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			c.JSON(400, gin.H{"error": "Invalid or expired verification token"})
+			return
+		}
+		if errors.Is(err, services.ErrEmailTaken) {
+			c.JSON(409, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Error verifying email"})
+		return
+	}
+
 	c.JSON(200, gin.H{
-		"token": token,
-		"user":  user,
+		"message": "Email verified successfully",
+		"user":    user,
 	})
 }
 
+// ResendEmailVerification re-sends the verification link to the current user
+func (r *UserRoutes) ResendEmailVerification(c *gin.Context) {
+	wait, err := r.userService.ResendEmailVerification(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		if errors.Is(err, services.ErrVerificationResendThrottled) {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(429, gin.H{"error": "A verification email was sent recently. Try again later.", "retry_after": retryAfter})
+			return
+		}
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Verification email sent"})
+}
+
+// loginResponse builds the response body returned whenever a user obtains tokens
+func loginResponse(tokens *services.TokenPair, user *models.User) gin.H {
+	return gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"token_type":    tokens.TokenType,
+		"expires_in":    tokens.ExpiresIn,
+		"user":          user,
+	}
+}
+
+// ListUsers lists users matching the filters, search and sort of the query string
+func (r *UserRoutes) ListUsers(c *gin.Context) {
+	query, err := services.ParseListQuery(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	users, err := r.userService.List(c.Request.Context(), query)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidQuery) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Error listing users"})
+		return
+	}
+
+	c.JSON(200, users)
+}
+
+// GetCurrentUser retrieves the authenticated user
+func (r *UserRoutes) GetCurrentUser(c *gin.Context) {
+	user, err := r.userService.GetByID(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, user)
+}
+
 // GetUser retrieves a user by ID
 func (r *UserRoutes) GetUser(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -112,7 +567,7 @@ func (r *UserRoutes) GetUser(c *gin.Context) {
 		return
 	}
 
-	user, err := r.userService.GetByID(uint(id))
+	user, err := r.userService.GetByID(c.Request.Context(), uint(id))
 	if err != nil {
 		c.JSON(404, gin.H{"error": err.Error()})
 		return
@@ -136,7 +591,11 @@ func (r *UserRoutes) UpdateUser(c *gin.Context) {
 	}
 
 	user.ID = uint(id)
-	if err := r.userService.Update(&user); err != nil {
+	if err := r.userService.Update(c.Request.Context(), &user); err != nil {
+		if errors.Is(err, services.ErrEmailTaken) {
+			c.JSON(409, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
@@ -148,7 +607,7 @@ func (r *UserRoutes) UpdateUser(c *gin.Context) {
 func (r *UserRoutes) GetUserByEmail(c *gin.Context) {
 	email := c.Param("email")
 
-	user, err := r.userService.GetByEmail(email)
+	user, err := r.userService.GetByEmail(c.Request.Context(), email)
 	if err != nil {
 		c.JSON(404, gin.H{"error": err.Error()})
 		return
@@ -165,7 +624,7 @@ func (r *UserRoutes) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	if err := r.userService.Delete(uint(id)); err != nil {
+	if err := r.userService.Delete(c.Request.Context(), uint(id)); err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
@@ -191,29 +650,47 @@ func (r *UserRoutes) UpdatePassword(c *gin.Context) {
 		return
 	}
 
-	// Validate current password
-	user, err := r.userService.GetByID(uint(id))
+	if err := r.userService.ChangePassword(c.Request.Context(), uint(id), input.CurrentPassword, input.NewPassword); err != nil {
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			c.JSON(401, gin.H{"error": "Current password is incorrect"})
+			return
+		}
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Password updated successfully"})
+}
+
+// UpdateRole changes a user's role
+func (r *UserRoutes) UpdateRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(404, gin.H{"error": err.Error()})
+		c.JSON(400, gin.H{"error": "Invalid user ID"})
 		return
 	}
 
-	// Note: In a real application, you would:
-	// 1. Hash the current password
-	// 2. Compare it with the stored hash
-	// 3. If they match, hash the new password
-	// 4. Update the stored hash
-	if user.Password != input.CurrentPassword {
-		c.JSON(401, gin.H{"error": "Current password is incorrect"})
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := r.userService.UpdatePassword(uint(id), input.NewPassword); err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+	// Nobody can grant a role as high as their own
+	if middleware.RoleRank(input.Role) >= middleware.RoleRank(c.GetString("role")) {
+		c.JSON(403, gin.H{"error": "You can only assign roles lower than your own"})
 		return
 	}
 
-	c.JSON(200, gin.H{"message": "Password updated successfully"})
+	if err := r.userService.UpdateRole(c.Request.Context(), uint(id), input.Role); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "User role updated successfully"})
 }
 
 // ActivateUser activates a user account
@@ -224,7 +701,7 @@ func (r *UserRoutes) ActivateUser(c *gin.Context) {
 		return
 	}
 
-	if err := r.userService.Activate(uint(id)); err != nil {
+	if err := r.userService.Activate(c.Request.Context(), uint(id)); err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
@@ -232,6 +709,22 @@ func (r *UserRoutes) ActivateUser(c *gin.Context) {
 	c.JSON(200, gin.H{"message": "User account activated successfully"})
 }
 
+// UnlockUser lifts a lockout caused by repeated failed logins
+func (r *UserRoutes) UnlockUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := r.loginThrottle.Unlock(c.Request.Context(), uint(id), c.GetUint("user_id")); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "User account unlocked successfully"})
+}
+
 // DeactivateUser deactivates a user account
 func (r *UserRoutes) DeactivateUser(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -240,7 +733,7 @@ func (r *UserRoutes) DeactivateUser(c *gin.Context) {
 		return
 	}
 
-	if err := r.userService.Deactivate(uint(id)); err != nil {
+	if err := r.userService.Deactivate(c.Request.Context(), uint(id)); err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
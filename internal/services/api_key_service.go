@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// apiKeyPrefix marks our keys so they are easy to recognise, e.g. by secret scanners
+	apiKeyPrefix = "ign_"
+	// maxAPIKeysPerUser caps the number of active keys a user may hold
+	maxAPIKeysPerUser = 25
+	// apiKeyLastUsedInterval limits how often last_used_at is written for a busy key
+	apiKeyLastUsedInterval = time.Minute
+)
+
+var (
+	// ErrAPIKeyNotFound is returned when revoking a key that doesn't exist or belongs to another user
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrInvalidAPIKeyScope is returned when a requested scope is not granted by the user's role
+	ErrInvalidAPIKeyScope = errors.New("invalid API key scope")
+	// ErrTooManyAPIKeys is returned when the user already holds the maximum number of keys
+	ErrTooManyAPIKeys = errors.New("too many active API keys")
+)
+
+// APIKeyService manages personal API keys and authenticates requests made with them
+type APIKeyService struct {
+	db     *gorm.DB
+	logger *utils.Logger
+}
+
+// NewAPIKeyService creates a new API key service instance
+func NewAPIKeyService(db *gorm.DB) *APIKeyService {
+	return &APIKeyService{
+		db:     db,
+		logger: utils.GetLogger().WithService("api_key_service"),
+	}
+}
+
+// CreateAPIKeyInput represents the input for creating an API key
+type CreateAPIKeyInput struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Create issues a new API key for the user. Scopes must be permissions the user's
+// role grants. The returned plaintext key is shown once and can't be recovered.
+func (s *APIKeyService) Create(ctx context.Context, userID uint, input CreateAPIKeyInput) (*models.APIKey, string, error) {
+	s.logger.Info("Creating API key", map[string]interface{}{
+		"user_id": userID,
+	})
+
+	var user models.User
+	if err := connectors.Conn(ctx, s.db).Select("id", "role").First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", errors.New("user not found")
+		}
+		return nil, "", err
+	}
+
+	for _, scope := range input.Scopes {
+		if !middleware.HasPermission(user.Role, scope) {
+			return nil, "", ErrInvalidAPIKeyScope
+		}
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return nil, "", errors.New("expiry must be in the future")
+	}
+
+	var active int64
+	if err := s.activeKeys(ctx, userID).Model(&models.APIKey{}).Count(&active).Error; err != nil {
+		return nil, "", err
+	}
+	if active >= maxAPIKeysPerUser {
+		return nil, "", ErrTooManyAPIKeys
+	}
+
+	prefix, err := generateOpaqueToken(6)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := generateOpaqueToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &models.APIKey{
+		UserID:     userID,
+		Name:       input.Name,
+		Prefix:     apiKeyPrefix + prefix,
+		SecretHash: hashOpaqueToken(secret),
+		Scopes:     input.Scopes,
+		ExpiresAt:  input.ExpiresAt,
+	}
+	if err := connectors.Conn(ctx, s.db).Create(key).Error; err != nil {
+		s.logger.Error("Failed to create API key", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		return nil, "", err
+	}
+
+	return key, key.Prefix + "." + secret, nil
+}
+
+// List returns the user's active API keys, newest first
+func (s *APIKeyService) List(ctx context.Context, userID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := s.activeKeys(ctx, userID).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// Revoke revokes one of the user's API keys
+func (s *APIKeyService) Revoke(ctx context.Context, userID, keyID uint) error {
+	s.logger.Info("Revoking API key", map[string]interface{}{
+		"user_id": userID,
+		"key_id":  keyID,
+	})
+
+	result := connectors.Conn(ctx, s.db).Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey resolves a plaintext API key to the user it acts as.
+// It implements middleware.APIKeyAuthenticator.
+func (s *APIKeyService) AuthenticateAPIKey(ctx context.Context, plaintext string) (*middleware.APIKeyPrincipal, error) {
+	prefix, secret, ok := strings.Cut(plaintext, ".")
+	if !ok || !strings.HasPrefix(prefix, apiKeyPrefix) || secret == "" {
+		return nil, middleware.ErrInvalidAPIKey
+	}
+
+	var key models.APIKey
+	if err := connectors.Conn(ctx, s.db).Where("prefix = ?", prefix).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, middleware.ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.SecretHash), []byte(hashOpaqueToken(secret))) != 1 {
+		return nil, middleware.ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, middleware.ErrInvalidAPIKey
+	}
+
+	var user models.User
+	if err := connectors.Conn(ctx, s.db).Select("id", "email", "role", "is_active").First(&user, key.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, middleware.ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, middleware.ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyLastUsedInterval {
+		if err := connectors.Conn(ctx, s.db).Model(&key).UpdateColumn("last_used_at", now).Error; err != nil {
+			s.logger.Warn("Failed to record API key use", map[string]interface{}{
+				"key_id": key.ID,
+				"error":  err.Error(),
+			})
+		}
+	}
+
+	return &middleware.APIKeyPrincipal{
+		KeyID:  key.ID,
+		UserID: user.ID,
+		Email:  user.Email,
+		Role:   user.Role,
+		Scopes: key.Scopes,
+	}, nil
+}
+
+// activeKeys scopes a query to the user's unrevoked, unexpired keys
+func (s *APIKeyService) activeKeys(ctx context.Context, userID uint) *gorm.DB {
+	return connectors.Conn(ctx, s.db).Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now())
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+)
+
+func TestCreateAPIKeyScopes(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewAPIKeyService(db)
+	ctx := context.Background()
+	user := createTestUser(t, db, cfg, "ada@example.com", middleware.RoleUser)
+	admin := createTestUser(t, db, cfg, "root@example.com", middleware.RoleAdmin)
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		userID    uint
+		scopes    []string
+		expiresAt *time.Time
+		wantErr   error
+	}{
+		{"scopes the role grants", user.ID, []string{middleware.PermUsersRead, middleware.PermSettingsRead}, nil, nil},
+		{"scope beyond the role", user.ID, []string{middleware.PermUsersRead, middleware.PermUsersDelete}, nil, ErrInvalidAPIKeyScope},
+		{"resource wildcard beyond the role", user.ID, []string{"users:*"}, nil, ErrInvalidAPIKeyScope},
+		{"unknown scope", user.ID, []string{"launch:missiles"}, nil, ErrInvalidAPIKeyScope},
+		{"admin wildcard", admin.ID, []string{"*"}, nil, nil},
+		{"expiry in the past", user.ID, []string{middleware.PermUsersRead}, &past, errors.New("expiry must be in the future")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, plaintext, err := service.Create(ctx, tt.userID, CreateAPIKeyInput{Name: tt.name, Scopes: tt.scopes, ExpiresAt: tt.expiresAt})
+			if tt.wantErr != nil {
+				if err == nil || err.Error() != tt.wantErr.Error() {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+
+			principal, err := service.AuthenticateAPIKey(ctx, plaintext)
+			if err != nil {
+				t.Fatalf("AuthenticateAPIKey: %v", err)
+			}
+			if principal.KeyID != key.ID || principal.UserID != tt.userID || len(principal.Scopes) != len(tt.scopes) {
+				t.Errorf("principal = %+v, want key %d of user %d with scopes %v", principal, key.ID, tt.userID, tt.scopes)
+			}
+		})
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewAPIKeyService(db)
+	ctx := context.Background()
+	user := createTestUser(t, db, cfg, "ada@example.com", middleware.RoleUser)
+	inactive := createTestUser(t, db, cfg, "gone@example.com", middleware.RoleUser)
+
+	create := func(userID uint) (*models.APIKey, string) {
+		key, plaintext, err := service.Create(ctx, userID, CreateAPIKeyInput{Name: "ci", Scopes: []string{middleware.PermUsersRead}})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		return key, plaintext
+	}
+	_, valid := create(user.ID)
+	revokedKey, revoked := create(user.ID)
+	if err := service.Revoke(ctx, user.ID, revokedKey.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	expiredKey, expired := create(user.ID)
+	db.Model(expiredKey).Update("expires_at", time.Now().Add(-time.Minute))
+	_, ofInactive := create(inactive.ID)
+	db.Model(inactive).Update("is_active", false)
+
+	prefix, _, _ := strings.Cut(valid, ".")
+
+	tests := []struct {
+		name    string
+		key     string
+		wantErr error
+	}{
+		{"valid key", valid, nil},
+		{"wrong secret", prefix + ".wrong", middleware.ErrInvalidAPIKey},
+		{"unknown prefix", "ign_unknown.secret", middleware.ErrInvalidAPIKey},
+		{"no separator", prefix, middleware.ErrInvalidAPIKey},
+		{"foreign prefix", "sk_live.secret", middleware.ErrInvalidAPIKey},
+		{"revoked key", revoked, middleware.ErrInvalidAPIKey},
+		{"expired key", expired, middleware.ErrInvalidAPIKey},
+		{"inactive user", ofInactive, middleware.ErrInvalidAPIKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.AuthenticateAPIKey(ctx, tt.key); !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	keys, err := service.List(ctx, user.ID)
+	if err != nil || len(keys) != 1 {
+		t.Errorf("List returned %d keys (%v), want only the active one", len(keys), err)
+	}
+}
+
+func TestRevokeAPIKeyOfAnotherUser(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewAPIKeyService(db)
+	ctx := context.Background()
+	owner := createTestUser(t, db, cfg, "ada@example.com", middleware.RoleUser)
+	other := createTestUser(t, db, cfg, "bob@example.com", middleware.RoleUser)
+
+	key, plaintext, err := service.Create(ctx, owner.ID, CreateAPIKeyInput{Name: "ci", Scopes: []string{middleware.PermUsersRead}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := service.Revoke(ctx, other.ID, key.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("err = %v, want ErrAPIKeyNotFound", err)
+	}
+	if _, err := service.AuthenticateAPIKey(ctx, plaintext); err != nil {
+		t.Errorf("the key stopped working: %v", err)
+	}
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// auditIgnoredFields are never reported as changes
+var auditIgnoredFields = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+}
+
+// auditChainMu serializes chained inserts made by this process; the row lock
+// on the latest event does the same across processes
+var auditChainMu sync.Mutex
+
+// AuditService records who changed what in an append-only audit log
+type AuditService struct {
+	db        *gorm.DB
+	hashChain bool
+	logger    *utils.Logger
+}
+
+// NewAuditService creates a new audit service instance. Enabling audit.hash_chain
+// links every event to the previous one by hash.
+func NewAuditService(db *gorm.DB, cfg *config.Config) *AuditService {
+	return &AuditService{
+		db:        db,
+		hashChain: cfg.Audit.HashChain,
+		logger:    utils.GetLogger().WithService("audit_service"),
+	}
+}
+
+// AuditFilter narrows an audit log query; zero values match everything
+type AuditFilter struct {
+	ActorID    uint      `form:"actor_id"`
+	Action     string    `form:"action"`
+	TargetType string    `form:"target_type"`
+	TargetID   string    `form:"target_id"`
+	RequestID  string    `form:"request_id"`
+	Since      time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until      time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// ChainVerification is the result of checking the audit hash chain
+type ChainVerification struct {
+	Valid    bool  `json:"valid"`
+	Checked  int64 `json:"checked"`             // Hashed events checked
+	BrokenAt *uint `json:"broken_at,omitempty"` // First event whose hash or link doesn't match
+}
+
+// Record stores a change to the target made by the actor in ctx. before and
+// after are the target before and after the change (either may be nil); only
+// the fields that differ are kept. Updates that changed nothing are skipped.
+// Failures are logged rather than returned, so auditing never fails the change.
+// In a transaction the event is part of it, and is dropped if it rolls back.
+func (s *AuditService) Record(ctx context.Context, action, targetType string, targetID uint, before, after interface{}) {
+	changes := auditDiff(before, after)
+	if before != nil && after != nil && len(changes) == 0 {
+		return
+	}
+
+	s.RecordEvent(ctx, &models.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   strconv.FormatUint(uint64(targetID), 10),
+		Changes:    changes,
+	})
+}
+
+// RecordEvent stores an event, filling in the actor and request details from ctx
+func (s *AuditService) RecordEvent(ctx context.Context, event *models.AuditEvent) {
+	if actor, ok := models.AuditActorFromContext(ctx); ok {
+		event.ActorID = optionalID(actor.UserID)
+		event.ImpersonatorID = optionalID(actor.ImpersonatorID)
+		event.APIKeyID = optionalID(actor.APIKeyID)
+		event.IP = actor.IP
+		event.UserAgent = actor.UserAgent
+		event.RequestID = actor.RequestID
+	}
+	// Stored with millisecond precision so the hash can be recomputed from the row
+	event.CreatedAt = time.Now().UTC().Truncate(time.Millisecond)
+
+	// The change has been made; record it even if the request is cancelled now
+	ctx = context.WithoutCancel(ctx)
+
+	var err error
+	if s.hashChain {
+		err = s.createChained(ctx, event)
+	} else {
+		// A savepoint keeps a failed insert from aborting the caller's transaction
+		err = connectors.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+			return tx.Create(event).Error
+		})
+	}
+	if err != nil {
+		s.logger.Error("Failed to record audit event", err, map[string]interface{}{
+			"action":      event.Action,
+			"target_type": event.TargetType,
+			"target_id":   event.TargetID,
+		})
+	}
+}
+
+// List returns audit events matching the filter, newest first
+func (s *AuditService) List(ctx context.Context, filter AuditFilter, page, pageSize int) ([]models.AuditEvent, int64, error) {
+	query := connectors.Conn(ctx, s.db).Model(&models.AuditEvent{})
+	if filter.ActorID != 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.RequestID != "" {
+		query = query.Where("request_id = ?", filter.RequestID)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var events []models.AuditEvent
+	err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&events).Error
+	return events, total, err
+}
+
+// VerifyChain recomputes the hash of every chained event and checks that each
+// links to the one before it. Events recorded while chaining was off aren't covered.
+func (s *AuditService) VerifyChain(ctx context.Context) (*ChainVerification, error) {
+	result := &ChainVerification{Valid: true}
+	prevHash := ""
+
+	var batch []models.AuditEvent
+	err := connectors.Conn(ctx, s.db).Where("hash <> ''").Order("id").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			event := &batch[i]
+			result.Checked++
+			if event.PrevHash != prevHash || event.Hash != auditHash(event) {
+				result.Valid = false
+				result.BrokenAt = &event.ID
+				return errAuditChainBroken
+			}
+			prevHash = event.Hash
+		}
+		return nil
+	}).Error
+	if err != nil && !errors.Is(err, errAuditChainBroken) {
+		return nil, err
+	}
+	return result, nil
+}
+
+// errAuditChainBroken stops VerifyChain at the first mismatch
+var errAuditChainBroken = errors.New("audit chain broken")
+
+// createChained inserts the event linked to the latest chained event
+func (s *AuditService) createChained(ctx context.Context, event *models.AuditEvent) error {
+	// In a caller's transaction the row lock outlives the mutex, until commit.
+	// A second event of that transaction would then wait for the mutex while
+	// its holder waits for the lock, so rely on the lock alone there.
+	if !connectors.InTransaction(ctx) {
+		auditChainMu.Lock()
+		defer auditChainMu.Unlock()
+	}
+
+	return connectors.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		var last models.AuditEvent
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "hash").
+			Where("hash <> ''").
+			Order("id DESC").
+			Limit(1).
+			Find(&last).Error
+		if err != nil {
+			return err
+		}
+
+		event.PrevHash = last.Hash
+		event.Hash = auditHash(event)
+		return tx.Create(event).Error
+	})
+}
+
+// auditHash hashes the event's content together with the previous event's hash
+func auditHash(event *models.AuditEvent) string {
+	payload, _ := json.Marshal(struct {
+		PrevHash       string                        `json:"prev_hash"`
+		CreatedAt      int64                         `json:"created_at"`
+		ActorID        *uint                         `json:"actor_id"`
+		ImpersonatorID *uint                         `json:"impersonator_id"`
+		APIKeyID       *uint                         `json:"api_key_id"`
+		Action         string                        `json:"action"`
+		TargetType     string                        `json:"target_type"`
+		TargetID       string                        `json:"target_id"`
+		Changes        map[string]models.AuditChange `json:"changes"`
+		Metadata       map[string]interface{}        `json:"metadata"`
+		IP             string                        `json:"ip"`
+		UserAgent      string                        `json:"user_agent"`
+		RequestID      string                        `json:"request_id"`
+	}{
+		event.PrevHash, event.CreatedAt.UnixMilli(), event.ActorID, event.ImpersonatorID, event.APIKeyID,
+		event.Action, event.TargetType, event.TargetID, event.Changes, event.Metadata,
+		event.IP, event.UserAgent, event.RequestID,
+	})
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// auditDiff returns the fields whose JSON values differ between before and
+// after. Fields hidden from JSON, such as password hashes, are never included.
+func auditDiff(before, after interface{}) map[string]models.AuditChange {
+	beforeFields, afterFields := auditFields(before), auditFields(after)
+
+	changes := make(map[string]models.AuditChange)
+	for name, value := range afterFields {
+		if old, ok := beforeFields[name]; !ok || !reflect.DeepEqual(old, value) {
+			changes[name] = models.AuditChange{Before: beforeFields[name], After: value}
+		}
+	}
+	for name, old := range beforeFields {
+		if _, ok := afterFields[name]; !ok {
+			changes[name] = models.AuditChange{Before: old}
+		}
+	}
+	return changes
+}
+
+// auditFields flattens a record into its JSON fields
+func auditFields(record interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if record == nil {
+		return fields
+	}
+	if value := reflect.ValueOf(record); value.Kind() == reflect.Ptr && value.IsNil() {
+		return fields
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fields
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fields
+	}
+	for name := range auditIgnoredFields {
+		delete(fields, name)
+	}
+	return fields
+}
+
+// optionalID returns nil for a zero ID
+func optionalID(id uint) *uint {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+)
+
+func TestAuditDiff(t *testing.T) {
+	before := &models.User{Email: "ada@example.com", Password: "old-hash", FirstName: "Ada", Role: "user"}
+	renamed := *before
+	renamed.FirstName = "Augusta"
+	renamed.Password = "new-hash"
+	renamed.UpdatedAt = time.Now()
+
+	tests := []struct {
+		name        string
+		before      interface{}
+		after       interface{}
+		wantChanged []string
+		exact       bool // No other field may be reported
+	}{
+		{"changed field", before, &renamed, []string{"first_name"}, true},
+		{"nothing changed", before, before, nil, true},
+		{"only hidden and ignored fields changed", before, &models.User{Email: "ada@example.com", Password: "other", FirstName: "Ada", Role: "user", BaseModel: models.BaseModel{UpdatedAt: time.Now()}}, nil, true},
+		{"created", nil, before, []string{"email", "first_name", "role"}, false},
+		{"deleted", before, (*models.User)(nil), []string{"email", "first_name", "role"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := auditDiff(tt.before, tt.after)
+			for _, field := range tt.wantChanged {
+				if _, ok := changes[field]; !ok {
+					t.Errorf("%s missing from changes %v", field, changes)
+				}
+			}
+			if _, ok := changes["password"]; ok {
+				t.Error("the password hash was recorded")
+			}
+			if tt.exact && len(changes) != len(tt.wantChanged) {
+				t.Errorf("changes = %v, want only %v", changes, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestAuditRecord(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewAuditService(db, cfg)
+	ctx := models.WithAuditActor(context.Background(), models.AuditActor{UserID: 3, APIKeyID: 5, IP: "192.0.2.1", RequestID: "req-1"})
+	before := &models.User{Email: "ada@example.com", FirstName: "Ada"}
+	after := &models.User{Email: "ada@example.com", FirstName: "Augusta"}
+
+	service.Record(ctx, models.AuditUserRoleChange, "user", 7, before, before)
+	service.Record(ctx, "user.update", "user", 7, before, after)
+
+	var events []models.AuditEvent
+	db.Find(&events)
+	if len(events) != 1 {
+		t.Fatalf("%d events, want 1; updates that change nothing are skipped", len(events))
+	}
+	event := events[0]
+	if event.Action != "user.update" || event.TargetType != "user" || event.TargetID != "7" {
+		t.Errorf("event = %+v", event)
+	}
+	if event.ActorID == nil || *event.ActorID != 3 || event.APIKeyID == nil || *event.APIKeyID != 5 || event.ImpersonatorID != nil {
+		t.Errorf("actor %v, key %v, impersonator %v, want 3, 5 and none", event.ActorID, event.APIKeyID, event.ImpersonatorID)
+	}
+	if event.IP != "192.0.2.1" || event.RequestID != "req-1" {
+		t.Errorf("IP %q, request %q", event.IP, event.RequestID)
+	}
+	if change := event.Changes["first_name"]; change.Before != "Ada" || change.After != "Augusta" {
+		t.Errorf("changes = %v", event.Changes)
+	}
+
+	if err := db.Model(&event).Update("action", "forged").Error; !errors.Is(err, models.ErrAuditEventImmutable) {
+		t.Errorf("update: err = %v, want ErrAuditEventImmutable", err)
+	}
+	if err := db.Delete(&event).Error; !errors.Is(err, models.ErrAuditEventImmutable) {
+		t.Errorf("delete: err = %v, want ErrAuditEventImmutable", err)
+	}
+}
+
+func TestAuditRecordRollsBackWithTransaction(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewAuditService(db, cfg)
+	failed := errors.New("change failed")
+
+	err := connectors.WithTransaction(context.Background(), db, func(ctx context.Context) error {
+		service.Record(ctx, "user.update", "user", 7, nil, &models.User{Email: "ada@example.com"})
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("err = %v, want %v", err, failed)
+	}
+
+	var count int64
+	db.Model(&models.AuditEvent{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d events recorded for a rolled back change, want 0", count)
+	}
+}
+
+func TestAuditList(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewAuditService(db, cfg)
+	ctx := context.Background()
+
+	for _, event := range []struct {
+		action, targetID, requestID string
+	}{
+		{"user.update", "1", "a"},
+		{"user.update", "2", "b"},
+		{"user.delete", "2", "b"},
+	} {
+		actor := models.AuditActor{UserID: 9, RequestID: event.requestID}
+		service.RecordEvent(models.WithAuditActor(ctx, actor), &models.AuditEvent{Action: event.action, TargetType: "user", TargetID: event.targetID})
+	}
+
+	tests := []struct {
+		name      string
+		filter    AuditFilter
+		wantTotal int64
+	}{
+		{"everything", AuditFilter{}, 3},
+		{"action", AuditFilter{Action: "user.update"}, 2},
+		{"target", AuditFilter{TargetType: "user", TargetID: "2"}, 2},
+		{"request", AuditFilter{RequestID: "a"}, 1},
+		{"actor", AuditFilter{ActorID: 9}, 3},
+		{"other actor", AuditFilter{ActorID: 8}, 0},
+		{"since the future", AuditFilter{Since: time.Now().Add(time.Hour)}, 0},
+		{"until the future", AuditFilter{Until: time.Now().Add(time.Hour)}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, total, err := service.List(ctx, tt.filter, 1, 2)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("total = %d, want %d", total, tt.wantTotal)
+			}
+			if want := min(tt.wantTotal, 2); int64(len(events)) != want {
+				t.Errorf("%d events on the page, want %d", len(events), want)
+			}
+			for i := 1; i < len(events); i++ {
+				if events[i].ID > events[i-1].ID {
+					t.Error("events aren't newest first")
+				}
+			}
+		})
+	}
+}
+
+func TestAuditVerifyChain(t *testing.T) {
+	tests := []struct {
+		name       string
+		tamper     func(t *testing.T, service *AuditService, ids []uint)
+		wantBroken int // Index of the first broken event, or -1
+	}{
+		{"untouched", func(*testing.T, *AuditService, []uint) {}, -1},
+		{
+			name: "edited event",
+			tamper: func(t *testing.T, s *AuditService, ids []uint) {
+				s.db.Exec("UPDATE audit_events SET action = ? WHERE id = ?", "user.forged", ids[1])
+			},
+			wantBroken: 1,
+		},
+		{
+			name: "deleted event",
+			tamper: func(t *testing.T, s *AuditService, ids []uint) {
+				s.db.Exec("DELETE FROM audit_events WHERE id = ?", ids[1])
+			},
+			wantBroken: 2,
+		},
+		{
+			name: "rehashed event",
+			tamper: func(t *testing.T, s *AuditService, ids []uint) {
+				var event models.AuditEvent
+				s.db.First(&event, ids[0])
+				event.Action = "user.forged"
+				s.db.Exec("UPDATE audit_events SET action = ?, hash = ? WHERE id = ?", event.Action, auditHash(&event), ids[0])
+			},
+			wantBroken: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, cfg := newTestEnv(t)
+			cfg.Audit.HashChain = true
+			service := NewAuditService(db, cfg)
+			ctx := context.Background()
+
+			var ids []uint
+			for i := 0; i < 3; i++ {
+				event := &models.AuditEvent{Action: "user.update", TargetType: "user", TargetID: "1"}
+				service.RecordEvent(ctx, event)
+				ids = append(ids, event.ID)
+			}
+			tt.tamper(t, service, ids)
+
+			result, err := service.VerifyChain(ctx)
+			if err != nil {
+				t.Fatalf("VerifyChain: %v", err)
+			}
+			if tt.wantBroken < 0 {
+				if !result.Valid || result.Checked != 3 {
+					t.Errorf("result = %+v, want a valid chain of 3", result)
+				}
+				return
+			}
+			if result.Valid || result.BrokenAt == nil || *result.BrokenAt != ids[tt.wantBroken] {
+				t.Errorf("result = %+v, want broken at event %d", result, ids[tt.wantBroken])
+			}
+		})
+	}
+}
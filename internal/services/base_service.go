@@ -5,6 +5,9 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/cam-boltnote/go-ignite/internal/config"
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/models"
 	"github.com/cam-boltnote/go-ignite/internal/utils"
 
 	"gorm.io/gorm"
@@ -12,15 +15,17 @@ import (
 
 // BaseService provides common CRUD operations for services
 type BaseService[T any] struct {
-	db     *gorm.DB
-	logger *utils.Logger
+	db      *gorm.DB
+	cursors *cursorSigner
+	logger  *utils.Logger
 }
 
 // NewBaseService creates a new base service instance
-func NewBaseService[T any](db *gorm.DB) *BaseService[T] {
+func NewBaseService[T any](db *gorm.DB, cfg *config.Config) *BaseService[T] {
 	return &BaseService[T]{
-		db:     db,
-		logger: utils.GetLogger().WithService("base_service"),
+		db:      db,
+		cursors: newCursorSigner(cfg.Security),
+		logger:  utils.GetLogger().WithService("base_service"),
 	}
 }
 
@@ -30,7 +35,7 @@ func (s *BaseService[T]) Create(ctx context.Context, model *T) error {
 		"model_type": fmt.Sprintf("%T", *model),
 	})
 
-	err := s.db.WithContext(ctx).Create(model).Error
+	err := connectors.Conn(ctx, s.db).Create(model).Error
 	if err != nil {
 		s.logger.Error("Failed to create record", err, map[string]interface{}{
 			"model_type": fmt.Sprintf("%T", *model),
@@ -46,7 +51,7 @@ func (s *BaseService[T]) GetByID(ctx context.Context, id uint) (*T, error) {
 	})
 
 	var model T
-	err := s.db.WithContext(ctx).First(&model, id).Error
+	err := connectors.Conn(ctx, s.db).First(&model, id).Error
 	if err != nil {
 		s.logger.Error("Failed to fetch record", err, map[string]interface{}{
 			"id": id,
@@ -56,42 +61,46 @@ func (s *BaseService[T]) GetByID(ctx context.Context, id uint) (*T, error) {
 	return &model, nil
 }
 
-// List retrieves a list of records with pagination
-func (s *BaseService[T]) List(ctx context.Context, page, pageSize int) ([]T, int64, error) {
+// List retrieves a page of records filtered, searched and sorted as the query
+// says, within the fields T declares in QueryFields, by page number or by
+// cursor. Invalid queries and cursors return an error wrapping ErrInvalidQuery.
+func (s *BaseService[T]) List(ctx context.Context, query ListQuery) (*models.PaginatedResponse, error) {
 	s.logger.Debug("Listing records", map[string]interface{}{
-		"page":      page,
-		"page_size": pageSize,
+		"page":      query.Page,
+		"page_size": query.PageSize,
+		"sort_by":   query.SortBy,
+		"filters":   len(query.Filters),
+		"cursor":    query.UseCursor,
 	})
 
-	var models []T
-	var total int64
-
-	offset := (page - 1) * pageSize
-	err := s.db.WithContext(ctx).Model(new(T)).Count(&total).Error
-	if err != nil {
-		s.logger.Error("Failed to count records", err, nil)
-		return nil, 0, err
-	}
-
-	err = s.db.WithContext(ctx).Offset(offset).Limit(pageSize).Find(&models).Error
+	_, page, err := findPage[T](connectors.Conn(ctx, s.db), query, s.cursors)
 	if err != nil {
-		s.logger.Error("Failed to fetch records", err, map[string]interface{}{
-			"page":      page,
-			"page_size": pageSize,
-		})
-		return nil, 0, err
+		if !errors.Is(err, ErrInvalidQuery) {
+			s.logger.Error("Failed to fetch records", err, map[string]interface{}{
+				"page":      query.Page,
+				"page_size": query.PageSize,
+			})
+		}
+		return nil, err
 	}
 
-	return models, total, nil
+	return page, nil
 }
 
-// Update updates a record
+// Update updates a record. Tenant-owned records are only updated within the
+// organization in the context and keep their organization; updating one that
+// doesn't exist there returns gorm.ErrRecordNotFound.
 func (s *BaseService[T]) Update(ctx context.Context, model *T) error {
 	s.logger.Info("Updating record", map[string]interface{}{
 		"model_type": fmt.Sprintf("%T", *model),
 	})
 
-	err := s.db.WithContext(ctx).Save(model).Error
+	var err error
+	if models.IsTenantOwned(model) {
+		err = updateTenantOwned(connectors.Conn(ctx, s.db), model)
+	} else {
+		err = connectors.Conn(ctx, s.db).Save(model).Error
+	}
 	if err != nil {
 		s.logger.Error("Failed to update record", err, map[string]interface{}{
 			"model_type": fmt.Sprintf("%T", *model),
@@ -100,13 +109,28 @@ func (s *BaseService[T]) Update(ctx context.Context, model *T) error {
 	return err
 }
 
+// updateTenantOwned updates every field of a tenant-owned record but its
+// organization. Unlike Save it never falls back to inserting the record when
+// the organization filter matches no row, which would take over the record of
+// another organization.
+func updateTenantOwned(db *gorm.DB, model interface{}) error {
+	result := db.Model(model).Select("*").Omit("id", "created_at", "organization_id").Updates(model)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
 // Delete deletes a record
 func (s *BaseService[T]) Delete(ctx context.Context, id uint) error {
 	s.logger.Info("Deleting record", map[string]interface{}{
 		"id": id,
 	})
 
-	result := s.db.WithContext(ctx).Delete(new(T), id)
+	result := connectors.Conn(ctx, s.db).Delete(new(T), id)
 	if result.Error != nil {
 		s.logger.Error("Failed to delete record", result.Error, map[string]interface{}{
 			"id": id,
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/models"
+
+	"gorm.io/gorm"
+)
+
+func TestBaseServiceUpdateTenantOwned(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewBaseService[models.Invitation](db, cfg)
+
+	orgA := &models.Organization{Name: "A", Slug: "a"}
+	orgB := &models.Organization{Name: "B", Slug: "b"}
+	for _, org := range []*models.Organization{orgA, orgB} {
+		if err := db.Create(org).Error; err != nil {
+			t.Fatalf("create organization: %v", err)
+		}
+	}
+	ctxA := models.WithTenant(context.Background(), orgA.ID)
+	ctxB := models.WithTenant(context.Background(), orgB.ID)
+
+	newInvitation := func(ctx context.Context, email string) *models.Invitation {
+		invitation := &models.Invitation{
+			Email:       email,
+			Role:        models.OrgRoleMember,
+			InvitedByID: 1,
+			ExpiresAt:   time.Now().Add(time.Hour),
+		}
+		if err := service.Create(ctx, invitation); err != nil {
+			t.Fatalf("create invitation: %v", err)
+		}
+		return invitation
+	}
+	own := newInvitation(ctxA, "own@example.com")
+	victim := newInvitation(ctxB, "victim@example.com")
+
+	tests := []struct {
+		name    string
+		change  func() *models.Invitation
+		wantErr error
+	}{
+		{
+			name: "another organization's record",
+			change: func() *models.Invitation {
+				return &models.Invitation{
+					TenantModel: models.TenantModel{BaseModel: models.BaseModel{ID: victim.ID}},
+					Email:       "attacker@example.com",
+					Role:        models.OrgRoleOwner,
+					ExpiresAt:   time.Now().Add(time.Hour),
+				}
+			},
+			wantErr: gorm.ErrRecordNotFound,
+		},
+		{
+			name: "missing record",
+			change: func() *models.Invitation {
+				return &models.Invitation{
+					TenantModel: models.TenantModel{BaseModel: models.BaseModel{ID: 404}},
+					Email:       "nobody@example.com",
+				}
+			},
+			wantErr: gorm.ErrRecordNotFound,
+		},
+		{
+			name: "own record moved to another organization",
+			change: func() *models.Invitation {
+				changed := *own
+				changed.OrganizationID = orgB.ID
+				changed.Role = models.OrgRoleAdmin
+				return &changed
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.Update(ctxA, tt.change())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	stored, err := service.GetByID(ctxB, victim.ID)
+	if err != nil {
+		t.Fatalf("load victim's invitation: %v", err)
+	}
+	if stored.Email != "victim@example.com" || stored.Role != models.OrgRoleMember || stored.OrganizationID != orgB.ID {
+		t.Errorf("another organization's invitation was changed: %+v", stored)
+	}
+
+	updated, err := service.GetByID(ctxA, own.ID)
+	if err != nil {
+		t.Fatalf("load own invitation: %v", err)
+	}
+	if updated.Role != models.OrgRoleAdmin || updated.OrganizationID != orgA.ID {
+		t.Errorf("own invitation = role %s in organization %d, want admin in %d", updated.Role, updated.OrganizationID, orgA.ID)
+	}
+}
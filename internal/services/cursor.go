@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// processCursorKey signs cursors when no key is configured
+	processCursorKey     []byte
+	processCursorKeyOnce sync.Once
+)
+
+// cursorSigner encodes and verifies pagination cursors. A cursor holds the
+// sort values of the row a page starts after, signed so clients can't forge
+// positions or conditions.
+type cursorSigner struct {
+	key []byte
+}
+
+// newCursorSigner creates a signer with the configured cursor key, falling
+// back to a random key shared by the whole process. Config validation requires
+// the key in release mode; the fallback is for development and tests.
+func newCursorSigner(cfg config.SecurityConfig) *cursorSigner {
+	if key, err := base64.StdEncoding.DecodeString(cfg.CursorKey); err == nil && len(key) >= config.MinCursorKeyLength {
+		return &cursorSigner{key: key}
+	}
+
+	processCursorKeyOnce.Do(func() {
+		processCursorKey = make([]byte, config.MinCursorKeyLength)
+		if _, err := rand.Read(processCursorKey); err != nil {
+			panic(fmt.Sprintf("failed to generate a cursor key: %v", err))
+		}
+	})
+	return &cursorSigner{key: processCursorKey}
+}
+
+// cursor is the position a cursor page continues from
+type cursor struct {
+	Query  string   `json:"q"`           // Fingerprint of the query the cursor belongs to
+	Values []string `json:"v"`           // Sort values of the row to continue from
+	Before bool     `json:"b,omitempty"` // Page backwards, towards the start
+}
+
+// encode returns the signed, URL-safe form of c
+func (s *cursorSigner) encode(c cursor) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(s.sign(payload)), nil
+}
+
+// decode verifies a cursor from encode and checks it belongs to the query
+// with the given fingerprint
+func (s *cursorSigner) decode(encoded, fingerprint string, columns int) (cursor, error) {
+	invalid := fmt.Errorf("%w: invalid cursor", ErrInvalidQuery)
+
+	encodedPayload, encodedMAC, ok := strings.Cut(encoded, ".")
+	if !ok {
+		return cursor{}, invalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return cursor{}, invalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, s.sign(payload)) {
+		return cursor{}, invalid
+	}
+
+	var c cursor
+	if err := json.Unmarshal(payload, &c); err != nil || len(c.Values) != columns {
+		return cursor{}, invalid
+	}
+	if c.Query != fingerprint {
+		return cursor{}, fmt.Errorf("%w: the cursor belongs to a query with other filters or sorting", ErrInvalidQuery)
+	}
+	return c, nil
+}
+
+func (s *cursorSigner) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// fingerprint identifies the filters, search and sort of the query, which a
+// cursor must be used with
+func (q ListQuery) fingerprint(model string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n%s\n%s\n%s\n", model, q.SortBy, strings.ToLower(q.Order), q.Search)
+	for _, filter := range q.Filters {
+		fmt.Fprintf(&b, "%s[%s]=%q\n", filter.Field, filter.Op, filter.Values)
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// cursorValues returns the sort values of a row as they're stored in cursors
+func cursorValues(order []sortColumn, row reflect.Value) []string {
+	values := make([]string, len(order))
+	for i, column := range order {
+		value, _ := column.field.ValueOf(context.Background(), row)
+		switch v := value.(type) {
+		case time.Time:
+			values[i] = v.Format(time.RFC3339Nano)
+		case string:
+			values[i] = v
+		case bool:
+			values[i] = strconv.FormatBool(v)
+		default:
+			values[i] = fmt.Sprint(v)
+		}
+	}
+	return values
+}
+
+// keysetCondition selects the rows after the cursor in the query's order, or
+// before it when the cursor pages backwards:
+//
+//	a > x OR (a = x AND id > y)
+func keysetCondition(order []sortColumn, c cursor) (clause.Expression, error) {
+	values := make([]interface{}, len(order))
+	for i, column := range order {
+		value, err := fieldValue(column.field, c.Values[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidQuery)
+		}
+		values[i] = value
+	}
+
+	alternatives := make([]clause.Expression, len(order))
+	for i, column := range order {
+		var conditions []clause.Expression
+		for j := 0; j < i; j++ {
+			conditions = append(conditions, clause.Eq{Column: order[j].column(), Value: values[j]})
+		}
+		if column.desc != c.Before {
+			conditions = append(conditions, clause.Lt{Column: column.column(), Value: values[i]})
+		} else {
+			conditions = append(conditions, clause.Gt{Column: column.column(), Value: values[i]})
+		}
+		alternatives[i] = clause.And(conditions...)
+	}
+	return clause.Or(alternatives...), nil
+}
+
+// checkKeysetColumns rejects sorting by columns that can be NULL, which
+// comparisons with a cursor would skip
+func checkKeysetColumns(order []sortColumn) error {
+	for _, column := range order {
+		if column.field.FieldType.Kind() == reflect.Ptr {
+			return fmt.Errorf("%w: can't page by cursor when sorting by %q, which may be empty", ErrInvalidQuery, column.field.DBName)
+		}
+	}
+	return nil
+}
+
+// reversed returns the order with every direction flipped
+func reversed(order []sortColumn) []sortColumn {
+	flipped := make([]sortColumn, len(order))
+	for i, column := range order {
+		flipped[i] = sortColumn{field: column.field, desc: !column.desc}
+	}
+	return flipped
+}
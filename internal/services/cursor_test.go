@@ -0,0 +1,94 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+)
+
+// testCursorKey returns a base64 cursor key made of b repeated
+func testCursorKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), config.MinCursorKeyLength)))
+}
+
+func TestCursorSigner(t *testing.T) {
+	signer := newCursorSigner(config.SecurityConfig{CursorKey: testCursorKey('a')})
+	foreign := newCursorSigner(config.SecurityConfig{CursorKey: testCursorKey('b')})
+	position := cursor{Query: "fingerprint", Values: []string{"2026-10-16T08:00:00Z", "42"}}
+
+	valid, err := signer.encode(position)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	foreignCursor, err := foreign.encode(position)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	payload, mac, _ := strings.Cut(valid, ".")
+	forgedPayload := base64.RawURLEncoding.EncodeToString([]byte(`{"q":"fingerprint","v":["2000-01-01T00:00:00Z","1"]}`))
+
+	tests := []struct {
+		name        string
+		encoded     string
+		fingerprint string
+		columns     int
+		wantErr     bool
+	}{
+		{"valid", valid, "fingerprint", 2, false},
+		{"signed with another key", foreignCursor, "fingerprint", 2, true},
+		{"tampered payload", forgedPayload + "." + mac, "fingerprint", 2, true},
+		{"tampered signature", payload + "." + base64.RawURLEncoding.EncodeToString([]byte("forged")), "fingerprint", 2, true},
+		{"no signature", payload, "fingerprint", 2, true},
+		{"not base64", "%%%." + mac, "fingerprint", 2, true},
+		{"other query", valid, "other", 2, true},
+		{"other number of sort columns", valid, "fingerprint", 1, true},
+		{"empty", "", "fingerprint", 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := signer.decode(tt.encoded, tt.fingerprint, tt.columns)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidQuery) {
+					t.Errorf("err = %v, want ErrInvalidQuery", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if decoded.Query != position.Query || strings.Join(decoded.Values, ",") != strings.Join(position.Values, ",") {
+				t.Errorf("decoded %+v, want %+v", decoded, position)
+			}
+		})
+	}
+}
+
+func TestCursorSignerKeys(t *testing.T) {
+	position := cursor{Query: "fingerprint", Values: []string{"1"}}
+
+	// Instances configured with the same key accept each other's cursors
+	encoded, err := newCursorSigner(config.SecurityConfig{CursorKey: testCursorKey('a')}).encode(position)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if _, err := newCursorSigner(config.SecurityConfig{CursorKey: testCursorKey('a')}).decode(encoded, "fingerprint", 1); err != nil {
+		t.Errorf("another signer with the same key rejected the cursor: %v", err)
+	}
+
+	// Without a key cursors only work within the process, never with a configured key
+	fallback := newCursorSigner(config.SecurityConfig{})
+	if _, err := fallback.decode(encoded, "fingerprint", 1); err == nil {
+		t.Error("the fallback key accepted a cursor signed with the configured key")
+	}
+	encoded, err = fallback.encode(position)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if _, err := newCursorSigner(config.SecurityConfig{}).decode(encoded, "fingerprint", 1); err != nil {
+		t.Errorf("the fallback key differs within the process: %v", err)
+	}
+}
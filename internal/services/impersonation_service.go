@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrCannotImpersonate is returned when the target may not be impersonated,
+	// i.e. the actor themselves, an inactive user or another user who may impersonate
+	ErrCannotImpersonate = errors.New("this user cannot be impersonated")
+	// ErrNotImpersonating is returned when ending impersonation with a regular token
+	ErrNotImpersonating = errors.New("not an impersonation token")
+)
+
+// ImpersonationService lets admins act as another user for support purposes.
+// Impersonation tokens have a hard expiry and can't be refreshed, and every
+// start, end and mutating request is recorded.
+type ImpersonationService struct {
+	db           *gorm.DB
+	tokenService *TokenService
+	audit        *AuditService
+	ttl          time.Duration
+	logger       *utils.Logger
+}
+
+// NewImpersonationService creates a new impersonation service instance
+func NewImpersonationService(db *gorm.DB, tokenService *TokenService, cfg *config.Config) *ImpersonationService {
+	return &ImpersonationService{
+		db:           db,
+		tokenService: tokenService,
+		audit:        NewAuditService(db, cfg),
+		ttl:          cfg.Impersonation.TTL,
+		logger:       utils.GetLogger().WithService("impersonation_service"),
+	}
+}
+
+// ImpersonationToken is returned to an admin who starts impersonating a user
+type ImpersonationToken struct {
+	AccessToken  string    `json:"token"`
+	TokenType    string    `json:"token_type"`
+	ExpiresIn    int64     `json:"expires_in"` // Token lifetime in seconds
+	ExpiresAt    time.Time `json:"expires_at"`
+	TargetUserID uint      `json:"target_user_id"`
+	ActorID      uint      `json:"actor_id"`
+}
+
+// Start issues an access token that acts as the target user on behalf of the actor
+func (s *ImpersonationService) Start(ctx context.Context, actorID, targetID uint) (*ImpersonationToken, error) {
+	if actorID == targetID {
+		return nil, ErrCannotImpersonate
+	}
+
+	var target models.User
+	if err := connectors.Conn(ctx, s.db).First(&target, targetID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+	// Impersonating another admin would let one admin act with another's authority
+	if !target.IsActive || middleware.HasPermission(target.Role, middleware.PermUsersImpersonate) {
+		return nil, ErrCannotImpersonate
+	}
+
+	token, claims, err := middleware.GenerateImpersonationToken(&target, actorID, s.ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	s.record(ctx, models.AuditImpersonationStart, targetID, map[string]interface{}{
+		"token_id":   claims.ID,
+		"expires_at": claims.ExpiresAt.Time,
+	})
+	s.logger.Warn("Impersonation started", map[string]interface{}{
+		"event":      "impersonation_started",
+		"actor_id":   actorID,
+		"user_id":    targetID,
+		"expires_at": claims.ExpiresAt.Time,
+	})
+
+	return &ImpersonationToken{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.ttl.Seconds()),
+		ExpiresAt:    claims.ExpiresAt.Time,
+		TargetUserID: targetID,
+		ActorID:      actorID,
+	}, nil
+}
+
+// End revokes the impersonation token before its expiry
+func (s *ImpersonationService) End(ctx context.Context, claims *middleware.Claims) error {
+	if claims.ActorID == 0 {
+		return ErrNotImpersonating
+	}
+
+	if err := s.tokenService.RevokeAccessToken(ctx, claims); err != nil {
+		return err
+	}
+
+	s.record(ctx, models.AuditImpersonationEnd, claims.UserID, map[string]interface{}{
+		"token_id": claims.ID,
+	})
+	s.logger.Info("Impersonation ended", map[string]interface{}{
+		"event":    "impersonation_ended",
+		"actor_id": claims.ActorID,
+		"user_id":  claims.UserID,
+	})
+	return nil
+}
+
+// RecordImpersonatedRequest records a mutating request made while impersonating.
+// It implements middleware.ImpersonationAuditor.
+func (s *ImpersonationService) RecordImpersonatedRequest(ctx context.Context, claims *middleware.Claims, method, path string, status int) {
+	s.record(ctx, models.AuditImpersonationRequest, claims.UserID, map[string]interface{}{
+		"token_id": claims.ID,
+		"method":   method,
+		"path":     path,
+		"status":   status,
+	})
+}
+
+// record stores an impersonation audit event targeting the impersonated user
+func (s *ImpersonationService) record(ctx context.Context, action string, userID uint, metadata map[string]interface{}) {
+	s.audit.RecordEvent(ctx, &models.AuditEvent{
+		Action:     action,
+		TargetType: "user",
+		TargetID:   strconv.FormatUint(uint64(userID), 10),
+		Metadata:   metadata,
+	})
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tokenClaims returns the claims of an access token that passes AuthMiddleware
+func tokenClaims(t *testing.T, token string) *middleware.Claims {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	var claims *middleware.Claims
+	router := gin.New()
+	router.GET("/me", middleware.AuthMiddleware(middleware.AuthOptions{}), func(c *gin.Context) {
+		value, _ := c.Get("claims")
+		claims = value.(*middleware.Claims)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if claims == nil {
+		t.Fatal("the token was rejected")
+	}
+	return claims
+}
+
+// adminContext is the context of a request made by the admin
+func adminContext(admin *models.User) context.Context {
+	return models.WithAuditActor(context.Background(), models.AuditActor{UserID: admin.ID})
+}
+
+func TestImpersonationStart(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewImpersonationService(db, NewTokenService(db, cfg), cfg)
+	admin := createTestUser(t, db, cfg, "admin@example.com", middleware.RoleAdmin)
+	otherAdmin := createTestUser(t, db, cfg, "grace@example.com", middleware.RoleAdmin)
+	moderator := createTestUser(t, db, cfg, "mod@example.com", middleware.RoleModerator)
+	user := createTestUser(t, db, cfg, "ada@example.com", middleware.RoleUser)
+	inactive := createTestUser(t, db, cfg, "gone@example.com", middleware.RoleUser)
+	db.Model(inactive).Update("is_active", false)
+
+	tests := []struct {
+		name    string
+		target  uint
+		wantErr error
+	}{
+		{"user", user.ID, nil},
+		{"moderator", moderator.ID, nil},
+		{"self", admin.ID, ErrCannotImpersonate},
+		{"another admin", otherAdmin.ID, ErrCannotImpersonate},
+		{"inactive user", inactive.ID, ErrCannotImpersonate},
+		{"missing user", 999, errors.New("user not found")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := service.Start(adminContext(admin), admin.ID, tt.target)
+			if tt.wantErr != nil {
+				if err == nil || err.Error() != tt.wantErr.Error() {
+					t.Errorf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+
+			claims := tokenClaims(t, token.AccessToken)
+			if claims.UserID != tt.target || claims.ActorID != admin.ID || claims.SessionID != 0 {
+				t.Errorf("user %d, actor %d, session %d, want %d, %d and none", claims.UserID, claims.ActorID, claims.SessionID, tt.target, admin.ID)
+			}
+			if token.TargetUserID != tt.target || token.ActorID != admin.ID || token.ExpiresIn != int64(cfg.Impersonation.TTL.Seconds()) {
+				t.Errorf("token = %+v", token)
+			}
+
+			var event models.AuditEvent
+			if err := db.Where("action = ? AND target_id = ?", models.AuditImpersonationStart, strconv.FormatUint(uint64(tt.target), 10)).First(&event).Error; err != nil {
+				t.Fatalf("start event: %v", err)
+			}
+			if event.ActorID == nil || *event.ActorID != admin.ID || event.Metadata["token_id"] != claims.ID {
+				t.Errorf("start event by %v for token %v, want %d and %s", event.ActorID, event.Metadata["token_id"], admin.ID, claims.ID)
+			}
+		})
+	}
+}
+
+func TestImpersonationEnd(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	tokenService := NewTokenService(db, cfg)
+	service := NewImpersonationService(db, tokenService, cfg)
+	admin := createTestUser(t, db, cfg, "admin@example.com", middleware.RoleAdmin)
+	user := createTestUser(t, db, cfg, "ada@example.com", middleware.RoleUser)
+
+	token, err := service.Start(adminContext(admin), admin.ID, user.ID)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if status := authStatus(t, tokenService, token.AccessToken); status != http.StatusOK {
+		t.Fatalf("status = %d before ending, want %d", status, http.StatusOK)
+	}
+
+	claims := tokenClaims(t, token.AccessToken)
+	if err := service.End(context.Background(), claims); err != nil {
+		t.Fatalf("End: %v", err)
+	}
+	if status := authStatus(t, tokenService, token.AccessToken); status != http.StatusUnauthorized {
+		t.Errorf("status = %d after ending, want %d", status, http.StatusUnauthorized)
+	}
+	var count int64
+	db.Model(&models.AuditEvent{}).Where("action = ?", models.AuditImpersonationEnd).Count(&count)
+	if count != 1 {
+		t.Errorf("%d end events, want 1", count)
+	}
+
+	regular := &middleware.Claims{UserID: user.ID}
+	if err := service.End(context.Background(), regular); !errors.Is(err, ErrNotImpersonating) {
+		t.Errorf("End with a regular token: err = %v, want %v", err, ErrNotImpersonating)
+	}
+}
+
+func TestImpersonationRevokedWithAdmin(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(t *testing.T, ctx context.Context, tokenService *TokenService, admin *models.User)
+	}{
+		{"admin signs out everywhere", func(t *testing.T, ctx context.Context, tokenService *TokenService, admin *models.User) {
+			time.Sleep(2 * time.Millisecond) // Tokens from the revocation's millisecond stay valid
+			if err := tokenService.RevokeAllForUser(ctx, admin.ID); err != nil {
+				t.Fatalf("RevokeAllForUser: %v", err)
+			}
+		}},
+		{"admin deactivated", func(t *testing.T, ctx context.Context, tokenService *TokenService, admin *models.User) {
+			tokenService.db.Model(admin).Update("is_active", false)
+		}},
+		{"admin demoted", func(t *testing.T, ctx context.Context, tokenService *TokenService, admin *models.User) {
+			tokenService.db.Model(admin).Update("role", middleware.RoleModerator)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, cfg := newTestEnv(t)
+			tokenService := NewTokenService(db, cfg)
+			service := NewImpersonationService(db, tokenService, cfg)
+			admin := createTestUser(t, db, cfg, "admin@example.com", middleware.RoleAdmin)
+			user := createTestUser(t, db, cfg, "ada@example.com", middleware.RoleUser)
+
+			token, err := service.Start(adminContext(admin), admin.ID, user.ID)
+			if err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			tt.revoke(t, context.Background(), tokenService, admin)
+
+			if status := authStatus(t, tokenService, token.AccessToken); status != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", status, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestImpersonationAudit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cfg := newTestEnv(t)
+	tokenService := NewTokenService(db, cfg)
+	service := NewImpersonationService(db, tokenService, cfg)
+	audit := NewAuditService(db, cfg)
+	admin := createTestUser(t, db, cfg, "admin@example.com", middleware.RoleAdmin)
+	user := createTestUser(t, db, cfg, "ada@example.com", middleware.RoleUser)
+
+	token, err := service.Start(adminContext(admin), admin.ID, user.ID)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	router := gin.New()
+	api := router.Group("", middleware.AuthMiddleware(middleware.AuthOptions{Revocations: tokenService}), middleware.AuditImpersonation(service))
+	api.GET("/me", func(c *gin.Context) { c.Status(http.StatusOK) })
+	api.PUT("/me", func(c *gin.Context) {
+		audit.Record(c.Request.Context(), "user.update", "user", user.ID, &models.User{FirstName: "Ada"}, &models.User{FirstName: "Augusta"})
+		c.Status(http.StatusOK)
+	})
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		req := httptest.NewRequest(method, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s /me: status = %d", method, rec.Code)
+		}
+	}
+
+	var events []models.AuditEvent
+	db.Where("action IN ?", []string{models.AuditImpersonationRequest, "user.update"}).Order("id").Find(&events)
+	if len(events) != 2 {
+		t.Fatalf("%d events, want the update and one impersonated request; reads aren't recorded", len(events))
+	}
+	for _, event := range events {
+		if event.ActorID == nil || *event.ActorID != user.ID || event.ImpersonatorID == nil || *event.ImpersonatorID != admin.ID {
+			t.Errorf("%s: actor %v, impersonator %v, want %d and %d", event.Action, event.ActorID, event.ImpersonatorID, user.ID, admin.ID)
+		}
+	}
+	if request := events[1]; request.Metadata["method"] != http.MethodPut || request.Metadata["path"] != "/me" {
+		t.Errorf("request metadata = %v", request.Metadata)
+	}
+}
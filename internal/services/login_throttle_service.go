@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// loginBackoffFreeAttempts is the number of failures allowed before backoff starts,
+// so an occasional typo never slows anyone down
+const loginBackoffFreeAttempts = 2
+
+// mfaTokenMaxAttempts is how many codes may be tried with one MFA login token
+const mfaTokenMaxAttempts = 5
+
+var (
+	// ErrLoginThrottled is returned while an account or IP must wait before trying again
+	ErrLoginThrottled = errors.New("too many failed login attempts")
+	// ErrMFATokenUsed is returned for an MFA login token that completed a login
+	// or ran out of attempts
+	ErrMFATokenUsed = errors.New("MFA token already used")
+)
+
+// LoginThrottleService tracks failed logins per account and per client IP. Each
+// failure past a few free attempts doubles the wait before the next attempt,
+// and reaching the threshold locks the account or IP for the lockout duration.
+type LoginThrottleService struct {
+	db          *gorm.DB
+	config      config.LoginThrottleConfig
+	emailSender *connectors.EmailSender
+	logger      *utils.Logger
+}
+
+// NewLoginThrottleService creates a new login throttle service instance
+func NewLoginThrottleService(db *gorm.DB, userService *UserService, cfg *config.Config) *LoginThrottleService {
+	return &LoginThrottleService{
+		db:          db,
+		config:      cfg.LoginThrottle,
+		emailSender: userService.emailSender,
+		logger:      utils.GetLogger().WithService("login_throttle_service"),
+	}
+}
+
+// Check returns ErrLoginThrottled and how long to wait if the account or the IP
+// may not attempt a login right now
+func (s *LoginThrottleService) Check(ctx context.Context, email, ip string) (time.Duration, error) {
+	var throttles []models.LoginThrottle
+	if err := connectors.Conn(ctx, s.db).Where("throttle_key IN ?", []string{accountThrottleKey(email), ipThrottleKey(ip)}).Find(&throttles).Error; err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	var wait time.Duration
+	for _, throttle := range throttles {
+		if d := s.retryAfter(&throttle, now); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		return wait, ErrLoginThrottled
+	}
+	return 0, nil
+}
+
+// RecordFailure counts a failed login against the account and the IP, locking
+// either once its threshold is reached
+func (s *LoginThrottleService) RecordFailure(ctx context.Context, email, ip string) {
+	// Count the failure even if the client hangs up, or guesses would go uncounted
+	ctx = context.WithoutCancel(ctx)
+
+	if locked, until := s.recordFailure(ctx, accountThrottleKey(email), s.config.MaxAttempts); locked {
+		s.logger.Warn("Account locked after repeated failed logins", map[string]interface{}{
+			"event":        "account_locked",
+			"email":        email,
+			"ip":           ip,
+			"locked_until": until,
+		})
+		s.notifyAccountLocked(ctx, email, until)
+	}
+
+	if locked, until := s.recordFailure(ctx, ipThrottleKey(ip), s.config.IPMaxAttempts); locked {
+		s.logger.Warn("Client IP locked after repeated failed logins", map[string]interface{}{
+			"event":        "ip_locked",
+			"ip":           ip,
+			"locked_until": until,
+		})
+	}
+}
+
+// RecordSuccess clears the account's failures. The IP's failures are kept, so
+// signing into one account can't be used to keep guessing at others.
+func (s *LoginThrottleService) RecordSuccess(ctx context.Context, email string) {
+	if err := connectors.Conn(ctx, s.db).Unscoped().Where("throttle_key = ?", accountThrottleKey(email)).Delete(&models.LoginThrottle{}).Error; err != nil {
+		s.logger.Error("Failed to reset login failures", err, map[string]interface{}{
+			"email": email,
+		})
+	}
+
+	// Rows that stopped mattering a while ago are no longer needed
+	connectors.Conn(ctx, s.db).Unscoped().
+		Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", time.Now().Add(-s.config.LockoutDuration), time.Now()).
+		Delete(&models.LoginThrottle{})
+}
+
+// UseMFAToken counts an attempt to complete a login with the MFA login token
+// identified by tokenID. It returns ErrMFATokenUsed once the token has completed
+// a login or had mfaTokenMaxAttempts codes tried. expiresAt is the token's
+// expiry; its attempts are tracked until then.
+func (s *LoginThrottleService) UseMFAToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	now := time.Now()
+	return connectors.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		throttle, err := lockThrottle(tx, mfaTokenThrottleKey(tokenID), now)
+		if err != nil {
+			return err
+		}
+		if throttle.LockedUntil != nil {
+			return ErrMFATokenUsed
+		}
+
+		throttle.Failures++
+		throttle.LastFailureAt = now
+		if throttle.Failures >= mfaTokenMaxAttempts {
+			throttle.LockedUntil = &expiresAt
+		}
+		return tx.Save(throttle).Error
+	})
+}
+
+// SpendMFAToken marks the MFA login token as used once it has completed a login
+func (s *LoginThrottleService) SpendMFAToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	return connectors.Conn(ctx, s.db).Model(&models.LoginThrottle{}).
+		Where("throttle_key = ?", mfaTokenThrottleKey(tokenID)).
+		Update("locked_until", expiresAt).Error
+}
+
+// Unlock lifts the lockout and clears the failures of the user's account
+func (s *LoginThrottleService) Unlock(ctx context.Context, userID uint, unlockedBy uint) error {
+	var user models.User
+	if err := connectors.Conn(ctx, s.db).Select("id", "email").First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("user not found")
+		}
+		return err
+	}
+
+	if err := connectors.Conn(ctx, s.db).Unscoped().Where("throttle_key = ?", accountThrottleKey(user.Email)).Delete(&models.LoginThrottle{}).Error; err != nil {
+		s.logger.Error("Failed to unlock account", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		return err
+	}
+
+	s.logger.Info("Account unlocked", map[string]interface{}{
+		"event":       "account_unlocked",
+		"user_id":     userID,
+		"unlocked_by": unlockedBy,
+	})
+	return nil
+}
+
+// recordFailure increments the failure count for a key and reports whether this
+// failure locked it
+func (s *LoginThrottleService) recordFailure(ctx context.Context, key string, maxAttempts int) (bool, time.Time) {
+	now := time.Now()
+	var locked bool
+	var lockedUntil time.Time
+
+	err := connectors.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		throttle, err := lockThrottle(tx, key, now)
+		if err != nil {
+			return err
+		}
+
+		// Start counting afresh once a lock has expired or the last failure is old
+		if (throttle.LockedUntil != nil && now.After(*throttle.LockedUntil)) ||
+			now.Sub(throttle.LastFailureAt) > s.config.LockoutDuration {
+			throttle.Failures = 0
+			throttle.LockedUntil = nil
+		}
+
+		throttle.Failures++
+		throttle.LastFailureAt = now
+		if throttle.Failures >= maxAttempts && throttle.LockedUntil == nil {
+			lockedUntil = now.Add(s.config.LockoutDuration)
+			throttle.LockedUntil = &lockedUntil
+			locked = true
+		}
+		return tx.Save(throttle).Error
+	})
+	if err != nil {
+		s.logger.Error("Failed to record failed login", err, map[string]interface{}{
+			"key": key,
+		})
+		return false, time.Time{}
+	}
+	return locked, lockedUntil
+}
+
+// lockThrottle returns the throttle row of key, locked for update within tx. A
+// missing row is created first with an insert that does nothing on conflict,
+// so concurrent first failures for a key share one row instead of one of them
+// failing on the unique key.
+func lockThrottle(tx *gorm.DB, key string, now time.Time) (*models.LoginThrottle, error) {
+	if err := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "throttle_key"}}, DoNothing: true}).
+		Create(&models.LoginThrottle{Key: key, LastFailureAt: now}).Error; err != nil {
+		return nil, err
+	}
+
+	var throttle models.LoginThrottle
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("throttle_key = ?", key).First(&throttle).Error; err != nil {
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+// retryAfter returns how long the key must wait before the next attempt
+func (s *LoginThrottleService) retryAfter(throttle *models.LoginThrottle, now time.Time) time.Duration {
+	if throttle.LockedUntil != nil {
+		return throttle.LockedUntil.Sub(now) // Zero or negative once the lock has expired
+	}
+
+	if throttle.Failures <= loginBackoffFreeAttempts {
+		return 0
+	}
+	backoff := s.config.BackoffBase << (throttle.Failures - loginBackoffFreeAttempts - 1)
+	if backoff > s.config.BackoffMax || backoff <= 0 {
+		backoff = s.config.BackoffMax
+	}
+	return throttle.LastFailureAt.Add(backoff).Sub(now)
+}
+
+// notifyAccountLocked emails the account owner, if the account exists
+func (s *LoginThrottleService) notifyAccountLocked(ctx context.Context, email string, lockedUntil time.Time) {
+	if !s.emailSender.IsEnabled() {
+		return
+	}
+
+	var user models.User
+	if err := connectors.Conn(ctx, s.db).Select("id", "email").Where("email = ?", email).First(&user).Error; err != nil {
+		return // Unknown address; nobody to notify
+	}
+
+	go func() {
+		if err := s.emailSender.SendAccountLocked(user.Email, lockedUntil); err != nil {
+			s.logger.Error("Failed to send account locked email", err, map[string]interface{}{
+				"user_id": user.ID,
+			})
+		}
+	}()
+}
+
+// accountThrottleKey returns the throttle key for an account. Accounts are keyed
+// by email, whether or not it exists, so throttling doesn't reveal which do.
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// ipThrottleKey returns the throttle key for a client IP
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// mfaTokenThrottleKey returns the throttle key counting the attempts of an MFA
+// login token
+func mfaTokenThrottleKey(tokenID string) string {
+	return "mfa_token:" + tokenID
+}
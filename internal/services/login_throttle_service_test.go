@@ -0,0 +1,265 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/testutil"
+
+	"gorm.io/gorm"
+)
+
+// throttleFailures returns the failures counted against a throttle key
+func throttleFailures(t *testing.T, db *gorm.DB, key string) int {
+	t.Helper()
+
+	var throttle models.LoginThrottle
+	if err := db.Where("throttle_key = ?", key).First(&throttle).Error; err != nil {
+		return 0
+	}
+	return throttle.Failures
+}
+
+func TestLoginThrottleBackoff(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	cfg.LoginThrottle.MaxAttempts = 100
+	cfg.LoginThrottle.BackoffBase = time.Second
+	cfg.LoginThrottle.BackoffMax = 30 * time.Second
+	service := NewLoginThrottleService(db, newUserService(t, db, cfg), cfg)
+	ctx := context.Background()
+
+	tests := []struct {
+		failures int
+		wantWait time.Duration
+	}{
+		{1, 0},
+		{2, 0}, // The free attempts
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{9, 30 * time.Second}, // 64s, capped at BackoffMax
+	}
+
+	failures := 0
+	for _, tt := range tests {
+		for ; failures < tt.failures; failures++ {
+			service.RecordFailure(ctx, "ada@example.com", "192.0.2.1")
+		}
+
+		wait, err := service.Check(ctx, "ada@example.com", "192.0.2.2")
+		if tt.wantWait == 0 {
+			if err != nil {
+				t.Errorf("after %d failures: err = %v, want none", tt.failures, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrLoginThrottled) {
+			t.Fatalf("after %d failures: err = %v, want ErrLoginThrottled", tt.failures, err)
+		}
+		if wait > tt.wantWait || wait < tt.wantWait-time.Second {
+			t.Errorf("after %d failures: wait = %s, want about %s", tt.failures, wait, tt.wantWait)
+		}
+	}
+}
+
+func TestLoginThrottleLockout(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	cfg.LoginThrottle.MaxAttempts = 3
+	cfg.LoginThrottle.BackoffBase = time.Nanosecond
+	cfg.LoginThrottle.BackoffMax = time.Nanosecond
+	service := NewLoginThrottleService(db, newUserService(t, db, cfg), cfg)
+	ctx := context.Background()
+	key := accountThrottleKey("ada@example.com")
+
+	for i := 0; i < 2; i++ {
+		service.RecordFailure(ctx, "ada@example.com", "192.0.2.1")
+	}
+	if _, err := service.Check(ctx, "ada@example.com", "192.0.2.9"); err != nil {
+		t.Fatalf("below the threshold: err = %v, want none", err)
+	}
+
+	// Addresses are compared case-insensitively
+	service.RecordFailure(ctx, " ADA@example.com", "192.0.2.1")
+	wait, err := service.Check(ctx, "ada@example.com", "192.0.2.9")
+	if !errors.Is(err, ErrLoginThrottled) {
+		t.Fatalf("at the threshold: err = %v, want ErrLoginThrottled", err)
+	}
+	if lockout := cfg.LoginThrottle.LockoutDuration; wait > lockout || wait < lockout-time.Minute {
+		t.Errorf("wait = %s, want about %s", wait, lockout)
+	}
+
+	// Failures during the lock don't extend it
+	var locked models.LoginThrottle
+	db.Where("throttle_key = ?", key).First(&locked)
+	service.RecordFailure(ctx, "ada@example.com", "192.0.2.1")
+	var after models.LoginThrottle
+	db.Where("throttle_key = ?", key).First(&after)
+	if !after.LockedUntil.Equal(*locked.LockedUntil) {
+		t.Errorf("locked until %s, then %s after another failure", locked.LockedUntil, after.LockedUntil)
+	}
+
+	// Once the lock expires the account may try again, and counting starts afresh
+	past := time.Now().Add(-time.Second)
+	db.Model(&models.LoginThrottle{}).Where("throttle_key = ?", key).Update("locked_until", past)
+	if _, err := service.Check(ctx, "ada@example.com", "192.0.2.9"); err != nil {
+		t.Errorf("after the lock expired: err = %v, want none", err)
+	}
+	service.RecordFailure(ctx, "ada@example.com", "192.0.2.1")
+	if failures := throttleFailures(t, db, key); failures != 1 {
+		t.Errorf("%d failures after the lock expired, want 1", failures)
+	}
+}
+
+func TestLoginThrottleAccountsAndIPs(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures [][2]string // Email and IP of each failure
+		success  string      // Email signing in afterwards, if any
+		check    [2]string
+		want     bool // Throttled
+	}{
+		{
+			name:     "account locked from any IP",
+			failures: [][2]string{{"ada@example.com", "192.0.2.1"}, {"ada@example.com", "192.0.2.2"}, {"ada@example.com", "192.0.2.3"}},
+			check:    [2]string{"ada@example.com", "192.0.2.4"},
+			want:     true,
+		},
+		{
+			name:     "other accounts unaffected",
+			failures: [][2]string{{"ada@example.com", "192.0.2.1"}, {"ada@example.com", "192.0.2.2"}, {"ada@example.com", "192.0.2.3"}},
+			check:    [2]string{"bob@example.com", "192.0.2.4"},
+		},
+		{
+			name:     "IP locked for every account",
+			failures: [][2]string{{"a@example.com", "192.0.2.1"}, {"b@example.com", "192.0.2.1"}, {"c@example.com", "192.0.2.1"}, {"d@example.com", "192.0.2.1"}},
+			check:    [2]string{"e@example.com", "192.0.2.1"},
+			want:     true,
+		},
+		{
+			name:     "other IPs unaffected",
+			failures: [][2]string{{"a@example.com", "192.0.2.1"}, {"b@example.com", "192.0.2.1"}, {"c@example.com", "192.0.2.1"}, {"d@example.com", "192.0.2.1"}},
+			check:    [2]string{"e@example.com", "192.0.2.2"},
+		},
+		{
+			name:     "success clears the account",
+			failures: [][2]string{{"ada@example.com", "192.0.2.1"}, {"ada@example.com", "192.0.2.2"}},
+			success:  "ada@example.com",
+			check:    [2]string{"ada@example.com", "192.0.2.3"},
+		},
+		{
+			name:     "success doesn't clear the IP",
+			failures: [][2]string{{"a@example.com", "192.0.2.1"}, {"b@example.com", "192.0.2.1"}, {"c@example.com", "192.0.2.1"}, {"ada@example.com", "192.0.2.1"}},
+			success:  "ada@example.com",
+			check:    [2]string{"ada@example.com", "192.0.2.1"},
+			want:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, cfg := newTestEnv(t)
+			cfg.LoginThrottle.MaxAttempts = 3
+			cfg.LoginThrottle.IPMaxAttempts = 4
+			cfg.LoginThrottle.BackoffBase = time.Nanosecond
+			cfg.LoginThrottle.BackoffMax = time.Nanosecond
+			service := NewLoginThrottleService(db, newUserService(t, db, cfg), cfg)
+			ctx := context.Background()
+
+			for _, failure := range tt.failures {
+				service.RecordFailure(ctx, failure[0], failure[1])
+			}
+			if tt.success != "" {
+				service.RecordSuccess(ctx, tt.success)
+			}
+
+			_, err := service.Check(ctx, tt.check[0], tt.check[1])
+			if throttled := errors.Is(err, ErrLoginThrottled); throttled != tt.want {
+				t.Errorf("throttled = %v (%v), want %v", throttled, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginThrottleUnlock(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	cfg.LoginThrottle.MaxAttempts = 2
+	service := NewLoginThrottleService(db, newUserService(t, db, cfg), cfg)
+	ctx := context.Background()
+	user := createTestUser(t, db, cfg, "ada@example.com", "user")
+
+	for i := 0; i < 2; i++ {
+		service.RecordFailure(ctx, "ada@example.com", "192.0.2.1")
+	}
+	if _, err := service.Check(ctx, "ada@example.com", "192.0.2.2"); !errors.Is(err, ErrLoginThrottled) {
+		t.Fatalf("err = %v, want the account locked", err)
+	}
+
+	if err := service.Unlock(ctx, user.ID, 1); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if _, err := service.Check(ctx, "ada@example.com", "192.0.2.2"); err != nil {
+		t.Errorf("after Unlock: err = %v, want none", err)
+	}
+	if err := service.Unlock(ctx, 404, 1); err == nil {
+		t.Error("unlocking a missing user succeeded")
+	}
+}
+
+func TestLoginThrottleLockEmail(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	smtp := testutil.NewSMTPServer(t)
+	cfg.Email = smtp.EmailConfig()
+	cfg.LoginThrottle.MaxAttempts = 2
+	service := NewLoginThrottleService(db, newUserService(t, db, cfg), cfg)
+	ctx := context.Background()
+	createTestUser(t, db, cfg, "ada@example.com", "user")
+
+	// Locking an address without an account emails nobody
+	for _, email := range []string{"nobody@example.com", "nobody@example.com", "ada@example.com", "ada@example.com"} {
+		service.RecordFailure(ctx, email, "192.0.2.1")
+	}
+
+	emails := smtp.WaitForEmails(t, 1)
+	time.Sleep(50 * time.Millisecond) // Give an unexpected second email time to arrive
+	if emails = smtp.Emails(); len(emails) != 1 {
+		t.Fatalf("%d emails sent, want 1", len(emails))
+	}
+	if to := emails[0].To; len(to) != 1 || to[0] != "ada@example.com" {
+		t.Errorf("email sent to %v, want ada@example.com", to)
+	}
+	if subject := emails[0].Subject(); !strings.Contains(strings.ToLower(subject), "locked") {
+		t.Errorf("subject = %q, want the account locked email", subject)
+	}
+}
+
+func TestLoginThrottleConcurrentFirstFailure(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewLoginThrottleService(db, newUserService(t, db, cfg), cfg)
+	key := accountThrottleKey("ada@example.com")
+
+	// Another request records its first failure for the account just before
+	// this one inserts the row
+	raced := false
+	err := db.Callback().Create().Before("gorm:create").Register("test:concurrent_failure", func(tx *gorm.DB) {
+		if raced || tx.Statement.Table != "login_throttles" {
+			return
+		}
+		raced = true
+		tx.Session(&gorm.Session{NewDB: true}).Create(&models.LoginThrottle{Key: key, Failures: 1, LastFailureAt: time.Now()})
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	service.RecordFailure(context.Background(), "ada@example.com", "192.0.2.1")
+	if !raced {
+		t.Fatal("the concurrent failure wasn't simulated")
+	}
+	if failures := throttleFailures(t, db, key); failures != 2 {
+		t.Errorf("%d failures, want both counted", failures)
+	}
+}
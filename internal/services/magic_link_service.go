@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidMagicLink is returned for invalid, expired or already used sign-in links
+	ErrInvalidMagicLink = errors.New("invalid or expired sign-in link")
+	// ErrMagicLinkRateLimited is returned when an address has requested too many sign-in links
+	ErrMagicLinkRateLimited = errors.New("too many sign-in links requested")
+)
+
+// MagicLinkService signs users in with single-use links sent to their email address
+type MagicLinkService struct {
+	db          *gorm.DB
+	userService *UserService
+	emailSender *connectors.EmailSender
+	config      config.MagicLinkConfig
+	logger      *utils.Logger
+}
+
+// NewMagicLinkService creates a new magic link service instance
+func NewMagicLinkService(db *gorm.DB, userService *UserService, cfg *config.Config) *MagicLinkService {
+	return &MagicLinkService{
+		db:          db,
+		userService: userService,
+		emailSender: userService.emailSender,
+		config:      cfg.MagicLink,
+		logger:      utils.GetLogger().WithService("magic_link_service"),
+	}
+}
+
+// RequestLink emails a sign-in link to the user with the given address. Like
+// password resets, it succeeds whether or not the address belongs to an active
+// account. Each address may request a limited number of links per window;
+// beyond that it returns ErrMagicLinkRateLimited and how long to wait.
+func (s *MagicLinkService) RequestLink(ctx context.Context, email string) (time.Duration, error) {
+	address := strings.ToLower(strings.TrimSpace(email))
+	now := time.Now()
+
+	var recent []models.MagicLink
+	if err := connectors.Conn(ctx, s.db).Select("created_at").
+		Where("email = ? AND created_at > ?", address, now.Add(-s.config.Window)).
+		Order("created_at").
+		Find(&recent).Error; err != nil {
+		return 0, err
+	}
+	if len(recent) >= s.config.MaxRequests {
+		s.logger.Warn("Magic link requests rate limited", map[string]interface{}{
+			"email": address,
+		})
+		return recent[0].CreatedAt.Add(s.config.Window).Sub(now), ErrMagicLinkRateLimited
+	}
+
+	request := &models.MagicLink{
+		Email:     address,
+		ExpiresAt: now.Add(s.config.TTL),
+	}
+
+	user, _ := s.userService.GetByEmail(ctx, address)
+	var token string
+	if user != nil && user.IsActive {
+		linkID, err := generateOpaqueToken(16)
+		if err != nil {
+			return 0, err
+		}
+		token, err = middleware.GenerateActionTokenWithData(middleware.PurposeMagicLink, user.ID, user.Email,
+			map[string]string{"link_id": linkID}, s.config.TTL)
+		if err != nil {
+			return 0, fmt.Errorf("error generating sign-in link: %v", err)
+		}
+		request.UserID = &user.ID
+		request.LinkID = linkID
+	}
+
+	if err := connectors.Conn(ctx, s.db).Create(request).Error; err != nil {
+		s.logger.Error("Failed to record magic link request", err, map[string]interface{}{
+			"email": address,
+		})
+		return 0, err
+	}
+
+	// Requests older than any window or link lifetime are no longer needed
+	connectors.Conn(ctx, s.db).Unscoped().Where("created_at < ?", now.Add(-s.config.Window-s.config.TTL)).Delete(&models.MagicLink{})
+
+	if token == "" {
+		return 0, nil
+	}
+	if s.emailSender == nil {
+		s.logger.Warn("Email sender unavailable, magic link not sent", map[string]interface{}{
+			"id": user.ID,
+		})
+		return 0, nil
+	}
+
+	loginURL := fmt.Sprintf("%s?token=%s", s.config.URL, url.QueryEscape(token))
+
+	// Send in the background so response timing doesn't reveal whether the account exists
+	go func() {
+		if err := s.emailSender.SendMagicLink(user.Email, loginURL, s.config.TTL); err != nil {
+			s.logger.Error("Failed to send magic link email", err, map[string]interface{}{
+				"id": user.ID,
+			})
+		}
+	}()
+	return 0, nil
+}
+
+// Redeem consumes a sign-in link and returns the user it signs in. Redeeming a
+// link proves the user owns the address, so an unverified address becomes
+// verified, and the user's other outstanding links stop working.
+func (s *MagicLinkService) Redeem(ctx context.Context, token string) (*models.User, error) {
+	claims, err := middleware.ValidateActionToken(middleware.PurposeMagicLink, token)
+	if err != nil || claims.Data["link_id"] == "" {
+		return nil, ErrInvalidMagicLink
+	}
+
+	// Mark the link used; a concurrent redemption of the same link loses
+	now := time.Now()
+	consumed := connectors.Conn(ctx, s.db).Model(&models.MagicLink{}).
+		Where("link_id = ? AND user_id = ? AND used_at IS NULL AND expires_at > ?", claims.Data["link_id"], claims.UserID, now).
+		Update("used_at", now)
+	if consumed.Error != nil {
+		return nil, consumed.Error
+	}
+	if consumed.RowsAffected == 0 {
+		return nil, ErrInvalidMagicLink
+	}
+
+	user, err := s.userService.GetByID(ctx, claims.UserID)
+	if err != nil || !strings.EqualFold(user.Email, claims.Email) {
+		// The link was sent to an address the user no longer has
+		return nil, ErrInvalidMagicLink
+	}
+	if !user.IsActive {
+		return nil, ErrAccountInactive
+	}
+
+	if user.EmailVerifiedAt == nil {
+		if err := s.userService.claimUnverifiedAccount(ctx, user, "magic_link"); err != nil {
+			return nil, err
+		}
+		if user, err = s.userService.GetByID(ctx, user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := connectors.Conn(ctx, s.db).Model(&models.MagicLink{}).
+		Where("user_id = ? AND used_at IS NULL", user.ID).
+		Update("used_at", now).Error; err != nil {
+		s.logger.Error("Failed to invalidate outstanding magic links", err, map[string]interface{}{
+			"user_id": user.ID,
+		})
+	}
+
+	s.logger.Info("Magic link login", map[string]interface{}{
+		"user_id": user.ID,
+	})
+	return user, nil
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+)
+
+// requestMagicLink requests a link for the email and returns the token the
+// emailed link would carry
+func requestMagicLink(t *testing.T, service *MagicLinkService, user *models.User) string {
+	t.Helper()
+
+	if _, err := service.RequestLink(context.Background(), user.Email); err != nil {
+		t.Fatalf("RequestLink: %v", err)
+	}
+	var link models.MagicLink
+	if err := service.db.Where("user_id = ?", user.ID).Order("id DESC").First(&link).Error; err != nil {
+		t.Fatalf("no magic link recorded: %v", err)
+	}
+	token, err := middleware.GenerateActionTokenWithData(middleware.PurposeMagicLink, user.ID, user.Email,
+		map[string]string{"link_id": link.LinkID}, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateActionTokenWithData: %v", err)
+	}
+	return token
+}
+
+func TestRequestMagicLink(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewMagicLinkService(db, newUserService(t, db, cfg), cfg)
+	ctx := context.Background()
+	createTestUser(t, db, cfg, "ada@example.com", "user")
+
+	tests := []struct {
+		name     string
+		email    string
+		wantLink bool
+	}{
+		{"registered email", "Ada@Example.com ", true},
+		{"unknown email", "nobody@example.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.RequestLink(ctx, tt.email); err != nil {
+				t.Fatalf("RequestLink: %v", err)
+			}
+
+			// Unknown addresses are recorded too, so they're rate limited the same way
+			var link models.MagicLink
+			if err := db.Order("id DESC").First(&link).Error; err != nil {
+				t.Fatalf("no request recorded: %v", err)
+			}
+			if hasLink := link.LinkID != "" && link.UserID != nil; hasLink != tt.wantLink {
+				t.Errorf("link sent = %v, want %v", hasLink, tt.wantLink)
+			}
+		})
+	}
+}
+
+func TestRequestMagicLinkRateLimit(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewMagicLinkService(db, newUserService(t, db, cfg), cfg)
+	ctx := context.Background()
+
+	for i := 0; i < cfg.MagicLink.MaxRequests; i++ {
+		if _, err := service.RequestLink(ctx, "nobody@example.com"); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+	wait, err := service.RequestLink(ctx, "NOBODY@example.com")
+	if !errors.Is(err, ErrMagicLinkRateLimited) {
+		t.Fatalf("err = %v, want ErrMagicLinkRateLimited", err)
+	}
+	if wait <= 0 || wait > cfg.MagicLink.Window {
+		t.Errorf("wait = %s, want up to %s", wait, cfg.MagicLink.Window)
+	}
+	if _, err := service.RequestLink(ctx, "other@example.com"); err != nil {
+		t.Errorf("another address was rate limited: %v", err)
+	}
+}
+
+func TestRedeemMagicLink(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   func(t *testing.T, service *MagicLinkService, user *models.User) string
+		wantErr error
+	}{
+		{
+			name:  "valid link",
+			token: requestMagicLink,
+		},
+		{
+			name: "link already used",
+			token: func(t *testing.T, service *MagicLinkService, user *models.User) string {
+				token := requestMagicLink(t, service, user)
+				if _, err := service.Redeem(context.Background(), token); err != nil {
+					t.Fatalf("first Redeem: %v", err)
+				}
+				return token
+			},
+			wantErr: ErrInvalidMagicLink,
+		},
+		{
+			name: "older link after signing in with a newer one",
+			token: func(t *testing.T, service *MagicLinkService, user *models.User) string {
+				older := requestMagicLink(t, service, user)
+				if _, err := service.Redeem(context.Background(), requestMagicLink(t, service, user)); err != nil {
+					t.Fatalf("Redeem: %v", err)
+				}
+				return older
+			},
+			wantErr: ErrInvalidMagicLink,
+		},
+		{
+			name: "expired link",
+			token: func(t *testing.T, service *MagicLinkService, user *models.User) string {
+				token := requestMagicLink(t, service, user)
+				service.db.Model(&models.MagicLink{}).Where("user_id = ?", user.ID).Update("expires_at", time.Now().Add(-time.Second))
+				return token
+			},
+			wantErr: ErrInvalidMagicLink,
+		},
+		{
+			name: "token for another purpose",
+			token: func(t *testing.T, service *MagicLinkService, user *models.User) string {
+				requestMagicLink(t, service, user)
+				var link models.MagicLink
+				service.db.Where("user_id = ?", user.ID).First(&link)
+				token, _ := middleware.GenerateActionTokenWithData(middleware.PurposeEmailVerification, user.ID, user.Email,
+					map[string]string{"link_id": link.LinkID}, time.Minute)
+				return token
+			},
+			wantErr: ErrInvalidMagicLink,
+		},
+		{
+			name: "email changed since the link was sent",
+			token: func(t *testing.T, service *MagicLinkService, user *models.User) string {
+				token := requestMagicLink(t, service, user)
+				service.db.Model(user).Update("email", "ada@elsewhere.com")
+				return token
+			},
+			wantErr: ErrInvalidMagicLink,
+		},
+		{
+			name: "deactivated since the link was sent",
+			token: func(t *testing.T, service *MagicLinkService, user *models.User) string {
+				token := requestMagicLink(t, service, user)
+				service.db.Model(user).Update("is_active", false)
+				return token
+			},
+			wantErr: ErrAccountInactive,
+		},
+		{
+			name: "garbage",
+			token: func(*testing.T, *MagicLinkService, *models.User) string {
+				return "not-a-token"
+			},
+			wantErr: ErrInvalidMagicLink,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, cfg := newTestEnv(t)
+			service := NewMagicLinkService(db, newUserService(t, db, cfg), cfg)
+			user := createTestUser(t, db, cfg, "ada@example.com", "user")
+
+			signedIn, err := service.Redeem(context.Background(), tt.token(t, service, user))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if signedIn.ID != user.ID {
+				t.Errorf("signed in user %d, want %d", signedIn.ID, user.ID)
+			}
+			if signedIn.EmailVerifiedAt == nil {
+				t.Error("redeeming the link didn't verify the email address")
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// recoveryCodeCount is the number of recovery codes issued per enrollment
+	recoveryCodeCount = 10
+	// totpSkew is the number of time steps of clock drift accepted either way
+	totpSkew = 1
+)
+
+var (
+	// ErrInvalidMFACode is returned when a TOTP or recovery code does not match
+	ErrInvalidMFACode = errors.New("invalid verification code")
+	// ErrMFAAlreadyEnabled is returned when enrolling a user that already has MFA enabled
+	ErrMFAAlreadyEnabled = errors.New("multi-factor authentication is already enabled")
+	// ErrMFANotEnabled is returned for operations that require MFA to be enabled
+	ErrMFANotEnabled = errors.New("multi-factor authentication is not enabled")
+	// ErrMFAEnrollmentNotStarted is returned when confirming without a pending enrollment
+	ErrMFAEnrollmentNotStarted = errors.New("multi-factor enrollment has not been started")
+)
+
+// MFAEnrollment holds what a client needs to add the account to an authenticator app
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"` // Render as a QR code
+}
+
+// MFAService handles TOTP enrollment, verification and recovery codes
+type MFAService struct {
+	db     *gorm.DB
+	issuer string
+	logger *utils.Logger
+}
+
+// NewMFAService creates a new MFA service instance
+func NewMFAService(db *gorm.DB, cfg *config.Config) *MFAService {
+	return &MFAService{
+		db:     db,
+		issuer: cfg.Security.MFAIssuer,
+		logger: utils.GetLogger().WithService("mfa_service"),
+	}
+}
+
+// BeginEnrollment generates a new TOTP secret for the user. MFA is not enabled
+// until the secret is confirmed with ConfirmEnrollment.
+func (s *MFAService) BeginEnrollment(ctx context.Context, userID uint) (*MFAEnrollment, error) {
+	s.logger.Info("Starting MFA enrollment", map[string]interface{}{
+		"user_id": userID,
+	})
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := connectors.Conn(ctx, s.db).Model(user).Updates(map[string]interface{}{
+		"mfa_secret":         secret,
+		"mfa_last_used_step": 0,
+	}).Error; err != nil {
+		s.logger.Error("Failed to store MFA secret", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		return nil, err
+	}
+
+	return &MFAEnrollment{
+		Secret: secret,
+		URI:    utils.TOTPProvisioningURI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmEnrollment enables MFA once the user proves their authenticator works,
+// returning a fresh set of recovery codes that are only shown once
+func (s *MFAService) ConfirmEnrollment(ctx context.Context, userID uint, code string) ([]string, error) {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.MFASecret == "" {
+		return nil, ErrMFAEnrollmentNotStarted
+	}
+
+	if err := s.verifyTOTP(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err = connectors.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("mfa_enabled", true).Error; err != nil {
+			return err
+		}
+		codes, err = s.replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		s.logger.Error("Failed to enable MFA", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		return nil, err
+	}
+
+	s.logger.Info("MFA enabled", map[string]interface{}{
+		"user_id": userID,
+	})
+	return codes, nil
+}
+
+// Disable turns MFA off after verifying a current TOTP or recovery code
+func (s *MFAService) Disable(ctx context.Context, userID uint, code string) error {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+
+	err := connectors.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"mfa_enabled":        false,
+			"mfa_secret":         "",
+			"mfa_last_used_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error
+	})
+	if err != nil {
+		s.logger.Error("Failed to disable MFA", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		return err
+	}
+
+	s.logger.Info("MFA disabled", map[string]interface{}{
+		"user_id": userID,
+	})
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after verifying a current code
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) ([]string, error) {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := connectors.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = s.replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		s.logger.Error("Failed to regenerate recovery codes", err, map[string]interface{}{
+			"user_id": userID,
+		})
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify checks a TOTP code or, failing that, consumes a recovery code
+func (s *MFAService) Verify(ctx context.Context, userID uint, code string) error {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.MFAEnabled {
+		return ErrMFANotEnabled
+	}
+
+	if err := s.verifyTOTP(ctx, user, code); err == nil {
+		return nil
+	}
+	return s.useRecoveryCode(ctx, userID, code)
+}
+
+// verifyTOTP validates a TOTP code and records its time step so it can't be replayed
+func (s *MFAService) verifyTOTP(ctx context.Context, user *models.User, code string) error {
+	step, ok := utils.ValidateTOTP(user.MFASecret, code, time.Now(), totpSkew)
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	result := connectors.Conn(ctx, s.db).Model(&models.User{}).
+		Where("id = ? AND mfa_last_used_step < ?", user.ID, step).
+		Update("mfa_last_used_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		s.logger.Warn("Rejected replayed TOTP code", map[string]interface{}{
+			"user_id": user.ID,
+		})
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// useRecoveryCode marks a matching unused recovery code as used
+func (s *MFAService) useRecoveryCode(ctx context.Context, userID uint, code string) error {
+	result := connectors.Conn(ctx, s.db).Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashOpaqueToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+
+	s.logger.Info("Recovery code used", map[string]interface{}{
+		"user_id": userID,
+	})
+	return nil
+}
+
+// replaceRecoveryCodes deletes existing recovery codes and stores a new set
+func (s *MFAService) replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.MFARecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, models.MFARecoveryCode{
+			UserID:   userID,
+			CodeHash: hashOpaqueToken(normalizeRecoveryCode(code)),
+		})
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *MFAService) getUser(ctx context.Context, userID uint) (*models.User, error) {
+	var user models.User
+	if err := connectors.Conn(ctx, s.db).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// generateRecoveryCode returns a code formatted as two groups of five characters
+func generateRecoveryCode() (string, error) {
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %v", err)
+	}
+	code := strings.ToLower(secret[:10])
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeRecoveryCode makes recovery code comparison ignore case, spaces and dashes
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
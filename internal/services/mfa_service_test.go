@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/utils"
+)
+
+// totpAt computes the TOTP code an authenticator app shows for the secret at
+// the given time
+func totpAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decode TOTP secret: %v", err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(at.Unix()/utils.TOTPPeriod))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+// enrollMFA enables MFA for the user with the code for now and returns the
+// secret and recovery codes
+func enrollMFA(t *testing.T, service *MFAService, userID uint, now time.Time) (string, []string) {
+	t.Helper()
+
+	enrollment, err := service.BeginEnrollment(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("BeginEnrollment: %v", err)
+	}
+	codes, err := service.ConfirmEnrollment(context.Background(), userID, totpAt(t, enrollment.Secret, now))
+	if err != nil {
+		t.Fatalf("ConfirmEnrollment: %v", err)
+	}
+	return enrollment.Secret, codes
+}
+
+func TestMFAEnrollment(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewMFAService(db, cfg)
+	ctx := context.Background()
+	user := createTestUser(t, db, cfg, "ada@example.com", "user")
+
+	if _, err := service.ConfirmEnrollment(ctx, user.ID, "123456"); !errors.Is(err, ErrMFAEnrollmentNotStarted) {
+		t.Errorf("confirm before begin: err = %v, want ErrMFAEnrollmentNotStarted", err)
+	}
+
+	enrollment, err := service.BeginEnrollment(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("BeginEnrollment: %v", err)
+	}
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/") || !strings.Contains(enrollment.URI, enrollment.Secret) {
+		t.Errorf("URI = %s, want an otpauth URI with the secret", enrollment.URI)
+	}
+
+	wrong := totpAt(t, enrollment.Secret, time.Now().Add(-time.Hour))
+	if _, err := service.ConfirmEnrollment(ctx, user.ID, wrong); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("confirm with an old code: err = %v, want ErrInvalidMFACode", err)
+	}
+	if err := service.Verify(ctx, user.ID, wrong); !errors.Is(err, ErrMFANotEnabled) {
+		t.Errorf("verify before confirming: err = %v, want ErrMFANotEnabled", err)
+	}
+
+	codes, err := service.ConfirmEnrollment(ctx, user.ID, totpAt(t, enrollment.Secret, time.Now()))
+	if err != nil {
+		t.Fatalf("ConfirmEnrollment: %v", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Errorf("%d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+	if _, err := service.BeginEnrollment(ctx, user.ID); !errors.Is(err, ErrMFAAlreadyEnabled) {
+		t.Errorf("enroll twice: err = %v, want ErrMFAAlreadyEnabled", err)
+	}
+}
+
+func TestMFAVerify(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewMFAService(db, cfg)
+	ctx := context.Background()
+	user := createTestUser(t, db, cfg, "ada@example.com", "user")
+
+	// Codes are relative to the enrollment time so a step boundary passing
+	// during the test doesn't change which codes have been used
+	now := time.Now()
+	secret, codes := enrollMFA(t, service, user.ID, now)
+	next := totpAt(t, secret, now.Add(utils.TOTPPeriod*time.Second))
+
+	steps := []struct {
+		name    string
+		code    string
+		wantErr error
+	}{
+		{"code used to enroll", totpAt(t, secret, now), ErrInvalidMFACode},
+		{"next code", next, nil},
+		{"next code replayed", next, ErrInvalidMFACode},
+		{"code from a minute ago", totpAt(t, secret, now.Add(-2*utils.TOTPPeriod*time.Second)), ErrInvalidMFACode},
+		{"recovery code", codes[0], nil},
+		{"recovery code reused", codes[0], ErrInvalidMFACode},
+		{"recovery code without dash in upper case", strings.ToUpper(strings.ReplaceAll(codes[1], "-", "")), nil},
+		{"unknown recovery code", "aaaaa-bbbbb", ErrInvalidMFACode},
+	}
+
+	// Each step depends on the ones before it
+	for _, step := range steps {
+		if err := service.Verify(ctx, user.ID, step.code); !errors.Is(err, step.wantErr) {
+			t.Errorf("%s: err = %v, want %v", step.name, err, step.wantErr)
+		}
+	}
+}
+
+func TestRegenerateRecoveryCodes(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewMFAService(db, cfg)
+	ctx := context.Background()
+	user := createTestUser(t, db, cfg, "ada@example.com", "user")
+	_, codes := enrollMFA(t, service, user.ID, time.Now())
+
+	if _, err := service.RegenerateRecoveryCodes(ctx, user.ID, "aaaaa-bbbbb"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("regenerate with a wrong code: err = %v, want ErrInvalidMFACode", err)
+	}
+
+	fresh, err := service.RegenerateRecoveryCodes(ctx, user.ID, codes[0])
+	if err != nil {
+		t.Fatalf("RegenerateRecoveryCodes: %v", err)
+	}
+	if err := service.Verify(ctx, user.ID, codes[1]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("old recovery code: err = %v, want ErrInvalidMFACode", err)
+	}
+	if err := service.Verify(ctx, user.ID, fresh[0]); err != nil {
+		t.Errorf("new recovery code: %v", err)
+	}
+}
+
+func TestDisableMFA(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewMFAService(db, cfg)
+	ctx := context.Background()
+	user := createTestUser(t, db, cfg, "ada@example.com", "user")
+	_, codes := enrollMFA(t, service, user.ID, time.Now())
+
+	if err := service.Disable(ctx, user.ID, "aaaaa-bbbbb"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("disable with a wrong code: err = %v, want ErrInvalidMFACode", err)
+	}
+	if err := service.Disable(ctx, user.ID, codes[0]); err != nil {
+		t.Fatalf("Disable: %v", err)
+	}
+
+	var stored models.User
+	db.First(&stored, user.ID)
+	if stored.MFAEnabled || stored.MFASecret != "" {
+		t.Error("MFA is still enabled")
+	}
+	var remaining int64
+	db.Model(&models.MFARecoveryCode{}).Where("user_id = ?", user.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("%d recovery codes left, want 0", remaining)
+	}
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/utils"
+
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// OIDCStateTTL bounds how long a user may take at the identity provider
+const OIDCStateTTL = 10 * time.Minute
+
+var (
+	// ErrUnknownOIDCProvider is returned for a provider name that isn't configured
+	ErrUnknownOIDCProvider = errors.New("unknown identity provider")
+	// ErrInvalidOIDCState is returned when the callback doesn't match the login that was started
+	ErrInvalidOIDCState = errors.New("invalid or expired login state")
+	// ErrOIDCEmailNotVerified is returned when the provider can't vouch for the user's email address
+	ErrOIDCEmailNotVerified = errors.New("the identity provider did not return a verified email address")
+)
+
+// OIDCService signs users in through external OpenID Connect providers and links
+// provider accounts to local users
+type OIDCService struct {
+	db          *gorm.DB
+	userService *UserService
+	providers   map[string]*connectors.OIDCProvider
+	logger      *utils.Logger
+}
+
+// NewOIDCService creates a new OIDC service instance for the given providers
+func NewOIDCService(db *gorm.DB, userService *UserService, providers ...*connectors.OIDCProvider) *OIDCService {
+	byName := make(map[string]*connectors.OIDCProvider, len(providers))
+	for _, provider := range providers {
+		byName[provider.Name()] = provider
+	}
+
+	return &OIDCService{
+		db:          db,
+		userService: userService,
+		providers:   byName,
+		logger:      utils.GetLogger().WithService("oidc_service"),
+	}
+}
+
+// Providers returns the names of the configured providers
+func (s *OIDCService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BeginLogin starts an authorization code flow. It returns the provider URL to
+// redirect the user to and a signed state token holding the state, nonce and
+// PKCE verifier, which the caller must keep private to the user agent (e.g. in
+// an HttpOnly cookie) and pass back to CompleteLogin.
+func (s *OIDCService) BeginLogin(providerName string) (authURL, stateToken string, err error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", ErrUnknownOIDCProvider
+	}
+
+	state, err := generateOpaqueToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := generateOpaqueToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	stateToken, err = middleware.GenerateActionTokenWithData(middleware.PurposeOIDCState, 0, "", map[string]string{
+		"provider": providerName,
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+	}, OIDCStateTTL)
+	if err != nil {
+		return "", "", err
+	}
+
+	return provider.AuthCodeURL(state, nonce, verifier), stateToken, nil
+}
+
+// CompleteLogin handles the provider callback: it checks the state, redeems the
+// code, verifies the ID token and returns the linked local user, creating or
+// linking one by verified email if this provider account is new
+func (s *OIDCService) CompleteLogin(ctx context.Context, providerName, code, state, stateToken string) (*models.User, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+
+	claims, err := middleware.ValidateActionToken(middleware.PurposeOIDCState, stateToken)
+	if err != nil || claims.Data["provider"] != providerName || state == "" ||
+		subtle.ConstantTimeCompare([]byte(claims.Data["state"]), []byte(state)) != 1 {
+		return nil, ErrInvalidOIDCState
+	}
+
+	identity, err := provider.Exchange(ctx, code, claims.Data["verifier"], claims.Data["nonce"])
+	if err != nil {
+		s.logger.Warn("OIDC login failed", map[string]interface{}{
+			"provider": providerName,
+			"error":    err.Error(),
+		})
+		return nil, err
+	}
+
+	// A user created on first login is only kept if the identity is linked to it
+	var user *models.User
+	err = connectors.WithTransaction(ctx, s.db, func(ctx context.Context) error {
+		user, err = s.resolveUser(ctx, providerName, identity)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrAccountInactive
+	}
+
+	s.logger.Info("OIDC login", map[string]interface{}{
+		"provider": providerName,
+		"user_id":  user.ID,
+	})
+	return user, nil
+}
+
+// resolveUser finds the user linked to the provider account, linking or creating
+// one by verified email on first login
+func (s *OIDCService) resolveUser(ctx context.Context, providerName string, identity *connectors.OIDCIdentity) (*models.User, error) {
+	var link models.UserIdentity
+	err := connectors.Conn(ctx, s.db).Where("provider = ? AND subject = ?", providerName, identity.Subject).First(&link).Error
+	if err == nil {
+		if identity.Email != "" && identity.Email != link.Email {
+			connectors.Conn(ctx, s.db).Model(&link).Update("email", identity.Email)
+		}
+		return s.userService.GetByID(ctx, link.UserID)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// Only an address the provider has verified may claim a local account
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, ErrOIDCEmailNotVerified
+	}
+
+	user, _ := s.userService.GetByEmail(ctx, identity.Email)
+	if user == nil {
+		firstName, lastName := identity.GivenName, identity.FamilyName
+		if firstName == "" && lastName == "" {
+			firstName, lastName, _ = strings.Cut(identity.Name, " ")
+		}
+		if user, err = s.userService.CreateExternalUser(ctx, identity.Email, firstName, lastName); err != nil {
+			return nil, err
+		}
+	} else if user.EmailVerifiedAt == nil {
+		// Whoever registered this address never proved they own it, so the
+		// password they chose can't be trusted once the real owner signs in
+		if err := s.userService.claimUnverifiedAccount(ctx, user, "oidc:"+providerName); err != nil {
+			return nil, err
+		}
+	}
+
+	link = models.UserIdentity{
+		UserID:   user.ID,
+		Provider: providerName,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+	if err := connectors.Conn(ctx, s.db).Create(&link).Error; err != nil {
+		s.logger.Error("Failed to link identity", err, map[string]interface{}{
+			"provider": providerName,
+			"user_id":  user.ID,
+		})
+		return nil, err
+	}
+
+	s.logger.Info("Linked external identity", map[string]interface{}{
+		"provider": providerName,
+		"user_id":  user.ID,
+	})
+	return s.userService.GetByID(ctx, user.ID)
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/testutil"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// newTestOIDCService returns an OIDC service for a fake provider named "fake"
+func newTestOIDCService(t *testing.T) (*OIDCService, *testutil.FakeOIDCProvider, *gorm.DB) {
+	t.Helper()
+	db, cfg := newTestEnv(t)
+	fake := testutil.NewOIDCProvider(t)
+	provider, err := connectors.NewOIDCProvider(context.Background(), fake.ProviderConfig("fake"))
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	return NewOIDCService(db, newUserService(t, db, cfg), provider), fake, db
+}
+
+// oidcLogin signs the user in at the fake provider and completes the login
+func oidcLogin(t *testing.T, service *OIDCService, fake *testutil.FakeOIDCProvider, user testutil.OIDCUser) (*models.User, error) {
+	t.Helper()
+	authURL, stateToken, err := service.BeginLogin("fake")
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	code, state := fake.Authorize(t, authURL, user, nil)
+	return service.CompleteLogin(context.Background(), "fake", code, state, stateToken)
+}
+
+func TestOIDCCompleteLoginState(t *testing.T) {
+	service, fake, _ := newTestOIDCService(t)
+	user := testutil.OIDCUser{Subject: "sub-1", Email: "ada@example.com", EmailVerified: true}
+
+	tests := []struct {
+		name    string
+		tamper  func(code, state, stateToken, otherStateToken string) (string, string, string, string)
+		wantErr error
+	}{
+		{
+			name: "matching state",
+			tamper: func(code, state, stateToken, _ string) (string, string, string, string) {
+				return "fake", code, state, stateToken
+			},
+		},
+		{
+			name: "state mismatch",
+			tamper: func(code, _, stateToken, _ string) (string, string, string, string) {
+				return "fake", code, "forged", stateToken
+			},
+			wantErr: ErrInvalidOIDCState,
+		},
+		{
+			name: "empty state",
+			tamper: func(code, _, stateToken, _ string) (string, string, string, string) {
+				return "fake", code, "", stateToken
+			},
+			wantErr: ErrInvalidOIDCState,
+		},
+		{
+			name: "state token of another login",
+			tamper: func(code, state, _, otherStateToken string) (string, string, string, string) {
+				return "fake", code, state, otherStateToken
+			},
+			wantErr: ErrInvalidOIDCState,
+		},
+		{
+			name: "forged state token",
+			tamper: func(code, state, _, _ string) (string, string, string, string) {
+				return "fake", code, state, "not-a-token"
+			},
+			wantErr: ErrInvalidOIDCState,
+		},
+		{
+			name: "unknown provider",
+			tamper: func(code, state, stateToken, _ string) (string, string, string, string) {
+				return "other", code, state, stateToken
+			},
+			wantErr: ErrUnknownOIDCProvider,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authURL, stateToken, err := service.BeginLogin("fake")
+			if err != nil {
+				t.Fatalf("BeginLogin: %v", err)
+			}
+			_, otherStateToken, err := service.BeginLogin("fake")
+			if err != nil {
+				t.Fatalf("BeginLogin: %v", err)
+			}
+			code, state := fake.Authorize(t, authURL, user, nil)
+
+			provider, code, state, stateToken := tt.tamper(code, state, stateToken, otherStateToken)
+			_, err = service.CompleteLogin(context.Background(), provider, code, state, stateToken)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDCCompleteLoginRejectsNonceMismatch(t *testing.T) {
+	service, fake, _ := newTestOIDCService(t)
+
+	authURL, stateToken, err := service.BeginLogin("fake")
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	user := testutil.OIDCUser{Subject: "sub-1", Email: "ada@example.com", EmailVerified: true}
+	code, state := fake.Authorize(t, authURL, user, func(claims jwt.MapClaims) {
+		claims["nonce"] = "replayed"
+	})
+
+	if _, err := service.CompleteLogin(context.Background(), "fake", code, state, stateToken); err == nil {
+		t.Error("an ID token with another login's nonce was accepted")
+	}
+}
+
+func TestOIDCCompleteLoginLinking(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing *models.User // Local user before the first login
+		identity testutil.OIDCUser
+		wantErr  error
+		wantNew  bool // A user was created
+	}{
+		{
+			name:     "new verified email creates a user",
+			identity: testutil.OIDCUser{Subject: "sub-1", Email: "new@example.com", EmailVerified: true, GivenName: "Ada", FamilyName: "Lovelace"},
+			wantNew:  true,
+		},
+		{
+			name:     "verified email links an existing user",
+			existing: &models.User{Email: "ada@example.com", Password: "$2a$04$unused", IsActive: true},
+			identity: testutil.OIDCUser{Subject: "sub-1", Email: "ada@example.com", EmailVerified: true},
+		},
+		{
+			name:     "unverified email doesn't link an existing user",
+			existing: &models.User{Email: "ada@example.com", Password: "$2a$04$unused", IsActive: true},
+			identity: testutil.OIDCUser{Subject: "sub-1", Email: "ada@example.com", EmailVerified: false},
+			wantErr:  ErrOIDCEmailNotVerified,
+		},
+		{
+			name:     "unverified email doesn't create a user",
+			identity: testutil.OIDCUser{Subject: "sub-1", Email: "new@example.com", EmailVerified: false},
+			wantErr:  ErrOIDCEmailNotVerified,
+		},
+		{
+			name:     "missing email doesn't create a user",
+			identity: testutil.OIDCUser{Subject: "sub-1", EmailVerified: true},
+			wantErr:  ErrOIDCEmailNotVerified,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, fake, db := newTestOIDCService(t)
+			if tt.existing != nil {
+				if err := db.Create(tt.existing).Error; err != nil {
+					t.Fatalf("create user: %v", err)
+				}
+			}
+
+			user, err := oidcLogin(t, service, fake, tt.identity)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			var users, links int64
+			db.Model(&models.User{}).Count(&users)
+			db.Model(&models.UserIdentity{}).Count(&links)
+			wantUsers := int64(0)
+			if tt.existing != nil || tt.wantNew {
+				wantUsers = 1
+			}
+			if users != wantUsers {
+				t.Errorf("%d users, want %d", users, wantUsers)
+			}
+			if tt.wantErr != nil {
+				if links != 0 {
+					t.Errorf("%d identities linked, want 0", links)
+				}
+				return
+			}
+
+			if links != 1 {
+				t.Errorf("%d identities linked, want 1", links)
+			}
+			if user.Email != tt.identity.Email || user.EmailVerifiedAt == nil {
+				t.Errorf("user = %s verified at %v, want %s verified", user.Email, user.EmailVerifiedAt, tt.identity.Email)
+			}
+			if tt.existing != nil && user.ID != tt.existing.ID {
+				t.Errorf("signed in as user %d, want the existing user %d", user.ID, tt.existing.ID)
+			}
+		})
+	}
+}
+
+func TestOIDCCompleteLoginClaimsUnverifiedAccount(t *testing.T) {
+	service, fake, db := newTestOIDCService(t)
+	squatter := &models.User{Email: "ada@example.com", Password: "$2a$04$squatter", IsActive: true}
+	if err := db.Create(squatter).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	user, err := oidcLogin(t, service, fake, testutil.OIDCUser{Subject: "sub-1", Email: "ada@example.com", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+	if user.ID != squatter.ID || user.EmailVerifiedAt == nil {
+		t.Fatalf("user = %d verified at %v, want %d verified", user.ID, user.EmailVerifiedAt, squatter.ID)
+	}
+	if user.Password == squatter.Password {
+		t.Error("the password set by whoever registered the unverified address still works")
+	}
+}
+
+func TestOIDCCompleteLoginBySubject(t *testing.T) {
+	service, fake, _ := newTestOIDCService(t)
+
+	first, err := oidcLogin(t, service, fake, testutil.OIDCUser{Subject: "sub-1", Email: "ada@example.com", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	// The provider account is linked, so a changed and unverified address still signs in
+	second, err := oidcLogin(t, service, fake, testutil.OIDCUser{Subject: "sub-1", Email: "ada@new.example.com"})
+	if err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("second login signed in as user %d, want %d", second.ID, first.ID)
+	}
+}
@@ -0,0 +1,515 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrOrganizationNotFound is returned for an organization that doesn't exist
+	ErrOrganizationNotFound = errors.New("organization not found")
+	// ErrSlugTaken is returned when another organization already uses the slug
+	ErrSlugTaken = errors.New("organization slug is already taken")
+	// ErrInvalidOrgRole is returned for a role that isn't owner, admin or member
+	ErrInvalidOrgRole = errors.New("invalid organization role")
+	// ErrOrgRoleNotAllowed is returned when the acting member's role can't grant or change the role
+	ErrOrgRoleNotAllowed = errors.New("your organization role does not allow this")
+	// ErrMemberNotFound is returned when the user isn't a member of the organization
+	ErrMemberNotFound = errors.New("member not found")
+	// ErrLastOwner is returned when a change would leave the organization without an owner
+	ErrLastOwner = errors.New("an organization must keep at least one owner")
+	// ErrAlreadyMember is returned when inviting someone who already belongs to the organization
+	ErrAlreadyMember = errors.New("user is already a member of this organization")
+	// ErrInvitationNotFound is returned for an invitation that doesn't exist or was already used
+	ErrInvitationNotFound = errors.New("invitation not found")
+	// ErrInvalidInvitation is returned for invalid, expired, revoked or already accepted invitation links
+	ErrInvalidInvitation = errors.New("invalid or expired invitation")
+	// ErrInvitationEmailMismatch is returned when the signed-in user isn't the invited address
+	ErrInvitationEmailMismatch = errors.New("this invitation was sent to a different email address")
+)
+
+// slugInvalidChars matches runs of characters that can't appear in a slug
+var slugInvalidChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// OrganizationService manages organizations, their members and invitations
+type OrganizationService struct {
+	db          *gorm.DB
+	emailSender *connectors.EmailSender
+	invitations config.OrganizationsConfig
+	logger      *utils.Logger
+}
+
+// NewOrganizationService creates a new organization service instance
+func NewOrganizationService(db *gorm.DB, userService *UserService, cfg *config.Config) *OrganizationService {
+	return &OrganizationService{
+		db:          db,
+		emailSender: userService.emailSender,
+		invitations: cfg.Organizations,
+		logger:      utils.GetLogger().WithService("organization_service"),
+	}
+}
+
+// CreateOrganizationInput represents the input for creating an organization
+type CreateOrganizationInput struct {
+	Name string `json:"name" binding:"required,max=100"`
+	Slug string `json:"slug" binding:"omitempty,max=100"` // Derived from the name when empty
+}
+
+// UpdateOrganizationInput represents the input for updating an organization
+type UpdateOrganizationInput struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// InviteMemberInput represents the input for inviting someone to an organization
+type InviteMemberInput struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required"`
+}
+
+// Member is a user's membership as shown to other members
+type Member struct {
+	UserID    uint      `json:"user_id"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Role      string    `json:"role"`
+	JoinedAt  time.Time `json:"joined_at"`
+}
+
+// Create creates an organization with the user as its owner
+func (s *OrganizationService) Create(ctx context.Context, userID uint, input CreateOrganizationInput) (*models.Organization, error) {
+	s.logger.Info("Creating organization", map[string]interface{}{
+		"user_id": userID,
+	})
+
+	slug := slugify(input.Slug)
+	if slug == "" {
+		slug = slugify(input.Name)
+	}
+	if slug == "" {
+		return nil, errors.New("organization name must contain letters or digits")
+	}
+
+	org := &models.Organization{Name: strings.TrimSpace(input.Name), Slug: slug}
+	err := connectors.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Unscoped().Model(&models.Organization{}).Where("slug = ?", slug).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrSlugTaken
+		}
+
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.Membership{
+			OrganizationID: org.ID,
+			UserID:         userID,
+			Role:           models.OrgRoleOwner,
+		}).Error
+	})
+	if err != nil {
+		if !errors.Is(err, ErrSlugTaken) {
+			s.logger.Error("Failed to create organization", err, map[string]interface{}{
+				"user_id": userID,
+			})
+		}
+		return nil, err
+	}
+
+	return org, nil
+}
+
+// ListForUser returns the user's memberships with their organizations
+func (s *OrganizationService) ListForUser(ctx context.Context, userID uint) ([]models.Membership, error) {
+	var memberships []models.Membership
+	err := connectors.Conn(ctx, s.db).Preload("Organization").
+		Joins("JOIN organizations ON organizations.id = memberships.organization_id AND organizations.deleted_at IS NULL").
+		Where("memberships.user_id = ?", userID).
+		Order("organizations.name").
+		Find(&memberships).Error
+	return memberships, err
+}
+
+// Get retrieves an organization by ID
+func (s *OrganizationService) Get(ctx context.Context, organizationID uint) (*models.Organization, error) {
+	var org models.Organization
+	if err := connectors.Conn(ctx, s.db).First(&org, organizationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, err
+	}
+	return &org, nil
+}
+
+// Update renames an organization
+func (s *OrganizationService) Update(ctx context.Context, organizationID uint, input UpdateOrganizationInput) (*models.Organization, error) {
+	result := connectors.Conn(ctx, s.db).Model(&models.Organization{}).Where("id = ?", organizationID).Update("name", strings.TrimSpace(input.Name))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrOrganizationNotFound
+	}
+	return s.Get(ctx, organizationID)
+}
+
+// Delete deletes an organization along with its memberships and invitations
+func (s *OrganizationService) Delete(ctx context.Context, organizationID uint) error {
+	s.logger.Info("Deleting organization", map[string]interface{}{
+		"organization_id": organizationID,
+	})
+
+	err := connectors.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ?", organizationID).Delete(&models.Membership{}).Error; err != nil {
+			return err
+		}
+		// The tenant scope limits this to the organization's invitations
+		if err := tx.WithContext(models.WithTenant(ctx, organizationID)).Delete(&models.Invitation{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&models.Organization{}, organizationID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrganizationNotFound
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrOrganizationNotFound) {
+		s.logger.Error("Failed to delete organization", err, map[string]interface{}{
+			"organization_id": organizationID,
+		})
+	}
+	return err
+}
+
+// MembershipRole returns the user's role in the organization.
+// It implements middleware.MembershipResolver.
+func (s *OrganizationService) MembershipRole(ctx context.Context, organizationID, userID uint) (string, error) {
+	var membership models.Membership
+	err := connectors.Conn(ctx, s.db).Select("role").
+		Where("organization_id = ? AND user_id = ?", organizationID, userID).
+		First(&membership).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", middleware.ErrNotMember
+		}
+		return "", err
+	}
+	return membership.Role, nil
+}
+
+// ListMembers returns the organization's members, owners first
+func (s *OrganizationService) ListMembers(ctx context.Context, organizationID uint) ([]Member, error) {
+	var members []Member
+	err := connectors.Conn(ctx, s.db).Model(&models.Membership{}).
+		Select("memberships.user_id, users.email, users.first_name, users.last_name, memberships.role, memberships.created_at AS joined_at").
+		Joins("JOIN users ON users.id = memberships.user_id AND users.deleted_at IS NULL").
+		Where("memberships.organization_id = ?", organizationID).
+		Order("CASE memberships.role WHEN 'owner' THEN 0 WHEN 'admin' THEN 1 ELSE 2 END, memberships.created_at").
+		Scan(&members).Error
+	return members, err
+}
+
+// UpdateMemberRole changes a member's role. actorRole is the role of the member
+// making the change: only owners can grant or take away the owner role, and the
+// last owner can't be demoted.
+func (s *OrganizationService) UpdateMemberRole(ctx context.Context, organizationID uint, actorRole string, userID uint, role string) error {
+	if models.OrgRoleRank(role) == 0 {
+		return ErrInvalidOrgRole
+	}
+
+	err := connectors.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		membership, err := s.findMembership(tx, organizationID, userID)
+		if err != nil {
+			return err
+		}
+		if !canManageOrgRole(actorRole, membership.Role) || !canManageOrgRole(actorRole, role) {
+			return ErrOrgRoleNotAllowed
+		}
+		if membership.Role == models.OrgRoleOwner && role != models.OrgRoleOwner {
+			if err := s.ensureAnotherOwner(tx, organizationID, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Model(membership).Update("role", role).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("Changed organization member role", map[string]interface{}{
+		"organization_id": organizationID,
+		"user_id":         userID,
+		"role":            role,
+	})
+	return nil
+}
+
+// RemoveMember removes a user from the organization. Members may always leave;
+// removing someone else follows the same rules as changing their role.
+func (s *OrganizationService) RemoveMember(ctx context.Context, organizationID, actorID uint, actorRole string, userID uint) error {
+	err := connectors.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		membership, err := s.findMembership(tx, organizationID, userID)
+		if err != nil {
+			return err
+		}
+		if actorID != userID && !canManageOrgRole(actorRole, membership.Role) {
+			return ErrOrgRoleNotAllowed
+		}
+		if membership.Role == models.OrgRoleOwner {
+			if err := s.ensureAnotherOwner(tx, organizationID, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Delete(membership).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("Removed organization member", map[string]interface{}{
+		"organization_id": organizationID,
+		"user_id":         userID,
+		"removed_by":      actorID,
+	})
+	return nil
+}
+
+// Invite emails a signed invitation link to join the organization. Inviting an
+// address that already has a pending invitation replaces it.
+func (s *OrganizationService) Invite(ctx context.Context, organizationID, inviterID uint, inviterRole string, input InviteMemberInput) (*models.Invitation, error) {
+	if models.OrgRoleRank(input.Role) == 0 {
+		return nil, ErrInvalidOrgRole
+	}
+	if !canManageOrgRole(inviterRole, input.Role) {
+		return nil, ErrOrgRoleNotAllowed
+	}
+
+	org, err := s.Get(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(input.Email))
+	var count int64
+	if err := connectors.Conn(ctx, s.db).Model(&models.Membership{}).
+		Joins("JOIN users ON users.id = memberships.user_id").
+		Where("memberships.organization_id = ? AND LOWER(users.email) = ?", organizationID, email).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrAlreadyMember
+	}
+
+	invitation := &models.Invitation{
+		Email:       email,
+		Role:        input.Role,
+		InvitedByID: inviterID,
+		ExpiresAt:   time.Now().Add(s.invitations.InvitationTTL),
+	}
+	tenantDB := s.tenantDB(ctx, organizationID)
+	err = tenantDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("email = ? AND accepted_at IS NULL", email).Delete(&models.Invitation{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(invitation).Error
+	})
+	if err != nil {
+		s.logger.Error("Failed to create invitation", err, map[string]interface{}{
+			"organization_id": organizationID,
+		})
+		return nil, err
+	}
+
+	s.logger.Info("Invited organization member", map[string]interface{}{
+		"organization_id": organizationID,
+		"invitation_id":   invitation.ID,
+		"invited_by":      inviterID,
+		"role":            input.Role,
+	})
+
+	if err := s.sendInvitation(org, invitation); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// ListInvitations returns the organization's pending invitations
+func (s *OrganizationService) ListInvitations(ctx context.Context, organizationID uint) ([]models.Invitation, error) {
+	var invitations []models.Invitation
+	err := s.tenantDB(ctx, organizationID).
+		Where("accepted_at IS NULL AND expires_at > ?", time.Now()).
+		Order("created_at DESC").
+		Find(&invitations).Error
+	return invitations, err
+}
+
+// RevokeInvitation deletes a pending invitation so its link stops working
+func (s *OrganizationService) RevokeInvitation(ctx context.Context, organizationID, invitationID uint) error {
+	result := s.tenantDB(ctx, organizationID).Where("accepted_at IS NULL").Delete(&models.Invitation{}, invitationID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// AcceptInvitation redeems an invitation link for the signed-in user, whose
+// email address must be the one the invitation was sent to
+func (s *OrganizationService) AcceptInvitation(ctx context.Context, userID uint, email string, token string) (*models.Membership, error) {
+	claims, err := middleware.ValidateActionToken(middleware.PurposeOrgInvitation, token)
+	if err != nil {
+		return nil, ErrInvalidInvitation
+	}
+	organizationID, err := strconv.ParseUint(claims.Data["organization_id"], 10, 32)
+	if err != nil {
+		return nil, ErrInvalidInvitation
+	}
+	invitationID, err := strconv.ParseUint(claims.Data["invitation_id"], 10, 32)
+	if err != nil {
+		return nil, ErrInvalidInvitation
+	}
+
+	var membership models.Membership
+	err = s.tenantDB(ctx, uint(organizationID)).Transaction(func(tx *gorm.DB) error {
+		var invitation models.Invitation
+		if err := tx.First(&invitation, invitationID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidInvitation
+			}
+			return err
+		}
+		if invitation.AcceptedAt != nil || time.Now().After(invitation.ExpiresAt) {
+			return ErrInvalidInvitation
+		}
+		if !strings.EqualFold(invitation.Email, claims.Email) || !strings.EqualFold(invitation.Email, strings.TrimSpace(email)) {
+			return ErrInvitationEmailMismatch
+		}
+
+		err := tx.Where("organization_id = ? AND user_id = ?", organizationID, userID).First(&membership).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			membership = models.Membership{
+				OrganizationID: uint(organizationID),
+				UserID:         userID,
+				Role:           invitation.Role,
+			}
+			err = tx.Create(&membership).Error
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&invitation).Update("accepted_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Accepted organization invitation", map[string]interface{}{
+		"organization_id": organizationID,
+		"invitation_id":   invitationID,
+		"user_id":         userID,
+	})
+
+	if err := connectors.Conn(ctx, s.db).Preload("Organization").First(&membership, membership.ID).Error; err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// sendInvitation signs an accept link for the invitation and emails it
+func (s *OrganizationService) sendInvitation(org *models.Organization, invitation *models.Invitation) error {
+	token, err := middleware.GenerateActionTokenWithData(middleware.PurposeOrgInvitation, 0, invitation.Email, map[string]string{
+		"organization_id": strconv.FormatUint(uint64(org.ID), 10),
+		"invitation_id":   strconv.FormatUint(uint64(invitation.ID), 10),
+	}, time.Until(invitation.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("error generating invitation token: %v", err)
+	}
+
+	if s.emailSender == nil {
+		s.logger.Warn("Email sender unavailable, invitation not sent", map[string]interface{}{
+			"invitation_id": invitation.ID,
+		})
+		return nil
+	}
+
+	acceptURL := fmt.Sprintf("%s?token=%s", s.invitations.InvitationURL, url.QueryEscape(token))
+	if err := s.emailSender.SendOrganizationInvitation(invitation.Email, org.Name, acceptURL); err != nil {
+		s.logger.Error("Failed to send invitation email", err, map[string]interface{}{
+			"invitation_id": invitation.ID,
+		})
+		return err
+	}
+	return nil
+}
+
+// findMembership loads the user's membership, failing with ErrMemberNotFound when there is none
+func (s *OrganizationService) findMembership(tx *gorm.DB, organizationID, userID uint) (*models.Membership, error) {
+	var membership models.Membership
+	if err := tx.Where("organization_id = ? AND user_id = ?", organizationID, userID).First(&membership).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMemberNotFound
+		}
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// ensureAnotherOwner returns ErrLastOwner unless someone other than userID owns the organization
+func (s *OrganizationService) ensureAnotherOwner(tx *gorm.DB, organizationID, userID uint) error {
+	var owners int64
+	if err := tx.Model(&models.Membership{}).
+		Where("organization_id = ? AND role = ? AND user_id <> ?", organizationID, models.OrgRoleOwner, userID).
+		Count(&owners).Error; err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// tenantDB returns a handle whose statements on tenant-owned models are limited to the organization
+func (s *OrganizationService) tenantDB(ctx context.Context, organizationID uint) *gorm.DB {
+	return connectors.Conn(models.WithTenant(ctx, organizationID), s.db)
+}
+
+// canManageOrgRole reports whether a member with actorRole may grant, change or
+// remove the role. Owners manage everyone; admins manage admins and members.
+func canManageOrgRole(actorRole, role string) bool {
+	if actorRole == models.OrgRoleOwner {
+		return true
+	}
+	return actorRole == models.OrgRoleAdmin && role != models.OrgRoleOwner
+}
+
+// slugify lowercases s and replaces everything but letters and digits with dashes
+func slugify(s string) string {
+	slug := strings.Trim(slugInvalidChars.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if len(slug) > 100 {
+		slug = strings.TrimRight(slug[:100], "-")
+	}
+	return slug
+}
@@ -0,0 +1,349 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/testutil"
+
+	"gorm.io/gorm"
+)
+
+// orgEnv is an organization owned by owner, with an admin and a member
+type orgEnv struct {
+	db      *gorm.DB
+	cfg     *config.Config
+	service *OrganizationService
+	smtp    *testutil.FakeSMTPServer
+	org     *models.Organization
+	owner   *models.User
+	admin   *models.User
+	member  *models.User
+}
+
+// newOrgEnv creates the organization and its members. Invitations are emailed
+// through a fake SMTP server.
+func newOrgEnv(t *testing.T) *orgEnv {
+	t.Helper()
+
+	db, cfg := newTestEnv(t)
+	smtp := testutil.NewSMTPServer(t)
+	cfg.Email = smtp.EmailConfig()
+	service := NewOrganizationService(db, newUserService(t, db, cfg), cfg)
+	ctx := context.Background()
+
+	env := &orgEnv{
+		db:      db,
+		cfg:     cfg,
+		service: service,
+		smtp:    smtp,
+		owner:   createTestUser(t, db, cfg, "owner@example.com", "user"),
+		admin:   createTestUser(t, db, cfg, "admin@example.com", "user"),
+		member:  createTestUser(t, db, cfg, "member@example.com", "user"),
+	}
+	org, err := service.Create(ctx, env.owner.ID, CreateOrganizationInput{Name: "Acme"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	env.org = org
+	for user, role := range map[*models.User]string{env.admin: models.OrgRoleAdmin, env.member: models.OrgRoleMember} {
+		if err := db.Create(&models.Membership{OrganizationID: org.ID, UserID: user.ID, Role: role}).Error; err != nil {
+			t.Fatalf("add member: %v", err)
+		}
+	}
+	return env
+}
+
+// role returns the user's role in the organization, or "" if they aren't a member
+func (e *orgEnv) role(t *testing.T, user *models.User) string {
+	t.Helper()
+
+	role, err := e.service.MembershipRole(context.Background(), e.org.ID, user.ID)
+	if errors.Is(err, middleware.ErrNotMember) {
+		return ""
+	}
+	if err != nil {
+		t.Fatalf("MembershipRole: %v", err)
+	}
+	return role
+}
+
+func TestCreateOrganization(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewOrganizationService(db, newUserService(t, db, cfg), cfg)
+	ctx := context.Background()
+	user := createTestUser(t, db, cfg, "ada@example.com", "user")
+
+	org, err := service.Create(ctx, user.ID, CreateOrganizationInput{Name: "  Analytical Engines, Ltd.  "})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if org.Name != "Analytical Engines, Ltd." || org.Slug != "analytical-engines-ltd" {
+		t.Errorf("name %q, slug %q", org.Name, org.Slug)
+	}
+	if role, err := service.MembershipRole(ctx, org.ID, user.ID); err != nil || role != models.OrgRoleOwner {
+		t.Errorf("creator's role = %q, %v; want owner", role, err)
+	}
+
+	tests := []struct {
+		name    string
+		input   CreateOrganizationInput
+		wantErr error
+	}{
+		{"taken slug", CreateOrganizationInput{Name: "Other", Slug: "Analytical Engines Ltd"}, ErrSlugTaken},
+		{"taken slug from the name", CreateOrganizationInput{Name: "analytical engines ltd"}, ErrSlugTaken},
+		{"name without letters or digits", CreateOrganizationInput{Name: "!!!"}, errors.New("organization name must contain letters or digits")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.Create(ctx, user.ID, tt.input)
+			if err == nil || err.Error() != tt.wantErr.Error() {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	var count int64
+	db.Model(&models.Organization{}).Count(&count)
+	if count != 1 {
+		t.Errorf("%d organizations, want 1; failed creations must not leave any", count)
+	}
+}
+
+func TestOrganizationInvitation(t *testing.T) {
+	env := newOrgEnv(t)
+	ctx := context.Background()
+	invitee := createTestUser(t, env.db, env.cfg, "grace@example.com", "user")
+	invite := func(inviter *models.User, inviterRole, email, role string) (*models.Invitation, error) {
+		return env.service.Invite(ctx, env.org.ID, inviter.ID, inviterRole, InviteMemberInput{Email: email, Role: role})
+	}
+
+	if _, err := invite(env.admin, models.OrgRoleAdmin, "grace@example.com", models.OrgRoleOwner); !errors.Is(err, ErrOrgRoleNotAllowed) {
+		t.Errorf("admin inviting an owner: err = %v, want %v", err, ErrOrgRoleNotAllowed)
+	}
+	if _, err := invite(env.owner, models.OrgRoleOwner, "grace@example.com", "superuser"); !errors.Is(err, ErrInvalidOrgRole) {
+		t.Errorf("unknown role: err = %v, want %v", err, ErrInvalidOrgRole)
+	}
+	if _, err := invite(env.owner, models.OrgRoleOwner, "MEMBER@example.com", models.OrgRoleMember); !errors.Is(err, ErrAlreadyMember) {
+		t.Errorf("inviting a member: err = %v, want %v", err, ErrAlreadyMember)
+	}
+
+	if _, err := invite(env.admin, models.OrgRoleAdmin, "Grace@Example.com", models.OrgRoleAdmin); err != nil {
+		t.Fatalf("Invite: %v", err)
+	}
+	token := linkToken(t, env.smtp, "accept-invitation", 1, "grace@example.com")
+
+	if _, err := env.service.AcceptInvitation(ctx, env.member.ID, env.member.Email, token); !errors.Is(err, ErrInvitationEmailMismatch) {
+		t.Errorf("accepting as someone else: err = %v, want %v", err, ErrInvitationEmailMismatch)
+	}
+	if _, err := env.service.AcceptInvitation(ctx, invitee.ID, invitee.Email, "not-a-token"); !errors.Is(err, ErrInvalidInvitation) {
+		t.Errorf("malformed token: err = %v, want %v", err, ErrInvalidInvitation)
+	}
+
+	membership, err := env.service.AcceptInvitation(ctx, invitee.ID, invitee.Email, token)
+	if err != nil {
+		t.Fatalf("AcceptInvitation: %v", err)
+	}
+	if membership.Role != models.OrgRoleAdmin || membership.Organization.ID != env.org.ID {
+		t.Errorf("membership = role %q in organization %d, want admin in %d", membership.Role, membership.Organization.ID, env.org.ID)
+	}
+	if _, err := env.service.AcceptInvitation(ctx, invitee.ID, invitee.Email, token); !errors.Is(err, ErrInvalidInvitation) {
+		t.Errorf("accepting twice: err = %v, want %v", err, ErrInvalidInvitation)
+	}
+	if pending, _ := env.service.ListInvitations(ctx, env.org.ID); len(pending) != 0 {
+		t.Errorf("%d pending invitations after accepting, want none", len(pending))
+	}
+}
+
+func TestOrganizationInvitationExpired(t *testing.T) {
+	env := newOrgEnv(t)
+	ctx := context.Background()
+	invitee := createTestUser(t, env.db, env.cfg, "grace@example.com", "user")
+
+	invitation, err := env.service.Invite(ctx, env.org.ID, env.owner.ID, models.OrgRoleOwner,
+		InviteMemberInput{Email: invitee.Email, Role: models.OrgRoleMember})
+	if err != nil {
+		t.Fatalf("Invite: %v", err)
+	}
+	token := linkToken(t, env.smtp, "accept-invitation", 1, invitee.Email)
+	if err := env.db.WithContext(models.WithTenant(ctx, env.org.ID)).Model(invitation).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("expire invitation: %v", err)
+	}
+
+	if _, err := env.service.AcceptInvitation(ctx, invitee.ID, invitee.Email, token); !errors.Is(err, ErrInvalidInvitation) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidInvitation)
+	}
+	if role := env.role(t, invitee); role != "" {
+		t.Errorf("invitee's role = %q, want no membership", role)
+	}
+	if pending, _ := env.service.ListInvitations(ctx, env.org.ID); len(pending) != 0 {
+		t.Errorf("%d pending invitations, want expired ones left out", len(pending))
+	}
+}
+
+func TestOrganizationMemberRoles(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(env *orgEnv) error
+		wantErr error
+		check   func(t *testing.T, env *orgEnv)
+	}{
+		{
+			name:   "owner promotes a member",
+			change: func(env *orgEnv) error { return env.updateRole(models.OrgRoleOwner, env.member, models.OrgRoleAdmin) },
+			check: func(t *testing.T, env *orgEnv) {
+				if role := env.role(t, env.member); role != models.OrgRoleAdmin {
+					t.Errorf("member's role = %q, want admin", role)
+				}
+			},
+		},
+		{
+			name:    "admin grants owner",
+			change:  func(env *orgEnv) error { return env.updateRole(models.OrgRoleAdmin, env.member, models.OrgRoleOwner) },
+			wantErr: ErrOrgRoleNotAllowed,
+		},
+		{
+			name:    "admin demotes the owner",
+			change:  func(env *orgEnv) error { return env.updateRole(models.OrgRoleAdmin, env.owner, models.OrgRoleMember) },
+			wantErr: ErrOrgRoleNotAllowed,
+		},
+		{
+			name:    "member promotes themselves",
+			change:  func(env *orgEnv) error { return env.updateRole(models.OrgRoleMember, env.member, models.OrgRoleAdmin) },
+			wantErr: ErrOrgRoleNotAllowed,
+		},
+		{
+			name:    "last owner steps down",
+			change:  func(env *orgEnv) error { return env.updateRole(models.OrgRoleOwner, env.owner, models.OrgRoleAdmin) },
+			wantErr: ErrLastOwner,
+		},
+		{
+			name:    "unknown role",
+			change:  func(env *orgEnv) error { return env.updateRole(models.OrgRoleOwner, env.member, "superuser") },
+			wantErr: ErrInvalidOrgRole,
+		},
+		{
+			name: "member removes someone else",
+			change: func(env *orgEnv) error {
+				return env.service.RemoveMember(context.Background(), env.org.ID, env.member.ID, models.OrgRoleMember, env.admin.ID)
+			},
+			wantErr: ErrOrgRoleNotAllowed,
+		},
+		{
+			name: "member leaves",
+			change: func(env *orgEnv) error {
+				return env.service.RemoveMember(context.Background(), env.org.ID, env.member.ID, models.OrgRoleMember, env.member.ID)
+			},
+			check: func(t *testing.T, env *orgEnv) {
+				if role := env.role(t, env.member); role != "" {
+					t.Errorf("member's role = %q after leaving, want no membership", role)
+				}
+			},
+		},
+		{
+			name: "last owner leaves",
+			change: func(env *orgEnv) error {
+				return env.service.RemoveMember(context.Background(), env.org.ID, env.owner.ID, models.OrgRoleOwner, env.owner.ID)
+			},
+			wantErr: ErrLastOwner,
+		},
+		{
+			name: "owner leaves once another owner exists",
+			change: func(env *orgEnv) error {
+				if err := env.updateRole(models.OrgRoleOwner, env.admin, models.OrgRoleOwner); err != nil {
+					return err
+				}
+				return env.service.RemoveMember(context.Background(), env.org.ID, env.owner.ID, models.OrgRoleOwner, env.owner.ID)
+			},
+			check: func(t *testing.T, env *orgEnv) {
+				if role := env.role(t, env.admin); role != models.OrgRoleOwner {
+					t.Errorf("new owner's role = %q, want owner", role)
+				}
+			},
+		},
+		{
+			name: "removing a non-member",
+			change: func(env *orgEnv) error {
+				return env.service.RemoveMember(context.Background(), env.org.ID, env.owner.ID, models.OrgRoleOwner, 404)
+			},
+			wantErr: ErrMemberNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newOrgEnv(t)
+			err := tt.change(env)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, env)
+			}
+			if tt.wantErr != nil && (env.role(t, env.owner) != models.OrgRoleOwner || env.role(t, env.admin) != models.OrgRoleAdmin || env.role(t, env.member) != models.OrgRoleMember) {
+				t.Error("a refused change modified the memberships")
+			}
+		})
+	}
+}
+
+// updateRole changes the user's role on behalf of a member with actorRole
+func (e *orgEnv) updateRole(actorRole string, user *models.User, role string) error {
+	return e.service.UpdateMemberRole(context.Background(), e.org.ID, actorRole, user.ID, role)
+}
+
+func TestOrganizationTenantScope(t *testing.T) {
+	env := newOrgEnv(t)
+	ctx := context.Background()
+	other, err := env.service.Create(ctx, env.member.ID, CreateOrganizationInput{Name: "Other"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	invitation, err := env.service.Invite(ctx, env.org.ID, env.owner.ID, models.OrgRoleOwner,
+		InviteMemberInput{Email: "grace@example.com", Role: models.OrgRoleMember})
+	if err != nil {
+		t.Fatalf("Invite: %v", err)
+	}
+	if invitation.OrganizationID != env.org.ID {
+		t.Errorf("invitation created for organization %d, want %d", invitation.OrganizationID, env.org.ID)
+	}
+	if _, err := env.service.Invite(ctx, other.ID, env.member.ID, models.OrgRoleOwner,
+		InviteMemberInput{Email: "grace@example.com", Role: models.OrgRoleAdmin}); err != nil {
+		t.Fatalf("Invite to the other organization: %v", err)
+	}
+
+	// Each organization only sees its own invitations, and replacing grace's
+	// invitation to one leaves the other's in place
+	for _, org := range []*models.Organization{env.org, other} {
+		pending, err := env.service.ListInvitations(ctx, org.ID)
+		if err != nil {
+			t.Fatalf("ListInvitations: %v", err)
+		}
+		if len(pending) != 1 || pending[0].OrganizationID != org.ID {
+			t.Errorf("organization %d sees %d invitations, want only its own", org.ID, len(pending))
+		}
+	}
+
+	if err := env.service.RevokeInvitation(ctx, other.ID, invitation.ID); !errors.Is(err, ErrInvitationNotFound) {
+		t.Errorf("revoking another organization's invitation: err = %v, want %v", err, ErrInvitationNotFound)
+	}
+	if err := env.service.RevokeInvitation(ctx, env.org.ID, invitation.ID); err != nil {
+		t.Errorf("RevokeInvitation: %v", err)
+	}
+
+	// Statements on tenant-owned models need an organization
+	var invitations []models.Invitation
+	if err := env.db.WithContext(ctx).Find(&invitations).Error; !errors.Is(err, models.ErrTenantRequired) {
+		t.Errorf("unscoped query: err = %v, want %v", err, models.ErrTenantRequired)
+	}
+	if err := env.db.WithContext(models.WithoutTenantScope(ctx)).Find(&invitations).Error; err != nil || len(invitations) != 1 {
+		t.Errorf("deliberately cross-tenant query found %d invitations, %v; want the other organization's", len(invitations), err)
+	}
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// Outbox topics
+const (
+	OutboxTopicEmail = "email"
+)
+
+const (
+	// outboxPollInterval is how often the dispatcher looks for messages to deliver
+	outboxPollInterval = 5 * time.Second
+	// outboxBatchSize bounds the messages delivered per poll
+	outboxBatchSize = 50
+	// outboxLease is how long a claimed message is hidden from other
+	// dispatchers; a message whose delivery outlasts it may be sent twice
+	outboxLease = time.Minute
+	// outboxRetryDelay is the wait after the first failed delivery; it doubles
+	// with every further failure, up to outboxMaxRetryDelay
+	outboxRetryDelay    = 30 * time.Second
+	outboxMaxRetryDelay = time.Hour
+	// outboxMaxAttempts is how often delivery is tried before giving up
+	outboxMaxAttempts = 10
+	// maxOutboxErrorLength fits the last_error column
+	maxOutboxErrorLength = 1024
+)
+
+// errEmailSenderUnavailable fails the delivery of email messages while email is disabled
+var errEmailSenderUnavailable = errors.New("email sender unavailable")
+
+// OutboxHandler delivers the payload of an outbox message. Messages are
+// delivered at least once, so handlers should tolerate repeats.
+type OutboxHandler func(ctx context.Context, payload models.JSONMap) error
+
+// OutboxService queues side effects in the ambient transaction and delivers
+// them once it has committed
+type OutboxService struct {
+	db         *gorm.DB
+	handlersMu sync.RWMutex
+	handlers   map[string]OutboxHandler
+	logger     *utils.Logger
+}
+
+// NewOutboxService creates an outbox that delivers email messages with
+// emailSender. Messages of other topics need a handler registered with Handle.
+func NewOutboxService(db *gorm.DB, emailSender *connectors.EmailSender) *OutboxService {
+	s := &OutboxService{
+		db:       db,
+		handlers: make(map[string]OutboxHandler),
+		logger:   utils.GetLogger().WithService("outbox_service"),
+	}
+	s.Handle(OutboxTopicEmail, s.emailHandler(emailSender))
+	return s
+}
+
+// Handle sets the handler delivering messages of a topic
+func (s *OutboxService) Handle(topic string, handler OutboxHandler) {
+	s.handlersMu.Lock()
+	defer s.handlersMu.Unlock()
+	s.handlers[topic] = handler
+}
+
+// Enqueue queues a message for delivery. Inside a transaction the message is
+// only delivered if the transaction commits.
+func (s *OutboxService) Enqueue(ctx context.Context, topic string, payload models.JSONMap) error {
+	message := &models.OutboxMessage{
+		Topic:       topic,
+		Payload:     payload,
+		AvailableAt: time.Now(),
+	}
+	if err := connectors.Conn(ctx, s.db).Create(message).Error; err != nil {
+		s.logger.Error("Failed to queue outbox message", err, map[string]interface{}{
+			"topic": topic,
+		})
+		return err
+	}
+	return nil
+}
+
+// EnqueueEmail queues an email for delivery
+func (s *OutboxService) EnqueueEmail(ctx context.Context, to, subject, body string) error {
+	return s.Enqueue(ctx, OutboxTopicEmail, models.JSONMap{
+		"to":      to,
+		"subject": subject,
+		"body":    body,
+	})
+}
+
+// Run delivers queued messages until ctx is done. Several processes may run
+// it at once; each message is claimed by one of them at a time.
+func (s *OutboxService) Run(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.dispatch(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Error("Failed to dispatch outbox messages", err, nil)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch delivers the messages that are due
+func (s *OutboxService) dispatch(ctx context.Context) error {
+	// Messages were just written to the primary; replicas may not have them yet
+	ctx = connectors.ReadFromPrimary(ctx)
+
+	var messages []models.OutboxMessage
+	err := connectors.Conn(ctx, s.db).
+		Where("sent_at IS NULL AND attempts < ? AND available_at <= ?", outboxMaxAttempts, time.Now()).
+		Order("id").Limit(outboxBatchSize).Find(&messages).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range messages {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.deliver(ctx, &messages[i])
+	}
+	return nil
+}
+
+// deliver claims a message and hands it to its handler, recording the outcome
+func (s *OutboxService) deliver(ctx context.Context, message *models.OutboxMessage) {
+	db := connectors.Conn(ctx, s.db)
+
+	// Claim the message unless another dispatcher got to it first
+	claim := db.Model(&models.OutboxMessage{}).
+		Where("id = ? AND attempts = ? AND sent_at IS NULL", message.ID, message.Attempts).
+		Updates(map[string]interface{}{
+			"attempts":     message.Attempts + 1,
+			"available_at": time.Now().Add(outboxLease),
+		})
+	if claim.Error != nil {
+		s.logger.Error("Failed to claim outbox message", claim.Error, map[string]interface{}{
+			"id": message.ID,
+		})
+		return
+	}
+	if claim.RowsAffected == 0 {
+		return
+	}
+	message.Attempts++
+
+	s.handlersMu.RLock()
+	handler, ok := s.handlers[message.Topic]
+	s.handlersMu.RUnlock()
+
+	var err error
+	if ok {
+		err = handler(ctx, message.Payload)
+	} else {
+		err = fmt.Errorf("no handler for topic %q", message.Topic)
+	}
+
+	if err == nil {
+		if err := db.Model(message).Updates(map[string]interface{}{
+			"sent_at":    time.Now(),
+			"last_error": "",
+		}).Error; err != nil {
+			s.logger.Error("Failed to mark outbox message sent", err, map[string]interface{}{
+				"id": message.ID,
+			})
+		}
+		return
+	}
+
+	lastError := err.Error()
+	if len(lastError) > maxOutboxErrorLength {
+		lastError = lastError[:maxOutboxErrorLength]
+	}
+	fields := map[string]interface{}{
+		"id":       message.ID,
+		"topic":    message.Topic,
+		"attempts": message.Attempts,
+	}
+	if message.Attempts >= outboxMaxAttempts {
+		s.logger.Error("Giving up on outbox message", err, fields)
+	} else {
+		s.logger.Warn("Failed to deliver outbox message, will retry", fields)
+	}
+
+	if err := db.Model(message).Updates(map[string]interface{}{
+		"available_at": time.Now().Add(outboxRetryBackoff(message.Attempts)),
+		"last_error":   lastError,
+	}).Error; err != nil {
+		s.logger.Error("Failed to record outbox delivery failure", err, map[string]interface{}{
+			"id": message.ID,
+		})
+	}
+}
+
+// outboxRetryBackoff returns the wait before retrying a message that has
+// failed attempts times
+func outboxRetryBackoff(attempts int) time.Duration {
+	backoff := outboxRetryDelay << (attempts - 1)
+	if backoff > outboxMaxRetryDelay || backoff <= 0 {
+		backoff = outboxMaxRetryDelay
+	}
+	return backoff
+}
+
+// emailHandler delivers email messages. Without an enabled sender delivery
+// fails, so messages are retried and kept until email works or they run out
+// of attempts.
+func (s *OutboxService) emailHandler(emailSender *connectors.EmailSender) OutboxHandler {
+	return func(ctx context.Context, payload models.JSONMap) error {
+		to, _ := payload["to"].(string)
+		subject, _ := payload["subject"].(string)
+		body, _ := payload["body"].(string)
+		if to == "" {
+			return errors.New("email message without a recipient")
+		}
+
+		if !emailSender.IsEnabled() {
+			return errEmailSenderUnavailable
+		}
+		return emailSender.SendEmail(to, subject, body)
+	}
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+)
+
+// recordingHandler records the payloads delivered to it and fails with err
+type recordingHandler struct {
+	delivered []models.JSONMap
+	err       error
+}
+
+func (h *recordingHandler) handle(_ context.Context, payload models.JSONMap) error {
+	h.delivered = append(h.delivered, payload)
+	return h.err
+}
+
+func TestOutboxEnqueueInTransaction(t *testing.T) {
+	failed := errors.New("change failed")
+
+	tests := []struct {
+		name        string
+		change      func(ctx context.Context, s *OutboxService) error
+		wantErr     error
+		wantQueued  int64
+		wantWritten int64 // Users the change stored
+	}{
+		{
+			name: "committed",
+			change: func(ctx context.Context, s *OutboxService) error {
+				if err := connectors.Conn(ctx, s.db).Create(&models.User{Email: "ada@example.com", Password: "hash"}).Error; err != nil {
+					return err
+				}
+				return s.EnqueueEmail(ctx, "ada@example.com", "Welcome", "Hello")
+			},
+			wantQueued:  1,
+			wantWritten: 1,
+		},
+		{
+			name: "rolled back",
+			change: func(ctx context.Context, s *OutboxService) error {
+				if err := connectors.Conn(ctx, s.db).Create(&models.User{Email: "ada@example.com", Password: "hash"}).Error; err != nil {
+					return err
+				}
+				if err := s.EnqueueEmail(ctx, "ada@example.com", "Welcome", "Hello"); err != nil {
+					return err
+				}
+				return failed
+			},
+			wantErr: failed,
+		},
+		{
+			name: "message fails to queue",
+			change: func(ctx context.Context, s *OutboxService) error {
+				if err := connectors.Conn(ctx, s.db).Create(&models.User{Email: "ada@example.com", Password: "hash"}).Error; err != nil {
+					return err
+				}
+				if err := connectors.Conn(ctx, s.db).Exec("DROP TABLE outbox_messages").Error; err != nil {
+					return err
+				}
+				return s.EnqueueEmail(ctx, "ada@example.com", "Welcome", "Hello")
+			},
+			wantErr: errors.New("no such table: outbox_messages"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := newTestEnv(t)
+			service := NewOutboxService(db, nil)
+
+			err := connectors.WithTransaction(context.Background(), db, func(ctx context.Context) error {
+				if !connectors.InTransaction(ctx) {
+					t.Error("the change isn't in a transaction")
+				}
+				return tt.change(ctx, service)
+			})
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("err = %v, want none", err)
+			case tt.wantErr != nil && (err == nil || !strings.Contains(err.Error(), tt.wantErr.Error())):
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			var queued, written int64
+			db.Model(&models.OutboxMessage{}).Count(&queued)
+			db.Model(&models.User{}).Count(&written)
+			if queued != tt.wantQueued || written != tt.wantWritten {
+				t.Errorf("%d messages and %d users stored, want %d and %d", queued, written, tt.wantQueued, tt.wantWritten)
+			}
+		})
+	}
+}
+
+func TestOutboxDispatch(t *testing.T) {
+	tests := []struct {
+		name         string
+		topic        string
+		handlerErr   error
+		attempts     int           // Failed attempts before this dispatch
+		wantCalls    int           // Deliveries to the handler
+		wantSent     bool          // Marked sent
+		wantError    string        // Recorded last error
+		wantRetryIn  time.Duration // Approximate wait before the next attempt
+		wantAttempts int
+	}{
+		{name: "delivered", topic: "test", wantCalls: 1, wantSent: true, wantAttempts: 1},
+		{name: "failed", topic: "test", handlerErr: errors.New("smtp: 451"), wantCalls: 1, wantError: "smtp: 451", wantRetryIn: outboxRetryDelay, wantAttempts: 1},
+		{name: "failed again", topic: "test", handlerErr: errors.New("smtp: 451"), attempts: 2, wantCalls: 1, wantError: "smtp: 451", wantRetryIn: 4 * outboxRetryDelay, wantAttempts: 3},
+		{name: "no handler for the topic", topic: "unknown", wantError: `no handler for topic "unknown"`, wantRetryIn: outboxRetryDelay, wantAttempts: 1},
+		{name: "out of attempts", topic: "test", attempts: outboxMaxAttempts, wantAttempts: outboxMaxAttempts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := newTestEnv(t)
+			service := NewOutboxService(db, nil)
+			handler := &recordingHandler{err: tt.handlerErr}
+			service.Handle("test", handler.handle)
+			ctx := context.Background()
+
+			if err := service.Enqueue(ctx, tt.topic, models.JSONMap{"n": "1"}); err != nil {
+				t.Fatalf("Enqueue: %v", err)
+			}
+			db.Model(&models.OutboxMessage{}).Where("1 = 1").Update("attempts", tt.attempts)
+
+			if err := service.dispatch(ctx); err != nil {
+				t.Fatalf("dispatch: %v", err)
+			}
+			if len(handler.delivered) != tt.wantCalls {
+				t.Fatalf("%d deliveries, want %d", len(handler.delivered), tt.wantCalls)
+			}
+			if tt.wantCalls > 0 && handler.delivered[0]["n"] != "1" {
+				t.Errorf("payload = %v", handler.delivered[0])
+			}
+
+			var message models.OutboxMessage
+			db.First(&message)
+			if sent := message.SentAt != nil; sent != tt.wantSent {
+				t.Errorf("sent = %v, want %v", sent, tt.wantSent)
+			}
+			if message.LastError != tt.wantError || message.Attempts != tt.wantAttempts {
+				t.Errorf("last error %q after %d attempts, want %q after %d", message.LastError, message.Attempts, tt.wantError, tt.wantAttempts)
+			}
+			if tt.wantRetryIn > 0 {
+				if wait := time.Until(message.AvailableAt); wait < tt.wantRetryIn-time.Minute/2 || wait > tt.wantRetryIn {
+					t.Errorf("retried in %s, want %s", wait, tt.wantRetryIn)
+				}
+			}
+
+			// Sent, failed and exhausted messages aren't delivered again right away
+			if err := service.dispatch(ctx); err != nil {
+				t.Fatalf("second dispatch: %v", err)
+			}
+			if len(handler.delivered) != tt.wantCalls {
+				t.Errorf("%d deliveries after dispatching again, want %d", len(handler.delivered), tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestOutboxDeliverLostClaim(t *testing.T) {
+	db, _ := newTestEnv(t)
+	service := NewOutboxService(db, nil)
+	handler := &recordingHandler{}
+	service.Handle("test", handler.handle)
+	ctx := context.Background()
+
+	if err := service.Enqueue(ctx, "test", models.JSONMap{}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	var stale models.OutboxMessage
+	db.First(&stale)
+	// Another dispatcher claims the message after this one read it
+	db.Model(&models.OutboxMessage{}).Where("id = ?", stale.ID).Update("attempts", 1)
+
+	service.deliver(ctx, &stale)
+	if len(handler.delivered) != 0 {
+		t.Error("a message claimed by another dispatcher was delivered")
+	}
+}
+
+func TestOutboxEmailHandler(t *testing.T) {
+	service := NewOutboxService(nil, nil)
+
+	tests := []struct {
+		name    string
+		sender  *connectors.EmailSender
+		payload models.JSONMap
+		wantErr error
+	}{
+		{"no sender", nil, models.JSONMap{"to": "ada@example.com", "subject": "Hi"}, errEmailSenderUnavailable},
+		{"disabled sender", &connectors.EmailSender{Enabled: false}, models.JSONMap{"to": "ada@example.com", "subject": "Hi"}, errEmailSenderUnavailable},
+		{"no recipient", nil, models.JSONMap{"subject": "Hi"}, errors.New("email message without a recipient")},
+		{"recipient of the wrong type", nil, models.JSONMap{"to": 7}, errors.New("email message without a recipient")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.emailHandler(tt.sender)(context.Background(), tt.payload)
+			if err == nil || err.Error() != tt.wantErr.Error() {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOutboxRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, outboxRetryDelay},
+		{2, 2 * outboxRetryDelay},
+		{5, 16 * outboxRetryDelay},
+		{outboxMaxAttempts, outboxMaxRetryDelay},
+		{100, outboxMaxRetryDelay},
+	}
+
+	for _, tt := range tests {
+		if got := outboxRetryBackoff(tt.attempts); got != tt.want {
+			t.Errorf("outboxRetryBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
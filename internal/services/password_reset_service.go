@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// passwordResetTTL matches the expiry promised by EmailSender.SendPasswordReset
+const passwordResetTTL = time.Hour
+
+// ErrInvalidResetToken is returned for unknown, expired or already used reset tokens
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// PasswordResetService issues and redeems password reset tokens
+type PasswordResetService struct {
+	db          *gorm.DB
+	userService *UserService
+	emailSender *connectors.EmailSender
+	resetURL    string
+	logger      *utils.Logger
+}
+
+// NewPasswordResetService creates a new password reset service instance
+func NewPasswordResetService(db *gorm.DB, userService *UserService, cfg *config.Config) *PasswordResetService {
+	return &PasswordResetService{
+		db:          db,
+		userService: userService,
+		emailSender: userService.emailSender,
+		resetURL:    cfg.PasswordReset.URL,
+		logger:      utils.GetLogger().WithService("password_reset_service"),
+	}
+}
+
+// RequestReset emails a reset link to the user with the given address. It returns
+// nil whether or not the address belongs to an account so callers cannot use it
+// to discover registered emails.
+func (s *PasswordResetService) RequestReset(ctx context.Context, email string) error {
+	s.logger.Info("Password reset requested", map[string]interface{}{
+		"email": email,
+	})
+
+	var user models.User
+	result := connectors.Conn(ctx, s.db).Where("email = ?", email).First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		s.logger.Error("Failed to fetch user", result.Error, map[string]interface{}{
+			"email": email,
+		})
+		return result.Error
+	}
+	if !user.IsActive {
+		s.logger.Warn("Password reset requested for inactive user", map[string]interface{}{
+			"id": user.ID,
+		})
+		return nil
+	}
+
+	token, err := generateOpaqueToken(32)
+	if err != nil {
+		return err
+	}
+
+	resetToken := &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashOpaqueToken(token),
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	}
+	if err := connectors.Conn(ctx, s.db).Create(resetToken).Error; err != nil {
+		s.logger.Error("Failed to create password reset token", err, map[string]interface{}{
+			"id": user.ID,
+		})
+		return fmt.Errorf("error creating reset token: %v", err)
+	}
+
+	if s.emailSender == nil {
+		s.logger.Warn("Email sender unavailable, password reset link not sent", map[string]interface{}{
+			"id": user.ID,
+		})
+		return nil
+	}
+
+	resetURL := fmt.Sprintf("%s?token=%s", s.resetURL, url.QueryEscape(token))
+
+	// Send in the background so response timing doesn't reveal whether the account exists
+	go func() {
+		if err := s.emailSender.SendPasswordReset(user.Email, token, resetURL); err != nil {
+			s.logger.Error("Failed to send password reset email", err, map[string]interface{}{
+				"id": user.ID,
+			})
+		}
+	}()
+	return nil
+}
+
+// ResetPassword redeems a reset token, sets the new password and signs the user
+// out of every existing session. The token stays valid if any of it fails.
+func (s *PasswordResetService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if err := s.userService.validatePassword(newPassword); err != nil {
+		return fmt.Errorf("invalid password: %v", err)
+	}
+
+	var resetToken models.PasswordResetToken
+	result := connectors.Conn(ctx, s.db).Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashOpaqueToken(token), time.Now()).
+		First(&resetToken)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return ErrInvalidResetToken
+		}
+		s.logger.Error("Failed to fetch password reset token", result.Error, nil)
+		return result.Error
+	}
+
+	err := connectors.WithTransaction(ctx, s.db, func(ctx context.Context) error {
+		// Mark the token used; a concurrent redemption of the same token loses
+		consumed := connectors.Conn(ctx, s.db).Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", resetToken.ID).
+			Update("used_at", time.Now())
+		if consumed.Error != nil {
+			return consumed.Error
+		}
+		if consumed.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+
+		// UpdatePassword also revokes all of the user's sessions
+		if err := s.userService.UpdatePassword(ctx, resetToken.UserID, newPassword); err != nil {
+			return err
+		}
+
+		// Any other outstanding reset links for this user are no longer valid
+		return connectors.Conn(ctx, s.db).Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", resetToken.UserID).
+			Update("used_at", time.Now()).Error
+	})
+	if errors.Is(err, ErrInvalidResetToken) {
+		return err
+	}
+	if err != nil {
+		s.logger.Error("Failed to reset password", err, map[string]interface{}{
+			"user_id": resetToken.UserID,
+		})
+		return err
+	}
+
+	s.logger.Info("Password reset completed", map[string]interface{}{
+		"user_id": resetToken.UserID,
+	})
+	return nil
+}
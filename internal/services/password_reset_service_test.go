@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/models"
+)
+
+func TestRequestReset(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	userService := newUserService(t, db, cfg)
+	service := NewPasswordResetService(db, userService, cfg)
+	ctx := context.Background()
+	user := createTestUser(t, db, cfg, "ada@example.com", "user")
+	inactive := createTestUser(t, db, cfg, "gone@example.com", "user")
+	db.Model(inactive).Update("is_active", false)
+
+	tests := []struct {
+		name       string
+		email      string
+		userID     uint
+		wantTokens int64
+	}{
+		{"registered email", "ada@example.com", user.ID, 1},
+		{"unknown email", "nobody@example.com", 0, 0},
+		{"inactive account", "gone@example.com", inactive.ID, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every case succeeds so the endpoint can't reveal which emails are registered
+			if err := service.RequestReset(ctx, tt.email); err != nil {
+				t.Fatalf("RequestReset: %v", err)
+			}
+
+			var count int64
+			db.Model(&models.PasswordResetToken{}).Where("user_id = ?", tt.userID).Count(&count)
+			if count != tt.wantTokens {
+				t.Errorf("%d reset tokens, want %d", count, tt.wantTokens)
+			}
+		})
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	const newPassword = "Battery-Staple-7"
+
+	tests := []struct {
+		name      string
+		expiresIn time.Duration
+		used      bool
+		token     string
+		password  string
+		wantErr   error
+		wantValid bool // Whether the token can still be redeemed afterwards
+	}{
+		{name: "valid token", expiresIn: time.Hour, password: newPassword},
+		{name: "expired token", expiresIn: -time.Minute, password: newPassword, wantErr: ErrInvalidResetToken},
+		{name: "used token", expiresIn: time.Hour, used: true, password: newPassword, wantErr: ErrInvalidResetToken},
+		{name: "unknown token", expiresIn: time.Hour, token: "guess", password: newPassword, wantErr: ErrInvalidResetToken, wantValid: true},
+		{name: "weak password", expiresIn: time.Hour, password: "short", wantValid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, cfg := newTestEnv(t)
+			userService := newUserService(t, db, cfg)
+			service := NewPasswordResetService(db, userService, cfg)
+			ctx := context.Background()
+			user := createTestUser(t, db, cfg, "ada@example.com", "user")
+
+			const token = "reset-token"
+			record := &models.PasswordResetToken{UserID: user.ID, TokenHash: hashOpaqueToken(token), ExpiresAt: time.Now().Add(tt.expiresIn)}
+			if tt.used {
+				now := time.Now()
+				record.UsedAt = &now
+			}
+			other := &models.PasswordResetToken{UserID: user.ID, TokenHash: hashOpaqueToken("other-token"), ExpiresAt: time.Now().Add(time.Hour)}
+			db.Create(record)
+			db.Create(other)
+
+			presented := token
+			if tt.token != "" {
+				presented = tt.token
+			}
+			err := service.ResetPassword(ctx, presented, tt.password)
+
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			case tt.password != newPassword:
+				if err == nil {
+					t.Fatal("ResetPassword accepted a password that breaks the rules")
+				}
+			default:
+				if err != nil {
+					t.Fatalf("ResetPassword: %v", err)
+				}
+				if _, err := userService.ValidateCredentials(ctx, user.Email, newPassword); err != nil {
+					t.Errorf("the new password doesn't work: %v", err)
+				}
+				var stored models.PasswordResetToken
+				db.First(&stored, other.ID)
+				if stored.UsedAt == nil {
+					t.Error("the user's other reset link is still valid")
+				}
+			}
+
+			var stored models.PasswordResetToken
+			db.First(&stored, record.ID)
+			if valid := stored.UsedAt == nil && stored.ExpiresAt.After(time.Now()); valid != tt.wantValid {
+				t.Errorf("token valid afterwards = %v, want %v", valid, tt.wantValid)
+			}
+		})
+	}
+}
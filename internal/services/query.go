@@ -0,0 +1,545 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Filter operators of list queries
+const (
+	OpEq      = "eq"
+	OpNe      = "ne"
+	OpLt      = "lt"
+	OpGt      = "gt"
+	OpIn      = "in"      // Comma-separated values
+	OpLike    = "like"    // Case-insensitive substring match
+	OpBetween = "between" // Inclusive range, "low,high"
+	OpNull    = "null"    // "true" matches missing values, "false" present ones
+)
+
+// Page sizes of list queries
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// maxInValues bounds the values of an in filter
+const maxInValues = 100
+
+// ErrInvalidQuery is returned for list queries with unknown parameters, fields
+// that can't be filtered or sorted by, or malformed values
+var ErrInvalidQuery = errors.New("invalid query")
+
+// filterParam matches filter parameters, "field" or "field[op]"
+var filterParam = regexp.MustCompile(`^([a-z0-9_]+)(?:\[([a-z]+)\])?$`)
+
+// Filter is one condition of a list query
+type Filter struct {
+	Field  string
+	Op     string
+	Values []string // One value, except for in and between
+}
+
+// ListQuery selects a page of records. SortBy lists the fields to sort by,
+// separated by commas, each optionally prefixed with "-" for descending or "+"
+// for ascending order; Order sets the direction of the others. Filters must
+// all match, and Search must occur in one of the model's search fields.
+type ListQuery struct {
+	models.PaginationParams
+	Filters []Filter
+	Search  string
+
+	// UseCursor pages by cursor instead of page number: from the start, or
+	// from Cursor, a next_cursor or prev_cursor of an earlier page. Unlike
+	// offsets, cursors stay fast on large tables and don't skip or repeat
+	// records that are added or removed between pages.
+	UseCursor bool
+	Cursor    string
+	// SkipCount saves the COUNT(*) of cursor pages, whose total and total
+	// pages are then 0. Pages by number are always counted.
+	SkipCount bool
+}
+
+// ParseListQuery reads a list query from query string parameters:
+//
+//	?page=2&page_size=50&sort_by=-created_at,email&q=smith
+//	&role=admin&created_at[between]=2026-01-01,2026-02-01&email_verified_at[null]=false
+//
+// A filter without an operator tests equality. A cursor parameter, empty for
+// the first page, selects cursor pagination, with which count=false skips
+// counting the total. Whether the fields may be used is checked when the query runs,
+// against the model's QueryFields.
+func ParseListQuery(values url.Values) (ListQuery, error) {
+	query := ListQuery{PaginationParams: models.PaginationParams{Page: 1, PageSize: DefaultPageSize}}
+	for key, params := range values {
+		value := params[len(params)-1]
+		switch key {
+		case "page":
+			page, err := strconv.Atoi(value)
+			if err != nil || page < 1 {
+				return ListQuery{}, fmt.Errorf("%w: page must be a positive number", ErrInvalidQuery)
+			}
+			query.Page = page
+		case "page_size":
+			pageSize, err := strconv.Atoi(value)
+			if err != nil || pageSize < 1 || pageSize > MaxPageSize {
+				return ListQuery{}, fmt.Errorf("%w: page_size must be between 1 and %d", ErrInvalidQuery, MaxPageSize)
+			}
+			query.PageSize = pageSize
+		case "sort_by":
+			query.SortBy = value
+		case "order":
+			query.Order = value
+		case "q":
+			query.Search = strings.TrimSpace(value)
+		case "cursor":
+			query.UseCursor, query.Cursor = true, value
+		case "count":
+			count, err := strconv.ParseBool(value)
+			if err != nil {
+				return ListQuery{}, fmt.Errorf("%w: count must be true or false", ErrInvalidQuery)
+			}
+			query.SkipCount = !count
+		default:
+			match := filterParam.FindStringSubmatch(key)
+			if match == nil {
+				return ListQuery{}, fmt.Errorf("%w: unknown parameter %q", ErrInvalidQuery, key)
+			}
+			op := match[2]
+			if op == "" {
+				op = OpEq
+			}
+			for _, param := range params {
+				filter, err := newFilter(match[1], op, param)
+				if err != nil {
+					return ListQuery{}, err
+				}
+				query.Filters = append(query.Filters, filter)
+			}
+		}
+	}
+
+	if query.UseCursor && values.Has("page") {
+		return ListQuery{}, fmt.Errorf("%w: page can't be combined with cursor", ErrInvalidQuery)
+	}
+	if query.SkipCount && !query.UseCursor {
+		return ListQuery{}, fmt.Errorf("%w: count=false requires cursor", ErrInvalidQuery)
+	}
+
+	// Parameters come from a map; keep the conditions in a stable order
+	sort.SliceStable(query.Filters, func(i, j int) bool {
+		if query.Filters[i].Field != query.Filters[j].Field {
+			return query.Filters[i].Field < query.Filters[j].Field
+		}
+		return query.Filters[i].Op < query.Filters[j].Op
+	})
+	return query, nil
+}
+
+// newFilter checks the operator of a filter and splits its value
+func newFilter(field, op, value string) (Filter, error) {
+	filter := Filter{Field: field, Op: op, Values: []string{value}}
+	switch op {
+	case OpEq, OpNe, OpLt, OpGt, OpLike:
+	case OpIn:
+		filter.Values = strings.Split(value, ",")
+		if len(filter.Values) > maxInValues {
+			return Filter{}, fmt.Errorf("%w: %s[in] takes at most %d values", ErrInvalidQuery, field, maxInValues)
+		}
+	case OpBetween:
+		filter.Values = strings.Split(value, ",")
+		if len(filter.Values) != 2 {
+			return Filter{}, fmt.Errorf("%w: %s[between] takes two values, low,high", ErrInvalidQuery, field)
+		}
+	case OpNull:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return Filter{}, fmt.Errorf("%w: %s[null] must be true or false", ErrInvalidQuery, field)
+		}
+	default:
+		return Filter{}, fmt.Errorf("%w: unknown operator %q", ErrInvalidQuery, op)
+	}
+	return filter, nil
+}
+
+// withDefaults fills in the page and page size when they aren't set
+func (q ListQuery) withDefaults() ListQuery {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize < 1 {
+		q.PageSize = DefaultPageSize
+	}
+	return q
+}
+
+// response returns a page of items with the query's pagination
+func (q ListQuery) response(items interface{}, total int64) *models.PaginatedResponse {
+	response := &models.PaginatedResponse{
+		Data:       items,
+		Total:      total,
+		PageSize:   q.PageSize,
+		TotalPages: int((total + int64(q.PageSize) - 1) / int64(q.PageSize)),
+	}
+	if !q.UseCursor {
+		response.Page = q.Page
+	}
+	return response
+}
+
+// sortColumn is one column a list is ordered by
+type sortColumn struct {
+	field *schema.Field
+	desc  bool
+}
+
+// compiledQuery holds the conditions and order of a list query on one model
+type compiledQuery struct {
+	table      string
+	conditions []clause.Expression
+	order      []sortColumn
+}
+
+// compile checks the query against the QueryFields of model, a pointer to a
+// model, and turns it into SQL conditions and an order. The order always ends
+// with the primary key, so pages don't overlap or skip records.
+func (q ListQuery) compile(db *gorm.DB, model interface{}) (*compiledQuery, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	var fields models.QueryFields
+	if queryable, ok := model.(models.Queryable); ok {
+		fields = queryable.QueryFields()
+	}
+
+	compiled := &compiledQuery{table: stmt.Schema.Table}
+	for _, filter := range q.Filters {
+		field := lookUpField(stmt.Schema, fields.Filter, filter.Field)
+		if field == nil {
+			return nil, fmt.Errorf("%w: can't filter by %q", ErrInvalidQuery, filter.Field)
+		}
+		condition, err := filterCondition(field, filter)
+		if err != nil {
+			return nil, err
+		}
+		compiled.conditions = append(compiled.conditions, condition)
+	}
+
+	if q.Search != "" {
+		pattern := likePattern(q.Search)
+		var matches []clause.Expression
+		for _, name := range fields.Search {
+			if field := stmt.Schema.LookUpField(name); field != nil {
+				matches = append(matches, likeCondition(field, pattern))
+			}
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%w: search isn't supported here", ErrInvalidQuery)
+		}
+		compiled.conditions = append(compiled.conditions, clause.Or(matches...))
+	}
+
+	order, err := q.sortColumns(stmt.Schema, fields.Sort)
+	if err != nil {
+		return nil, err
+	}
+	compiled.order = order
+	return compiled, nil
+}
+
+// sortColumns parses SortBy and Order into the columns to order by
+func (q ListQuery) sortColumns(s *schema.Schema, allowed []string) ([]sortColumn, error) {
+	var defaultDesc bool
+	switch strings.ToLower(q.Order) {
+	case "", "asc":
+	case "desc":
+		defaultDesc = true
+	default:
+		return nil, fmt.Errorf("%w: order must be asc or desc", ErrInvalidQuery)
+	}
+
+	var columns []sortColumn
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(q.SortBy, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		desc := defaultDesc
+		switch name[0] {
+		case '-':
+			name, desc = name[1:], true
+		case '+':
+			name, desc = name[1:], false
+		}
+		field := lookUpField(s, allowed, name)
+		if field == nil {
+			return nil, fmt.Errorf("%w: can't sort by %q", ErrInvalidQuery, name)
+		}
+		if seen[field.DBName] {
+			return nil, fmt.Errorf("%w: %q is sorted by twice", ErrInvalidQuery, name)
+		}
+		seen[field.DBName] = true
+		columns = append(columns, sortColumn{field: field, desc: desc})
+	}
+
+	if primary := s.PrioritizedPrimaryField; primary != nil && !seen[primary.DBName] {
+		columns = append(columns, sortColumn{field: primary, desc: defaultDesc && len(columns) == 0})
+	}
+	return columns, nil
+}
+
+// where adds the conditions to db
+func (c *compiledQuery) where(db *gorm.DB) *gorm.DB {
+	if len(c.conditions) > 0 {
+		db = db.Where(clause.And(c.conditions...))
+	}
+	return db
+}
+
+// orderBy adds the order to db
+func orderBy(db *gorm.DB, order []sortColumn) *gorm.DB {
+	for _, column := range order {
+		db = db.Order(clause.OrderByColumn{Column: column.column(), Desc: column.desc})
+	}
+	return db
+}
+
+// column returns the sorted column of the queried table
+func (c sortColumn) column() clause.Column {
+	return clause.Column{Table: clause.CurrentTable, Name: c.field.DBName}
+}
+
+// lookUpField returns the field of the schema named name if it's allowed
+func lookUpField(s *schema.Schema, allowed []string, name string) *schema.Field {
+	for _, candidate := range allowed {
+		if candidate == name {
+			return s.LookUpField(name)
+		}
+	}
+	return nil
+}
+
+// filterCondition turns a filter on field into a SQL condition. Values are
+// converted to the field's type and passed as parameters.
+func filterCondition(field *schema.Field, filter Filter) (clause.Expression, error) {
+	column := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+
+	switch filter.Op {
+	case OpNull:
+		isNull, _ := strconv.ParseBool(filter.Values[0])
+		if isNull {
+			return clause.Expr{SQL: "? IS NULL", Vars: []interface{}{column}}, nil
+		}
+		return clause.Expr{SQL: "? IS NOT NULL", Vars: []interface{}{column}}, nil
+	case OpLike:
+		if kind(field) != reflect.String {
+			return nil, fmt.Errorf("%w: %s[like] only applies to text", ErrInvalidQuery, filter.Field)
+		}
+		return likeCondition(field, likePattern(filter.Values[0])), nil
+	}
+
+	values := make([]interface{}, len(filter.Values))
+	for i, raw := range filter.Values {
+		value, err := fieldValue(field, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidQuery, filter.Field, err)
+		}
+		values[i] = value
+	}
+
+	switch filter.Op {
+	case OpNe:
+		return clause.Neq{Column: column, Value: values[0]}, nil
+	case OpLt:
+		return clause.Lt{Column: column, Value: values[0]}, nil
+	case OpGt:
+		return clause.Gt{Column: column, Value: values[0]}, nil
+	case OpIn:
+		return clause.IN{Column: column, Values: values}, nil
+	case OpBetween:
+		return clause.Expr{SQL: "? BETWEEN ? AND ?", Vars: []interface{}{column, values[0], values[1]}}, nil
+	default:
+		return clause.Eq{Column: column, Value: values[0]}, nil
+	}
+}
+
+// likePattern matches text containing s. "!" escapes the wildcards in s, as
+// backslashes are read differently by MySQL and PostgreSQL.
+func likePattern(s string) string {
+	escaped := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(strings.ToLower(s))
+	return "%" + escaped + "%"
+}
+
+// likeCondition matches the field case-insensitively against pattern
+func likeCondition(field *schema.Field, pattern string) clause.Expression {
+	column := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+	return clause.Expr{SQL: "LOWER(?) LIKE ? ESCAPE '!'", Vars: []interface{}{column, pattern}}
+}
+
+// kind returns the kind of the field's type, looking through pointers
+func kind(field *schema.Field) reflect.Kind {
+	t := field.FieldType
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind()
+}
+
+// timeType is the type of timestamp fields
+var timeType = reflect.TypeOf(time.Time{})
+
+// fieldValue converts a query string value to the type of the field
+func fieldValue(field *schema.Field, raw string) (interface{}, error) {
+	t := field.FieldType
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		if value, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+			return value, nil
+		}
+		if value, err := time.Parse(time.DateOnly, raw); err == nil {
+			return value, nil
+		}
+		return nil, fmt.Errorf("%q isn't an RFC 3339 time or a date", raw)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return raw, nil
+	case reflect.Bool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q isn't true or false", raw)
+		}
+		return value, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q isn't a whole number", raw)
+		}
+		return value, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q isn't a non-negative whole number", raw)
+		}
+		return value, nil
+	case reflect.Float32, reflect.Float64:
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q isn't a number", raw)
+		}
+		return value, nil
+	default:
+		return nil, errors.New("this field can't be compared")
+	}
+}
+
+// findPage returns the records of T that query selects and the response
+// describing their page, whose Data holds the same records
+func findPage[T any](db *gorm.DB, query ListQuery, cursors *cursorSigner) ([]T, *models.PaginatedResponse, error) {
+	query = query.withDefaults()
+	compiled, err := query.compile(db, new(T))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filtered := compiled.where(db.Model(new(T)))
+	var total int64
+	if !query.SkipCount || !query.UseCursor {
+		if err := filtered.Count(&total).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if query.UseCursor {
+		return findCursorPage[T](filtered, query, compiled, cursors, total)
+	}
+
+	var records []T
+	err = orderBy(filtered, compiled.order).Offset((query.Page - 1) * query.PageSize).Limit(query.PageSize).Find(&records).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	return records, query.response(records, total), nil
+}
+
+// findCursorPage returns the page of records after or before the query's
+// cursor, with the cursors of the pages around it. Pages going backwards are
+// read in reverse order and flipped back.
+func findCursorPage[T any](filtered *gorm.DB, query ListQuery, compiled *compiledQuery, cursors *cursorSigner, total int64) ([]T, *models.PaginatedResponse, error) {
+	if err := checkKeysetColumns(compiled.order); err != nil {
+		return nil, nil, err
+	}
+	fingerprint := query.fingerprint(compiled.table)
+
+	var position *cursor
+	if query.Cursor != "" {
+		c, err := cursors.decode(query.Cursor, fingerprint, len(compiled.order))
+		if err != nil {
+			return nil, nil, err
+		}
+		condition, err := keysetCondition(compiled.order, c)
+		if err != nil {
+			return nil, nil, err
+		}
+		filtered = filtered.Where(condition)
+		position = &c
+	}
+	backwards := position != nil && position.Before
+
+	order := compiled.order
+	if backwards {
+		order = reversed(order)
+	}
+	// One more record than the page tells whether there's another page
+	var records []T
+	if err := orderBy(filtered, order).Limit(query.PageSize + 1).Find(&records).Error; err != nil {
+		return nil, nil, err
+	}
+	more := len(records) > query.PageSize
+	if more {
+		records = records[:query.PageSize]
+	}
+	if backwards {
+		slices.Reverse(records)
+	}
+
+	response := query.response(records, total)
+	if len(records) == 0 {
+		return records, response, nil
+	}
+	var err error
+	if more || backwards {
+		last := reflect.ValueOf(&records[len(records)-1]).Elem()
+		response.NextCursor, err = cursors.encode(cursor{Query: fingerprint, Values: cursorValues(compiled.order, last)})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if (more && backwards) || (position != nil && !backwards) {
+		first := reflect.ValueOf(&records[0]).Elem()
+		response.PrevCursor, err = cursors.encode(cursor{Query: fingerprint, Values: cursorValues(compiled.order, first), Before: true})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return records, response, nil
+}
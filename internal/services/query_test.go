@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+)
+
+func TestParseListQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    ListQuery
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			want:  ListQuery{PaginationParams: models.PaginationParams{Page: 1, PageSize: DefaultPageSize}},
+		},
+		{
+			name:  "paging, sorting and search",
+			query: "page=2&page_size=50&sort_by=-created_at,email&order=desc&q=+smith+",
+			want: ListQuery{
+				PaginationParams: models.PaginationParams{Page: 2, PageSize: 50, SortBy: "-created_at,email", Order: "desc"},
+				Search:           "smith",
+			},
+		},
+		{
+			name:  "filters in a stable order",
+			query: "role=admin&created_at[between]=2026-01-01,2026-02-01&id[in]=1,2,3&email_verified_at[null]=false",
+			want: ListQuery{
+				PaginationParams: models.PaginationParams{Page: 1, PageSize: DefaultPageSize},
+				Filters: []Filter{
+					{Field: "created_at", Op: OpBetween, Values: []string{"2026-01-01", "2026-02-01"}},
+					{Field: "email_verified_at", Op: OpNull, Values: []string{"false"}},
+					{Field: "id", Op: OpIn, Values: []string{"1", "2", "3"}},
+					{Field: "role", Op: OpEq, Values: []string{"admin"}},
+				},
+			},
+		},
+		{
+			name:  "first cursor page",
+			query: "cursor=",
+			want:  ListQuery{PaginationParams: models.PaginationParams{Page: 1, PageSize: DefaultPageSize}, UseCursor: true},
+		},
+		{
+			name:  "cursor page without a count",
+			query: "cursor=&count=false",
+			want:  ListQuery{PaginationParams: models.PaginationParams{Page: 1, PageSize: DefaultPageSize}, UseCursor: true, SkipCount: true},
+		},
+		{name: "page zero", query: "page=0", wantErr: true},
+		{name: "page size too large", query: "page_size=101", wantErr: true},
+		{name: "count not a boolean", query: "count=maybe", wantErr: true},
+		{name: "unknown operator", query: "role[regex]=adm.*", wantErr: true},
+		{name: "malformed parameter", query: "role%3Bdrop=1", wantErr: true},
+		{name: "between with one value", query: "created_at[between]=2026-01-01", wantErr: true},
+		{name: "null not a boolean", query: "email_verified_at[null]=yes-please", wantErr: true},
+		{name: "page with a cursor", query: "page=2&cursor=abc", wantErr: true},
+		{name: "count=false without a cursor", query: "page=2&count=false", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery: %v", err)
+			}
+			got, err := ParseListQuery(values)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidQuery) {
+					t.Errorf("err = %v, want ErrInvalidQuery", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseListQuery: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("query = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListQueryFiltersAndSorting(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewBaseService[models.User](db, cfg)
+	ctx := context.Background()
+
+	for _, user := range []struct {
+		email, firstName, role string
+		verified               bool
+	}{
+		{"ada@example.com", "Ada", middleware.RoleAdmin, true},
+		{"bob@example.com", "Bob", middleware.RoleUser, false},
+		{"carol_100%@example.com", "Carol", middleware.RoleUser, true},
+	} {
+		created := createTestUser(t, db, cfg, user.email, user.role)
+		updates := map[string]interface{}{"first_name": user.firstName}
+		if user.verified {
+			updates["email_verified_at"] = time.Now()
+		}
+		db.Model(created).Updates(updates)
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantEmails []string // In order
+		wantErr    bool
+	}{
+		{"everyone, oldest first", "", []string{"ada@example.com", "bob@example.com", "carol_100%@example.com"}, false},
+		{"equality", "role=user", []string{"bob@example.com", "carol_100%@example.com"}, false},
+		{"not equal", "role[ne]=user", []string{"ada@example.com"}, false},
+		{"in", "first_name[in]=Ada,Carol", []string{"ada@example.com", "carol_100%@example.com"}, false},
+		{"null", "email_verified_at[null]=true", []string{"bob@example.com"}, false},
+		{"like is case-insensitive", "email[like]=BOB", []string{"bob@example.com"}, false},
+		{"like wildcards are literal", "email[like]=_100%25", []string{"carol_100%@example.com"}, false},
+		{"wildcard alone matches nothing extra", "email[like]=%25", []string{"carol_100%@example.com"}, false},
+		{"search", "q=carol", []string{"carol_100%@example.com"}, false},
+		{"descending sort", "sort_by=-email", []string{"carol_100%@example.com", "bob@example.com", "ada@example.com"}, false},
+		{"order sets the default direction", "sort_by=role,email&order=desc", []string{"carol_100%@example.com", "bob@example.com", "ada@example.com"}, false},
+		{"explicit ascending overrides order", "sort_by=%2Brole,email&order=desc", []string{"ada@example.com", "carol_100%@example.com", "bob@example.com"}, false},
+		{"time filter", "created_at[lt]=2000-01-01", nil, false},
+
+		{"filter on a hidden field", "password=x", nil, true},
+		{"filter on a field that can't be filtered", "mfa_secret[null]=false", nil, true},
+		{"filter on an unknown field", "nickname=ada", nil, true},
+		{"sort by a hidden field", "sort_by=password", nil, true},
+		{"sort by a field that can only be filtered", "sort_by=is_active", nil, true},
+		{"sort by SQL", "sort_by=email%3BDROP+TABLE+users", nil, true},
+		{"sort by a field twice", "sort_by=email,-email", nil, true},
+		{"unknown order", "order=sideways", nil, true},
+		{"like on a non-text field", "is_active[like]=true", nil, true},
+		{"value of the wrong type", "id[gt]=one", nil, true},
+		{"malformed time", "created_at[gt]=yesterday", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery: %v", err)
+			}
+			query, err := ParseListQuery(values)
+			if err != nil {
+				t.Fatalf("ParseListQuery: %v", err)
+			}
+
+			page, err := service.List(ctx, query)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidQuery) {
+					t.Errorf("err = %v, want ErrInvalidQuery", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+
+			var emails []string
+			for _, user := range page.Data.([]models.User) {
+				emails = append(emails, user.Email)
+			}
+			if !reflect.DeepEqual(emails, tt.wantEmails) {
+				t.Errorf("users = %q, want %q", emails, tt.wantEmails)
+			}
+			if page.Total != int64(len(tt.wantEmails)) {
+				t.Errorf("total = %v, want %d", page.Total, len(tt.wantEmails))
+			}
+		})
+	}
+}
+
+func TestListQueryPages(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewBaseService[models.User](db, cfg)
+	ctx := context.Background()
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		createTestUser(t, db, cfg, email, middleware.RoleUser)
+	}
+
+	tests := []struct {
+		name           string
+		query          ListQuery
+		wantUsers      int
+		wantPage       int
+		wantTotal      int64
+		wantTotalPages int
+	}{
+		{"first page", ListQuery{PaginationParams: models.PaginationParams{Page: 1, PageSize: 2}}, 2, 1, 3, 2},
+		{"last page", ListQuery{PaginationParams: models.PaginationParams{Page: 2, PageSize: 2}}, 1, 2, 3, 2},
+		{"past the end", ListQuery{PaginationParams: models.PaginationParams{Page: 3, PageSize: 2}}, 0, 3, 3, 2},
+		{"pages by number are always counted", ListQuery{PaginationParams: models.PaginationParams{Page: 1, PageSize: 2}, SkipCount: true}, 2, 1, 3, 2},
+		{"zero values get the defaults", ListQuery{}, 3, 1, 3, 1},
+		{"cursor page", ListQuery{PaginationParams: models.PaginationParams{PageSize: 2}, UseCursor: true}, 2, 0, 3, 2},
+		{"cursor page without a count", ListQuery{PaginationParams: models.PaginationParams{PageSize: 2}, UseCursor: true, SkipCount: true}, 2, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := service.List(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if users := page.Data.([]models.User); len(users) != tt.wantUsers {
+				t.Errorf("%d users, want %d", len(users), tt.wantUsers)
+			}
+			if page.Page != tt.wantPage || page.Total != tt.wantTotal || page.TotalPages != tt.wantTotalPages {
+				t.Errorf("page %d, total %d in %d pages, want page %d, total %d in %d pages",
+					page.Page, page.Total, page.TotalPages, tt.wantPage, tt.wantTotal, tt.wantTotalPages)
+			}
+
+			// Clients rely on the page fields being present, even when zero
+			body, err := json.Marshal(page)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			var fields map[string]interface{}
+			if err := json.Unmarshal(body, &fields); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			for _, field := range []string{"data", "total", "page", "page_size", "total_pages"} {
+				if _, ok := fields[field]; !ok {
+					t.Errorf("the response has no %s: %s", field, body)
+				}
+			}
+			if _, ok := fields["prev_cursor"]; ok {
+				t.Errorf("the first page has a prev_cursor: %s", body)
+			}
+		})
+	}
+}
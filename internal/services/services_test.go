@@ -0,0 +1,96 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// testPassword satisfies the default password rules
+const testPassword = "Correct-Horse-9"
+
+// newTestEnv returns a migrated in-memory database and the test configuration
+func newTestEnv(t *testing.T) (*gorm.DB, *config.Config) {
+	t.Helper()
+	return testutil.NewDB(t), testutil.Config(t)
+}
+
+// newUserService returns a user service that emails through the SMTP server
+// in cfg.Email, if one is set
+func newUserService(t *testing.T, db *gorm.DB, cfg *config.Config) *UserService {
+	t.Helper()
+
+	emailSender, err := connectors.NewEmailSender(cfg.Email)
+	if err != nil {
+		t.Fatalf("NewEmailSender: %v", err)
+	}
+	return NewUserService(db, emailSender, NewSettingsService(db, cfg), NewTokenService(db, cfg), NewAuditService(db, cfg), cfg)
+}
+
+// createTestUser stores an active user with the given role and testPassword
+func createTestUser(t *testing.T, db *gorm.DB, cfg *config.Config, email, role string) *models.User {
+	t.Helper()
+
+	hash, err := newPasswordHasher(cfg.Password).Hash(testPassword)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	user := &models.User{Email: email, Password: hash, Role: role, IsActive: true}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user %s: %v", email, err)
+	}
+	return user
+}
+
+// authStatus returns the status of a request authenticated with the access
+// token, checked for revocation by revocations
+func authStatus(t *testing.T, revocations middleware.TokenRevocationChecker, token string) int {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/me", middleware.AuthMiddleware(middleware.AuthOptions{Revocations: revocations}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// linkToken returns the token of the link to page in the last of the first n
+// emails sent to the address, waiting for them to arrive
+func linkToken(t *testing.T, smtp *testutil.FakeSMTPServer, page string, n int, address string) string {
+	t.Helper()
+
+	link := regexp.MustCompile(regexp.QuoteMeta(page) + `\?token=([^"&\s]+)`)
+	emails := smtp.WaitForEmails(t, n)
+	for i := len(emails) - 1; i >= 0; i-- {
+		if len(emails[i].To) != 1 || emails[i].To[0] != address {
+			continue
+		}
+		match := link.FindStringSubmatch(emails[i].Body())
+		if match == nil {
+			continue
+		}
+		token, err := url.QueryUnescape(match[1])
+		if err != nil {
+			t.Fatalf("invalid token in the link: %v", err)
+		}
+		return token
+	}
+	t.Fatalf("no email with a %s link sent to %s", page, address)
+	return ""
+}
@@ -1,31 +1,39 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
+	"github.com/cam-boltnote/go-ignite/internal/config"
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
 	"github.com/cam-boltnote/go-ignite/internal/models"
 	"github.com/cam-boltnote/go-ignite/internal/utils"
 
 	"gorm.io/gorm"
 )
 
+// errNoSettings is returned when changing the settings of a user who has none
+var errNoSettings = errors.New("no settings found for this user")
+
 // SettingsService handles settings-related database operations and business logic
 type SettingsService struct {
 	db     *gorm.DB
+	audit  *AuditService
 	logger *utils.Logger
 }
 
 // NewSettingsService creates a new settings service instance
-func NewSettingsService(db *gorm.DB) *SettingsService {
+func NewSettingsService(db *gorm.DB, cfg *config.Config) *SettingsService {
 	return &SettingsService{
 		db:     db,
+		audit:  NewAuditService(db, cfg),
 		logger: utils.GetLogger().WithService("settings_service"),
 	}
 }
 
 // CreateDefaultSettings creates a new settings entry with default values for a user
-func (s *SettingsService) CreateDefaultSettings(userID uint) error {
+func (s *SettingsService) CreateDefaultSettings(ctx context.Context, userID uint) error {
 	s.logger.Info("Creating default settings", map[string]interface{}{
 		"user_id": userID,
 	})
@@ -35,7 +43,7 @@ func (s *SettingsService) CreateDefaultSettings(userID uint) error {
 		// Default values are set in the model
 	}
 
-	if err := s.db.Create(settings).Error; err != nil {
+	if err := connectors.Conn(ctx, s.db).Create(settings).Error; err != nil {
 		s.logger.Error("Failed to create default settings", err, map[string]interface{}{
 			"user_id": userID,
 		})
@@ -46,13 +54,13 @@ func (s *SettingsService) CreateDefaultSettings(userID uint) error {
 }
 
 // GetByID retrieves settings by their ID
-func (s *SettingsService) GetByID(id uint) (*models.Settings, error) {
+func (s *SettingsService) GetByID(ctx context.Context, id uint) (*models.Settings, error) {
 	s.logger.Debug("Fetching settings by ID", map[string]interface{}{
 		"id": id,
 	})
 
 	var settings models.Settings
-	result := s.db.First(&settings, id)
+	result := connectors.Conn(ctx, s.db).First(&settings, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			s.logger.Warn("Settings not found", map[string]interface{}{
@@ -69,13 +77,13 @@ func (s *SettingsService) GetByID(id uint) (*models.Settings, error) {
 }
 
 // GetByUserID retrieves settings by user ID
-func (s *SettingsService) GetByUserID(userID uint) (*models.Settings, error) {
+func (s *SettingsService) GetByUserID(ctx context.Context, userID uint) (*models.Settings, error) {
 	s.logger.Debug("Fetching settings by user ID", map[string]interface{}{
 		"user_id": userID,
 	})
 
 	var settings models.Settings
-	result := s.db.Where("user_id = ?", userID).First(&settings)
+	result := connectors.Conn(ctx, s.db).Where("user_id = ?", userID).First(&settings)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			s.logger.Warn("Settings not found", map[string]interface{}{
@@ -92,34 +100,37 @@ func (s *SettingsService) GetByUserID(userID uint) (*models.Settings, error) {
 }
 
 // Update updates existing settings
-func (s *SettingsService) Update(settings *models.Settings) error {
+func (s *SettingsService) Update(ctx context.Context, settings *models.Settings) error {
 	s.logger.Info("Updating settings", map[string]interface{}{
 		"user_id": settings.UserID,
 	})
 
-	result := s.db.Where("user_id = ?", settings.UserID).Updates(settings)
-	if result.Error != nil {
-		s.logger.Error("Failed to update settings", result.Error, map[string]interface{}{
-			"user_id": settings.UserID,
-		})
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		s.logger.Warn("No settings found to update", map[string]interface{}{
-			"user_id": settings.UserID,
-		})
-		return errors.New("no settings found for this user")
+	err := s.auditChange(ctx, settings.UserID, func(tx *gorm.DB) error {
+		// Security settings have their own checks; see UpdateSecuritySettings
+		return tx.Omit("passwordless_only").Updates(settings).Error
+	})
+	if err != nil {
+		if errors.Is(err, errNoSettings) {
+			s.logger.Warn("No settings found to update", map[string]interface{}{
+				"user_id": settings.UserID,
+			})
+		} else {
+			s.logger.Error("Failed to update settings", err, map[string]interface{}{
+				"user_id": settings.UserID,
+			})
+		}
+		return err
 	}
 	return nil
 }
 
 // Delete deletes settings
-func (s *SettingsService) Delete(id uint) error {
+func (s *SettingsService) Delete(ctx context.Context, id uint) error {
 	s.logger.Info("Deleting settings", map[string]interface{}{
 		"id": id,
 	})
 
-	result := s.db.Delete(&models.Settings{}, id)
+	result := connectors.Conn(ctx, s.db).Delete(&models.Settings{}, id)
 	if result.Error != nil {
 		s.logger.Error("Failed to delete settings", result.Error, map[string]interface{}{
 			"id": id,
@@ -135,15 +146,15 @@ func (s *SettingsService) Delete(id uint) error {
 }
 
 // UpdateCustomSettings updates only the custom settings for a user
-func (s *SettingsService) UpdateCustomSettings(userID uint, customSettings map[string]interface{}) error {
+func (s *SettingsService) UpdateCustomSettings(ctx context.Context, userID uint, customSettings map[string]interface{}) error {
 	s.logger.Info("Updating custom settings", map[string]interface{}{
 		"user_id":  userID,
 		"settings": customSettings,
 	})
 
-	err := s.db.Model(&models.Settings{}).
-		Where("user_id = ?", userID).
-		Update("custom_settings", customSettings).Error
+	err := s.auditChange(ctx, userID, func(tx *gorm.DB) error {
+		return tx.Update("custom_settings", models.JSONMap(customSettings)).Error
+	})
 
 	if err != nil {
 		s.logger.Error("Failed to update custom settings", err, map[string]interface{}{
@@ -154,14 +165,14 @@ func (s *SettingsService) UpdateCustomSettings(userID uint, customSettings map[s
 }
 
 // GetCustomSetting retrieves a specific custom setting
-func (s *SettingsService) GetCustomSetting(userID uint, key string) (interface{}, error) {
+func (s *SettingsService) GetCustomSetting(ctx context.Context, userID uint, key string) (interface{}, error) {
 	s.logger.Debug("Fetching custom setting", map[string]interface{}{
 		"user_id": userID,
 		"key":     key,
 	})
 
 	var settings models.Settings
-	err := s.db.Where("user_id = ?", userID).First(&settings).Error
+	err := connectors.Conn(ctx, s.db).Where("user_id = ?", userID).First(&settings).Error
 	if err != nil {
 		s.logger.Error("Failed to fetch custom setting", err, map[string]interface{}{
 			"user_id": userID,
@@ -179,7 +190,7 @@ func (s *SettingsService) GetCustomSetting(userID uint, key string) (interface{}
 }
 
 // UpdateNotificationSettings updates notification preferences
-func (s *SettingsService) UpdateNotificationSettings(userID uint, emailEnabled, pushEnabled bool, frequency string) error {
+func (s *SettingsService) UpdateNotificationSettings(ctx context.Context, userID uint, emailEnabled, pushEnabled bool, frequency string) error {
 	s.logger.Info("Updating notification settings", map[string]interface{}{
 		"user_id":       userID,
 		"email_enabled": emailEnabled,
@@ -187,13 +198,13 @@ func (s *SettingsService) UpdateNotificationSettings(userID uint, emailEnabled,
 		"frequency":     frequency,
 	})
 
-	err := s.db.Model(&models.Settings{}).
-		Where("user_id = ?", userID).
-		Updates(map[string]interface{}{
+	err := s.auditChange(ctx, userID, func(tx *gorm.DB) error {
+		return tx.Updates(map[string]interface{}{
 			"email_notifications_enabled": emailEnabled,
 			"push_notifications_enabled":  pushEnabled,
 			"notification_frequency":      frequency,
 		}).Error
+	})
 
 	if err != nil {
 		s.logger.Error("Failed to update notification settings", err, map[string]interface{}{
@@ -204,19 +215,19 @@ func (s *SettingsService) UpdateNotificationSettings(userID uint, emailEnabled,
 }
 
 // UpdatePrivacySettings updates privacy preferences
-func (s *SettingsService) UpdatePrivacySettings(userID uint, visibility string, dataSharing bool) error {
+func (s *SettingsService) UpdatePrivacySettings(ctx context.Context, userID uint, visibility string, dataSharing bool) error {
 	s.logger.Info("Updating privacy settings", map[string]interface{}{
 		"user_id":      userID,
 		"visibility":   visibility,
 		"data_sharing": dataSharing,
 	})
 
-	err := s.db.Model(&models.Settings{}).
-		Where("user_id = ?", userID).
-		Updates(map[string]interface{}{
+	err := s.auditChange(ctx, userID, func(tx *gorm.DB) error {
+		return tx.Updates(map[string]interface{}{
 			"profile_visibility": visibility,
 			"data_sharing":       dataSharing,
 		}).Error
+	})
 
 	if err != nil {
 		s.logger.Error("Failed to update privacy settings", err, map[string]interface{}{
@@ -226,8 +237,40 @@ func (s *SettingsService) UpdatePrivacySettings(userID uint, visibility string,
 	return err
 }
 
+// UpdateSecuritySettings updates sign-in preferences. Passwordless-only requires
+// a verified email address, since that is where sign-in links are sent.
+func (s *SettingsService) UpdateSecuritySettings(ctx context.Context, userID uint, passwordlessOnly bool) error {
+	s.logger.Info("Updating security settings", map[string]interface{}{
+		"user_id":           userID,
+		"passwordless_only": passwordlessOnly,
+	})
+
+	if passwordlessOnly {
+		var user models.User
+		if err := connectors.Conn(ctx, s.db).Select("id", "email_verified_at").First(&user, userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("user not found")
+			}
+			return err
+		}
+		if user.EmailVerifiedAt == nil {
+			return ErrEmailNotVerified
+		}
+	}
+
+	err := s.auditChange(ctx, userID, func(tx *gorm.DB) error {
+		return tx.Update("passwordless_only", passwordlessOnly).Error
+	})
+	if err != nil && !errors.Is(err, errNoSettings) {
+		s.logger.Error("Failed to update security settings", err, map[string]interface{}{
+			"user_id": userID,
+		})
+	}
+	return err
+}
+
 // UpdateGeneralSettings updates general preferences
-func (s *SettingsService) UpdateGeneralSettings(userID uint, timezone, language, theme string) error {
+func (s *SettingsService) UpdateGeneralSettings(ctx context.Context, userID uint, timezone, language, theme string) error {
 	s.logger.Info("Updating general settings", map[string]interface{}{
 		"user_id":  userID,
 		"timezone": timezone,
@@ -253,9 +296,9 @@ func (s *SettingsService) UpdateGeneralSettings(userID uint, timezone, language,
 		return nil
 	}
 
-	err := s.db.Model(&models.Settings{}).
-		Where("user_id = ?", userID).
-		Updates(updates).Error
+	err := s.auditChange(ctx, userID, func(tx *gorm.DB) error {
+		return tx.Updates(updates).Error
+	})
 
 	if err != nil {
 		s.logger.Error("Failed to update general settings", err, map[string]interface{}{
@@ -264,3 +307,26 @@ func (s *SettingsService) UpdateGeneralSettings(userID uint, timezone, language,
 	}
 	return err
 }
+
+// auditChange applies a change to the user's settings and records how they
+// differ afterwards. change receives a query scoped to the user's settings.
+func (s *SettingsService) auditChange(ctx context.Context, userID uint, change func(tx *gorm.DB) error) error {
+	var before models.Settings
+	if err := connectors.Conn(ctx, s.db).Where("user_id = ?", userID).First(&before).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errNoSettings
+		}
+		return err
+	}
+
+	if err := change(connectors.Conn(ctx, s.db).Model(&models.Settings{}).Where("user_id = ?", userID)); err != nil {
+		return err
+	}
+
+	var after models.Settings
+	if err := connectors.Conn(ctx, s.db).First(&after, before.ID).Error; err != nil {
+		return err
+	}
+	s.audit.Record(ctx, models.AuditSettingsUpdate, "settings", before.ID, &before, &after)
+	return nil
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cam-boltnote/go-ignite/internal/models"
+)
+
+func TestSettingsCustomSettingsRoundTrip(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	ctx := context.Background()
+	user := createTestUser(t, db, cfg, "ada@example.com", "user")
+	service := NewSettingsService(db, cfg)
+
+	if err := service.CreateDefaultSettings(ctx, user.ID); err != nil {
+		t.Fatalf("CreateDefaultSettings: %v", err)
+	}
+	settings, err := service.GetByUserID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetByUserID: %v", err)
+	}
+	if settings.Timezone != "UTC" || settings.Theme != "light" || !settings.EmailNotificationsEnabled {
+		t.Errorf("defaults not applied: %+v", settings)
+	}
+
+	custom := map[string]interface{}{"layout": "compact", "pinned": []interface{}{"inbox"}}
+	if err := service.UpdateCustomSettings(ctx, user.ID, custom); err != nil {
+		t.Fatalf("UpdateCustomSettings: %v", err)
+	}
+	value, err := service.GetCustomSetting(ctx, user.ID, "layout")
+	if err != nil {
+		t.Fatalf("GetCustomSetting: %v", err)
+	}
+	if value != "compact" {
+		t.Errorf("layout = %v, want compact", value)
+	}
+
+	var events int64
+	db.Model(&models.AuditEvent{}).Where("action = ?", models.AuditSettingsUpdate).Count(&events)
+	if events != 1 {
+		t.Errorf("recorded %d settings audit events, want 1", events)
+	}
+}
+
+func TestSettingsUpdateWithoutSettings(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewSettingsService(db, cfg)
+
+	err := service.UpdateCustomSettings(context.Background(), 404, map[string]interface{}{"a": 1})
+	if !errors.Is(err, errNoSettings) {
+		t.Errorf("err = %v, want errNoSettings", err)
+	}
+}
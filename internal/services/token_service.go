@@ -0,0 +1,401 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown or expired refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already-rotated refresh token is presented again
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// TokenPair is the set of tokens returned to a client after authenticating
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"` // Access token lifetime in seconds
+}
+
+// TokenService issues, rotates and revokes access and refresh tokens
+type TokenService struct {
+	db         *gorm.DB
+	refreshTTL time.Duration
+	logger     *utils.Logger
+}
+
+// NewTokenService creates a new token service instance
+func NewTokenService(db *gorm.DB, cfg *config.Config) *TokenService {
+	return &TokenService{
+		db:         db,
+		refreshTTL: cfg.JWT.RefreshTokenTTL,
+		logger:     utils.GetLogger().WithService("token_service"),
+	}
+}
+
+// IssueTokens starts a new session and refresh token family for the user and returns a token pair
+func (s *TokenService) IssueTokens(ctx context.Context, user *models.User, info SessionInfo) (*TokenPair, error) {
+	familyID, err := generateOpaqueToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	var session *models.Session
+	var refreshToken string
+	err = connectors.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		if session, err = s.createSession(tx, user.ID, familyID, info); err != nil {
+			return err
+		}
+		refreshToken, _, err = s.createRefreshToken(tx, user.ID, familyID)
+		return err
+	})
+	if err != nil {
+		s.logger.Error("Failed to create session", err, map[string]interface{}{
+			"user_id": user.ID,
+		})
+		return nil, err
+	}
+
+	return s.newTokenPair(user, session.ID, refreshToken)
+}
+
+// Refresh rotates a refresh token, returning a new token pair. Presenting a
+// token that has already been rotated or revoked revokes its entire family.
+// The session's last-seen time, IP and user agent are updated from info.
+func (s *TokenService) Refresh(ctx context.Context, refreshToken string, info SessionInfo) (*TokenPair, *models.User, error) {
+	var stored models.RefreshToken
+	result := connectors.Conn(ctx, s.db).Where("token_hash = ?", hashOpaqueToken(refreshToken)).First(&stored)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		s.logger.Error("Failed to fetch refresh token", result.Error, nil)
+		return nil, nil, result.Error
+	}
+
+	if stored.RevokedAt != nil {
+		s.handleReuse(ctx, &stored)
+		return nil, nil, ErrRefreshTokenReused
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	var user models.User
+	if err := connectors.Conn(ctx, s.db).First(&user, stored.UserID).Error; err != nil || !user.IsActive {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	var newToken string
+	var session *models.Session
+	err := connectors.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if session, err = s.touchSession(tx, stored.UserID, stored.FamilyID, info); err != nil {
+			return err
+		}
+
+		token, record, err := s.createRefreshToken(tx, stored.UserID, stored.FamilyID)
+		if err != nil {
+			return err
+		}
+
+		// Only one caller can rotate a given token; a concurrent rotation counts as reuse
+		rotated := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", stored.ID).
+			Updates(map[string]interface{}{
+				"revoked_at":     time.Now(),
+				"replaced_by_id": record.ID,
+			})
+		if rotated.Error != nil {
+			return rotated.Error
+		}
+		if rotated.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		newToken = token
+		return nil
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		s.handleReuse(ctx, &stored)
+		return nil, nil, err
+	}
+	if errors.Is(err, ErrInvalidRefreshToken) {
+		return nil, nil, err
+	}
+	if err != nil {
+		s.logger.Error("Failed to rotate refresh token", err, map[string]interface{}{
+			"user_id": stored.UserID,
+		})
+		return nil, nil, err
+	}
+
+	pair, err := s.newTokenPair(&user, session.ID, newToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	user.Password = "" // Don't return the password
+	return pair, &user, nil
+}
+
+// Logout revokes the presented access token and, if given, the refresh token family it belongs to
+func (s *TokenService) Logout(ctx context.Context, claims *middleware.Claims, refreshToken string) error {
+	s.logger.Info("Logging out", map[string]interface{}{
+		"user_id": claims.UserID,
+	})
+
+	if err := s.RevokeAccessToken(ctx, claims); err != nil {
+		return err
+	}
+
+	if claims.SessionID != 0 {
+		if err := s.RevokeSession(ctx, claims.UserID, claims.SessionID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return err
+		}
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	var stored models.RefreshToken
+	result := connectors.Conn(ctx, s.db).Where("token_hash = ? AND user_id = ?", hashOpaqueToken(refreshToken), claims.UserID).First(&stored)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return result.Error
+	}
+	return s.revokeFamily(ctx, stored.FamilyID)
+}
+
+// RevokeAccessToken adds the access token's jti to the revocation list
+func (s *TokenService) RevokeAccessToken(ctx context.Context, claims *middleware.Claims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+
+	revoked := &models.RevokedToken{
+		JTI:       claims.ID,
+		UserID:    claims.UserID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	if err := connectors.Conn(ctx, s.db).Create(revoked).Error; err != nil {
+		s.logger.Error("Failed to revoke access token", err, map[string]interface{}{
+			"user_id": claims.UserID,
+		})
+		return err
+	}
+
+	// Entries for tokens that have expired anyway are no longer needed
+	connectors.Conn(ctx, s.db).Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{})
+	return nil
+}
+
+// RevokeAllForUser revokes every refresh token of the user and invalidates all
+// access tokens issued so far
+func (s *TokenService) RevokeAllForUser(ctx context.Context, userID uint) error {
+	s.logger.Info("Revoking all tokens for user", map[string]interface{}{
+		"user_id": userID,
+	})
+
+	// Tokens carry their issue time in milliseconds, so the cutoff is stored at
+	// the same precision; see issuedBefore
+	now := time.Now().Truncate(time.Millisecond)
+	err := connectors.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			Update("tokens_revoked_at", now).Error
+	})
+	if err != nil {
+		s.logger.Error("Failed to revoke tokens for user", err, map[string]interface{}{
+			"user_id": userID,
+		})
+	}
+	return err
+}
+
+// IsTokenRevoked reports whether the access token was revoked by jti or with its
+// session, belongs to an inactive or deleted user, or was issued before the
+// user's tokens were revoked. Impersonation tokens are also revoked once the
+// acting admin fails the same checks or loses the impersonate permission.
+func (s *TokenService) IsTokenRevoked(ctx context.Context, claims *middleware.Claims) (bool, error) {
+	// A revocation must take effect at once, not when the replicas catch up
+	ctx = connectors.ReadFromPrimary(ctx)
+
+	if claims.SessionID != 0 {
+		active, err := s.checkSession(ctx, claims.UserID, claims.SessionID)
+		if err != nil {
+			return false, err
+		}
+		if !active {
+			return true, nil
+		}
+	}
+
+	if claims.ID != "" {
+		var count int64
+		if err := connectors.Conn(ctx, s.db).Model(&models.RevokedToken{}).Where("jti = ?", claims.ID).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+
+	revoked, err := s.isUserTokenRevoked(ctx, claims.UserID, claims)
+	if err != nil || revoked {
+		return revoked, err
+	}
+
+	if claims.ActorID != 0 {
+		return s.isUserTokenRevoked(ctx, claims.ActorID, claims)
+	}
+	return false, nil
+}
+
+// isUserTokenRevoked reports whether the user is missing or inactive, or revoked
+// their tokens after the token was issued. For an impersonation token's actor it
+// also checks the actor may still impersonate.
+func (s *TokenService) isUserTokenRevoked(ctx context.Context, userID uint, claims *middleware.Claims) (bool, error) {
+	var user models.User
+	result := connectors.Conn(ctx, s.db).Select("id", "role", "is_active", "tokens_revoked_at").First(&user, userID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return true, nil
+		}
+		return false, result.Error
+	}
+	if !user.IsActive {
+		return true, nil
+	}
+	if user.TokensRevokedAt != nil && issuedBefore(claims, *user.TokensRevokedAt) {
+		return true, nil
+	}
+	if userID == claims.ActorID && !middleware.HasPermission(user.Role, middleware.PermUsersImpersonate) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// issuedBefore reports whether the token was issued before cutoff. A token
+// issued in the cutoff's millisecond counts as issued after it, so the login
+// that follows a password change or account claim isn't rejected. Tokens
+// without iat_ms only have whole seconds; one from the cutoff's second counts
+// as issued before it.
+func issuedBefore(claims *middleware.Claims, cutoff time.Time) bool {
+	if claims.IssuedAtMs != 0 {
+		return time.UnixMilli(claims.IssuedAtMs).Before(cutoff)
+	}
+	return claims.IssuedAt != nil && !claims.IssuedAt.Time.After(cutoff)
+}
+
+// handleReuse revokes the family of a refresh token that was presented after being rotated
+func (s *TokenService) handleReuse(ctx context.Context, stored *models.RefreshToken) {
+	// Revoke the family even if the client hangs up
+	ctx = context.WithoutCancel(ctx)
+
+	s.logger.Warn("Refresh token reuse detected, revoking token family", map[string]interface{}{
+		"user_id":   stored.UserID,
+		"family_id": stored.FamilyID,
+	})
+	if err := s.revokeFamily(ctx, stored.FamilyID); err != nil {
+		s.logger.Error("Failed to revoke refresh token family", err, map[string]interface{}{
+			"family_id": stored.FamilyID,
+		})
+	}
+}
+
+// revokeFamily revokes every active refresh token in a family and the session it belongs to
+func (s *TokenService) revokeFamily(ctx context.Context, familyID string) error {
+	now := time.Now()
+	return connectors.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL", familyID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Session{}).
+			Where("family_id = ? AND revoked_at IS NULL", familyID).
+			Update("revoked_at", now).Error
+	})
+}
+
+// createRefreshToken generates and stores a new refresh token in the given family
+func (s *TokenService) createRefreshToken(db *gorm.DB, userID uint, familyID string) (string, *models.RefreshToken, error) {
+	token, err := generateOpaqueToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	record := &models.RefreshToken{
+		UserID:    userID,
+		TokenHash: hashOpaqueToken(token),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(s.refreshTTL),
+	}
+	if err := db.Create(record).Error; err != nil {
+		return "", nil, err
+	}
+	return token, record, nil
+}
+
+// newTokenPair signs an access token for the user's session and pairs it with the refresh token
+func (s *TokenService) newTokenPair(user *models.User, sessionID uint, refreshToken string) (*TokenPair, error) {
+	accessToken, err := middleware.GenerateToken(user, sessionID)
+	if err != nil {
+		s.logger.Error("Failed to generate access token", err, map[string]interface{}{
+			"user_id": user.ID,
+		})
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(middleware.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+// generateOpaqueToken returns a random URL-safe token of n bytes of entropy
+func generateOpaqueToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashOpaqueToken returns the hex-encoded SHA-256 of a token for storage and lookup
+func hashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
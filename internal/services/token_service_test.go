@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRevokeAllForUser(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewTokenService(db, cfg)
+	ctx := context.Background()
+	user := createTestUser(t, db, cfg, "ada@example.com", "user")
+
+	pair, err := service.IssueTokens(ctx, user, SessionInfo{Method: "password"})
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+	if err := service.RevokeAllForUser(ctx, user.ID); err != nil {
+		t.Fatalf("RevokeAllForUser: %v", err)
+	}
+
+	var stored models.User
+	db.First(&stored, user.ID)
+	revokedAt := *stored.TokensRevokedAt
+	if !revokedAt.Equal(revokedAt.Truncate(time.Millisecond)) {
+		t.Errorf("tokens_revoked_at = %s, want whole milliseconds", revokedAt)
+	}
+
+	tests := []struct {
+		name   string
+		claims middleware.Claims
+		want   bool
+	}{
+		{"issued a millisecond before", middleware.Claims{IssuedAtMs: revokedAt.Add(-time.Millisecond).UnixMilli()}, true},
+		{"issued the same millisecond", middleware.Claims{IssuedAtMs: revokedAt.UnixMilli()}, false},
+		{"issued a millisecond after", middleware.Claims{IssuedAtMs: revokedAt.Add(time.Millisecond).UnixMilli()}, false},
+		{"without iat_ms, issued the same second", middleware.Claims{RegisteredClaims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(revokedAt)}}, true},
+		{"without iat_ms, issued a second after", middleware.Claims{RegisteredClaims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(revokedAt.Add(time.Second))}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := tt.claims
+			claims.UserID = user.ID
+			revoked, err := service.IsTokenRevoked(ctx, &claims)
+			if err != nil {
+				t.Fatalf("IsTokenRevoked: %v", err)
+			}
+			if revoked != tt.want {
+				t.Errorf("revoked = %v, want %v", revoked, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := service.Refresh(ctx, pair.RefreshToken, SessionInfo{}); err == nil {
+		t.Error("the refresh token still works after revoking all tokens")
+	}
+}
+
+func TestSignInRightAfterRevokeAllForUser(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewTokenService(db, cfg)
+	ctx := context.Background()
+	user := createTestUser(t, db, cfg, "ada@example.com", "user")
+
+	before, err := service.IssueTokens(ctx, user, SessionInfo{Method: "password"})
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+	// As after a password change: revoke everything, then sign in again
+	// within the same second
+	if err := service.RevokeAllForUser(ctx, user.ID); err != nil {
+		t.Fatalf("RevokeAllForUser: %v", err)
+	}
+	after, err := service.IssueTokens(ctx, user, SessionInfo{Method: "password"})
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+
+	if status := authStatus(t, service, before.AccessToken); status != http.StatusUnauthorized {
+		t.Errorf("token issued before the revocation: status = %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status := authStatus(t, service, after.AccessToken); status != http.StatusOK {
+		t.Errorf("token issued after the revocation: status = %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewTokenService(db, cfg)
+	ctx := context.Background()
+	user := createTestUser(t, db, cfg, "ada@example.com", "user")
+
+	first, err := service.IssueTokens(ctx, user, SessionInfo{Method: "password"})
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+	second, _, err := service.Refresh(ctx, first.RefreshToken, SessionInfo{})
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("Refresh didn't rotate the refresh token")
+	}
+
+	// Replaying the rotated token revokes the whole family, including the
+	// token it was replaced by
+	if _, _, err := service.Refresh(ctx, first.RefreshToken, SessionInfo{}); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replayed token: err = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, _, err := service.Refresh(ctx, second.RefreshToken, SessionInfo{}); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("newest token after reuse: err = %v, want ErrRefreshTokenReused", err)
+	}
+
+	var active int64
+	db.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Count(&active)
+	if active != 0 {
+		t.Errorf("%d sessions still active after reuse, want 0", active)
+	}
+
+	if _, _, err := service.Refresh(ctx, "unknown", SessionInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// sessionLastSeenInterval limits how often a session's last-seen time is written
+const sessionLastSeenInterval = time.Minute
+
+// ErrSessionNotFound is returned for sessions that don't exist, belong to another
+// user or have already been revoked
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionInfo describes the device and sign-in method a session is created for
+type SessionInfo struct {
+	Method    string
+	UserAgent string
+	IP        string
+}
+
+// ListSessions returns the user's active sessions, most recently used first
+func (s *TokenService) ListSessions(ctx context.Context, userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := connectors.Conn(ctx, s.db).Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// A session whose refresh tokens have all expired can't be resumed
+	active := sessions[:0]
+	for _, session := range sessions {
+		if time.Since(session.LastSeenAt) < s.refreshTTL {
+			active = append(active, session)
+		}
+	}
+	return active, nil
+}
+
+// RevokeSession signs one of the user's sessions out. Its refresh tokens stop
+// working and its access tokens are rejected by AuthMiddleware.
+func (s *TokenService) RevokeSession(ctx context.Context, userID, sessionID uint) error {
+	var session models.Session
+	err := connectors.Conn(ctx, s.db).Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).First(&session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+
+	s.logger.Info("Revoking session", map[string]interface{}{
+		"user_id":    userID,
+		"session_id": sessionID,
+	})
+	return s.revokeFamily(ctx, session.FamilyID)
+}
+
+// RevokeOtherSessions signs out every session of the user except the current one
+func (s *TokenService) RevokeOtherSessions(ctx context.Context, userID, currentSessionID uint) (int, error) {
+	var sessions []models.Session
+	if err := connectors.Conn(ctx, s.db).Select("id", "family_id").
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, currentSessionID).
+		Find(&sessions).Error; err != nil {
+		return 0, err
+	}
+
+	s.logger.Info("Revoking other sessions", map[string]interface{}{
+		"user_id":    userID,
+		"session_id": currentSessionID,
+		"count":      len(sessions),
+	})
+	for _, session := range sessions {
+		if err := s.revokeFamily(ctx, session.FamilyID); err != nil {
+			s.logger.Error("Failed to revoke session", err, map[string]interface{}{
+				"user_id":    userID,
+				"session_id": session.ID,
+			})
+			return 0, err
+		}
+	}
+	return len(sessions), nil
+}
+
+// createSession stores a new session for a refresh token family
+func (s *TokenService) createSession(db *gorm.DB, userID uint, familyID string, info SessionInfo) (*models.Session, error) {
+	session := &models.Session{
+		UserID:     userID,
+		FamilyID:   familyID,
+		Method:     info.Method,
+		UserAgent:  truncate(info.UserAgent, 512),
+		IP:         info.IP,
+		LastSeenAt: time.Now(),
+	}
+	if err := db.Create(session).Error; err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// touchSession records that a session's refresh token was used from info's device.
+// Families issued before sessions were tracked get a session on first refresh.
+func (s *TokenService) touchSession(db *gorm.DB, userID uint, familyID string, info SessionInfo) (*models.Session, error) {
+	var session models.Session
+	err := db.Where("family_id = ?", familyID).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		info.Method = "refresh"
+		return s.createSession(db, userID, familyID, info)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.RevokedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if err := db.Model(&session).Updates(map[string]interface{}{
+		"last_seen_at": time.Now(),
+		"ip":           info.IP,
+		"user_agent":   truncate(info.UserAgent, 512),
+	}).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// checkSession reports whether the session is still active and, at most once per
+// sessionLastSeenInterval, records that it was just used
+func (s *TokenService) checkSession(ctx context.Context, userID, sessionID uint) (bool, error) {
+	var session models.Session
+	err := connectors.Conn(ctx, s.db).Select("id", "user_id", "last_seen_at", "revoked_at").First(&session, sessionID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if session.UserID != userID || session.RevokedAt != nil {
+		return false, nil
+	}
+
+	if time.Since(session.LastSeenAt) > sessionLastSeenInterval {
+		connectors.Conn(ctx, s.db).Model(&session).UpdateColumn("last_seen_at", time.Now())
+	}
+	return true, nil
+}
+
+// truncate shortens s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/models"
+)
+
+// signIn issues a token pair for the user from the given device and returns
+// it with its session ID
+func signIn(t *testing.T, service *TokenService, user *models.User, userAgent string) (*TokenPair, uint) {
+	t.Helper()
+
+	pair, err := service.IssueTokens(context.Background(), user, SessionInfo{Method: "password", UserAgent: userAgent, IP: "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+	return pair, tokenClaims(t, pair.AccessToken).SessionID
+}
+
+func TestListSessions(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewTokenService(db, cfg)
+	ctx := context.Background()
+	ada := createTestUser(t, db, cfg, "ada@example.com", "user")
+	grace := createTestUser(t, db, cfg, "grace@example.com", "user")
+
+	_, laptop := signIn(t, service, ada, "laptop")
+	_, phone := signIn(t, service, ada, "phone")
+	_, stale := signIn(t, service, ada, "old tablet")
+	_, revoked := signIn(t, service, ada, "lost phone")
+	signIn(t, service, grace, "grace's laptop")
+
+	now := time.Now()
+	db.Model(&models.Session{}).Where("id = ?", laptop).Update("last_seen_at", now.Add(-time.Hour))
+	db.Model(&models.Session{}).Where("id = ?", stale).Update("last_seen_at", now.Add(-cfg.JWT.RefreshTokenTTL-time.Minute))
+	if err := service.RevokeSession(ctx, ada.ID, revoked); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+
+	sessions, err := service.ListSessions(ctx, ada.ID)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	var got []uint
+	for _, session := range sessions {
+		got = append(got, session.ID)
+	}
+	if len(got) != 2 || got[0] != phone || got[1] != laptop {
+		t.Errorf("sessions = %v, want %v; most recent first, without expired, revoked or other users' sessions", got, []uint{phone, laptop})
+	}
+	if sessions[0].UserAgent != "phone" || sessions[0].IP != "192.0.2.1" || sessions[0].Method != "password" {
+		t.Errorf("session = %+v", sessions[0])
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewTokenService(db, cfg)
+	ctx := context.Background()
+	ada := createTestUser(t, db, cfg, "ada@example.com", "user")
+	grace := createTestUser(t, db, cfg, "grace@example.com", "user")
+
+	laptop, laptopID := signIn(t, service, ada, "laptop")
+	phone, phoneID := signIn(t, service, ada, "phone")
+
+	if err := service.RevokeSession(ctx, grace.ID, phoneID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("revoking another user's session: err = %v, want %v", err, ErrSessionNotFound)
+	}
+	if status := authStatus(t, service, phone.AccessToken); status != http.StatusOK {
+		t.Fatalf("status = %d after another user's attempt, want %d", status, http.StatusOK)
+	}
+
+	if err := service.RevokeSession(ctx, ada.ID, phoneID); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	if status := authStatus(t, service, phone.AccessToken); status != http.StatusUnauthorized {
+		t.Errorf("revoked session's access token: status = %d, want %d", status, http.StatusUnauthorized)
+	}
+	if _, _, err := service.Refresh(ctx, phone.RefreshToken, SessionInfo{}); err == nil {
+		t.Error("the revoked session's refresh token still works")
+	}
+	if err := service.RevokeSession(ctx, ada.ID, phoneID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("revoking it again: err = %v, want %v", err, ErrSessionNotFound)
+	}
+
+	if status := authStatus(t, service, laptop.AccessToken); status != http.StatusOK {
+		t.Errorf("other session's access token: status = %d, want %d", status, http.StatusOK)
+	}
+	if _, _, err := service.Refresh(ctx, laptop.RefreshToken, SessionInfo{}); err != nil {
+		t.Errorf("other session's refresh token: %v", err)
+	}
+	if laptopID == phoneID {
+		t.Error("both sign-ins share a session")
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := NewTokenService(db, cfg)
+	ctx := context.Background()
+	ada := createTestUser(t, db, cfg, "ada@example.com", "user")
+	grace := createTestUser(t, db, cfg, "grace@example.com", "user")
+
+	current, currentID := signIn(t, service, ada, "laptop")
+	phone, _ := signIn(t, service, ada, "phone")
+	tablet, _ := signIn(t, service, ada, "tablet")
+	other, _ := signIn(t, service, grace, "grace's laptop")
+
+	count, err := service.RevokeOtherSessions(ctx, ada.ID, currentID)
+	if err != nil {
+		t.Fatalf("RevokeOtherSessions: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("revoked %d sessions, want 2", count)
+	}
+
+	for _, pair := range []*TokenPair{phone, tablet} {
+		if status := authStatus(t, service, pair.AccessToken); status != http.StatusUnauthorized {
+			t.Errorf("revoked session's access token: status = %d, want %d", status, http.StatusUnauthorized)
+		}
+		if _, _, err := service.Refresh(ctx, pair.RefreshToken, SessionInfo{}); err == nil {
+			t.Error("a revoked session's refresh token still works")
+		}
+	}
+	for _, pair := range []*TokenPair{current, other} {
+		if status := authStatus(t, service, pair.AccessToken); status != http.StatusOK {
+			t.Errorf("kept session's access token: status = %d, want %d", status, http.StatusOK)
+		}
+	}
+
+	sessions, err := service.ListSessions(ctx, ada.ID)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != currentID {
+		t.Errorf("%d sessions left, want only the current one", len(sessions))
+	}
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrEmailNotVerified is returned on login when verification is required and still pending
+	ErrEmailNotVerified = errors.New("email address has not been verified")
+	// ErrInvalidVerificationToken is returned for invalid, expired or superseded verification links
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	// ErrEmailTaken is returned when an email address already belongs to another account
+	ErrEmailTaken = errors.New("user with this email already exists")
+	// ErrVerificationResendThrottled is returned when a verification link was re-sent too recently
+	ErrVerificationResendThrottled = errors.New("a verification email was sent recently")
+)
+
+// SendEmailVerification emails a signed verification link for the user's current address
+func (s *UserService) SendEmailVerification(ctx context.Context, user *models.User) error {
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+	return s.sendVerificationLink(ctx, user.ID, user.Email)
+}
+
+// ResendEmailVerification re-sends the verification link for the user's pending
+// address, or for the current address if it is not verified yet. Within the
+// resend interval of the last link it returns ErrVerificationResendThrottled
+// and how long to wait.
+func (s *UserService) ResendEmailVerification(ctx context.Context, id uint) (time.Duration, error) {
+	user, err := s.GetByID(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	email := user.Email
+	if user.PendingEmail != nil {
+		email = *user.PendingEmail
+	} else if user.EmailVerifiedAt != nil {
+		return 0, errors.New("email address is already verified")
+	}
+
+	if wait, err := s.claimVerificationResend(ctx, user.ID); err != nil {
+		return wait, err
+	}
+	return 0, s.sendVerificationLink(ctx, user.ID, email)
+}
+
+// claimVerificationResend records that a verification link is about to be
+// re-sent, unless the last one was sent less than the resend interval ago. The
+// check and the update are one statement, so concurrent resends send one link.
+func (s *UserService) claimVerificationResend(ctx context.Context, id uint) (time.Duration, error) {
+	now := time.Now()
+	result := connectors.Conn(ctx, s.db).Model(&models.User{}).
+		Where("id = ? AND (verification_sent_at IS NULL OR verification_sent_at <= ?)", id, now.Add(-s.emailVerification.ResendInterval)).
+		UpdateColumn("verification_sent_at", now)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return 0, nil
+	}
+
+	var user models.User
+	if err := connectors.Conn(ctx, s.db).Select("id", "verification_sent_at").First(&user, id).Error; err != nil {
+		return 0, err
+	}
+	s.logger.Warn("Verification email resend throttled", map[string]interface{}{
+		"id": id,
+	})
+	return user.VerificationSentAt.Add(s.emailVerification.ResendInterval).Sub(now), ErrVerificationResendThrottled
+}
+
+// RequestEmailChange records newEmail as pending and sends a verification link to
+// it. The user's email only changes once the link is redeemed.
+func (s *UserService) RequestEmailChange(ctx context.Context, id uint, newEmail string) error {
+	s.logger.Info("Requesting email change", map[string]interface{}{
+		"id": id,
+	})
+
+	var count int64
+	if err := connectors.Conn(ctx, s.db).Model(&models.User{}).Where("email = ? AND id <> ?", newEmail, id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrEmailTaken
+	}
+
+	if err := connectors.Conn(ctx, s.db).Model(&models.User{}).Where("id = ?", id).Update("pending_email", newEmail).Error; err != nil {
+		s.logger.Error("Failed to store pending email", err, map[string]interface{}{
+			"id": id,
+		})
+		return err
+	}
+
+	return s.sendVerificationLink(ctx, id, newEmail)
+}
+
+// VerifyEmail redeems a verification link. A link for the current address marks
+// it verified; a link for the pending address makes it the user's email.
+func (s *UserService) VerifyEmail(ctx context.Context, token string) (*models.User, error) {
+	claims, err := middleware.ValidateActionToken(middleware.PurposeEmailVerification, token)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	var user models.User
+	if err := connectors.Conn(ctx, s.db).First(&user, claims.UserID).Error; err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	now := time.Now()
+	switch {
+	case claims.Email == user.Email:
+		if user.EmailVerifiedAt == nil {
+			if err := connectors.Conn(ctx, s.db).Model(&user).Update("email_verified_at", now).Error; err != nil {
+				return nil, err
+			}
+		}
+
+	case user.PendingEmail != nil && claims.Email == *user.PendingEmail:
+		err := connectors.Conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+			var count int64
+			if err := tx.Model(&models.User{}).Where("email = ? AND id <> ?", claims.Email, user.ID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrEmailTaken
+			}
+			return tx.Model(&user).Updates(map[string]interface{}{
+				"email":             claims.Email,
+				"pending_email":     nil,
+				"email_verified_at": now,
+			}).Error
+		})
+		if err != nil {
+			s.logger.Error("Failed to apply email change", err, map[string]interface{}{
+				"id": user.ID,
+			})
+			return nil, err
+		}
+		s.logger.Info("Email change confirmed", map[string]interface{}{
+			"id": user.ID,
+		})
+
+	default:
+		// The link was issued for an address the user no longer has or wants
+		return nil, ErrInvalidVerificationToken
+	}
+
+	return s.GetByID(ctx, user.ID)
+}
+
+// sendVerificationLink signs a verification token for the address, emails it
+// and records when, so resends can be throttled
+func (s *UserService) sendVerificationLink(ctx context.Context, userID uint, email string) error {
+	token, err := middleware.GenerateActionToken(middleware.PurposeEmailVerification, userID, email, s.emailVerification.TTL)
+	if err != nil {
+		s.logger.Error("Failed to generate verification token", err, map[string]interface{}{
+			"id": userID,
+		})
+		return fmt.Errorf("error generating verification token: %v", err)
+	}
+
+	if s.emailSender == nil {
+		s.logger.Warn("Email sender unavailable, verification link not sent", map[string]interface{}{
+			"id": userID,
+		})
+		return nil
+	}
+
+	verifyURL := fmt.Sprintf("%s?token=%s", s.emailVerification.URL, url.QueryEscape(token))
+	if err := s.emailSender.SendEmailVerification(email, verifyURL); err != nil {
+		s.logger.Error("Failed to send verification email", err, map[string]interface{}{
+			"id": userID,
+		})
+		return err
+	}
+	return connectors.Conn(ctx, s.db).Model(&models.User{}).Where("id = ?", userID).
+		UpdateColumn("verification_sent_at", time.Now()).Error
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/testutil"
+)
+
+// newVerificationEnv returns a user service that emails through a fake SMTP
+// server, and the server
+func newVerificationEnv(t *testing.T) (*UserService, *testutil.FakeSMTPServer) {
+	t.Helper()
+
+	db, cfg := newTestEnv(t)
+	smtp := testutil.NewSMTPServer(t)
+	cfg.Email = smtp.EmailConfig()
+	return newUserService(t, db, cfg), smtp
+}
+
+// signUp creates a user through the service, which sends the verification email
+func signUp(t *testing.T, service *UserService, email string) *models.User {
+	t.Helper()
+
+	user, err := service.CreateUser(context.Background(), CreateUserInput{
+		Email: email, Password: testPassword, FirstName: "Ada", LastName: "Lovelace",
+	})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return user
+}
+
+func TestVerifyEmail(t *testing.T) {
+	service, smtp := newVerificationEnv(t)
+	ctx := context.Background()
+	user := signUp(t, service, "ada@example.com")
+	signupToken := linkToken(t, smtp, "verify-email", 1, "ada@example.com")
+
+	expired, _ := middleware.GenerateActionToken(middleware.PurposeEmailVerification, user.ID, user.Email, -time.Minute)
+	magicLink, _ := middleware.GenerateActionToken(middleware.PurposeMagicLink, user.ID, user.Email, time.Minute)
+	otherAddress, _ := middleware.GenerateActionToken(middleware.PurposeEmailVerification, user.ID, "old@example.com", time.Minute)
+	missingUser, _ := middleware.GenerateActionToken(middleware.PurposeEmailVerification, 404, user.Email, time.Minute)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"expired", expired},
+		{"other purpose", magicLink},
+		{"address the user doesn't have", otherAddress},
+		{"missing user", missingUser},
+		{"malformed", "not-a-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.VerifyEmail(ctx, tt.token); !errors.Is(err, ErrInvalidVerificationToken) {
+				t.Errorf("err = %v, want %v", err, ErrInvalidVerificationToken)
+			}
+		})
+	}
+
+	stored, _ := service.GetByID(ctx, user.ID)
+	if stored.EmailVerifiedAt != nil {
+		t.Fatal("the address was verified by an invalid token")
+	}
+
+	verified, err := service.VerifyEmail(ctx, signupToken)
+	if err != nil {
+		t.Fatalf("VerifyEmail with the signup link: %v", err)
+	}
+	if verified.EmailVerifiedAt == nil {
+		t.Error("the address wasn't marked verified")
+	}
+	// Redeeming the link again changes nothing and still succeeds
+	if _, err := service.VerifyEmail(ctx, signupToken); err != nil {
+		t.Errorf("VerifyEmail again: %v", err)
+	}
+}
+
+func TestEmailChange(t *testing.T) {
+	service, smtp := newVerificationEnv(t)
+	ctx := context.Background()
+	user := signUp(t, service, "ada@example.com")
+	oldToken := linkToken(t, smtp, "verify-email", 1, "ada@example.com")
+	signUp(t, service, "grace@example.com")
+
+	if err := service.RequestEmailChange(ctx, user.ID, "grace@example.com"); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("changing to a taken address: err = %v, want %v", err, ErrEmailTaken)
+	}
+
+	if err := service.RequestEmailChange(ctx, user.ID, "augusta@example.com"); err != nil {
+		t.Fatalf("RequestEmailChange: %v", err)
+	}
+	pending, _ := service.GetByID(ctx, user.ID)
+	if pending.Email != "ada@example.com" || pending.PendingEmail == nil || *pending.PendingEmail != "augusta@example.com" {
+		t.Fatalf("email %q, pending %v; the change must wait for verification", pending.Email, pending.PendingEmail)
+	}
+
+	changed, err := service.VerifyEmail(ctx, linkToken(t, smtp, "verify-email", 3, "augusta@example.com"))
+	if err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	if changed.Email != "augusta@example.com" || changed.PendingEmail != nil || changed.EmailVerifiedAt == nil {
+		t.Errorf("email %q, pending %v, verified %v after confirming", changed.Email, changed.PendingEmail, changed.EmailVerifiedAt)
+	}
+
+	// The link for the address the user left no longer works
+	if _, err := service.VerifyEmail(ctx, oldToken); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("old address's link: err = %v, want %v", err, ErrInvalidVerificationToken)
+	}
+}
+
+func TestResendEmailVerification(t *testing.T) {
+	service, smtp := newVerificationEnv(t)
+	ctx := context.Background()
+	user := signUp(t, service, "ada@example.com")
+	smtp.WaitForEmails(t, 1)
+
+	// The signup email counts as the last one sent
+	wait, err := service.ResendEmailVerification(ctx, user.ID)
+	if !errors.Is(err, ErrVerificationResendThrottled) {
+		t.Fatalf("resending right after signup: err = %v, want %v", err, ErrVerificationResendThrottled)
+	}
+	if wait <= 0 || wait > service.emailVerification.ResendInterval {
+		t.Errorf("wait = %v, want at most %v", wait, service.emailVerification.ResendInterval)
+	}
+
+	// Once the interval has passed
+	service.db.Model(&models.User{}).Where("id = ?", user.ID).
+		Update("verification_sent_at", time.Now().Add(-service.emailVerification.ResendInterval))
+	if _, err := service.ResendEmailVerification(ctx, user.ID); err != nil {
+		t.Fatalf("ResendEmailVerification: %v", err)
+	}
+	token := linkToken(t, smtp, "verify-email", 2, "ada@example.com")
+	if _, err := service.ResendEmailVerification(ctx, user.ID); !errors.Is(err, ErrVerificationResendThrottled) {
+		t.Errorf("resending twice: err = %v, want %v", err, ErrVerificationResendThrottled)
+	}
+
+	// The re-sent link works, after which there is nothing left to verify
+	if _, err := service.VerifyEmail(ctx, token); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	service.db.Model(&models.User{}).Where("id = ?", user.ID).Update("verification_sent_at", nil)
+	if _, err := service.ResendEmailVerification(ctx, user.ID); err == nil || errors.Is(err, ErrVerificationResendThrottled) {
+		t.Errorf("resending for a verified address: err = %v, want already verified", err)
+	}
+	if emails := smtp.Emails(); len(emails) != 2 {
+		t.Errorf("%d emails sent, want the signup email and one resend", len(emails))
+	}
+}
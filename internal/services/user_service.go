@@ -1,70 +1,81 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"os"
-	"strconv"
+	"sync"
+	"time"
 	"unicode"
 
+	"github.com/cam-boltnote/go-ignite/internal/config"
 	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
 	"github.com/cam-boltnote/go-ignite/internal/models"
 	"github.com/cam-boltnote/go-ignite/internal/utils"
 
 	"gorm.io/gorm"
 )
 
-// getPasswordLengthConfig loads password length configuration from environment variables
-// with fallback default values
-func getPasswordLengthConfig() (min, max int) {
-	min = 8  // default minimum
-	max = 72 // default maximum
+// newPasswordHasher builds the password hasher. New hashes use the configured
+// algorithm; hashes produced by the other supported algorithm still verify and
+// are upgraded on next login.
+func newPasswordHasher(cfg config.PasswordConfig) utils.PasswordHasher {
+	argon2idHasher := utils.NewArgon2idHasher(cfg.Argon2Memory, cfg.Argon2Iterations, cfg.Argon2Parallelism)
+	bcryptHasher := utils.NewBcryptHasher(cfg.BcryptCost)
 
-	if minStr := os.Getenv("PASSWORD_MIN_LENGTH"); minStr != "" {
-		if val, err := strconv.Atoi(minStr); err == nil {
-			min = val
-		}
-	}
-
-	if maxStr := os.Getenv("PASSWORD_MAX_LENGTH"); maxStr != "" {
-		if val, err := strconv.Atoi(maxStr); err == nil {
-			max = val
-		}
+	if cfg.HashAlgorithm == utils.BcryptAlgorithm {
+		return utils.NewMultiHasher(bcryptHasher, argon2idHasher)
 	}
-
-	return min, max
+	return utils.NewMultiHasher(argon2idHasher, bcryptHasher)
 }
 
+var (
+	// ErrInvalidCredentials is returned when an email/password combination does not match
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrAccountInactive is returned when a deactivated user tries to authenticate
+	ErrAccountInactive = errors.New("account is deactivated")
+	// ErrPasswordlessOnly is returned on password login for an account that opted into magic links only
+	ErrPasswordlessOnly = errors.New("this account signs in with email links only")
+)
+
 // UserService handles user-related database operations and business logic
 type UserService struct {
-	db              *gorm.DB
-	settingsService *SettingsService
-	minPassLength   int
-	maxPassLength   int
-	emailSender     *connectors.EmailSender
-	logger          *utils.Logger
+	db                *gorm.DB
+	settingsService   *SettingsService
+	tokenService      *TokenService
+	audit             *AuditService
+	passLengthMu      sync.RWMutex // Guards the length limits, which change on config reload
+	minPassLength     int
+	maxPassLength     int
+	hasher            utils.PasswordHasher
+	dummyHashOnce     sync.Once
+	dummyHash         string // Verified for unknown emails; see ValidateCredentials
+	emailVerification config.EmailVerificationConfig
+	adminEmail        string
+	emailSender       *connectors.EmailSender
+	outbox            *OutboxService
+	cursors           *cursorSigner
+	logger            *utils.Logger
 }
 
-// NewUserService creates a new user service instance
-func NewUserService(db *gorm.DB) *UserService {
-	minLength, maxLength := getPasswordLengthConfig()
-
-	// Initialize logger
-	logger := utils.GetLogger().WithService("user_service")
-
-	// Initialize email sender
-	emailSender, err := connectors.NewEmailSender()
-	if err != nil {
-		logger.Error("Failed to initialize email sender", err, nil)
-	}
-
+// NewUserService creates a new user service instance that emails through
+// emailSender, which may be nil when email is disabled
+func NewUserService(db *gorm.DB, emailSender *connectors.EmailSender, settingsService *SettingsService, tokenService *TokenService, audit *AuditService, cfg *config.Config) *UserService {
 	return &UserService{
-		db:              db,
-		settingsService: NewSettingsService(db),
-		minPassLength:   minLength,
-		maxPassLength:   maxLength,
-		emailSender:     emailSender,
-		logger:          logger,
+		db:                db,
+		settingsService:   settingsService,
+		tokenService:      tokenService,
+		audit:             audit,
+		minPassLength:     cfg.Password.MinLength,
+		maxPassLength:     cfg.Password.MaxLength,
+		hasher:            newPasswordHasher(cfg.Password),
+		emailVerification: cfg.EmailVerification,
+		adminEmail:        cfg.Email.AdminNotificationEmail,
+		emailSender:       emailSender,
+		outbox:            NewOutboxService(db, emailSender),
+		cursors:           newCursorSigner(cfg.Security),
+		logger:            utils.GetLogger().WithService("user_service"),
 	}
 }
 
@@ -74,16 +85,27 @@ type CreateUserInput struct {
 	Password  string `json:"password" binding:"required,min=8"`
 	FirstName string `json:"firstName" binding:"required"`
 	LastName  string `json:"lastName" binding:"required"`
-	Role      string `json:"role,omitempty"`
+}
+
+// ApplyConfig applies a reloaded configuration's password length limits
+func (s *UserService) ApplyConfig(cfg *config.Config) {
+	s.passLengthMu.Lock()
+	defer s.passLengthMu.Unlock()
+	s.minPassLength = cfg.Password.MinLength
+	s.maxPassLength = cfg.Password.MaxLength
 }
 
 // validatePassword validates password strength requirements
 func (s *UserService) validatePassword(password string) error {
-	if len(password) < s.minPassLength {
-		return fmt.Errorf("password must be at least %d characters long", s.minPassLength)
+	s.passLengthMu.RLock()
+	minLength, maxLength := s.minPassLength, s.maxPassLength
+	s.passLengthMu.RUnlock()
+
+	if len(password) < minLength {
+		return fmt.Errorf("password must be at least %d characters long", minLength)
 	}
-	if len(password) > s.maxPassLength {
-		return fmt.Errorf("password must not exceed %d characters", s.maxPassLength)
+	if len(password) > maxLength {
+		return fmt.Errorf("password must not exceed %d characters", maxLength)
 	}
 
 	// Check for at least one number
@@ -114,18 +136,18 @@ func (s *UserService) validatePassword(password string) error {
 }
 
 // CreateUser creates a new user
-func (s *UserService) CreateUser(input CreateUserInput) (*models.User, error) {
+func (s *UserService) CreateUser(ctx context.Context, input CreateUserInput) (*models.User, error) {
 	s.logger.Info("Creating new user", map[string]interface{}{
 		"email": input.Email,
 	})
 
 	// Check if user already exists
-	existingUser, _ := s.GetByEmail(input.Email)
+	existingUser, _ := s.GetByEmail(ctx, input.Email)
 	if existingUser != nil {
 		s.logger.Warn("User already exists", map[string]interface{}{
 			"email": input.Email,
 		})
-		return nil, errors.New("user with this email already exists")
+		return nil, ErrEmailTaken
 	}
 
 	// Validate password
@@ -136,124 +158,120 @@ func (s *UserService) CreateUser(input CreateUserInput) (*models.User, error) {
 		return nil, fmt.Errorf("invalid password: %v", err)
 	}
 
-	// Create user with default role if not specified
-	if input.Role == "" {
-		input.Role = "user"
+	hashedPassword, err := s.hasher.Hash(input.Password)
+	if err != nil {
+		s.logger.Error("Failed to hash password", err, nil)
+		return nil, fmt.Errorf("error hashing password: %v", err)
 	}
 
-	user := &models.User{
-		Email:     input.Email,
-		Password:  input.Password, // Note: Password should be hashed before storage
-		FirstName: input.FirstName,
-		LastName:  input.LastName,
-		Role:      input.Role,
-		IsActive:  true,
+	return s.createUser(ctx, input, hashedPassword, nil)
+}
+
+// CreateExternalUser creates a user whose identity and email address were
+// verified by an external identity provider. The account gets a random password
+// that nobody knows; one can be set later through the password reset flow.
+func (s *UserService) CreateExternalUser(ctx context.Context, email, firstName, lastName string) (*models.User, error) {
+	s.logger.Info("Creating new user from external identity", map[string]interface{}{
+		"email": email,
+	})
+
+	if existingUser, _ := s.GetByEmail(ctx, email); existingUser != nil {
+		return nil, ErrEmailTaken
 	}
 
-	if err := s.db.Create(user).Error; err != nil {
-		s.logger.Error("Failed to create user", err, map[string]interface{}{
-			"email": input.Email,
-		})
-		return nil, fmt.Errorf("error creating user: %v", err)
+	hashedPassword, err := s.unusablePasswordHash()
+	if err != nil {
+		return nil, err
 	}
 
-	// Create default settings for the new user
-	if err := s.settingsService.CreateDefaultSettings(user.ID); err != nil {
-		s.logger.Error("Failed to create default settings", err, map[string]interface{}{
-			"user_id": user.ID,
-		})
-		// If settings creation fails, we should probably delete the user
-		s.Delete(user.ID)
-		return nil, fmt.Errorf("error creating default settings: %v", err)
+	verifiedAt := time.Now()
+	return s.createUser(ctx, CreateUserInput{
+		Email:     email,
+		FirstName: firstName,
+		LastName:  lastName,
+	}, hashedPassword, &verifiedAt)
+}
+
+// unusablePasswordHash hashes a random password so that an account can't be
+// signed into with a password until the owner sets one
+func (s *UserService) unusablePasswordHash() (string, error) {
+	password, err := generateOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password: %v", err)
 	}
+	return hashedPassword, nil
+}
 
-	// Send welcome email to the user
-	if s.emailSender != nil {
-		s.logger.Info("Sending welcome email", map[string]interface{}{
-			"email": user.Email,
-		})
-		welcomeSubject := "Welcome to boltnote.ai!"
-		welcomeBody := fmt.Sprintf(`
-			<html>
-			<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
-				<div style="max-width: 600px; margin: 0 auto; padding: 20px;">
-					<h2 style="color: #2c3e50;">Welcome to boltnote.ai, %s!</h2>
-					<p>Thank you for joining us. We're excited to help you track and organize your activities.</p>
-					<p>Get started by creating your first entry!</p>
-					<p style="margin: 25px 0;">
-						<a href="https://app.boltnote.ai" style="background-color: #3498db; color: white; padding: 12px 25px; text-decoration: none; border-radius: 4px;">Start Using Boltnote</a>
-					</p>
-					<p>If you have any questions, feel free to reach out to our support team.</p>
-				</div>
-			</body>
-			</html>
-		`, input.FirstName)
-
-		if err := s.emailSender.SendEmail(user.Email, welcomeSubject, welcomeBody); err != nil {
-			// Log the error but don't fail the user creation
-			s.logger.Error("Failed to send welcome email", err, map[string]interface{}{
-				"email": user.Email,
-			})
-		}
+// claimUnverifiedAccount marks the email verified, replaces the password and
+// signs out every existing session of an account whose address was never
+// verified. It is used when the owner of the address proves it some other way,
+// since whoever set the password never did.
+func (s *UserService) claimUnverifiedAccount(ctx context.Context, user *models.User, method string) error {
+	hashedPassword, err := s.unusablePasswordHash()
+	if err != nil {
+		return err
+	}
 
-		// Send notification to admin
-		adminEmail := os.Getenv("ADMIN_NOTIFICATION_EMAIL")
-		if adminEmail == "" {
-			s.logger.Warn("ADMIN_NOTIFICATION_EMAIL not set in environment", map[string]interface{}{
-				"fallback": "cam@boltnote.ai",
-			})
-			adminEmail = "cam@boltnote.ai" // fallback value
+	err = connectors.WithTransaction(ctx, s.db, func(ctx context.Context) error {
+		if err := connectors.Conn(ctx, s.db).Model(user).Updates(map[string]interface{}{
+			"email_verified_at": time.Now(),
+			"password":          hashedPassword,
+		}).Error; err != nil {
+			return err
 		}
+		return s.tokenService.RevokeAllForUser(ctx, user.ID)
+	})
+	if err != nil {
+		return err
+	}
 
-		// Add debug logging
-		s.logger.Info("User details for admin email", map[string]interface{}{
-			"firstName": user.FirstName,
-			"lastName":  user.LastName,
-			"email":     user.Email,
-			"id":        user.ID,
-			"createdAt": user.CreatedAt.Format("2006-01-02 15:04:05"),
-		})
+	s.logger.Warn("Reset credentials of unverified account claimed by the email owner", map[string]interface{}{
+		"user_id": user.ID,
+		"method":  method,
+	})
+	return nil
+}
 
-		adminSubject := fmt.Sprintf("New User Signup: %s %s", input.FirstName, input.LastName)
-		adminBody := fmt.Sprintf(`
-			<html>
-			<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
-				<div style="max-width: 600px; margin: 0 auto; padding: 20px; background-color: #f9f9f9; border-radius: 8px;">
-					<h2 style="color: #2c3e50; margin-bottom: 20px;">New User Registration</h2>
-					<div style="background-color: white; padding: 20px; border-radius: 4px; box-shadow: 0 2px 4px rgba(0,0,0,0.1);">
-						<table style="width: 100%%; border-collapse: collapse;">
-							<tr>
-								<td style="padding: 10px 0; border-bottom: 1px solid #eee;"><strong>Name:</strong></td>
-								<td style="padding: 10px 0; border-bottom: 1px solid #eee;">%[1]s %[2]s</td>
-							</tr>
-							<tr>
-								<td style="padding: 10px 0; border-bottom: 1px solid #eee;"><strong>Email:</strong></td>
-								<td style="padding: 10px 0; border-bottom: 1px solid #eee;">%[3]s</td>
-							</tr>
-							<tr>
-								<td style="padding: 10px 0; border-bottom: 1px solid #eee;"><strong>User ID:</strong></td>
-								<td style="padding: 10px 0; border-bottom: 1px solid #eee;">%[4]d</td>
-							</tr>
-							<tr>
-								<td style="padding: 10px 0;"><strong>Signup Time:</strong></td>
-								<td style="padding: 10px 0;">%[5]s</td>
-							</tr>
-						</table>
-					</div>
-					<div style="margin-top: 20px; text-align: center;">
-						<a href="https://admin.boltnote.ai/users/%[4]d" style="background-color: #3498db; color: white; padding: 12px 25px; text-decoration: none; border-radius: 4px; display: inline-block;">View User Details</a>
-					</div>
-				</div>
-			</body>
-			</html>
-		`, user.FirstName, user.LastName, user.Email, user.ID, user.CreatedAt.Format("2006-01-02 15:04:05"))
-
-		if err := s.emailSender.SendEmail(adminEmail, adminSubject, adminBody); err != nil {
-			// Log the error but don't fail the user creation
-			s.logger.Error("Failed to send admin notification", err, map[string]interface{}{
-				"email": adminEmail,
-			})
+// createUser stores a new user with default settings and queues the signup
+// emails in one transaction, so none of it is kept if any step fails, then
+// sends the verification email
+func (s *UserService) createUser(ctx context.Context, input CreateUserInput, hashedPassword string, emailVerifiedAt *time.Time) (*models.User, error) {
+	user := &models.User{
+		Email:           input.Email,
+		Password:        hashedPassword,
+		FirstName:       input.FirstName,
+		LastName:        input.LastName,
+		Role:            middleware.RoleUser, // Other roles are only granted through UpdateRole
+		IsActive:        true,
+		EmailVerifiedAt: emailVerifiedAt,
+	}
+
+	err := connectors.WithTransaction(ctx, s.db, func(ctx context.Context) error {
+		if err := connectors.Conn(ctx, s.db).Create(user).Error; err != nil {
+			return fmt.Errorf("error creating user: %v", err)
 		}
+		if err := s.settingsService.CreateDefaultSettings(ctx, user.ID); err != nil {
+			return fmt.Errorf("error creating default settings: %v", err)
+		}
+		return s.enqueueSignupEmails(ctx, user)
+	})
+	if err != nil {
+		s.logger.Error("Failed to create user", err, map[string]interface{}{
+			"email": input.Email,
+		})
+		return nil, err
+	}
+
+	// Ask the user to confirm their address
+	if err := s.SendEmailVerification(ctx, user); err != nil {
+		// Log the error but don't fail the user creation; the link can be re-sent
+		s.logger.Error("Failed to send verification email", err, map[string]interface{}{
+			"email": user.Email,
+		})
 	}
 
 	// Don't return the password
@@ -261,14 +279,85 @@ func (s *UserService) CreateUser(input CreateUserInput) (*models.User, error) {
 	return user, nil
 }
 
+// enqueueSignupEmails queues the welcome email to a new user and the signup
+// notification to the admin in the outbox, within the ambient transaction
+func (s *UserService) enqueueSignupEmails(ctx context.Context, user *models.User) error {
+	if !s.emailSender.IsEnabled() {
+		return nil
+	}
+
+	welcomeSubject := "Welcome to boltnote.ai!"
+	welcomeBody := fmt.Sprintf(`
+		<html>
+		<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+			<div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+				<h2 style="color: #2c3e50;">Welcome to boltnote.ai, %s!</h2>
+				<p>Thank you for joining us. We're excited to help you track and organize your activities.</p>
+				<p>Get started by creating your first entry!</p>
+				<p style="margin: 25px 0;">
+					<a href="https://app.boltnote.ai" style="background-color: #3498db; color: white; padding: 12px 25px; text-decoration: none; border-radius: 4px;">Start Using Boltnote</a>
+				</p>
+				<p>If you have any questions, feel free to reach out to our support team.</p>
+			</div>
+		</body>
+		</html>
+	`, user.FirstName)
+
+	if err := s.outbox.EnqueueEmail(ctx, user.Email, welcomeSubject, welcomeBody); err != nil {
+		return fmt.Errorf("error queueing welcome email: %v", err)
+	}
+
+	if s.adminEmail == "" {
+		return nil
+	}
+	adminSubject := fmt.Sprintf("New User Signup: %s %s", user.FirstName, user.LastName)
+	adminBody := fmt.Sprintf(`
+		<html>
+		<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+			<div style="max-width: 600px; margin: 0 auto; padding: 20px; background-color: #f9f9f9; border-radius: 8px;">
+				<h2 style="color: #2c3e50; margin-bottom: 20px;">New User Registration</h2>
+				<div style="background-color: white; padding: 20px; border-radius: 4px; box-shadow: 0 2px 4px rgba(0,0,0,0.1);">
+					<table style="width: 100%%; border-collapse: collapse;">
+						<tr>
+							<td style="padding: 10px 0; border-bottom: 1px solid #eee;"><strong>Name:</strong></td>
+							<td style="padding: 10px 0; border-bottom: 1px solid #eee;">%[1]s %[2]s</td>
+						</tr>
+						<tr>
+							<td style="padding: 10px 0; border-bottom: 1px solid #eee;"><strong>Email:</strong></td>
+							<td style="padding: 10px 0; border-bottom: 1px solid #eee;">%[3]s</td>
+						</tr>
+						<tr>
+							<td style="padding: 10px 0; border-bottom: 1px solid #eee;"><strong>User ID:</strong></td>
+							<td style="padding: 10px 0; border-bottom: 1px solid #eee;">%[4]d</td>
+						</tr>
+						<tr>
+							<td style="padding: 10px 0;"><strong>Signup Time:</strong></td>
+							<td style="padding: 10px 0;">%[5]s</td>
+						</tr>
+					</table>
+				</div>
+				<div style="margin-top: 20px; text-align: center;">
+					<a href="https://admin.boltnote.ai/users/%[4]d" style="background-color: #3498db; color: white; padding: 12px 25px; text-decoration: none; border-radius: 4px; display: inline-block;">View User Details</a>
+				</div>
+			</div>
+		</body>
+		</html>
+	`, user.FirstName, user.LastName, user.Email, user.ID, user.CreatedAt.Format("2006-01-02 15:04:05"))
+
+	if err := s.outbox.EnqueueEmail(ctx, s.adminEmail, adminSubject, adminBody); err != nil {
+		return fmt.Errorf("error queueing admin notification: %v", err)
+	}
+	return nil
+}
+
 // GetByID retrieves a user by their ID
-func (s *UserService) GetByID(id uint) (*models.User, error) {
+func (s *UserService) GetByID(ctx context.Context, id uint) (*models.User, error) {
 	s.logger.Debug("Fetching user by ID", map[string]interface{}{
 		"id": id,
 	})
 
 	var user models.User
-	result := s.db.First(&user, id)
+	result := connectors.Conn(ctx, s.db).First(&user, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			s.logger.Warn("User not found", map[string]interface{}{
@@ -285,14 +374,26 @@ func (s *UserService) GetByID(id uint) (*models.User, error) {
 	return &user, nil
 }
 
+// UserRole returns the user's role, for middleware.RequireLowerRole
+func (s *UserService) UserRole(ctx context.Context, id uint) (string, error) {
+	var user models.User
+	if err := connectors.Conn(ctx, s.db).Select("id", "role").First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", middleware.ErrUserNotFound
+		}
+		return "", err
+	}
+	return user.Role, nil
+}
+
 // GetByEmail retrieves a user by their email
-func (s *UserService) GetByEmail(email string) (*models.User, error) {
+func (s *UserService) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	s.logger.Debug("Fetching user by email", map[string]interface{}{
 		"email": email,
 	})
 
 	var user models.User
-	result := s.db.Where("email = ?", email).First(&user)
+	result := connectors.Conn(ctx, s.db).Where("email = ?", email).First(&user)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			s.logger.Warn("User not found", map[string]interface{}{
@@ -309,61 +410,89 @@ func (s *UserService) GetByEmail(email string) (*models.User, error) {
 	return &user, nil
 }
 
-// Update updates an existing user
-func (s *UserService) Update(user *models.User) error {
+// Update updates an existing user. A changed email address is not applied
+// directly; it becomes pending until the new address is verified.
+func (s *UserService) Update(ctx context.Context, user *models.User) error {
 	s.logger.Info("Updating user", map[string]interface{}{
 		"id":    user.ID,
 		"email": user.Email,
 	})
 
-	err := s.db.Save(user).Error
+	existing, err := s.GetByID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	requestedEmail := user.Email
+
+	// Fields that are managed by dedicated flows keep their stored values
+	user.CreatedAt = existing.CreatedAt
+	user.IsActive = existing.IsActive
+	user.Role = existing.Role
+	user.Email = existing.Email
+	user.EmailVerifiedAt = existing.EmailVerifiedAt
+	user.PendingEmail = existing.PendingEmail
+	user.TokensRevokedAt = existing.TokensRevokedAt
+	user.MFAEnabled = existing.MFAEnabled
+
+	// Passwords and MFA secrets are only changed through their own flows
+	err = connectors.Conn(ctx, s.db).Omit("password", "mfa_secret", "mfa_last_used_step").Save(user).Error
 	if err != nil {
 		s.logger.Error("Failed to update user", err, map[string]interface{}{
 			"id":    user.ID,
 			"email": user.Email,
 		})
+		return err
+	}
+
+	if requestedEmail != "" && requestedEmail != existing.Email {
+		if err := s.RequestEmailChange(ctx, user.ID, requestedEmail); err != nil {
+			return err
+		}
+		user.PendingEmail = &requestedEmail
 	}
-	return err
+
+	s.audit.Record(ctx, models.AuditUserUpdate, "user", user.ID, existing, user)
+	return nil
 }
 
 // Delete deletes a user
-func (s *UserService) Delete(id uint) error {
+func (s *UserService) Delete(ctx context.Context, id uint) error {
 	s.logger.Info("Deleting user", map[string]interface{}{
 		"id": id,
 	})
 
-	// Start a transaction since we're updating multiple tables
-	tx := s.db.Begin()
-	if tx.Error != nil {
-		s.logger.Error("Failed to begin transaction", tx.Error, nil)
-		return fmt.Errorf("failed to begin transaction: %v", tx.Error)
-	}
+	// Kept for the audit log; deleting a user that doesn't exist records nothing
+	before, _ := s.GetByID(ctx, id)
 
-	// First, soft delete the settings due to foreign key constraints
-	if err := tx.Where("user_id = ?", id).Delete(&models.Settings{}).Error; err != nil {
-		tx.Rollback()
-		s.logger.Error("Failed to delete settings", err, map[string]interface{}{
-			"user_id": id,
-		})
-		return fmt.Errorf("failed to delete settings: %v", err)
-	}
+	err := connectors.WithTransaction(ctx, s.db, func(ctx context.Context) error {
+		tx := connectors.Conn(ctx, s.db)
 
-	// Then soft delete the user
-	if err := tx.Delete(&models.User{}, id).Error; err != nil {
-		tx.Rollback()
-		s.logger.Error("Failed to delete user", err, map[string]interface{}{
-			"id": id,
-		})
-		return fmt.Errorf("failed to delete user: %v", err)
-	}
+		// First, soft delete the settings due to foreign key constraints
+		if err := tx.Where("user_id = ?", id).Delete(&models.Settings{}).Error; err != nil {
+			return fmt.Errorf("failed to delete settings: %v", err)
+		}
+
+		// Then soft delete the user
+		if err := tx.Delete(&models.User{}, id).Error; err != nil {
+			return fmt.Errorf("failed to delete user: %v", err)
+		}
+
+		// Refresh tokens of a deleted user must not be usable anymore
+		if err := s.tokenService.RevokeAllForUser(ctx, id); err != nil {
+			return fmt.Errorf("failed to revoke tokens: %v", err)
+		}
 
-	// Commit the transaction
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		s.logger.Error("Failed to commit transaction", err, map[string]interface{}{
+		if before != nil {
+			s.audit.Record(ctx, models.AuditUserDelete, "user", id, before, nil)
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("Failed to delete user", err, map[string]interface{}{
 			"id": id,
 		})
-		return fmt.Errorf("failed to commit transaction: %v", err)
+		return err
 	}
 
 	s.logger.Info("Successfully deleted user", map[string]interface{}{
@@ -372,59 +501,250 @@ func (s *UserService) Delete(id uint) error {
 	return nil
 }
 
-// List retrieves a list of users with pagination
-func (s *UserService) List(page, pageSize int) ([]models.User, int64, error) {
-	var users []models.User
-	var total int64
+// List retrieves a page of users filtered, searched and sorted as the query
+// says, by page number or by cursor; see models.User.QueryFields for the
+// fields it may use
+func (s *UserService) List(ctx context.Context, query ListQuery) (*models.PaginatedResponse, error) {
+	users, page, err := findPage[models.User](connectors.Conn(ctx, s.db), query, s.cursors)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clear passwords from response
+	for i := range users {
+		users[i].Password = ""
+	}
+
+	return page, nil
+}
+
+// UpdatePassword validates and hashes a new plaintext password and stores it
+func (s *UserService) UpdatePassword(ctx context.Context, id uint, password string) error {
+	s.logger.Info("Updating password", map[string]interface{}{
+		"id": id,
+	})
 
-	offset := (page - 1) * pageSize
-	err := s.db.Model(&models.User{}).Count(&total).Error
+	if err := s.validatePassword(password); err != nil {
+		s.logger.Warn("Invalid password", map[string]interface{}{
+			"id":    id,
+			"error": err.Error(),
+		})
+		return fmt.Errorf("invalid password: %v", err)
+	}
+
+	hashedPassword, err := s.hasher.Hash(password)
 	if err != nil {
-		return nil, 0, err
+		s.logger.Error("Failed to hash password", err, map[string]interface{}{
+			"id": id,
+		})
+		return fmt.Errorf("error hashing password: %v", err)
 	}
 
-	err = s.db.Offset(offset).Limit(pageSize).Find(&users).Error
+	return connectors.WithTransaction(ctx, s.db, func(ctx context.Context) error {
+		result := connectors.Conn(ctx, s.db).Model(&models.User{}).Where("id = ?", id).Update("password", hashedPassword)
+		if result.Error != nil {
+			s.logger.Error("Failed to update password", result.Error, map[string]interface{}{
+				"id": id,
+			})
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("user not found")
+		}
+
+		// The password itself is never recorded, only that it changed
+		s.audit.Record(ctx, models.AuditUserPasswordChange, "user", id, nil, nil)
+
+		// A password change signs the user out everywhere
+		return s.tokenService.RevokeAllForUser(ctx, id)
+	})
+}
+
+// ChangePassword verifies the current password before replacing it with a new one
+func (s *UserService) ChangePassword(ctx context.Context, id uint, currentPassword, newPassword string) error {
+	user, err := s.getWithPassword(ctx, "id = ?", id)
 	if err != nil {
-		return nil, 0, err
+		return err
 	}
 
-	// Clear passwords from response
-	for i := range users {
-		users[i].Password = ""
+	if err := s.verifyPassword(ctx, user, currentPassword); err != nil {
+		return err
 	}
 
-	return users, total, nil
+	return s.UpdatePassword(ctx, id, newPassword)
 }
 
-// UpdatePassword updates a user's password
-func (s *UserService) UpdatePassword(id uint, hashedPassword string) error {
-	return s.db.Model(&models.User{}).Where("id = ?", id).Update("password", hashedPassword).Error
+// UpdateRole changes a user's role and revokes their tokens so the change applies immediately
+func (s *UserService) UpdateRole(ctx context.Context, id uint, role string) error {
+	s.logger.Info("Updating user role", map[string]interface{}{
+		"id":   id,
+		"role": role,
+	})
+
+	if !middleware.IsKnownRole(role) {
+		return fmt.Errorf("unknown role: %s", role)
+	}
+
+	err := connectors.WithTransaction(ctx, s.db, func(ctx context.Context) error {
+		err := s.auditChange(ctx, models.AuditUserRoleChange, id, func(user *gorm.DB) error {
+			return user.Update("role", role).Error
+		})
+		if err != nil {
+			return err
+		}
+		return s.tokenService.RevokeAllForUser(ctx, id)
+	})
+	if err != nil {
+		s.logger.Error("Failed to update user role", err, map[string]interface{}{
+			"id": id,
+		})
+		return err
+	}
+	return nil
 }
 
-// Deactivate deactivates a user account
-func (s *UserService) Deactivate(id uint) error {
-	return s.db.Model(&models.User{}).Where("id = ?", id).Update("is_active", false).Error
+// Deactivate deactivates a user account and revokes its outstanding tokens
+func (s *UserService) Deactivate(ctx context.Context, id uint) error {
+	return connectors.WithTransaction(ctx, s.db, func(ctx context.Context) error {
+		err := s.auditChange(ctx, models.AuditUserDeactivate, id, func(user *gorm.DB) error {
+			return user.Update("is_active", false).Error
+		})
+		if err != nil {
+			return err
+		}
+		return s.tokenService.RevokeAllForUser(ctx, id)
+	})
 }
 
 // Activate activates a user account
-func (s *UserService) Activate(id uint) error {
-	return s.db.Model(&models.User{}).Where("id = ?", id).Update("is_active", true).Error
+func (s *UserService) Activate(ctx context.Context, id uint) error {
+	return s.auditChange(ctx, models.AuditUserActivate, id, func(user *gorm.DB) error {
+		return user.Update("is_active", true).Error
+	})
 }
 
-// ValidateCredentials validates user credentials
-func (s *UserService) ValidateCredentials(email, password string) (*models.User, error) {
-	user, err := s.GetByEmail(email)
+// auditChange applies a change to an existing user, given a query scoped to
+// the user, and records how the user differs afterwards
+func (s *UserService) auditChange(ctx context.Context, action string, id uint, change func(user *gorm.DB) error) error {
+	var before models.User
+	if err := connectors.Conn(ctx, s.db).First(&before, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("user not found")
+		}
+		return err
+	}
+
+	if err := change(connectors.Conn(ctx, s.db).Model(&models.User{}).Where("id = ?", id)); err != nil {
+		return err
+	}
+
+	var after models.User
+	if err := connectors.Conn(ctx, s.db).First(&after, id).Error; err != nil {
+		return err
+	}
+	s.audit.Record(ctx, action, "user", id, &before, &after)
+	return nil
+}
+
+// ValidateCredentials validates user credentials, upgrading the stored hash
+// if it was produced with outdated parameters
+func (s *UserService) ValidateCredentials(ctx context.Context, email, password string) (*models.User, error) {
+	user, err := s.getWithPassword(ctx, "email = ?", email)
 	if err != nil {
+		// Spend as long as a wrong password would, so response times don't
+		// reveal which email addresses have accounts
+		s.hasher.Verify(password, s.getDummyHash())
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := s.verifyPassword(ctx, user, password); err != nil {
 		return nil, err
 	}
 
-	// Note: This is a placeholder. In a real application, you would:
-	// 1. Hash the provided password
-	// 2. Compare it with the stored hash
-	// 3. Return appropriate errors
-	if user.Password != password {
-		return nil, errors.New("invalid credentials")
+	if !user.IsActive {
+		return nil, ErrAccountInactive
+	}
+
+	if s.emailVerification.Required && user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
 	}
 
+	var settings models.Settings
+	if err := connectors.Conn(ctx, s.db).Select("passwordless_only").Where("user_id = ?", user.ID).Limit(1).Find(&settings).Error; err != nil {
+		return nil, err
+	}
+	if settings.PasswordlessOnly {
+		return nil, ErrPasswordlessOnly
+	}
+
+	user.Password = "" // Don't return the password
 	return user, nil
 }
+
+// getDummyHash returns a hash of a random password made with the current
+// parameters, so verifying against it costs what verifying a real hash does
+func (s *UserService) getDummyHash() string {
+	s.dummyHashOnce.Do(func() {
+		hash, err := s.unusablePasswordHash()
+		if err != nil {
+			s.logger.Error("Failed to create dummy password hash", err, nil)
+			return
+		}
+		s.dummyHash = hash
+	})
+	return s.dummyHash
+}
+
+// getWithPassword loads a single user including the stored password hash
+func (s *UserService) getWithPassword(ctx context.Context, query string, args ...interface{}) (*models.User, error) {
+	var user models.User
+	result := connectors.Conn(ctx, s.db).Where(query, args...).First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		s.logger.Error("Failed to fetch user", result.Error, nil)
+		return nil, result.Error
+	}
+	return &user, nil
+}
+
+// verifyPassword checks the password against the user's stored hash and
+// transparently rehashes it when the hasher parameters have changed
+func (s *UserService) verifyPassword(ctx context.Context, user *models.User, password string) error {
+	ok, err := s.hasher.Verify(password, user.Password)
+	if err != nil {
+		s.logger.Warn("Failed to verify password hash", map[string]interface{}{
+			"id":    user.ID,
+			"error": err.Error(),
+		})
+		return ErrInvalidCredentials
+	}
+	if !ok {
+		return ErrInvalidCredentials
+	}
+
+	if !s.hasher.NeedsRehash(user.Password) {
+		return nil
+	}
+
+	newHash, err := s.hasher.Hash(password)
+	if err != nil {
+		s.logger.Error("Failed to rehash password", err, map[string]interface{}{
+			"id": user.ID,
+		})
+		return nil
+	}
+	if err := connectors.Conn(ctx, s.db).Model(&models.User{}).Where("id = ?", user.ID).Update("password", newHash).Error; err != nil {
+		s.logger.Error("Failed to store rehashed password", err, map[string]interface{}{
+			"id": user.ID,
+		})
+		return nil
+	}
+
+	s.logger.Info("Upgraded password hash", map[string]interface{}{
+		"id": user.ID,
+	})
+	user.Password = newHash
+	return nil
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+	"github.com/cam-boltnote/go-ignite/internal/models"
+	"github.com/cam-boltnote/go-ignite/internal/utils"
+)
+
+// recordingHasher records the hashes it is asked to verify
+type recordingHasher struct {
+	utils.PasswordHasher
+	verified []string
+}
+
+func (h *recordingHasher) Verify(password, encodedHash string) (bool, error) {
+	h.verified = append(h.verified, encodedHash)
+	return h.PasswordHasher.Verify(password, encodedHash)
+}
+
+func TestValidateCredentials(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := newUserService(t, db, cfg)
+	ctx := context.Background()
+	createTestUser(t, db, cfg, "ada@example.com", "user")
+	inactive := createTestUser(t, db, cfg, "gone@example.com", "user")
+	db.Model(inactive).Update("is_active", false)
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		wantErr  error
+	}{
+		{"right password", "ada@example.com", testPassword, nil},
+		{"wrong password", "ada@example.com", "Wrong-Horse-9", ErrInvalidCredentials},
+		{"unknown email", "nobody@example.com", testPassword, ErrInvalidCredentials},
+		{"inactive account", "gone@example.com", testPassword, ErrAccountInactive},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := service.ValidateCredentials(ctx, tt.email, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && user.Password != "" {
+				t.Error("the password hash was returned")
+			}
+		})
+	}
+}
+
+func TestValidateCredentialsHashesForUnknownEmail(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := newUserService(t, db, cfg)
+	hasher := &recordingHasher{PasswordHasher: service.hasher}
+	service.hasher = hasher
+
+	if _, err := service.ValidateCredentials(context.Background(), "nobody@example.com", testPassword); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("err = %v, want ErrInvalidCredentials", err)
+	}
+	if len(hasher.verified) != 1 {
+		t.Fatalf("verified %d hashes, want 1", len(hasher.verified))
+	}
+	if hash := hasher.verified[0]; !strings.HasPrefix(hash, "$argon2id$") || service.hasher.NeedsRehash(hash) {
+		t.Errorf("verified %q, want a hash with the current parameters", hash)
+	}
+}
+
+func TestValidateCredentialsRehashes(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := newUserService(t, db, cfg)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		email  string
+		hasher utils.PasswordHasher
+	}{
+		{"bcrypt hash", "bcrypt@example.com", utils.NewBcryptHasher(cfg.Password.BcryptCost)},
+		{"argon2id hash with other parameters", "argon2id@example.com",
+			utils.NewArgon2idHasher(cfg.Password.Argon2Memory, cfg.Password.Argon2Iterations, cfg.Password.Argon2Parallelism+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldHash, err := tt.hasher.Hash(testPassword)
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			user := &models.User{Email: tt.email, Password: oldHash, IsActive: true}
+			if err := db.Create(user).Error; err != nil {
+				t.Fatalf("create user: %v", err)
+			}
+
+			if _, err := service.ValidateCredentials(ctx, user.Email, testPassword); err != nil {
+				t.Fatalf("ValidateCredentials with the old hash: %v", err)
+			}
+
+			var stored models.User
+			db.First(&stored, user.ID)
+			if stored.Password == oldHash || service.hasher.NeedsRehash(stored.Password) {
+				t.Errorf("stored hash %s wasn't upgraded", stored.Password)
+			}
+			if _, err := service.ValidateCredentials(ctx, user.Email, testPassword); err != nil {
+				t.Errorf("ValidateCredentials with the new hash: %v", err)
+			}
+		})
+	}
+}
+
+func TestUserRole(t *testing.T) {
+	db, cfg := newTestEnv(t)
+	service := newUserService(t, db, cfg)
+	moderator := createTestUser(t, db, cfg, "mod@example.com", middleware.RoleModerator)
+
+	role, err := service.UserRole(context.Background(), moderator.ID)
+	if err != nil || role != middleware.RoleModerator {
+		t.Errorf("UserRole = %q, %v, want %q", role, err, middleware.RoleModerator)
+	}
+	if _, err := service.UserRole(context.Background(), moderator.ID+1); !errors.Is(err, middleware.ErrUserNotFound) {
+		t.Errorf("err = %v, want middleware.ErrUserNotFound", err)
+	}
+}
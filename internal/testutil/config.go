@@ -0,0 +1,33 @@
+package testutil
+
+import (
+	"testing"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+	"github.com/cam-boltnote/go-ignite/internal/middleware"
+)
+
+// Config returns the default configuration with cheap password hashing, so
+// tests creating users stay fast. It installs the test logger and a freshly
+// generated JWT signing key, so services built from it can issue tokens.
+func Config(t testing.TB) *config.Config {
+	t.Helper()
+	InitLogger()
+
+	cfg := config.Default()
+	cfg.Password.Argon2Memory = 1024
+	cfg.Password.Argon2Iterations = 1
+	cfg.Password.Argon2Parallelism = 1
+	cfg.Password.BcryptCost = 4
+
+	privatePEM, _, _, err := middleware.GenerateSigningKey(middleware.AlgEdDSA)
+	if err != nil {
+		t.Fatalf("failed to generate a signing key: %v", err)
+	}
+	km, err := middleware.NewKeyManager(privatePEM)
+	if err != nil {
+		t.Fatalf("failed to load the signing key: %v", err)
+	}
+	middleware.SetKeyManager(km)
+	return cfg
+}
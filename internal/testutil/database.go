@@ -0,0 +1,48 @@
+// Package testutil provides helpers for tests
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+	"github.com/cam-boltnote/go-ignite/internal/migrations"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// databases numbers the in-memory databases so each test gets its own
+var databases atomic.Int64
+
+// NewDB returns a new in-memory SQLite database with every migration applied,
+// so tests need no database server. It is dropped when the test ends. SQL is
+// only logged for failed statements.
+func NewDB(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	database, err := connectors.NewDatabase(config.DatabaseConfig{
+		Driver: config.DriverSQLite,
+		Name:   fmt.Sprintf("file:test%d?mode=memory&cache=shared", databases.Add(1)),
+	})
+	if err != nil {
+		t.Fatalf("failed to open the test database: %v", err)
+	}
+	db := database.GetDB()
+	if db == nil {
+		t.Fatal("failed to open the test database")
+	}
+	t.Cleanup(func() { database.Close() })
+
+	db = db.Session(&gorm.Session{Logger: db.Logger.LogMode(logger.Error)})
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("failed to migrate the test database: %v", err)
+	}
+	return db
+}
@@ -0,0 +1,45 @@
+package testutil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cam-boltnote/go-ignite/internal/models"
+)
+
+func TestNewDBIsMigrated(t *testing.T) {
+	db := NewDB(t)
+
+	for _, table := range []string{"users", "settings", "refresh_tokens", "organizations", "audit_events", "outbox_messages"} {
+		if !db.Migrator().HasTable(table) {
+			t.Errorf("table %s is missing", table)
+		}
+	}
+}
+
+func TestNewDBIsIsolated(t *testing.T) {
+	first, second := NewDB(t), NewDB(t)
+	ctx := context.Background()
+
+	user := &models.User{Email: "ada@example.com", Password: "x"}
+	if err := first.WithContext(ctx).Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	var count int64
+	if err := second.WithContext(ctx).Model(&models.User{}).Count(&count).Error; err != nil {
+		t.Fatalf("count users: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("second database has %d users, want 0", count)
+	}
+}
+
+func TestNewDBEnforcesForeignKeys(t *testing.T) {
+	db := NewDB(t)
+
+	err := db.Create(&models.Settings{UserID: 404}).Error
+	if err == nil {
+		t.Fatal("settings for a missing user were created")
+	}
+}
@@ -0,0 +1,26 @@
+package testutil
+
+import (
+	"io"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/cam-boltnote/go-ignite/internal/utils"
+
+	"github.com/rs/zerolog"
+)
+
+var loggerOnce sync.Once
+
+// InitLogger installs the default logger services are built with. Logs are
+// discarded unless the tests run with -v, which prints them to stderr.
+func InitLogger() {
+	loggerOnce.Do(func() {
+		var w io.Writer = io.Discard
+		if testing.Verbose() {
+			w = zerolog.ConsoleWriter{Out: os.Stderr}
+		}
+		utils.SetLogger(utils.NewWriterLogger(w))
+	})
+}
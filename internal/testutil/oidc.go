@@ -0,0 +1,247 @@
+package testutil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/connectors"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDCUser is the account a FakeOIDCProvider signs in
+type OIDCUser struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+// fakeOIDCCode is an authorization code waiting to be redeemed
+type fakeOIDCCode struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+// FakeOIDCProvider is an OpenID Connect provider served by an httptest.Server.
+// It serves discovery, a JWK set and a token endpoint that checks PKCE, and
+// issues RS256 ID tokens. Tests play the user agent with Authorize.
+type FakeOIDCProvider struct {
+	Server       *httptest.Server
+	ClientID     string
+	ClientSecret string
+	// DiscoveryIssuer overrides the issuer in the discovery document
+	DiscoveryIssuer string
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]fakeOIDCCode
+}
+
+// fakeOIDCKeyID is the kid of the fake provider's signing key
+const fakeOIDCKeyID = "test-key"
+
+// NewOIDCProvider starts a fake OpenID Connect provider that is shut down when
+// the test ends
+func NewOIDCProvider(t testing.TB) *FakeOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate the provider key: %v", err)
+	}
+	p := &FakeOIDCProvider{
+		ClientID:     "test-client",
+		ClientSecret: "test-secret",
+		key:          key,
+		codes:        make(map[string]fakeOIDCCode),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.serveDiscovery)
+	mux.HandleFunc("/jwks", p.serveJWKS)
+	mux.HandleFunc("/token", p.serveToken)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Server.Close)
+	return p
+}
+
+// Issuer returns the provider's issuer URL
+func (p *FakeOIDCProvider) Issuer() string {
+	return p.Server.URL
+}
+
+// ProviderConfig returns the connector configuration of the provider
+func (p *FakeOIDCProvider) ProviderConfig(name string) connectors.OIDCProviderConfig {
+	return connectors.OIDCProviderConfig{
+		Name:         name,
+		IssuerURL:    p.Issuer(),
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  "https://app.example.com/auth/oidc/" + name + "/callback",
+	}
+}
+
+// Claims returns valid ID token claims for the user with the given nonce
+func (p *FakeOIDCProvider) Claims(user OIDCUser, nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            p.Issuer(),
+		"aud":            p.ClientID,
+		"sub":            user.Subject,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"given_name":     user.GivenName,
+		"family_name":    user.FamilyName,
+		"nonce":          nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+}
+
+// SignIDToken signs the claims with the provider's key
+func (p *FakeOIDCProvider) SignIDToken(t testing.TB, claims jwt.MapClaims) string {
+	t.Helper()
+	return SignIDToken(t, p.key, claims)
+}
+
+// SignIDToken signs ID token claims with key, e.g. to forge a token with a key
+// the provider doesn't publish
+func SignIDToken(t testing.TB, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+
+	signed, err := signIDToken(key, claims)
+	if err != nil {
+		t.Fatalf("failed to sign the ID token: %v", err)
+	}
+	return signed
+}
+
+func signIDToken(key *rsa.PrivateKey, claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = fakeOIDCKeyID
+	return token.SignedString(key)
+}
+
+// Authorize plays the user signing in at the authorization URL the application
+// redirected to. It returns the code and state the provider would send to the
+// redirect URL. The ID token for the code carries the nonce and PKCE challenge
+// from the URL; modify, if given, may change its claims.
+func (p *FakeOIDCProvider) Authorize(t testing.TB, authURL string, user OIDCUser, modify func(jwt.MapClaims)) (code, state string) {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("invalid authorization URL: %v", err)
+	}
+	query := u.Query()
+	if query.Get("client_id") != p.ClientID || query.Get("response_type") != "code" {
+		t.Fatalf("unexpected authorization request: %s", authURL)
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization request has no S256 PKCE challenge: %s", authURL)
+	}
+
+	claims := p.Claims(user, query.Get("nonce"))
+	if modify != nil {
+		modify(claims)
+	}
+
+	code = randomString(t)
+	p.mu.Lock()
+	p.codes[code] = fakeOIDCCode{challenge: query.Get("code_challenge"), claims: claims}
+	p.mu.Unlock()
+	return code, query.Get("state")
+}
+
+func (p *FakeOIDCProvider) serveDiscovery(w http.ResponseWriter, _ *http.Request) {
+	issuer := p.Issuer()
+	if p.DiscoveryIssuer != "" {
+		issuer = p.DiscoveryIssuer
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 issuer,
+		"authorization_endpoint": p.Issuer() + "/authorize",
+		"token_endpoint":         p.Issuer() + "/token",
+		"jwks_uri":               p.Issuer() + "/jwks",
+	})
+}
+
+func (p *FakeOIDCProvider) serveJWKS(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": fakeOIDCKeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// serveToken redeems a code once, checking the client and the PKCE verifier
+func (p *FakeOIDCProvider) serveToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != p.ClientID || clientSecret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	code, found := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !found || base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := signIDToken(p.key, code.claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "test-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// randomString returns a random URL-safe string
+func randomString(t testing.TB) string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("failed to generate a random string: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,179 @@
+package testutil
+
+import (
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cam-boltnote/go-ignite/internal/config"
+)
+
+// smtpWait bounds how long WaitForEmails waits for emails sent in the background
+const smtpWait = 5 * time.Second
+
+// Email is a message received by a FakeSMTPServer
+type Email struct {
+	From string
+	To   []string
+	Data string // Headers and body as sent
+}
+
+// Subject returns the decoded Subject header
+func (e Email) Subject() string {
+	msg, err := mail.ReadMessage(strings.NewReader(e.Data))
+	if err != nil {
+		return ""
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		return msg.Header.Get("Subject")
+	}
+	return subject
+}
+
+// Body returns the body with its transfer encoding undone
+func (e Email) Body() string {
+	msg, err := mail.ReadMessage(strings.NewReader(e.Data))
+	if err != nil {
+		return ""
+	}
+	var body io.Reader = msg.Body
+	if strings.EqualFold(msg.Header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+		body = quotedprintable.NewReader(msg.Body)
+	}
+	data, _ := io.ReadAll(body)
+	return string(data)
+}
+
+// FakeSMTPServer is an SMTP server on localhost that records the emails sent to
+// it. It offers neither STARTTLS nor AUTH, so clients send without either.
+type FakeSMTPServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	emails   []Email
+}
+
+// NewSMTPServer starts a fake SMTP server that is shut down when the test ends
+func NewSMTPServer(t testing.TB) *FakeSMTPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start the SMTP server: %v", err)
+	}
+	s := &FakeSMTPServer{listener: listener}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+// EmailConfig returns the configuration of an email sender using the server
+func (s *FakeSMTPServer) EmailConfig() config.EmailConfig {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return config.EmailConfig{
+		Enabled:                true,
+		Host:                   addr.IP.String(),
+		Port:                   addr.Port,
+		Username:               "test",
+		Password:               "test",
+		FromEmail:              "noreply@example.com",
+		AdminNotificationEmail: "admin@example.com",
+	}
+}
+
+// Emails returns the emails received so far
+func (s *FakeSMTPServer) Emails() []Email {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Email(nil), s.emails...)
+}
+
+// WaitForEmails waits until at least n emails have been received and returns
+// them, failing the test if they don't arrive
+func (s *FakeSMTPServer) WaitForEmails(t testing.TB, n int) []Email {
+	t.Helper()
+
+	deadline := time.Now().Add(smtpWait)
+	for {
+		emails := s.Emails()
+		if len(emails) >= n {
+			return emails
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("received %d emails, want %d", len(emails), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// serve accepts connections until the listener is closed
+func (s *FakeSMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle speaks just enough SMTP to receive messages on conn
+func (s *FakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+
+	var email Email
+	text.PrintfLine("220 localhost ESMTP test server")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 localhost")
+		case "MAIL":
+			email = Email{From: smtpAddress(arg)}
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			email.To = append(email.To, smtpAddress(arg))
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			email.Data = string(data)
+			s.mu.Lock()
+			s.emails = append(s.emails, email)
+			s.mu.Unlock()
+			text.PrintfLine("250 OK")
+		case "RSET":
+			email = Email{}
+			text.PrintfLine("250 OK")
+		case "NOOP":
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// smtpAddress returns the address of a "FROM:<a@b>" or "TO:<a@b>" argument
+func smtpAddress(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	addr, _, _ = strings.Cut(strings.TrimSpace(addr), " ")
+	return strings.Trim(addr, "<>")
+}
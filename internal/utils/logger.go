@@ -35,29 +35,48 @@ const (
 // InitLogger creates and configures the default logger using application config
 func InitLogger(cfg *config.Config) error {
 	// Get log level from config
-	levelStr := cfg.LogLevel
+	levelStr := cfg.Log.Level
 	if levelStr == "" {
 		levelStr = string(InfoLevel) // Default to info level
 	}
 
 	// Create logs directory if it doesn't exist
-	logsDir := "logs"
-	if err := os.MkdirAll(logsDir, 0744); err != nil {
+	if err := os.MkdirAll(cfg.Log.Dir, 0744); err != nil {
 		return fmt.Errorf("failed to create logs directory: %v", err)
 	}
 
 	// Create a logger instance
-	logger, err := NewLogger(LogLevel(levelStr))
+	logger, err := NewLogger(LogLevel(levelStr), cfg.Log.Dir)
 	if err != nil {
 		return err
 	}
 
+	// Filter by the global level instead so SetLogLevel can change it later
+	logger.logger = logger.logger.Level(zerolog.TraceLevel)
 	defaultLogger = logger
+	return SetLogLevel(LogLevel(levelStr))
+}
+
+// SetLogLevel changes the level of the default logger and every logger derived from it
+func SetLogLevel(level LogLevel) error {
+	zerologLevel, err := zerolog.ParseLevel(string(level))
+	if err != nil {
+		return fmt.Errorf("invalid log level: %v", err)
+	}
+	zerolog.SetGlobalLevel(zerologLevel)
 	return nil
 }
 
-// NewLogger creates a new logger instance with the specified level
-func NewLogger(level LogLevel) (*Logger, error) {
+// ApplyLogConfig applies a reloaded configuration's log level
+func ApplyLogConfig(cfg *config.Config) {
+	if err := SetLogLevel(LogLevel(cfg.Log.Level)); err != nil {
+		defaultLogger.Error("Failed to change log level", err, nil)
+	}
+}
+
+// NewLogger creates a new logger instance with the specified level, writing
+// one file per level into logsDir
+func NewLogger(level LogLevel, logsDir string) (*Logger, error) {
 	// Parse the log level
 	zerologLevel, err := zerolog.ParseLevel(string(level))
 	if err != nil {
@@ -88,7 +107,7 @@ func NewLogger(level LogLevel) (*Logger, error) {
 	for _, lvl := range levels {
 		if lvl >= zerologLevel {
 			outputs = append(outputs, lvl)
-			filename := filepath.Join("logs", fmt.Sprintf("%s.log", lvl.String()))
+			filename := filepath.Join(logsDir, fmt.Sprintf("%s.log", lvl.String()))
 			file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 			if err != nil {
 				return nil, fmt.Errorf("failed to open log file %s: %v", filename, err)
@@ -109,11 +128,23 @@ func NewLogger(level LogLevel) (*Logger, error) {
 	}, nil
 }
 
+// NewWriterLogger creates a logger that writes to w only, without log files.
+// Its level is controlled by SetLogLevel.
+func NewWriterLogger(w io.Writer) *Logger {
+	return &Logger{logger: zerolog.New(w).With().Timestamp().Logger()}
+}
+
 // GetLogger returns the default logger instance
 func GetLogger() *Logger {
 	return defaultLogger
 }
 
+// SetLogger replaces the default logger, for programs and tests that don't
+// configure logging with InitLogger
+func SetLogger(logger *Logger) {
+	defaultLogger = logger
+}
+
 // Debug logs a debug message with optional fields
 func (l *Logger) Debug(msg string, fields map[string]interface{}) {
 	event := l.logger.Debug()
@@ -0,0 +1,268 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported password hashing algorithms
+const (
+	Argon2idAlgorithm = "argon2id"
+	BcryptAlgorithm   = "bcrypt"
+)
+
+var (
+	// ErrUnknownHashFormat is returned when a stored hash was not produced by a known hasher
+	ErrUnknownHashFormat = errors.New("unknown password hash format")
+	// ErrInvalidHash is returned when a stored hash cannot be decoded
+	ErrInvalidHash = errors.New("invalid password hash")
+)
+
+// Bounds on the parameters of stored argon2id hashes. Verification uses the
+// parameters in the hash, so without them a corrupt or tampered hash could make
+// a login allocate gigabytes of memory or spin for minutes.
+const (
+	MaxArgon2Memory      = 1024 * 1024 // KiB (1 GiB)
+	MaxArgon2Iterations  = 64
+	MaxArgon2Parallelism = 64
+	minArgon2SaltLength  = 8
+	maxArgon2SaltLength  = 64
+	minArgon2KeyLength   = 16
+	maxArgon2KeyLength   = 128
+)
+
+// PasswordHasher hashes and verifies passwords. Implementations encode their
+// parameters into the hash so they can be changed without breaking existing hashes.
+type PasswordHasher interface {
+	// Hash returns the encoded hash of the password
+	Hash(password string) (string, error)
+	// Verify reports whether the password matches the encoded hash
+	Verify(password, encodedHash string) (bool, error)
+	// NeedsRehash reports whether the encoded hash was produced with different parameters
+	NeedsRehash(encodedHash string) bool
+	// Supports reports whether the encoded hash was produced by this algorithm
+	Supports(encodedHash string) bool
+}
+
+// Argon2idHasher hashes passwords with argon2id using the PHC string format:
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<hash>
+type Argon2idHasher struct {
+	Memory      uint32 // memory in KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// NewArgon2idHasher creates an argon2id hasher with the given cost parameters
+func NewArgon2idHasher(memory, iterations uint32, parallelism uint8) *Argon2idHasher {
+	return &Argon2idHasher{
+		Memory:      memory,
+		Iterations:  iterations,
+		Parallelism: parallelism,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+type argon2idParams struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+// Hash returns the PHC-encoded argon2id hash of the password
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %v", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.Memory,
+		h.Iterations,
+		h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify reports whether the password matches the argon2id hash
+func (h *Argon2idHasher) Verify(password, encodedHash string) (bool, error) {
+	params, err := decodeArgon2id(encodedHash)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(password), params.salt, params.iterations, params.memory, params.parallelism, uint32(len(params.key)))
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+// NeedsRehash reports whether the hash was produced with different parameters
+func (h *Argon2idHasher) NeedsRehash(encodedHash string) bool {
+	params, err := decodeArgon2id(encodedHash)
+	if err != nil {
+		return true
+	}
+	return params.memory != h.Memory ||
+		params.iterations != h.Iterations ||
+		params.parallelism != h.Parallelism ||
+		uint32(len(params.salt)) != h.SaltLength ||
+		uint32(len(params.key)) != h.KeyLength
+}
+
+// Supports reports whether the hash is an argon2id hash
+func (h *Argon2idHasher) Supports(encodedHash string) bool {
+	return strings.HasPrefix(encodedHash, "$argon2id$")
+}
+
+// decodeArgon2id parses a PHC-encoded argon2id hash, rejecting parameters
+// outside the bounds above
+func decodeArgon2id(encodedHash string) (*argon2idParams, error) {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 || parts[1] != Argon2idAlgorithm {
+		return nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	params := &argon2idParams{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return nil, ErrInvalidHash
+	}
+
+	if params.memory > MaxArgon2Memory || params.iterations < 1 || params.iterations > MaxArgon2Iterations ||
+		params.parallelism < 1 || params.parallelism > MaxArgon2Parallelism {
+		return nil, ErrInvalidHash
+	}
+
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrInvalidHash
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, ErrInvalidHash
+	}
+	// An empty key would match every password
+	if len(params.salt) < minArgon2SaltLength || len(params.salt) > maxArgon2SaltLength ||
+		len(params.key) < minArgon2KeyLength || len(params.key) > maxArgon2KeyLength {
+		return nil, ErrInvalidHash
+	}
+	return params, nil
+}
+
+// BcryptHasher hashes passwords with bcrypt
+type BcryptHasher struct {
+	Cost int
+}
+
+// NewBcryptHasher creates a bcrypt hasher with the given cost
+func NewBcryptHasher(cost int) *BcryptHasher {
+	return &BcryptHasher{Cost: cost}
+}
+
+// Hash returns the bcrypt hash of the password
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify reports whether the password matches the bcrypt hash
+func (h *BcryptHasher) Verify(password, encodedHash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// NeedsRehash reports whether the hash was produced with a different cost
+func (h *BcryptHasher) NeedsRehash(encodedHash string) bool {
+	cost, err := bcrypt.Cost([]byte(encodedHash))
+	return err != nil || cost != h.Cost
+}
+
+// Supports reports whether the hash is a bcrypt hash
+func (h *BcryptHasher) Supports(encodedHash string) bool {
+	return strings.HasPrefix(encodedHash, "$2a$") ||
+		strings.HasPrefix(encodedHash, "$2b$") ||
+		strings.HasPrefix(encodedHash, "$2y$")
+}
+
+// MultiHasher hashes new passwords with a primary hasher while still verifying
+// hashes produced by any of the other registered hashers
+type MultiHasher struct {
+	primary PasswordHasher
+	others  []PasswordHasher
+}
+
+// NewMultiHasher creates a hasher that hashes with primary and verifies with any of the given hashers
+func NewMultiHasher(primary PasswordHasher, others ...PasswordHasher) *MultiHasher {
+	return &MultiHasher{
+		primary: primary,
+		others:  others,
+	}
+}
+
+// Hash returns the hash of the password using the primary hasher
+func (m *MultiHasher) Hash(password string) (string, error) {
+	return m.primary.Hash(password)
+}
+
+// Verify reports whether the password matches the hash using whichever hasher produced it
+func (m *MultiHasher) Verify(password, encodedHash string) (bool, error) {
+	hasher := m.hasherFor(encodedHash)
+	if hasher == nil {
+		return false, ErrUnknownHashFormat
+	}
+	return hasher.Verify(password, encodedHash)
+}
+
+// NeedsRehash reports whether the hash should be replaced with one from the primary hasher
+func (m *MultiHasher) NeedsRehash(encodedHash string) bool {
+	if !m.primary.Supports(encodedHash) {
+		return true
+	}
+	return m.primary.NeedsRehash(encodedHash)
+}
+
+// Supports reports whether any registered hasher produced the hash
+func (m *MultiHasher) Supports(encodedHash string) bool {
+	return m.hasherFor(encodedHash) != nil
+}
+
+func (m *MultiHasher) hasherFor(encodedHash string) PasswordHasher {
+	if m.primary.Supports(encodedHash) {
+		return m.primary
+	}
+	for _, hasher := range m.others {
+		if hasher.Supports(encodedHash) {
+			return hasher
+		}
+	}
+	return nil
+}
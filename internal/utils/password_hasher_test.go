@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Cheap parameters keep the tests fast
+func testArgon2idHasher() *Argon2idHasher {
+	return NewArgon2idHasher(1024, 1, 1)
+}
+
+func TestPasswordHashers(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+		prefix string
+	}{
+		{"argon2id", testArgon2idHasher(), "$argon2id$v=19$m=1024,t=1,p=1$"},
+		{"bcrypt", NewBcryptHasher(4), "$2a$04$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := tt.hasher.Hash("Correct-Horse-9")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if !strings.HasPrefix(hash, tt.prefix) {
+				t.Errorf("hash %s doesn't start with %s", hash, tt.prefix)
+			}
+			if !tt.hasher.Supports(hash) {
+				t.Error("hasher doesn't support its own hash")
+			}
+			if tt.hasher.NeedsRehash(hash) {
+				t.Error("a fresh hash needs rehashing")
+			}
+
+			other, err := tt.hasher.Hash("Correct-Horse-9")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if other == hash {
+				t.Error("hashing twice gave the same hash; the salt isn't random")
+			}
+
+			if ok, err := tt.hasher.Verify("Correct-Horse-9", hash); err != nil || !ok {
+				t.Errorf("Verify(right password) = %v, %v", ok, err)
+			}
+			if ok, err := tt.hasher.Verify("Wrong-Horse-9", hash); err != nil || ok {
+				t.Errorf("Verify(wrong password) = %v, %v", ok, err)
+			}
+		})
+	}
+}
+
+func TestArgon2idNeedsRehash(t *testing.T) {
+	hash, err := testArgon2idHasher().Hash("Correct-Horse-9")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		hasher *Argon2idHasher
+		want   bool
+	}{
+		{"same parameters", testArgon2idHasher(), false},
+		{"more memory", NewArgon2idHasher(2048, 1, 1), true},
+		{"more iterations", NewArgon2idHasher(1024, 2, 1), true},
+		{"more parallelism", NewArgon2idHasher(1024, 1, 2), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.NeedsRehash(hash); got != tt.want {
+				t.Errorf("NeedsRehash = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArgon2idRejectsOutOfBoundsParameters(t *testing.T) {
+	const salt = "c29tZXNhbHRzb21lc2FsdA"                     // 16 bytes
+	const key = "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U" // 32 bytes
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"huge memory", "$argon2id$v=19$m=4294967295,t=1,p=1$" + salt + "$" + key},
+		{"memory just over the bound", "$argon2id$v=19$m=1048577,t=1,p=1$" + salt + "$" + key},
+		{"no iterations", "$argon2id$v=19$m=1024,t=0,p=1$" + salt + "$" + key},
+		{"too many iterations", "$argon2id$v=19$m=1024,t=100000,p=1$" + salt + "$" + key},
+		{"no parallelism", "$argon2id$v=19$m=1024,t=1,p=0$" + salt + "$" + key},
+		{"too much parallelism", "$argon2id$v=19$m=1024,t=1,p=255$" + salt + "$" + key},
+		{"empty key", "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$"},
+		{"short salt", "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$" + key},
+		{"other version", "$argon2id$v=16$m=1024,t=1,p=1$" + salt + "$" + key},
+		{"missing parts", "$argon2id$v=19$m=1024,t=1,p=1$" + salt},
+		{"bad base64", "$argon2id$v=19$m=1024,t=1,p=1$!!!$" + key},
+	}
+
+	hasher := testArgon2idHasher()
+	if ok, err := hasher.Verify("anything", "$argon2id$v=19$m=1024,t=1,p=1$"+salt+"$"+key); err != nil || ok {
+		t.Fatalf("Verify(in-bounds hash) = %v, %v; want false, nil", ok, err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := hasher.Verify("anything", tt.hash)
+			if err == nil || ok {
+				t.Errorf("Verify = %v, %v; want an error", ok, err)
+			}
+			if !hasher.NeedsRehash(tt.hash) {
+				t.Error("an undecodable hash doesn't need rehashing")
+			}
+		})
+	}
+}
+
+func TestMultiHasher(t *testing.T) {
+	argon2id, bcrypt := testArgon2idHasher(), NewBcryptHasher(4)
+	hasher := NewMultiHasher(argon2id, bcrypt)
+
+	oldHash, err := bcrypt.Hash("Correct-Horse-9")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if ok, err := hasher.Verify("Correct-Horse-9", oldHash); err != nil || !ok {
+		t.Errorf("Verify(bcrypt hash) = %v, %v", ok, err)
+	}
+	if !hasher.NeedsRehash(oldHash) {
+		t.Error("a bcrypt hash doesn't need rehashing to argon2id")
+	}
+
+	newHash, err := hasher.Hash("Correct-Horse-9")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if !argon2id.Supports(newHash) {
+		t.Errorf("new hash %s isn't argon2id", newHash)
+	}
+	if hasher.NeedsRehash(newHash) {
+		t.Error("a primary hash needs rehashing")
+	}
+
+	if _, err := hasher.Verify("Correct-Horse-9", "plaintext"); !errors.Is(err, ErrUnknownHashFormat) {
+		t.Errorf("Verify(unknown format) err = %v, want ErrUnknownHashFormat", err)
+	}
+}
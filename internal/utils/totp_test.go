@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, base32 encoded
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTP(t *testing.T) {
+	// The RFC's 8-digit codes truncated to the last 6 digits
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, v := range vectors {
+		step, ok := ValidateTOTP(rfc6238Secret, v.code, time.Unix(v.unix, 0), 0)
+		if !ok || step != v.unix/TOTPPeriod {
+			t.Errorf("code %s at %d: step = %d, ok = %v, want step %d", v.code, v.unix, step, ok, v.unix/TOTPPeriod)
+		}
+	}
+
+	at := time.Unix(1111111111, 0)
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		at     time.Time
+		skew   int
+		want   bool
+	}{
+		{"lower case secret", strings.ToLower(rfc6238Secret), "050471", at, 0, true},
+		{"spaces in code", rfc6238Secret, "050 471", at, 0, true},
+		{"one step late within skew", rfc6238Secret, "050471", at.Add(TOTPPeriod * time.Second), 1, true},
+		{"one step early within skew", rfc6238Secret, "050471", at.Add(-TOTPPeriod * time.Second), 1, true},
+		{"one step late without skew", rfc6238Secret, "050471", at.Add(TOTPPeriod * time.Second), 0, false},
+		{"two steps late", rfc6238Secret, "050471", at.Add(2 * TOTPPeriod * time.Second), 1, false},
+		{"wrong code", rfc6238Secret, "050472", at, 1, false},
+		{"too short", rfc6238Secret, "50471", at, 1, false},
+		{"8 digits", rfc6238Secret, "14050471", at, 1, false},
+		{"invalid secret", "not base32!", "050471", at, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ValidateTOTP(tt.secret, tt.code, tt.at, tt.skew); ok != tt.want {
+				t.Errorf("ValidateTOTP = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	if key, err := totpEncoding.DecodeString(secret); err != nil || len(key) != totpSecretSize {
+		t.Errorf("secret %q decodes to %d bytes (%v), want %d", secret, len(key), err, totpSecretSize)
+	}
+
+	other, _ := GenerateTOTPSecret()
+	if other == secret {
+		t.Error("two secrets are the same")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("Go Ignite", "ada@example.com", rfc6238Secret)
+	want := "otpauth://totp/Go%20Ignite:ada@example.com?algorithm=SHA1&digits=6&issuer=Go+Ignite&period=30&secret=" + rfc6238Secret
+	if uri != want {
+		t.Errorf("uri = %s, want %s", uri, want)
+	}
+}